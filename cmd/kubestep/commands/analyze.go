@@ -3,6 +3,7 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/slyt3/kubestep/internal/assert"
 	"github.com/slyt3/kubestep/pkg/analysis"
@@ -11,8 +12,9 @@ import (
 )
 
 const (
-	defaultLoopWindow    = 10
-	defaultSlowThreshold = 1000
+	defaultLoopWindow      = 10
+	defaultSlowThreshold   = 1000
+	defaultMinStatusWrites = 3
 )
 
 // JSONSlowOperation represents slow operation in JSON output.
@@ -33,8 +35,29 @@ type JSONLoopDetection struct {
 
 // JSONErrorSummary represents error summary in JSON output.
 type JSONErrorSummary struct {
-	Total  int            `json:"total"`
-	ByType map[string]int `json:"by_type"`
+	Total    int               `json:"total"`
+	ByType   map[string]int    `json:"by_type"`
+	ByReason []JSONErrorReason `json:"by_reason,omitempty"`
+}
+
+// JSONErrorReason represents the errors sharing one API reason in JSON output.
+type JSONErrorReason struct {
+	Reason            string   `json:"reason"`
+	Code              int32    `json:"code,omitempty"`
+	Count             int      `json:"count"`
+	RetryAfterSeconds int32    `json:"max_retry_after_seconds,omitempty"`
+	Fields            []string `json:"fields,omitempty"`
+	Example           string   `json:"example,omitempty"`
+}
+
+// JSONStatusChurn represents status writes to one object in JSON output.
+type JSONStatusChurn struct {
+	Resource     string   `json:"resource"`
+	StatusWrites int      `json:"status_writes"`
+	SpecWrites   int      `json:"spec_writes"`
+	NoopWrites   int      `json:"noop_writes,omitempty"`
+	StatusOnly   bool     `json:"status_only"`
+	Actors       []string `json:"actors,omitempty"`
 }
 
 // JSONAnalysisReport represents complete analysis in JSON format.
@@ -44,6 +67,8 @@ type JSONAnalysisReport struct {
 	SlowOperations  []JSONSlowOperation `json:"slow_operations,omitempty"`
 	LoopsDetected   []JSONLoopDetection `json:"loops_detected,omitempty"`
 	Errors          *JSONErrorSummary   `json:"errors,omitempty"`
+	StatusChurn     []JSONStatusChurn   `json:"status_churn,omitempty"`
+	Warnings        []string            `json:"warnings,omitempty"`
 }
 
 // AnalyzeConfig holds analyze command configuration.
@@ -53,12 +78,16 @@ type AnalyzeConfig struct {
 	DetectLoops   bool
 	FindSlow      bool
 	AnalyzeErrors bool
-	LoopWindow    int
-	SlowThreshold int64
-	Format        string
-	StorageType   string
-	MongoURI      string
-	MongoDatabase string
+	// StatusChurn reports objects with at least MinStatusWrites status
+	// writes. Zero uses defaultMinStatusWrites.
+	StatusChurn     bool
+	MinStatusWrites int
+	LoopWindow      int
+	SlowThreshold   int64
+	Format          string
+	StorageType     string
+	MongoURI        string
+	MongoDatabase   string
 }
 
 // NewAnalyzeCommand creates the analyze subcommand.
@@ -72,6 +101,7 @@ func NewAnalyzeCommand() *cobra.Command {
 - Infinite loops and repeated patterns
 - Slow operations exceeding threshold
 - Error patterns and frequencies
+- Status-only churn from repeated status writes
 - Resource access patterns`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -79,14 +109,6 @@ func NewAnalyzeCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(
-		&cfg.DatabasePath,
-		"database",
-		"d",
-		defaultDatabasePath,
-		"Path to SQLite database",
-	)
-
 	cmd.Flags().BoolVarP(
 		&cfg.DetectLoops,
 		"loops",
@@ -111,6 +133,20 @@ func NewAnalyzeCommand() *cobra.Command {
 		"Analyze error patterns",
 	)
 
+	cmd.Flags().BoolVar(
+		&cfg.StatusChurn,
+		"status-churn",
+		true,
+		"Report objects with repeated status writes",
+	)
+
+	cmd.Flags().IntVar(
+		&cfg.MinStatusWrites,
+		"min-status-writes",
+		defaultMinStatusWrites,
+		"Status writes to one object before it is reported as churn",
+	)
+
 	cmd.Flags().IntVarP(
 		&cfg.LoopWindow,
 		"window",
@@ -134,25 +170,12 @@ func NewAnalyzeCommand() *cobra.Command {
 		"Output format: text or json",
 	)
 
-	cmd.Flags().StringVar(
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
 		&cfg.StorageType,
-		"storage",
-		"sqlite",
-		"Storage backend: sqlite or mongodb",
-	)
-
-	cmd.Flags().StringVar(
 		&cfg.MongoURI,
-		"mongo-uri",
-		"mongodb://localhost:27017",
-		"MongoDB connection URI",
-	)
-
-	cmd.Flags().StringVar(
 		&cfg.MongoDatabase,
-		"mongo-db",
-		"kubestep",
-		"MongoDB database name",
 	)
 
 	cmd.AddCommand(NewCausalityCommand())
@@ -179,11 +202,9 @@ func runAnalyze(cfg *AnalyzeConfig, args []string) error {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	// Create storage based on type
-	storeCfg := createStorageConfig(cfg)
-	store, err := storage.NewOperationStore(storeCfg)
+	store, err := openStore(cfg.storageOptions())
 	if err != nil {
-		return fmt.Errorf("failed to create storage: %w", err)
+		return err
 	}
 	defer func() {
 		closeErr := store.Close()
@@ -201,18 +222,46 @@ func runAnalyze(cfg *AnalyzeConfig, args []string) error {
 		return fmt.Errorf("no operations found for session: %s", cfg.SessionID)
 	}
 
+	var warnings []string
+	stats, err := store.GetSessionStats(cfg.SessionID)
+	if err == nil {
+		warnings = partialRecordingWarnings(stats)
+	}
+
 	if cfg.Format == "json" {
-		return outputJSON(cfg, ops)
+		return outputJSON(cfg, ops, warnings)
 	}
 
-	return outputText(cfg, ops)
+	return outputText(cfg, ops, warnings)
+}
+
+// partialRecordingWarnings explains why a session holds fewer operations
+// than the operator made.
+func partialRecordingWarnings(stats *storage.SessionStats) []string {
+	if stats == nil {
+		return nil
+	}
+
+	var warnings []string
+	if stats.FilteredOperations > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"partial recording: %d operations were filtered out; statistics cover recorded operations only",
+			stats.FilteredOperations))
+	}
+	if stats.DroppedOperations > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"partial recording: %d operations were dropped by the recorder queue",
+			stats.DroppedOperations))
+	}
+	return warnings
 }
 
 // outputJSON generates JSON format output.
-func outputJSON(cfg *AnalyzeConfig, ops []storage.Operation) error {
+func outputJSON(cfg *AnalyzeConfig, ops []storage.Operation, warnings []string) error {
 	report := JSONAnalysisReport{
 		SessionID:       cfg.SessionID,
 		TotalOperations: len(ops),
+		Warnings:        warnings,
 	}
 
 	if cfg.FindSlow {
@@ -269,6 +318,34 @@ func outputJSON(cfg *AnalyzeConfig, ops []storage.Operation) error {
 			Total:  summary.TotalErrors,
 			ByType: summary.ErrorsByType,
 		}
+		for _, reason := range summary.Reasons {
+			report.Errors.ByReason = append(report.Errors.ByReason, JSONErrorReason{
+				Reason:            reason.Reason,
+				Code:              reason.Code,
+				Count:             reason.Count,
+				RetryAfterSeconds: reason.MaxRetryAfterSeconds,
+				Fields:            reason.Fields,
+				Example:           reason.Example,
+			})
+		}
+	}
+
+	if cfg.StatusChurn {
+		churn, err := analysis.AnalyzeStatusChurn(ops, cfg.minStatusWrites())
+		if err != nil {
+			return fmt.Errorf("status churn analysis failed: %w", err)
+		}
+
+		for _, entry := range churn {
+			report.StatusChurn = append(report.StatusChurn, JSONStatusChurn{
+				Resource:     entry.ResourceKey,
+				StatusWrites: entry.StatusWrites,
+				SpecWrites:   entry.SpecWrites,
+				NoopWrites:   entry.NoopWrites,
+				StatusOnly:   entry.StatusOnly(),
+				Actors:       entry.Actors,
+			})
+		}
 	}
 
 	jsonBytes, err := json.MarshalIndent(report, "", "  ")
@@ -280,34 +357,29 @@ func outputJSON(cfg *AnalyzeConfig, ops []storage.Operation) error {
 	return nil
 }
 
-// createStorageConfig creates storage configuration.
-func createStorageConfig(cfg *AnalyzeConfig) storage.StorageConfig {
-	err := assert.AssertNotNil(cfg, "config")
-	if err != nil {
-		return storage.StorageConfig{}
+// storageOptions returns the storage flags of the analyze command.
+func (cfg *AnalyzeConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+		ReadOnly:      true,
 	}
-
-	storeCfg := storage.StorageConfig{
-		Type:          cfg.StorageType,
-		MaxOperations: 1000000, // Use default max operations
-	}
-
-	if cfg.StorageType == "sqlite" {
-		storeCfg.ConnectionURI = cfg.DatabasePath
-	} else if cfg.StorageType == "mongodb" {
-		storeCfg.ConnectionURI = cfg.MongoURI
-		storeCfg.DatabaseName = cfg.MongoDatabase
-		storeCfg.CollectionName = "operations"
-	}
-
-	return storeCfg
 }
 
 // outputText generates text format output.
-func outputText(cfg *AnalyzeConfig, ops []storage.Operation) error {
+func outputText(cfg *AnalyzeConfig, ops []storage.Operation, warnings []string) error {
 	fmt.Printf("Analyzing %d operations for session: %s\n\n",
 		len(ops), cfg.SessionID)
 
+	for i := 0; i < len(warnings); i++ {
+		fmt.Printf("Warning: %s\n", warnings[i])
+	}
+	if len(warnings) > 0 {
+		fmt.Println()
+	}
+
 	if cfg.DetectLoops {
 		err := analyzeLoops(ops, cfg.LoopWindow)
 		if err != nil {
@@ -329,9 +401,24 @@ func outputText(cfg *AnalyzeConfig, ops []storage.Operation) error {
 		}
 	}
 
+	if cfg.StatusChurn {
+		err := analyzeStatusChurn(ops, cfg.minStatusWrites())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// minStatusWrites returns the churn threshold, defaulting when unset.
+func (cfg *AnalyzeConfig) minStatusWrites() int {
+	if cfg.MinStatusWrites <= 0 {
+		return defaultMinStatusWrites
+	}
+	return cfg.MinStatusWrites
+}
+
 // validateAnalyzeConfig validates configuration.
 func validateAnalyzeConfig(cfg *AnalyzeConfig) error {
 	// Set default storage type if not specified (for tests)
@@ -339,29 +426,12 @@ func validateAnalyzeConfig(cfg *AnalyzeConfig) error {
 		cfg.StorageType = "sqlite"
 	}
 
-	// Storage type validation
-	if cfg.StorageType != "sqlite" && cfg.StorageType != "mongodb" {
-		return fmt.Errorf("invalid storage type: %s (must be 'sqlite' or 'mongodb')", cfg.StorageType)
-	}
-
-	// Storage-specific validations
-	if cfg.StorageType == "sqlite" {
-		err := assert.AssertStringNotEmpty(cfg.DatabasePath, "database path")
-		if err != nil {
-			return err
-		}
-	} else if cfg.StorageType == "mongodb" {
-		err := assert.AssertStringNotEmpty(cfg.MongoURI, "mongo URI")
-		if err != nil {
-			return err
-		}
-		err = assert.AssertStringNotEmpty(cfg.MongoDatabase, "mongo database")
-		if err != nil {
-			return err
-		}
+	err := validateStorageOptions(cfg.storageOptions())
+	if err != nil {
+		return err
 	}
 
-	err := assert.AssertStringNotEmpty(cfg.SessionID, "session ID")
+	err = assert.AssertStringNotEmpty(cfg.SessionID, "session ID")
 	if err != nil {
 		return err
 	}
@@ -489,6 +559,8 @@ func analyzeErrorPatterns(ops []storage.Operation) error {
 	}
 
 	fmt.Printf("Total Errors: %d\n", summary.TotalErrors)
+	fmt.Println("\nErrors by Reason:")
+	fmt.Print(formatErrorReasons(summary.Reasons))
 	fmt.Println("\nErrors by Type:")
 
 	maxTypes := 20
@@ -519,3 +591,108 @@ func analyzeErrorPatterns(ops []storage.Operation) error {
 	fmt.Println()
 	return nil
 }
+
+// formatErrorReasons renders one line per API reason with its status code,
+// retry delay and the fields named in its causes.
+// Rule 2: Bounded by maxReasonsDisplayed.
+func formatErrorReasons(reasons []analysis.ReasonSummary) string {
+	const maxReasonsDisplayed = 20
+
+	var b strings.Builder
+	count := len(reasons)
+	if count > maxReasonsDisplayed {
+		count = maxReasonsDisplayed
+	}
+
+	for i := 0; i < count; i++ {
+		reason := reasons[i]
+		fmt.Fprintf(&b, "  %s", reason.Reason)
+		if reason.Code > 0 {
+			fmt.Fprintf(&b, " (%d)", reason.Code)
+		}
+		fmt.Fprintf(&b, ": %d", reason.Count)
+		if reason.MaxRetryAfterSeconds > 0 {
+			fmt.Fprintf(&b, " | retry after up to %ds", reason.MaxRetryAfterSeconds)
+		}
+		if len(reason.Fields) > 0 {
+			fmt.Fprintf(&b, " | fields: %s", strings.Join(reason.Fields, ", "))
+		}
+		b.WriteString("\n")
+		if len(reason.Example) > 0 {
+			fmt.Fprintf(&b, "    e.g. %s\n", truncateDisplay(reason.Example))
+		}
+	}
+
+	if count < len(reasons) {
+		fmt.Fprintf(&b, "  ... and %d more\n", len(reasons)-count)
+	}
+	return b.String()
+}
+
+// analyzeStatusChurn reports objects with repeated status writes, listing
+// status-only churn apart from objects whose spec also changed.
+// Rule 2: Bounded by maxDisplay.
+func analyzeStatusChurn(ops []storage.Operation, minWrites int) error {
+	fmt.Println("=== Status Churn ===")
+
+	churn, err := analysis.AnalyzeStatusChurn(ops, minWrites)
+	if err != nil {
+		return fmt.Errorf("status churn analysis failed: %w", err)
+	}
+
+	if len(churn) == 0 {
+		fmt.Printf("No objects with %d or more status writes\n\n", minWrites)
+		return nil
+	}
+
+	statusOnly := make([]analysis.StatusChurn, 0, len(churn))
+	withSpec := make([]analysis.StatusChurn, 0, len(churn))
+	for _, entry := range churn {
+		if entry.StatusOnly() {
+			statusOnly = append(statusOnly, entry)
+		} else {
+			withSpec = append(withSpec, entry)
+		}
+	}
+
+	fmt.Print(formatStatusChurn("Status-only churn", statusOnly))
+	fmt.Print(formatStatusChurn("Status churn alongside spec writes", withSpec))
+	fmt.Println()
+	return nil
+}
+
+// formatStatusChurn renders one group of churning objects.
+func formatStatusChurn(title string, churn []analysis.StatusChurn) string {
+	if len(churn) == 0 {
+		return ""
+	}
+
+	const maxDisplay = 10
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%d objects):\n", title, len(churn))
+	count := len(churn)
+	if count > maxDisplay {
+		count = maxDisplay
+	}
+
+	for i := 0; i < count; i++ {
+		entry := churn[i]
+		fmt.Fprintf(&b, "  %s: %d status writes", entry.ResourceKey, entry.StatusWrites)
+		if entry.SpecWrites > 0 {
+			fmt.Fprintf(&b, ", %d spec writes", entry.SpecWrites)
+		}
+		if entry.NoopWrites > 0 {
+			fmt.Fprintf(&b, ", %d unchanged", entry.NoopWrites)
+		}
+		if len(entry.Actors) > 0 {
+			fmt.Fprintf(&b, " | by %s", strings.Join(entry.Actors, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	if count < len(churn) {
+		fmt.Fprintf(&b, "  ... and %d more\n", len(churn)-count)
+	}
+	return b.String()
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/slyt3/kubestep/pkg/analysis"
 	"github.com/slyt3/kubestep/pkg/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -210,7 +211,7 @@ func TestOutputJSONBasic(t *testing.T) {
 		Format:        "json",
 	}
 
-	err := outputJSON(cfg, ops)
+	err := outputJSON(cfg, ops, nil)
 	assert.NoError(t, err, "outputJSON should succeed")
 }
 
@@ -233,7 +234,7 @@ func TestOutputJSONSlowOperations(t *testing.T) {
 		Format:        "json",
 	}
 
-	err := outputJSON(cfg, ops)
+	err := outputJSON(cfg, ops, nil)
 	assert.NoError(t, err, "outputJSON with slow ops should succeed")
 }
 
@@ -269,7 +270,7 @@ func TestOutputJSONLoopDetection(t *testing.T) {
 		Format:        "json",
 	}
 
-	err := outputJSON(cfg, ops)
+	err := outputJSON(cfg, ops, nil)
 	assert.NoError(t, err, "outputJSON with loops should succeed")
 }
 
@@ -293,7 +294,7 @@ func TestOutputJSONErrorAnalysis(t *testing.T) {
 		Format:        "json",
 	}
 
-	err := outputJSON(cfg, ops)
+	err := outputJSON(cfg, ops, nil)
 	assert.NoError(t, err, "outputJSON with errors should succeed")
 }
 
@@ -312,7 +313,7 @@ func TestOutputJSONAllDisabled(t *testing.T) {
 		Format:        "json",
 	}
 
-	err := outputJSON(cfg, ops)
+	err := outputJSON(cfg, ops, nil)
 	assert.NoError(t, err, "outputJSON with all disabled should succeed")
 }
 
@@ -331,7 +332,7 @@ func TestOutputJSONEmptyOperations(t *testing.T) {
 		Format:        "json",
 	}
 
-	err := outputJSON(cfg, ops)
+	err := outputJSON(cfg, ops, nil)
 	assert.NoError(t, err, "outputJSON with empty ops should succeed")
 }
 
@@ -391,7 +392,7 @@ func TestOutputTextBasic(t *testing.T) {
 		Format:        "text",
 	}
 
-	err := outputText(cfg, ops)
+	err := outputText(cfg, ops, nil)
 	assert.NoError(t, err, "outputText should succeed")
 }
 
@@ -503,3 +504,45 @@ func TestRunAnalyzeWithInvalidArgs(t *testing.T) {
 	err = runAnalyze(cfg, []string{"session1", "session2"})
 	assert.Error(t, err, "runAnalyze should fail with too many args")
 }
+
+// TestPartialRecordingWarnings tests warnings for filtered and dropped operations.
+func TestPartialRecordingWarnings(t *testing.T) {
+	assert.Empty(t, partialRecordingWarnings(nil))
+	assert.Empty(t, partialRecordingWarnings(&storage.SessionStats{SessionID: "s"}))
+
+	warnings := partialRecordingWarnings(&storage.SessionStats{
+		SessionID:          "s",
+		FilteredOperations: 40,
+		DroppedOperations:  2,
+	})
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "40 operations were filtered out")
+	assert.Contains(t, warnings[1], "2 operations were dropped")
+}
+
+func TestFormatErrorReasons(t *testing.T) {
+	out := formatErrorReasons([]analysis.ReasonSummary{
+		{Reason: "Conflict", Code: 409, Count: 3, Example: "the object has been modified"},
+		{Reason: "TooManyRequests", Code: 429, Count: 2, MaxRetryAfterSeconds: 5},
+		{Reason: "Invalid", Code: 422, Count: 1, Fields: []string{"spec.replicas", "spec.selector"}},
+		{Reason: analysis.ReasonNone, Count: 1},
+	})
+
+	assert.Contains(t, out, "Conflict (409): 3\n    e.g. the object has been modified")
+	assert.Contains(t, out, "TooManyRequests (429): 2 | retry after up to 5s")
+	assert.Contains(t, out, "Invalid (422): 1 | fields: spec.replicas, spec.selector")
+	assert.Contains(t, out, "None: 1")
+}
+
+func TestFormatStatusChurn(t *testing.T) {
+	assert.Empty(t, formatStatusChurn("Status-only churn", nil))
+
+	out := formatStatusChurn("Status-only churn", []analysis.StatusChurn{
+		{ResourceKey: "Pod/default/web", StatusWrites: 12, NoopWrites: 9, Actors: []string{"pod-controller"}},
+		{ResourceKey: "Deployment/default/api", StatusWrites: 4, SpecWrites: 2},
+	})
+
+	assert.Contains(t, out, "Status-only churn (2 objects):")
+	assert.Contains(t, out, "Pod/default/web: 12 status writes, 9 unchanged | by pod-controller")
+	assert.Contains(t, out, "Deployment/default/api: 4 status writes, 2 spec writes")
+}
@@ -48,14 +48,6 @@ controller A WRITE -> controller B RECONCILE -> controller B WRITE -> ...`,
 		},
 	}
 
-	cmd.Flags().StringVarP(
-		&cfg.DatabasePath,
-		"database",
-		"d",
-		defaultDatabasePath,
-		"Path to SQLite database",
-	)
-
 	cmd.Flags().StringVar(
 		&cfg.SessionID,
 		"session",
@@ -91,25 +83,12 @@ controller A WRITE -> controller B RECONCILE -> controller B WRITE -> ...`,
 		"Include resource payloads in JSON output",
 	)
 
-	cmd.Flags().StringVar(
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
 		&cfg.StorageType,
-		"storage",
-		"sqlite",
-		"Storage backend: sqlite or mongodb",
-	)
-
-	cmd.Flags().StringVar(
 		&cfg.MongoURI,
-		"mongo-uri",
-		"mongodb://localhost:27017",
-		"MongoDB connection URI",
-	)
-
-	cmd.Flags().StringVar(
 		&cfg.MongoDatabase,
-		"mongo-db",
-		"kubestep",
-		"MongoDB database name",
 	)
 
 	return cmd
@@ -121,16 +100,9 @@ func runCausality(cfg *CausalityConfig) error {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	storeCfg := createStorageConfig(&AnalyzeConfig{
-		DatabasePath:  cfg.DatabasePath,
-		StorageType:   cfg.StorageType,
-		MongoURI:      cfg.MongoURI,
-		MongoDatabase: cfg.MongoDatabase,
-	})
-
-	store, err := storage.NewOperationStore(storeCfg)
+	store, err := openStore(cfg.storageOptions())
 	if err != nil {
-		return fmt.Errorf("failed to create storage: %w", err)
+		return err
 	}
 	defer func() {
 		closeErr := store.Close()
@@ -175,6 +147,17 @@ func runCausality(cfg *CausalityConfig) error {
 	return outputCausalityText(cfg, graph, warnings)
 }
 
+// storageOptions returns the storage flags of the causality command.
+func (cfg *CausalityConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+		ReadOnly:      true,
+	}
+}
+
 func validateCausalityConfig(cfg *CausalityConfig) error {
 	err := assert.AssertNotNil(cfg, "config")
 	if err != nil {
@@ -194,29 +177,7 @@ func validateCausalityConfig(cfg *CausalityConfig) error {
 		return fmt.Errorf("invalid max-depth: %d (must be 2-50)", cfg.MaxDepth)
 	}
 
-	if cfg.StorageType != "sqlite" && cfg.StorageType != "mongodb" {
-		return fmt.Errorf("invalid storage type: %s (must be 'sqlite' or 'mongodb')", cfg.StorageType)
-	}
-
-	if cfg.StorageType == "sqlite" {
-		err = assert.AssertStringNotEmpty(cfg.DatabasePath, "database path")
-		if err != nil {
-			return err
-		}
-	}
-
-	if cfg.StorageType == "mongodb" {
-		err = assert.AssertStringNotEmpty(cfg.MongoURI, "mongo URI")
-		if err != nil {
-			return err
-		}
-		err = assert.AssertStringNotEmpty(cfg.MongoDatabase, "mongo database")
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return validateStorageOptions(cfg.storageOptions())
 }
 
 func outputCausalityJSON(
@@ -306,7 +267,22 @@ func formatCausalityNode(node analysis.CausalityNode) string {
 
 	switch node.Type {
 	case analysis.NodeTypeOperation:
-		return fmt.Sprintf("op[%s %s %s rv=%s uid=%s ts=%s]",
+		kind := node.Kind
+		if len(node.Subresource) > 0 {
+			kind = kind + "/" + node.Subresource
+		}
+		return fmt.Sprintf("op[%s %s %s rv=%s uid=%s ts=%s%s]",
+			node.ActorID,
+			kind,
+			ref,
+			node.ResourceVer,
+			node.UID,
+			ts,
+			formatNodeEvents(node.Events),
+		)
+	case analysis.NodeTypeEvent:
+		return fmt.Sprintf("event[%s %s %s %s rv=%s uid=%s ts=%s]",
+			node.EventType,
 			node.ActorID,
 			node.Kind,
 			ref,
@@ -315,7 +291,7 @@ func formatCausalityNode(node analysis.CausalityNode) string {
 			ts,
 		)
 	case analysis.NodeTypeSpan:
-		return fmt.Sprintf("span[%s %s %s rv=%s uid=%s dur=%dms ts=%s]",
+		return fmt.Sprintf("span[%s %s %s rv=%s uid=%s dur=%dms ts=%s%s]",
 			node.ActorID,
 			node.Kind,
 			ref,
@@ -323,12 +299,32 @@ func formatCausalityNode(node analysis.CausalityNode) string {
 			node.UID,
 			node.DurationMs,
 			ts,
+			formatNodeEvents(node.Events),
 		)
 	default:
 		return fmt.Sprintf("node[%s]", node.ID)
 	}
 }
 
+// formatNodeEvents lists the type and reason of the Kubernetes Events
+// annotating a node.
+func formatNodeEvents(events []analysis.CausalityEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+
+	const maxShown = 3
+
+	parts := make([]string, 0, maxShown+1)
+	for i := 0; i < len(events) && i < maxShown; i++ {
+		parts = append(parts, events[i].Type+":"+events[i].Reason)
+	}
+	if len(events) > maxShown {
+		parts = append(parts, fmt.Sprintf("+%d", len(events)-maxShown))
+	}
+	return " events=" + strings.Join(parts, ",")
+}
+
 func formatResourceRef(namespace, name string) string {
 	if len(namespace) == 0 {
 		return name
@@ -56,6 +56,19 @@ func TestFormatCausalityNode(t *testing.T) {
 	out := formatCausalityNode(opNode)
 	require.True(t, strings.Contains(out, "op["))
 
+	opNode.Subresource = "status"
+	out = formatCausalityNode(opNode)
+	require.True(t, strings.Contains(out, "Pod/status"))
+
+	opNode.Events = []analysis.CausalityEvent{
+		{Type: "Warning", Reason: "FailedCreate"},
+		{Type: "Normal", Reason: "Scaled"},
+		{Type: "Normal", Reason: "Scaled"},
+		{Type: "Normal", Reason: "Ready"},
+	}
+	out = formatCausalityNode(opNode)
+	require.Contains(t, out, " events=Warning:FailedCreate,Normal:Scaled,Normal:Scaled,+1]")
+
 	spanNode := analysis.CausalityNode{
 		ID:          "span-1",
 		Type:        analysis.NodeTypeSpan,
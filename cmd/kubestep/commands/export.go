@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/bundle"
+	"github.com/spf13/cobra"
+)
+
+// ExportConfig holds export command configuration.
+type ExportConfig struct {
+	Output        string
+	DatabasePath  string
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
+}
+
+// NewExportCommand creates the export subcommand.
+func NewExportCommand() *cobra.Command {
+	cfg := &ExportConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "export [session-id]",
+		Short: "Export a session as a portable bundle",
+		Long: `Write one session to a compressed .ksb bundle holding a manifest
+with checksums, its operations, reconcile spans and events. Load the bundle
+into any storage backend with kubestep import.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(cfg, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&cfg.Output,
+		"output",
+		"o",
+		"",
+		"Bundle file to write, or - for stdout (required)",
+	)
+
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
+	)
+
+	return cmd
+}
+
+// runExport writes sessionID to the output bundle.
+func runExport(cfg *ExportConfig, sessionID string) error {
+	err := assert.AssertNotNil(cfg, "config")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(cfg.Output, "output")
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg.storageOptions())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := store.Close()
+		if closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close storage: %v\n", closeErr)
+		}
+	}()
+
+	var manifest *bundle.Manifest
+	err = writeOutput(cfg.Output, func(w io.Writer) error {
+		var exportErr error
+		manifest, exportErr = bundle.Export(store, sessionID, w)
+		return exportErr
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export session %s: %w", sessionID, err)
+	}
+
+	// Status goes to stderr so a bundle written to stdout stays intact.
+	fmt.Fprintf(os.Stderr, "Exported session %s to %s\n", sessionID, cfg.Output)
+	fmt.Fprintf(os.Stderr, "Operations: %d, spans: %d, events: %d\n",
+		manifest.Counts.Operations, manifest.Counts.Spans, manifest.Counts.Events)
+	return nil
+}
+
+// writeOutput calls write with stdout for "-", or with a temporary file
+// that replaces path once write succeeds, so a failed export leaves no
+// partial bundle behind.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	tmp := file.Name()
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// storageOptions returns the storage flags of the export command.
+func (cfg *ExportConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+		ReadOnly:      true,
+	}
+}
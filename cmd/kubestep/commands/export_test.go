@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportBundle(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "source.db")
+	db, err := storage.NewDatabase(dbPath, testMaxOps)
+	require.NoError(t, err)
+	require.NoError(t, db.BeginSession(&storage.Session{ID: "repro", OperatorName: "demo"}))
+	ops := createTestOperations("repro", 3)
+	for i := range ops {
+		require.NoError(t, db.InsertOperation(&ops[i]))
+	}
+	require.NoError(t, db.EndSession("repro", storage.SessionCompleted))
+	require.NoError(t, db.Close())
+
+	bundlePath := filepath.Join(dir, "repro.ksb")
+	require.NoError(t, runExport(&ExportConfig{Output: bundlePath, DatabasePath: dbPath}, "repro"))
+	require.Error(t, runExport(&ExportConfig{Output: filepath.Join(dir, "none.ksb"), DatabasePath: dbPath}, "none"))
+	_, err = os.Stat(filepath.Join(dir, "none.ksb"))
+	require.True(t, os.IsNotExist(err), "a failed export leaves no file")
+
+	target := filepath.Join(dir, "recordings")
+	cfg := &ImportBundleConfig{File: bundlePath, DatabasePath: target, StorageType: storage.StorageSegment}
+	require.NoError(t, runImportBundle(cfg))
+	require.NoError(t, runImportBundle(cfg))
+	require.NoError(t, runReplay(&ReplayConfig{DatabasePath: target, StorageType: storage.StorageSegment, Quiet: true},
+		[]string{"repro-import-1"}))
+
+	store, err := storage.NewSegmentStore(storage.StorageConfig{ConnectionURI: target, MaxOperations: testMaxOps})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, store.Close())
+	}()
+	for _, sessionID := range []string{"repro", "repro-import-1"} {
+		imported, err := store.QueryOperations(sessionID)
+		require.NoError(t, err)
+		assert.Len(t, imported, 3)
+		session, err := store.GetSession(sessionID)
+		require.NoError(t, err)
+		assert.Equal(t, "demo", session.OperatorName)
+		assert.Equal(t, storage.SessionCompleted, session.Status)
+	}
+
+	require.NoError(t, os.WriteFile(bundlePath, []byte("not a bundle"), 0o600))
+	require.Error(t, runImportBundle(cfg))
+}
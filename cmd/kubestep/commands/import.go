@@ -0,0 +1,445 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/bundle"
+	"github.com/slyt3/kubestep/pkg/recorder"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	serviceAccountPrefix = "system:serviceaccount:"
+)
+
+// ImportAuditConfig holds import audit command configuration.
+type ImportAuditConfig struct {
+	File          string
+	SessionID     string
+	Description   string
+	DatabasePath  string
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
+	// Users and ServiceAccounts keep events by these identities. Service
+	// accounts are given as namespace/name.
+	Users           []string
+	ServiceAccounts []string
+	Verbs           []string
+	Resources       []string
+	// Since and Until bound the request time, each given as a duration
+	// before now (24h), an RFC 3339 time or a date.
+	Since string
+	Until string
+}
+
+// ImportBundleConfig holds configuration for importing a session bundle.
+type ImportBundleConfig struct {
+	File          string
+	SessionID     string
+	Description   string
+	DatabasePath  string
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
+}
+
+// NewImportCommand creates the import subcommand. Given a file it imports a
+// session bundle written by kubestep export; its subcommands import
+// recordings from other sources.
+func NewImportCommand() *cobra.Command {
+	cfg := &ImportBundleConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "import [bundle.ksb]",
+		Short: "Import session bundles and recordings from other sources",
+		Long: `Import a session bundle written by kubestep export into any storage
+backend. The bundle checksums and records are verified before anything is
+stored. A session whose ID is already taken is imported as <id>-import-N,
+with its reconcile span IDs remapped to match.
+
+The subcommands import operations recorded outside kubestep into a session,
+so replay and analysis work on operators that were never instrumented.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return cmd.Help()
+			}
+			cfg.File = args[0]
+			return runImportBundle(cfg)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&cfg.SessionID,
+		"session",
+		"",
+		"Session ID to import the bundle as (default: the exported ID)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Description,
+		"description",
+		"",
+		"Session description when the bundle has no session metadata",
+	)
+
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
+	)
+
+	cmd.AddCommand(NewImportAuditCommand())
+
+	return cmd
+}
+
+// runImportBundle verifies the bundle and loads it into the store.
+func runImportBundle(cfg *ImportBundleConfig) error {
+	err := assert.AssertNotNil(cfg, "config")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(cfg.File, "bundle file")
+	if err != nil {
+		return err
+	}
+
+	err = validateStorageOptions(cfg.storageOptions())
+	if err != nil {
+		return err
+	}
+
+	input, closeInput, err := openImportFile(cfg.File)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	b, err := bundle.Read(input)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle %s: %w", cfg.File, err)
+	}
+
+	store, err := openStore(cfg.storageOptions())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := store.Close()
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close storage: %v\n", closeErr)
+		}
+	}()
+
+	result, err := bundle.Import(store, b, bundle.ImportOptions{
+		SessionID:   cfg.SessionID,
+		Description: cfg.Description,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import bundle: %w", err)
+	}
+
+	if result.Remapped {
+		fmt.Printf("Session %s exists, imported as %s\n", b.Manifest.SessionID, result.SessionID)
+	}
+	fmt.Printf("Imported session %s\n", result.SessionID)
+	fmt.Printf("Operations: %d, spans: %d, events: %d\n", result.Operations, result.Spans, result.Events)
+	return nil
+}
+
+// storageOptions returns the storage flags of the import command.
+func (cfg *ImportBundleConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+	}
+}
+
+// NewImportAuditCommand creates the import audit subcommand.
+func NewImportAuditCommand() *cobra.Command {
+	cfg := &ImportAuditConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Import a Kubernetes API server audit log",
+		Long: `Import JSON lines of audit.k8s.io/v1 Events as a session.
+Each completed resource request becomes an operation recorded for the user
+that made it. Events logged at the RequestResponse level keep their request
+and response bodies.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImportAudit(cfg)
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&cfg.File,
+		"file",
+		"f",
+		"",
+		"Audit log to import, or - for stdin (required)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.SessionID,
+		"session",
+		"",
+		"Session ID to import into (required)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Description,
+		"description",
+		"",
+		"Session description",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&cfg.Users,
+		"user",
+		nil,
+		"Only requests by this user (repeatable)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&cfg.ServiceAccounts,
+		"service-account",
+		nil,
+		"Only requests by this namespace/name service account (repeatable)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&cfg.Verbs,
+		"verb",
+		nil,
+		"Only requests with this verb (repeatable)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&cfg.Resources,
+		"resource",
+		nil,
+		"Only requests for this resource, e.g. pods, deployments.apps or pods/status (repeatable)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Since,
+		"since",
+		"",
+		"Only requests since a duration ago (24h), an RFC 3339 time or a date",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Until,
+		"until",
+		"",
+		"Only requests until a duration ago, an RFC 3339 time or a date",
+	)
+
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
+	)
+
+	return cmd
+}
+
+// runImportAudit imports the audit log into a new session.
+func runImportAudit(cfg *ImportAuditConfig) error {
+	err := assert.AssertNotNil(cfg, "config")
+	if err != nil {
+		return err
+	}
+
+	err = validateImportAuditConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	auditCfg, err := cfg.auditConfig(time.Now())
+	if err != nil {
+		return err
+	}
+
+	input, closeInput, err := openImportFile(cfg.File)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	store, err := openStore(cfg.storageOptions())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := store.Close()
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close storage: %v\n", closeErr)
+		}
+	}()
+
+	err = checkNewSession(store, cfg.SessionID)
+	if err != nil {
+		return err
+	}
+
+	err = store.BeginSession(&storage.Session{ID: cfg.SessionID, Description: cfg.description()})
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+
+	auditCfg.Database = store
+	result, importErr := recorder.ImportAudit(input, auditCfg)
+
+	status := storage.SessionCompleted
+	if importErr != nil {
+		status = storage.SessionFailed
+	}
+	err = store.EndSession(cfg.SessionID, status)
+	if importErr != nil {
+		return fmt.Errorf("failed to import audit log: %w", importErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+
+	fmt.Printf("Imported %d operations into session %s\n", result.Imported, cfg.SessionID)
+	fmt.Printf("Events: %d, skipped: %d, invalid: %d\n", result.Events, result.Skipped, result.Invalid)
+	return nil
+}
+
+// checkNewSession refuses a session ID that has metadata or recorded
+// operations, so an import never numbers operations over stored ones.
+func checkNewSession(store storage.OperationStore, sessionID string) error {
+	_, err := store.GetSession(sessionID)
+	if err == nil {
+		return fmt.Errorf("session %s already exists", sessionID)
+	}
+	if !errors.Is(err, storage.ErrSessionNotFound) {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+
+	clock, err := store.MaxLamport(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+	if clock > 0 {
+		return fmt.Errorf("session %s already has recorded operations", sessionID)
+	}
+	return nil
+}
+
+// validateImportAuditConfig checks the file, session and storage settings.
+// Rule 5: Multiple assertions for validation.
+func validateImportAuditConfig(cfg *ImportAuditConfig) error {
+	err := assert.AssertStringNotEmpty(cfg.File, "file")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(cfg.SessionID, "session")
+	if err != nil {
+		return err
+	}
+
+	return validateStorageOptions(cfg.storageOptions())
+}
+
+// auditConfig converts the command filters. now anchors --since and
+// --until durations.
+func (cfg *ImportAuditConfig) auditConfig(now time.Time) (recorder.AuditConfig, error) {
+	auditCfg := recorder.AuditConfig{
+		SessionID: cfg.SessionID,
+		Verbs:     cfg.Verbs,
+		Resources: cfg.Resources,
+	}
+
+	users, err := auditUsers(cfg.Users, cfg.ServiceAccounts)
+	if err != nil {
+		return auditCfg, err
+	}
+	auditCfg.Users = users
+
+	if len(cfg.Since) > 0 {
+		auditCfg.Since, err = parseSince(cfg.Since, now)
+		if err != nil {
+			return auditCfg, err
+		}
+	}
+
+	if len(cfg.Until) > 0 {
+		auditCfg.Until, err = parseSince(cfg.Until, now)
+		if err != nil {
+			return auditCfg, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+
+	return auditCfg, nil
+}
+
+// auditUsers returns users plus the audit usernames of serviceAccounts.
+// Rule 2: Bounded by the number of flags given.
+func auditUsers(users []string, serviceAccounts []string) ([]string, error) {
+	out := make([]string, 0, len(users)+len(serviceAccounts))
+	out = append(out, users...)
+	for i := 0; i < len(serviceAccounts); i++ {
+		namespace, name, ok := strings.Cut(serviceAccounts[i], "/")
+		if !ok || len(namespace) == 0 || len(name) == 0 {
+			return nil, fmt.Errorf("invalid service account %q: want namespace/name", serviceAccounts[i])
+		}
+		out = append(out, serviceAccountPrefix+namespace+":"+name)
+	}
+	return out, nil
+}
+
+// description returns the session description, naming the imported file
+// when none was given.
+func (cfg *ImportAuditConfig) description() string {
+	if len(cfg.Description) > 0 {
+		return cfg.Description
+	}
+	if cfg.File == "-" {
+		return "Imported from audit log on stdin"
+	}
+	return "Imported from audit log " + filepath.Base(cfg.File)
+}
+
+// openImportFile opens path for reading, or stdin for "-".
+func openImportFile(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return file, func() { _ = file.Close() }, nil
+}
+
+// storageOptions returns the storage flags of the import audit command.
+func (cfg *ImportAuditConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+	}
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAuditLog = `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse",` +
+	`"stage":"ResponseComplete","requestURI":"/api/v1/namespaces/default/configmaps/demo","verb":"get",` +
+	`"user":{"username":"system:serviceaccount:ops:widget-operator"},` +
+	`"objectRef":{"resource":"configmaps","namespace":"default","name":"demo","apiVersion":"v1"},` +
+	`"responseStatus":{"metadata":{},"code":200},` +
+	`"responseObject":{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo","namespace":"default",` +
+	`"uid":"uid-1","resourceVersion":"7"}},` +
+	`"requestReceivedTimestamp":"2024-05-01T10:00:00.000000Z","stageTimestamp":"2024-05-01T10:00:00.004000Z"}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","stage":"ResponseComplete",` +
+	`"requestURI":"/api/v1/namespaces/default/configmaps/demo","verb":"update",` +
+	`"user":{"username":"alice"},` +
+	`"objectRef":{"resource":"configmaps","namespace":"default","name":"demo","apiVersion":"v1"},` +
+	`"responseStatus":{"metadata":{},"code":200},` +
+	`"requestReceivedTimestamp":"2024-05-01T10:00:01.000000Z","stageTimestamp":"2024-05-01T10:00:01.004000Z"}
+`
+
+func TestRunImportAudit(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(testAuditLog), 0o600))
+	dbPath := filepath.Join(dir, "audit.db")
+
+	cfg := &ImportAuditConfig{
+		File:            logPath,
+		SessionID:       "from-audit",
+		DatabasePath:    dbPath,
+		ServiceAccounts: []string{"ops/widget-operator"},
+	}
+	require.NoError(t, runImportAudit(cfg))
+	require.Error(t, runImportAudit(cfg), "importing into an existing session")
+
+	// A session recorded without metadata is refused too.
+	db, err := storage.NewDatabase(dbPath, testMaxOps)
+	require.NoError(t, err)
+	require.NoError(t, db.InsertOperation(&createTestOperations("bare", 1)[0]))
+	require.NoError(t, db.Close())
+	bare := *cfg
+	bare.SessionID = "bare"
+	require.ErrorContains(t, runImportAudit(&bare), "already has recorded operations")
+
+	require.NoError(t, runAnalyze(&AnalyzeConfig{
+		DatabasePath:  dbPath,
+		DetectLoops:   true,
+		LoopWindow:    defaultLoopWindow,
+		SlowThreshold: defaultSlowThreshold,
+		Format:        "text",
+	}, []string{"from-audit"}))
+	require.NoError(t, runReplay(&ReplayConfig{DatabasePath: dbPath, Quiet: true}, []string{"from-audit"}))
+	require.NoError(t, runCausality(&CausalityConfig{
+		DatabasePath: dbPath,
+		SessionID:    "from-audit",
+		Format:       "text",
+		MaxDepth:     defaultCausalityDepth,
+	}))
+
+	db, err = storage.NewDatabase(dbPath, testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	ops, err := db.QueryOperations("from-audit")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "system:serviceaccount:ops:widget-operator", ops[0].ActorID)
+	assert.Equal(t, "uid-1", ops[0].UID)
+
+	session, err := db.GetSession("from-audit")
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionCompleted, session.Status)
+	assert.Equal(t, "Imported from audit log audit.log", session.Description)
+}
+
+func TestImportAuditConfigFilters(t *testing.T) {
+	now := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	cfg := &ImportAuditConfig{
+		SessionID:       "s",
+		Users:           []string{"alice"},
+		ServiceAccounts: []string{"ops/widget-operator"},
+		Since:           "2024-05-01",
+		Until:           "1h",
+	}
+	auditCfg, err := cfg.auditConfig(now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "system:serviceaccount:ops:widget-operator"}, auditCfg.Users)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), auditCfg.Since.UTC())
+	assert.Equal(t, now.Add(-time.Hour), auditCfg.Until)
+
+	_, err = (&ImportAuditConfig{ServiceAccounts: []string{"widget-operator"}}).auditConfig(now)
+	require.Error(t, err)
+	_, err = (&ImportAuditConfig{Until: "tomorrow"}).auditConfig(now)
+	require.Error(t, err)
+
+	require.Error(t, runImportAudit(&ImportAuditConfig{SessionID: "s", DatabasePath: "x.db"}))
+	err = runImportAudit(&ImportAuditConfig{
+		File:         filepath.Join(t.TempDir(), "missing.log"),
+		SessionID:    "s",
+		DatabasePath: filepath.Join(t.TempDir(), "x.db"),
+	})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "missing.log"))
+}
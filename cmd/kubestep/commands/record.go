@@ -1,83 +1,585 @@
 package commands
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/proxy"
 	"github.com/slyt3/kubestep/pkg/storage"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+const (
+	defaultProxyAddress  = "127.0.0.1:0"
+	defaultRecordActor   = "kubestep-proxy"
+	proxyKubeconfigName  = "kubeconfig"
+	proxyContextName     = "kubestep"
+	proxyHeaderTimeout   = 30 * time.Second
+	proxyTokenBytes      = 32
+	proxyCertLifetime    = 365 * 24 * time.Hour
+	serverVersionTimeout = 5 * time.Second
+)
+
+// RecordConfig holds record command configuration.
+type RecordConfig struct {
+	SessionID     string
+	DatabasePath  string
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
+	// Kubeconfig and Context select the real API server. Empty values use
+	// the usual KUBECONFIG and current-context resolution.
+	Kubeconfig string
+	Context    string
+	// ListenAddress is where the recording proxy listens.
+	ListenAddress string
+	ActorID       string
+	Description   string
+	Labels        []string
+	// OperatorName defaults to the base name of the command.
+	OperatorName    string
+	OperatorVersion string
+}
+
+// upstreamCluster is the API server the child would have talked to.
+type upstreamCluster struct {
+	config    *rest.Config
+	cluster   string
+	namespace string
+}
+
+// recordingProxy serves a proxy.Proxy over TLS with a certificate made for
+// the run. The proxy forwards with the upstream credentials, so it only
+// accepts requests carrying the token generated for the run; client-go
+// sends a kubeconfig token only over TLS.
+type recordingProxy struct {
+	listener net.Listener
+	server   *http.Server
+	handler  *proxy.Proxy
+	// ca is the PEM serving certificate clients trust.
+	ca       []byte
+	serveErr chan error
+}
+
 // NewRecordCommand creates the record subcommand.
 func NewRecordCommand() *cobra.Command {
+	cfg := &RecordConfig{}
+
 	cmd := &cobra.Command{
-		Use:   "record",
+		Use:   "record --session <id> -- <command> [args...]",
 		Short: "Record operator operations",
-		Long: `Start recording Kubernetes operator operations.
-This command is typically used as a library in operator code.`,
+		Long: `Run an operator behind a local recording proxy.
+The operator is started with KUBECONFIG pointing at the proxy, which forwards
+every request, including watches, to the real API server and records it.
+Operators that cannot be modified can be recorded this way. The proxy only
+accepts requests with a token generated for the run, which is written into
+the kubeconfig the operator is given.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("Recording is integrated into operator code")
-			fmt.Println("See documentation for RecordingClient usage")
-			return nil
+			return runRecord(cfg, args)
 		},
 	}
 
-	return cmd
-}
+	cmd.Flags().StringVar(
+		&cfg.SessionID,
+		"session",
+		"",
+		"Session ID to record into",
+	)
 
-// SessionInfo holds session information.
-type SessionInfo struct {
-	SessionID string
-	StartTime int64
-	OpCount   int
-}
+	cmd.Flags().StringVar(
+		&cfg.Kubeconfig,
+		"kubeconfig",
+		"",
+		"Kubeconfig of the real API server (defaults to KUBECONFIG)",
+	)
 
-// NewSessionsCommand creates the sessions subcommand.
-func NewSessionsCommand() *cobra.Command {
-	var databasePath string
+	cmd.Flags().StringVar(
+		&cfg.Context,
+		"context",
+		"",
+		"Kubeconfig context to use",
+	)
 
-	cmd := &cobra.Command{
-		Use:   "sessions",
-		Short: "List recorded sessions",
-		Long:  "Display all recorded sessions in the database",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSessions(databasePath)
-		},
-	}
+	cmd.Flags().StringVar(
+		&cfg.ListenAddress,
+		"listen",
+		defaultProxyAddress,
+		"Address the recording proxy listens on",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.ActorID,
+		"actor",
+		defaultRecordActor,
+		"Actor ID stored with each operation",
+	)
 
-	cmd.Flags().StringVarP(
-		&databasePath,
-		"database",
-		"d",
-		defaultDatabasePath,
-		"Path to SQLite database",
+	cmd.Flags().StringVar(
+		&cfg.Description,
+		"description",
+		"",
+		"Session description",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&cfg.Labels,
+		"label",
+		nil,
+		"Session label as key=value (repeatable)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.OperatorName,
+		"operator",
+		"",
+		"Operator name (defaults to the command name)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.OperatorVersion,
+		"operator-version",
+		"",
+		"Operator version",
+	)
+
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
 	)
 
 	return cmd
 }
 
-// runSessions lists all recorded sessions.
-func runSessions(dbPath string) error {
-	err := assert.AssertStringNotEmpty(dbPath, "database path")
+// runRecord runs args behind a recording proxy and stores the session.
+// The session ends failed when the command exits non-zero and aborted when
+// it was interrupted.
+func runRecord(cfg *RecordConfig, args []string) error {
+	err := assert.AssertNotNil(cfg, "config")
+	if err != nil {
+		return err
+	}
+
+	err = validateRecordConfig(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	labels, err := parseLabelFilters(cfg.Labels)
 	if err != nil {
 		return err
 	}
 
-	db, err := storage.NewDatabase(dbPath, 1000000)
+	upstream, err := loadUpstreamCluster(cfg.Kubeconfig, cfg.Context)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
+	}
+
+	store, err := openStore(cfg.storageOptions())
+	if err != nil {
+		return err
 	}
 	defer func() {
-		closeErr := db.Close()
+		closeErr := store.Close()
 		if closeErr != nil {
-			fmt.Printf("Warning: failed to close database: %v\n", closeErr)
+			fmt.Printf("Warning: failed to close storage: %v\n", closeErr)
+		}
+	}()
+
+	err = store.BeginSession(recordSessionMeta(cfg, args, labels, upstream))
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+
+	interrupted, runErr := recordCommand(cfg, args, upstream, store)
+
+	status := storage.SessionCompleted
+	if interrupted {
+		status = storage.SessionAborted
+	} else if runErr != nil {
+		status = storage.SessionFailed
+	}
+
+	err = store.EndSession(cfg.SessionID, status)
+	if err != nil && runErr == nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+
+	return runErr
+}
+
+// recordCommand starts the proxy, runs the command against it and stops
+// the proxy once the command exits.
+func recordCommand(
+	cfg *RecordConfig,
+	args []string,
+	upstream *upstreamCluster,
+	store storage.OperationStore,
+) (bool, error) {
+	token, err := newProxyToken()
+	if err != nil {
+		return false, err
+	}
+
+	recording, err := startRecordingProxy(cfg.listenAddress(), proxy.Config{
+		Upstream:  upstream.config,
+		Token:     token,
+		Database:  store,
+		SessionID: cfg.SessionID,
+		ActorID:   cfg.ActorID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	dir, err := os.MkdirTemp("", "kubestep-record-")
+	if err != nil {
+		_ = recording.Close()
+		return false, fmt.Errorf("failed to create kubeconfig directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, proxyKubeconfigName)
+	err = writeProxyKubeconfig(path, recording.URL(), recording.ca, token, upstream.namespace)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "Recording session %s through %s\n", cfg.SessionID, recording.URL())
+	}
+
+	interrupted := false
+	if err == nil {
+		interrupted, err = runChild(args, path)
+	}
+
+	closeErr := recording.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to stop recording: %w", closeErr)
+	}
+
+	return interrupted, err
+}
+
+// validateRecordConfig checks the session, command and storage settings.
+// Rule 5: Multiple assertions for validation.
+func validateRecordConfig(cfg *RecordConfig, args []string) error {
+	err := assert.AssertStringNotEmpty(cfg.SessionID, "session")
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(len(args) > 0, "command to record is required")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(cfg.ActorID, "actor")
+	if err != nil {
+		return err
+	}
+
+	return validateStorageOptions(cfg.storageOptions())
+}
+
+// loadUpstreamCluster resolves the rest config, cluster name and default
+// namespace from kubeconfig and context.
+func loadUpstreamCluster(kubeconfig, context string) (*upstreamCluster, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	)
+
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve namespace: %w", err)
+	}
+
+	upstream := &upstreamCluster{config: config, namespace: namespace}
+
+	raw, err := loader.RawConfig()
+	if err == nil {
+		if len(context) == 0 {
+			context = raw.CurrentContext
+		}
+		if kubeContext, ok := raw.Contexts[context]; ok {
+			upstream.cluster = kubeContext.Cluster
 		}
+	}
+
+	return upstream, nil
+}
+
+// recordSessionMeta builds the session metadata for a recorded command.
+// The API server version is looked up directly; a failed lookup leaves it
+// empty.
+func recordSessionMeta(
+	cfg *RecordConfig,
+	args []string,
+	labels map[string]string,
+	upstream *upstreamCluster,
+) *storage.Session {
+	meta := &storage.Session{
+		ID:              cfg.SessionID,
+		Description:     cfg.Description,
+		Labels:          labels,
+		OperatorName:    cfg.OperatorName,
+		OperatorVersion: cfg.OperatorVersion,
+		ClusterName:     upstream.cluster,
+	}
+	if len(meta.OperatorName) == 0 {
+		meta.OperatorName = filepath.Base(args[0])
+	}
+
+	versionCfg := rest.CopyConfig(upstream.config)
+	versionCfg.Timeout = serverVersionTimeout
+	client, err := discovery.NewDiscoveryClientForConfig(versionCfg)
+	if err == nil {
+		info, versionErr := client.ServerVersion()
+		if versionErr == nil && info != nil {
+			meta.KubernetesVersion = info.GitVersion
+		}
+	}
+
+	return meta
+}
+
+// startRecordingProxy listens on address and serves a recording proxy
+// built from cfg over TLS.
+func startRecordingProxy(address string, cfg proxy.Config) (*recordingProxy, error) {
+	handler, err := proxy.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording proxy: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		_ = handler.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	cert, ca, err := newProxyCertificate(listener.Addr())
+	if err != nil {
+		_ = listener.Close()
+		_ = handler.Close()
+		return nil, err
+	}
+
+	recording := &recordingProxy{
+		listener: listener,
+		server: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: proxyHeaderTimeout,
+			TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		},
+		handler:  handler,
+		ca:       ca,
+		serveErr: make(chan error, 1),
+	}
+	go func() {
+		recording.serveErr <- recording.server.ServeTLS(listener, "", "")
 	}()
 
-	fmt.Println("Available Sessions:")
-	fmt.Println("(Use 'kubestep replay <session-id>' to replay)")
-	fmt.Println()
-	fmt.Println("Note: Full session listing requires additional DB methods")
+	return recording, nil
+}
+
+// newProxyCertificate returns a self-signed serving certificate for addr
+// and the loopback addresses, with its PEM encoding.
+func newProxyCertificate(addr net.Addr) (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate proxy key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate proxy certificate: %w", err)
+	}
+
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if tcp, ok := addr.(*net.TCPAddr); ok && !tcp.IP.IsUnspecified() {
+		ips = append(ips, tcp.IP)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "kubestep-proxy"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(proxyCertLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           ips,
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate proxy certificate: %w", err)
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// URL returns the base URL clients use to reach the proxy. A proxy
+// listening on every interface is reached through loopback.
+func (p *recordingProxy) URL() string {
+	addr := p.listener.Addr()
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.IP.IsUnspecified() {
+		return "https://" + net.JoinHostPort("127.0.0.1", fmt.Sprint(tcp.Port))
+	}
+	return "https://" + addr.String()
+}
+
+// Close stops the proxy, dropping open watches, and flushes the recorder.
+func (p *recordingProxy) Close() error {
+	err := p.server.Close()
+	serveErr := <-p.serveErr
+	if err == nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		err = serveErr
+	}
 
+	closeErr := p.handler.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// newProxyToken returns a random bearer token for one recording run.
+func newProxyToken() (string, error) {
+	buf := make([]byte, proxyTokenBytes)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate proxy token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeProxyKubeconfig writes a kubeconfig whose only context points at the
+// proxy server, trusting its certificate ca and sending the proxy token,
+// and keeps the upstream default namespace.
+func writeProxyKubeconfig(path, server string, ca []byte, token, namespace string) error {
+	config := clientcmdapi.NewConfig()
+	config.Clusters[proxyContextName] = &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: ca}
+	config.AuthInfos[proxyContextName] = &clientcmdapi.AuthInfo{Token: token}
+	config.Contexts[proxyContextName] = &clientcmdapi.Context{
+		Cluster:   proxyContextName,
+		AuthInfo:  proxyContextName,
+		Namespace: namespace,
+	}
+	config.CurrentContext = proxyContextName
+
+	err := clientcmd.WriteToFile(*config, path)
+	if err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
 	return nil
 }
+
+// runChild runs args with KUBECONFIG set to kubeconfig, forwarding
+// interrupts to it. It reports whether an interrupt was forwarded.
+func runChild(args []string, kubeconfig string) (bool, error) {
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	child.Env = childEnv(os.Environ(), kubeconfig)
+
+	err := child.Start()
+	if err != nil {
+		return false, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var interrupted atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				interrupted.Store(true)
+				_ = child.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = child.Wait()
+	if err != nil {
+		return interrupted.Load(), fmt.Errorf("%s exited: %w", args[0], err)
+	}
+	return interrupted.Load(), nil
+}
+
+// childEnv returns env with KUBECONFIG replaced by kubeconfig.
+// Rule 2: Bounded by the length of env.
+func childEnv(env []string, kubeconfig string) []string {
+	out := make([]string, 0, len(env)+1)
+	for i := 0; i < len(env); i++ {
+		if strings.HasPrefix(env[i], "KUBECONFIG=") {
+			continue
+		}
+		out = append(out, env[i])
+	}
+	return append(out, "KUBECONFIG="+kubeconfig)
+}
+
+// listenAddress returns the proxy address, a free loopback port when unset.
+func (cfg *RecordConfig) listenAddress() string {
+	if len(cfg.ListenAddress) == 0 {
+		return defaultProxyAddress
+	}
+	return cfg.ListenAddress
+}
+
+// storageOptions returns the storage flags of the record command.
+func (cfg *RecordConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+	}
+}
@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/proxy"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	recordHelperEnv = "KUBESTEP_RECORD_HELPER"
+	upstreamToken   = "upstream-token"
+	recordCMJSON    = `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo",` +
+		`"namespace":"default","uid":"uid-1","resourceVersion":"7"}}`
+)
+
+// newRecordAPIServer serves a configmap, a two-event watch and the server
+// version over TLS, rejecting requests without the upstream token.
+// clientcmd only sends tokens to TLS servers.
+func newRecordAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major":"1","minor":"30","gitVersion":"v1.30.2"}`))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps/demo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(recordCMJSON))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		flusher, ok := w.(http.Flusher)
+		if r.URL.Query().Get("watch") != "true" || !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, eventType := range []string{"ADDED", "MODIFIED"} {
+			_, _ = fmt.Fprintf(w, "{\"type\":%q,\"object\":%s}\n", eventType, recordCMJSON)
+			flusher.Flush()
+		}
+	})
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+upstreamToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeUpstreamKubeconfig writes a kubeconfig for srv using the upstream
+// token.
+func writeUpstreamKubeconfig(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	config := clientcmdapi.NewConfig()
+	config.Clusters["fake"] = &clientcmdapi.Cluster{Server: srv.URL, CertificateAuthorityData: ca}
+	config.AuthInfos["fake"] = &clientcmdapi.AuthInfo{Token: upstreamToken}
+	config.Contexts["fake"] = &clientcmdapi.Context{Cluster: "fake", AuthInfo: "fake"}
+	config.CurrentContext = "fake"
+
+	path := filepath.Join(t.TempDir(), "upstream.kubeconfig")
+	require.NoError(t, clientcmd.WriteToFile(*config, path))
+	return path
+}
+
+// TestRecordHelperProcess is the operator run by the record tests. It gets
+// a configmap and drains a watch through the kubeconfig it is given.
+func TestRecordHelperProcess(t *testing.T) {
+	mode := os.Getenv(recordHelperEnv)
+	if len(mode) == 0 {
+		t.Skip("only run as a child of the record tests")
+	}
+
+	err := runRecordHelper()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if mode == "fail" {
+		os.Exit(3)
+	}
+	os.Exit(0)
+}
+
+func runRecordHelper() error {
+	ctx := context.Background()
+	cfg, err := clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "demo", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	watcher, err := client.CoreV1().ConfigMaps("default").Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	events := 0
+	for range watcher.ResultChan() {
+		events++
+	}
+	if events != 2 {
+		return fmt.Errorf("got %d watch events, want 2", events)
+	}
+	return nil
+}
+
+func TestRunRecordProxiesChildRequests(t *testing.T) {
+	srv := newRecordAPIServer(t)
+	dbPath := filepath.Join(t.TempDir(), "record.db")
+	cfg := &RecordConfig{
+		SessionID:    "proxied",
+		DatabasePath: dbPath,
+		Kubeconfig:   writeUpstreamKubeconfig(t, srv),
+		ActorID:      defaultRecordActor,
+		Labels:       []string{"env=test"},
+	}
+	args := []string{os.Args[0], "-test.run=^TestRecordHelperProcess$"}
+
+	t.Setenv(recordHelperEnv, "ok")
+	require.NoError(t, runRecord(cfg, args))
+
+	cfg.SessionID = "failing"
+	t.Setenv(recordHelperEnv, "fail")
+	require.Error(t, runRecord(cfg, args))
+
+	db, err := storage.NewDatabase(dbPath, testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	ops, err := db.QueryOperations("proxied")
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	assert.Equal(t, storage.OperationGet, ops[0].OperationType)
+	assert.Equal(t, "ConfigMap", ops[0].ResourceKind)
+	assert.Equal(t, "demo", ops[0].Name)
+	assert.Equal(t, "uid-1", ops[0].UID)
+	assert.Equal(t, defaultRecordActor, ops[0].ActorID)
+	assert.Equal(t, storage.OperationWatch, ops[1].OperationType)
+	assert.Equal(t, "configmaps", ops[1].Resource)
+	assert.Equal(t, "ADDED", ops[2].EventType)
+	assert.Equal(t, "MODIFIED", ops[3].EventType)
+	assert.Equal(t, "demo", ops[3].Name)
+
+	session, err := db.GetSession("proxied")
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionCompleted, session.Status)
+	assert.Equal(t, filepath.Base(os.Args[0]), session.OperatorName)
+	assert.Equal(t, "fake", session.ClusterName)
+	assert.Equal(t, "v1.30.2", session.KubernetesVersion)
+	assert.Equal(t, map[string]string{"env": "test"}, session.Labels)
+	assert.False(t, session.EndTime.IsZero())
+
+	session, err = db.GetSession("failing")
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionFailed, session.Status)
+}
+
+func TestRecordingProxyRequiresToken(t *testing.T) {
+	srv := newRecordAPIServer(t)
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "record.db"), testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	upstream, err := loadUpstreamCluster(writeUpstreamKubeconfig(t, srv), "")
+	require.NoError(t, err)
+	token, err := newProxyToken()
+	require.NoError(t, err)
+	recording, err := startRecordingProxy(defaultProxyAddress, proxy.Config{
+		Upstream:  upstream.config,
+		Token:     token,
+		Database:  db,
+		SessionID: "guarded",
+		ActorID:   defaultRecordActor,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, recording.Close())
+	}()
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(recording.ca))
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := anonymous.Get(recording.URL() + "/api/v1/namespaces/default/configmaps/demo")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	path := filepath.Join(t.TempDir(), proxyKubeconfigName)
+	require.NoError(t, writeProxyKubeconfig(path, recording.URL(), recording.ca, token, "default"))
+	cfg, err := clientcmd.BuildConfigFromFlags("", path)
+	require.NoError(t, err)
+	assert.Equal(t, token, cfg.BearerToken)
+	client, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+	_, err = client.CoreV1().ConfigMaps("default").Get(context.Background(), "demo", metav1.GetOptions{})
+	require.NoError(t, err)
+}
+
+func TestRecordValidationAndEnv(t *testing.T) {
+	args := []string{"operator"}
+	require.Error(t, runRecord(&RecordConfig{DatabasePath: "x.db", ActorID: "a"}, args))
+	require.Error(t, runRecord(&RecordConfig{SessionID: "s", DatabasePath: "x.db", ActorID: "a"}, nil))
+	require.Error(t, runRecord(&RecordConfig{SessionID: "s", DatabasePath: "x.db"}, args))
+	require.Error(t, runRecord(&RecordConfig{
+		SessionID: "s", DatabasePath: "x.db", ActorID: "a", Labels: []string{"env"},
+	}, args))
+
+	env := childEnv([]string{"HOME=/root", "KUBECONFIG=/old", "PATH=/bin"}, "/proxy")
+	assert.Equal(t, []string{"HOME=/root", "PATH=/bin", "KUBECONFIG=/proxy"}, env)
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/schollz/progressbar/v3"
 	"github.com/slyt3/kubestep/internal/assert"
@@ -11,16 +12,21 @@ import (
 )
 
 const (
-	defaultDatabasePath = "recordings.db"
-	maxSessionIDInput   = 100
+	defaultDatabasePath   = "recordings.db"
+	maxSessionIDInput     = 100
+	maxPatchDisplayLength = 512
+	maxDiffDisplayLines   = 20
 )
 
 // ReplayConfig holds replay command configuration.
 type ReplayConfig struct {
-	DatabasePath string
-	SessionID    string
-	Interactive  bool
-	Quiet        bool
+	DatabasePath  string
+	SessionID     string
+	Interactive   bool
+	Quiet         bool
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
 }
 
 // NewReplayCommand creates the replay subcommand.
@@ -38,12 +44,12 @@ Allows stepping forward/backward through the operation sequence.`,
 		},
 	}
 
-	cmd.Flags().StringVarP(
+	addStorageFlags(
+		cmd,
 		&cfg.DatabasePath,
-		"database",
-		"d",
-		defaultDatabasePath,
-		"Path to SQLite database",
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
 	)
 
 	cmd.Flags().BoolVarP(
@@ -85,18 +91,18 @@ func runReplay(cfg *ReplayConfig, args []string) error {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	db, err := storage.NewDatabase(cfg.DatabasePath, 1000000)
+	store, err := openStore(cfg.storageOptions())
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer func() {
-		closeErr := db.Close()
+		closeErr := store.Close()
 		if closeErr != nil {
-			fmt.Printf("Warning: failed to close database: %v\n", closeErr)
+			fmt.Printf("Warning: failed to close storage: %v\n", closeErr)
 		}
 	}()
 
-	ops, err := db.QueryOperations(cfg.SessionID)
+	ops, err := store.QueryOperations(cfg.SessionID)
 	if err != nil {
 		return fmt.Errorf("failed to load operations: %w", err)
 	}
@@ -105,6 +111,16 @@ func runReplay(cfg *ReplayConfig, args []string) error {
 		return fmt.Errorf("no operations found for session: %s", cfg.SessionID)
 	}
 
+	stats, err := store.GetSessionStats(cfg.SessionID)
+	if err == nil && stats.DroppedOperations > 0 {
+		fmt.Printf("Warning: recorder dropped %d operations in this session; sequence gaps are expected\n",
+			stats.DroppedOperations)
+	}
+	if err == nil && len(stats.Redaction) > 0 {
+		fmt.Printf("Note: payloads were redacted at record time (%s)\n",
+			strings.Join(stats.Redaction, "; "))
+	}
+
 	engine, err := replay.NewReplayEngine(replay.Config{
 		Operations:   ops,
 		SessionID:    cfg.SessionID,
@@ -121,9 +137,20 @@ func runReplay(cfg *ReplayConfig, args []string) error {
 	return runAutomaticReplay(engine, cfg.Quiet)
 }
 
+// storageOptions returns the storage flags of the replay command.
+func (cfg *ReplayConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+		ReadOnly:      true,
+	}
+}
+
 // validateReplayConfig validates configuration.
 func validateReplayConfig(cfg *ReplayConfig) error {
-	err := assert.AssertStringNotEmpty(cfg.DatabasePath, "database path")
+	err := validateStorageOptions(cfg.storageOptions())
 	if err != nil {
 		return err
 	}
@@ -280,9 +307,190 @@ func displayOperation(op *storage.Operation) {
 		op.DurationMs,
 	)
 
+	if op.OperationType == storage.OperationEvent {
+		fmt.Print(formatKubeEvent(op))
+	} else if len(op.EventType) > 0 {
+		fmt.Printf("  Event: %s | RV: %s | UID: %s\n", op.EventType, op.ResourceVersion, op.UID)
+	}
+
+	if len(op.PatchType) > 0 {
+		fmt.Print(formatPatchDetails(op))
+	}
+
+	fmt.Print(formatWriteDetails(op))
+
+	fmt.Print(formatListDetails(op))
+
 	if len(op.Error) > 0 {
-		fmt.Printf("  Error: %s\n", op.Error)
+		fmt.Printf("  Error: %s\n", formatError(op))
+	}
+}
+
+// formatKubeEvent renders an emitted Kubernetes Event with the version of
+// the object it was about.
+func formatKubeEvent(op *storage.Operation) string {
+	if op == nil || op.OperationType != storage.OperationEvent {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %s %s", op.EventType, op.EventReason)
+	if len(op.ResourceVersion) > 0 {
+		fmt.Fprintf(&b, " | RV: %s", op.ResourceVersion)
+	}
+	if len(op.UID) > 0 {
+		fmt.Fprintf(&b, " | UID: %s", op.UID)
 	}
+	b.WriteString("\n")
+	if len(op.EventMessage) > 0 {
+		fmt.Fprintf(&b, "  Message: %s\n", truncateDisplay(op.EventMessage))
+	}
+	return b.String()
+}
+
+// formatError prefixes the error message with its API reason and code.
+func formatError(op *storage.Operation) string {
+	if len(op.ErrorReason) == 0 {
+		return op.Error
+	}
+	if op.ErrorCode > 0 {
+		return fmt.Sprintf("[%s %d] %s", op.ErrorReason, op.ErrorCode, op.Error)
+	}
+	return fmt.Sprintf("[%s] %s", op.ErrorReason, op.Error)
+}
+
+// formatPatchDetails renders the patch type, apply options and document.
+func formatPatchDetails(op *storage.Operation) string {
+	if op == nil || len(op.PatchType) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  Patch: %s", op.PatchType)
+	if len(op.FieldManager) > 0 {
+		fmt.Fprintf(&b, " | Field manager: %s", op.FieldManager)
+	}
+	if op.Force != nil {
+		fmt.Fprintf(&b, " | Force: %t", *op.Force)
+	}
+	b.WriteString("\n")
+
+	if len(op.PatchData) > 0 {
+		fmt.Fprintf(&b, "  Sent: %s\n", truncateDisplay(op.PatchData))
+	}
+
+	return b.String()
+}
+
+// formatWriteDetails compares what a write sent with what the server stored,
+// and shows what changed from the object's prior state when it was recorded.
+func formatWriteDetails(op *storage.Operation) string {
+	if op == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	if len(op.RequestData) > 0 {
+		if len(op.ResourceData) == 0 {
+			fmt.Fprintf(&b, "  Sent: %s\n", truncateDisplay(op.RequestData))
+			b.WriteString("  Stored: nothing\n")
+		} else {
+			writeDiff(&b, "Sent vs stored", op.RequestData, op.ResourceData, "sent", "stored")
+		}
+	}
+
+	if len(op.PriorData) > 0 {
+		after := op.RequestData
+		if len(after) == 0 {
+			after = op.ResourceData
+		}
+		if len(after) == 0 {
+			fmt.Fprintf(&b, "  Prior: %s\n", truncateDisplay(op.PriorData))
+		} else {
+			writeDiff(&b, "Changes from prior", op.PriorData, after, "prior", "new")
+		}
+	}
+
+	return b.String()
+}
+
+// writeDiff renders the field changes between two payloads under title.
+// Payloads that cannot be compared are noted instead.
+// Rule 2: Bounded by maxDiffDisplayLines.
+func writeDiff(b *strings.Builder, title, before, after, beforeLabel, afterLabel string) {
+	changes, err := replay.DiffObjects(before, after)
+	if err != nil {
+		fmt.Fprintf(b, "  %s: not comparable (%v)\n", title, err)
+		return
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(b, "  %s: identical\n", title)
+		return
+	}
+
+	noun := "fields differ"
+	if len(changes) == 1 {
+		noun = "field differs"
+	}
+	fmt.Fprintf(b, "  %s: %d %s\n", title, len(changes), noun)
+	shown := len(changes)
+	if shown > maxDiffDisplayLines {
+		shown = maxDiffDisplayLines
+	}
+	for i := 0; i < shown; i++ {
+		fmt.Fprintf(b, "    %s: %s %s, %s %s\n",
+			changes[i].Path,
+			beforeLabel,
+			displayValue(changes[i].Before),
+			afterLabel,
+			displayValue(changes[i].After),
+		)
+	}
+	if shown < len(changes) {
+		fmt.Fprintf(b, "    ... %d more\n", len(changes)-shown)
+	}
+}
+
+func displayValue(value string) string {
+	if len(value) == 0 {
+		return "(absent)"
+	}
+	return truncateDisplay(value)
+}
+
+func truncateDisplay(value string) string {
+	if len(value) > maxPatchDisplayLength {
+		return value[:maxPatchDisplayLength] + "..."
+	}
+	return value
+}
+
+// formatListDetails renders the selectors, pagination and observed items of a LIST.
+func formatListDetails(op *storage.Operation) string {
+	if op == nil {
+		return ""
+	}
+	if op.OperationType != storage.OperationList && op.OperationType != storage.OperationCacheList {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  List: %d items | RV: %s", len(op.ListItems), op.ResourceVersion)
+	if len(op.LabelSelector) > 0 {
+		fmt.Fprintf(&b, " | Labels: %s", op.LabelSelector)
+	}
+	if len(op.FieldSelector) > 0 {
+		fmt.Fprintf(&b, " | Fields: %s", op.FieldSelector)
+	}
+	if op.Limit > 0 {
+		fmt.Fprintf(&b, " | Limit: %d", op.Limit)
+	}
+	if len(op.Continue) > 0 {
+		b.WriteString(" | Continued page")
+	}
+	b.WriteString("\n")
+
+	return b.String()
 }
 
 // displayStats shows operation statistics.
@@ -295,6 +503,9 @@ func displayStats(stats *replay.OperationStats) {
 	fmt.Printf("  Total Operations: %d\n", stats.TotalOps)
 	fmt.Printf("  GET: %d\n", stats.GetOps)
 	fmt.Printf("  UPDATE: %d\n", stats.UpdateOps)
+	fmt.Printf("  PATCH: %d\n", stats.PatchOps)
+	fmt.Printf("  WATCH events: %d\n", stats.WatchEvents)
+	fmt.Printf("  Kubernetes Events: %d (%d Warning)\n", stats.KubeEvents, stats.WarningEvents)
 	fmt.Printf("  CREATE: %d\n", stats.CreateOps)
 	fmt.Printf("  DELETE: %d\n", stats.DeleteOps)
 	fmt.Printf("  Errors: %d\n", stats.ErrorCount)
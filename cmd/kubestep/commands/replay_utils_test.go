@@ -92,3 +92,91 @@ func TestRunAutomaticReplayQuiet(t *testing.T) {
 
 	require.NoError(t, runAutomaticReplay(engine, true))
 }
+
+func TestFormatPatchDetails(t *testing.T) {
+	require.Empty(t, formatPatchDetails(&storage.Operation{OperationType: storage.OperationUpdate}))
+
+	op := &storage.Operation{
+		OperationType: storage.OperationPatch,
+		PatchType:     "application/apply-patch+yaml",
+		PatchData:     `{"spec":{"replicas":3}}`,
+		FieldManager:  "web-controller",
+	}
+	require.NotContains(t, formatPatchDetails(op), "Force", "force not sent is not shown")
+
+	forced := true
+	op.Force = &forced
+	out := formatPatchDetails(op)
+	require.Contains(t, out, "application/apply-patch+yaml")
+	require.Contains(t, out, "Field manager: web-controller")
+	require.Contains(t, out, "Force: true")
+	require.Contains(t, out, `{"spec":{"replicas":3}}`)
+}
+
+func TestFormatListDetails(t *testing.T) {
+	require.Empty(t, formatListDetails(&storage.Operation{OperationType: storage.OperationGet}))
+
+	op := &storage.Operation{
+		OperationType:   storage.OperationList,
+		ResourceVersion: "40",
+		LabelSelector:   "app=demo",
+		Limit:           100,
+		Continue:        "token-1",
+		ListItems: []storage.ListItem{
+			{UID: "uid-1", ResourceVersion: "12"},
+			{UID: "uid-2", ResourceVersion: "39"},
+		},
+	}
+	out := formatListDetails(op)
+	require.Contains(t, out, "2 items")
+	require.Contains(t, out, "RV: 40")
+	require.Contains(t, out, "Labels: app=demo")
+	require.Contains(t, out, "Limit: 100")
+	require.Contains(t, out, "Continued page")
+	require.NotContains(t, out, "Fields:")
+}
+
+func TestFormatWriteDetails(t *testing.T) {
+	require.Empty(t, formatWriteDetails(&storage.Operation{OperationType: storage.OperationGet}))
+
+	op := &storage.Operation{
+		OperationType: storage.OperationUpdate,
+		RequestData:   `{"metadata":{"name":"web"},"spec":{"replicas":3}}`,
+		ResourceData:  `{"metadata":{"name":"web","resourceVersion":"7"},"spec":{"replicas":5}}`,
+		PriorData:     `{"metadata":{"name":"web","resourceVersion":"6"},"spec":{"replicas":1}}`,
+	}
+	out := formatWriteDetails(op)
+	require.Contains(t, out, "Sent vs stored: 1 field differs")
+	require.Contains(t, out, "spec.replicas: sent 3, stored 5")
+	require.Contains(t, out, "spec.replicas: prior 1, new 3")
+	require.NotContains(t, out, "resourceVersion")
+
+	op.ResourceData = ""
+	op.Error = "conflict"
+	out = formatWriteDetails(op)
+	require.Contains(t, out, `Sent: {"metadata":{"name":"web"},"spec":{"replicas":3}}`)
+	require.Contains(t, out, "Stored: nothing")
+}
+
+func TestFormatError(t *testing.T) {
+	require.Equal(t, "boom", formatError(&storage.Operation{Error: "boom"}))
+	require.Equal(t, "[Conflict 409] modified", formatError(&storage.Operation{
+		Error:       "modified",
+		ErrorCode:   409,
+		ErrorReason: "Conflict",
+	}))
+}
+
+func TestFormatKubeEvent(t *testing.T) {
+	require.Empty(t, formatKubeEvent(&storage.Operation{OperationType: storage.OperationWatch}))
+
+	out := formatKubeEvent(&storage.Operation{
+		OperationType:   storage.OperationEvent,
+		EventType:       storage.EventTypeWarning,
+		EventReason:     "FailedCreate",
+		EventMessage:    "quota exceeded",
+		ResourceVersion: "42",
+		UID:             "uid-web",
+	})
+	require.Equal(t, "  Warning FailedCreate | RV: 42 | UID: uid-web\n  Message: quota exceeded\n", out)
+}
@@ -0,0 +1,606 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	sessionTimeFormat = "2006-01-02 15:04:05"
+	maxActorsShown    = 3
+)
+
+// Session sort keys accepted by --sort.
+const (
+	sortByStart    = "start"
+	sortByEnd      = "end"
+	sortByDuration = "duration"
+	sortByOps      = "ops"
+	sortBySpans    = "spans"
+	sortByErrors   = "errors"
+	sortByID       = "id"
+)
+
+// SessionsConfig holds sessions command configuration.
+type SessionsConfig struct {
+	DatabasePath  string
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
+	// Operator, Cluster and Status keep sessions whose metadata matches.
+	Operator string
+	Cluster  string
+	Status   string
+	// Labels keeps sessions carrying every key=value pair.
+	Labels []string
+	// Since keeps sessions started at or after a time, given as a duration
+	// before now (24h), an RFC 3339 time or a date.
+	Since     string
+	Actor     string
+	HasErrors bool
+	// Sort orders by start, end, duration, ops, spans, errors or id. Times
+	// and counts sort largest first, IDs alphabetically; Reverse flips it.
+	Sort    string
+	Reverse bool
+	// Format is table, json, yaml or csv.
+	Format string
+}
+
+// JSONSession is one session in json, yaml and csv output.
+type JSONSession struct {
+	ID                 string            `json:"id"`
+	Start              string            `json:"start,omitempty"`
+	End                string            `json:"end,omitempty"`
+	DurationSeconds    int64             `json:"duration_seconds"`
+	Operations         int64             `json:"operations"`
+	Spans              int64             `json:"spans"`
+	Errors             int64             `json:"errors"`
+	Actors             []string          `json:"actors,omitempty"`
+	Status             string            `json:"status,omitempty"`
+	Description        string            `json:"description,omitempty"`
+	OperatorName       string            `json:"operator_name,omitempty"`
+	OperatorVersion    string            `json:"operator_version,omitempty"`
+	GitSHA             string            `json:"git_sha,omitempty"`
+	ClusterName        string            `json:"cluster_name,omitempty"`
+	KubernetesVersion  string            `json:"kubernetes_version,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	DroppedOperations  int64             `json:"dropped_operations,omitempty"`
+	FilteredOperations int64             `json:"filtered_operations,omitempty"`
+}
+
+// sessionFilter is the parsed form of the sessions command filters.
+type sessionFilter struct {
+	operator  string
+	cluster   string
+	status    string
+	labels    map[string]string
+	since     time.Time
+	actor     string
+	hasErrors bool
+}
+
+// NewSessionsCommand creates the sessions subcommand.
+func NewSessionsCommand() *cobra.Command {
+	cfg := &SessionsConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "List recorded sessions",
+		Long: `Display recorded sessions with their time range, operation, span and
+error counts and the actors that recorded them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessions(cfg)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&cfg.Operator,
+		"operator",
+		"",
+		"Only sessions recorded by this operator",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Cluster,
+		"cluster",
+		"",
+		"Only sessions recorded on this cluster",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Status,
+		"status",
+		"",
+		"Only sessions in this state: running, completed, failed or aborted",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&cfg.Labels,
+		"label",
+		nil,
+		"Only sessions with this key=value label (repeatable)",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Since,
+		"since",
+		"",
+		"Only sessions started since a duration ago (24h), an RFC 3339 time or a date",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Actor,
+		"actor",
+		"",
+		"Only sessions with operations recorded by this actor",
+	)
+
+	cmd.Flags().BoolVar(
+		&cfg.HasErrors,
+		"has-errors",
+		false,
+		"Only sessions with failed operations",
+	)
+
+	cmd.Flags().StringVar(
+		&cfg.Sort,
+		"sort",
+		sortByStart,
+		"Sort by start, end, duration, ops, spans, errors or id",
+	)
+
+	cmd.Flags().BoolVar(
+		&cfg.Reverse,
+		"reverse",
+		false,
+		"Reverse the sort order",
+	)
+
+	cmd.Flags().StringVarP(
+		&cfg.Format,
+		"format",
+		"o",
+		"table",
+		"Output format: table, json, yaml or csv",
+	)
+
+	addStorageFlags(
+		cmd,
+		&cfg.DatabasePath,
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
+	)
+
+	return cmd
+}
+
+// runSessions lists the recorded sessions matching the filters.
+// Rule 2: Bounded by the store's session limit.
+func runSessions(cfg *SessionsConfig) error {
+	err := assert.AssertNotNil(cfg, "config")
+	if err != nil {
+		return err
+	}
+
+	err = validateSessionsConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	filter, err := newSessionFilter(cfg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg.storageOptions())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := store.Close()
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close storage: %v\n", closeErr)
+		}
+	}()
+
+	sessions, err := store.ListSessions()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions = filterSessions(sessions, filter)
+	sortSessions(sessions, cfg.Sort, cfg.Reverse)
+
+	if cfg.format() == "table" && len(sessions) == 0 {
+		fmt.Println("No sessions recorded")
+		return nil
+	}
+
+	out, err := formatSessions(sessions, cfg.format())
+	if err != nil {
+		return err
+	}
+
+	if cfg.format() == "table" {
+		fmt.Println("Available Sessions:")
+		fmt.Println("(Use 'kubestep replay <session-id>' to replay)")
+		fmt.Println()
+	}
+	fmt.Print(out)
+	return nil
+}
+
+// validateSessionsConfig checks the format, sort key and status filter.
+// Rule 5: Multiple assertions for validation.
+func validateSessionsConfig(cfg *SessionsConfig) error {
+	switch cfg.format() {
+	case "table", "json", "yaml", "csv":
+	default:
+		return fmt.Errorf("invalid format: %s (must be table, json, yaml or csv)", cfg.Format)
+	}
+
+	switch cfg.Sort {
+	case "", sortByStart, sortByEnd, sortByDuration, sortByOps, sortBySpans, sortByErrors, sortByID:
+	default:
+		return fmt.Errorf("invalid sort key: %s", cfg.Sort)
+	}
+
+	switch storage.SessionStatus(cfg.Status) {
+	case "", storage.SessionRunning, storage.SessionCompleted, storage.SessionFailed, storage.SessionAborted:
+	default:
+		return fmt.Errorf("invalid status: %s", cfg.Status)
+	}
+
+	return nil
+}
+
+// format returns the output format, table when unset.
+func (cfg *SessionsConfig) format() string {
+	if len(cfg.Format) == 0 {
+		return "table"
+	}
+	return cfg.Format
+}
+
+// newSessionFilter parses the filters of cfg. now anchors --since
+// durations.
+func newSessionFilter(cfg *SessionsConfig, now time.Time) (*sessionFilter, error) {
+	labels, err := parseLabelFilters(cfg.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &sessionFilter{
+		operator:  cfg.Operator,
+		cluster:   cfg.Cluster,
+		status:    cfg.Status,
+		labels:    labels,
+		actor:     cfg.Actor,
+		hasErrors: cfg.HasErrors,
+	}
+
+	if len(cfg.Since) > 0 {
+		filter.since, err = parseSince(cfg.Since, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return filter, nil
+}
+
+// parseSince reads a duration before now, an RFC 3339 time or a date.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid --since %q: duration must be positive", value)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.UTC); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: want a duration, RFC 3339 time or date", value)
+}
+
+// parseLabelFilters parses key=value label filters.
+// Rule 2: Bounded by the number of flags given.
+func parseLabelFilters(values []string) (map[string]string, error) {
+	labels := make(map[string]string, len(values))
+	for i := 0; i < len(values); i++ {
+		key, value, ok := strings.Cut(values[i], "=")
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("invalid label filter %q: want key=value", values[i])
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// filterSessions keeps the sessions matching every filter.
+// Rule 2: Bounded by the listed sessions.
+func filterSessions(sessions []storage.SessionInfo, filter *sessionFilter) []storage.SessionInfo {
+	out := make([]storage.SessionInfo, 0, len(sessions))
+	for i := 0; i < len(sessions); i++ {
+		if filter.matches(sessions[i]) {
+			out = append(out, sessions[i])
+		}
+	}
+	return out
+}
+
+// matches reports whether session satisfies the filter. Metadata filters
+// never match a session without metadata.
+func (f *sessionFilter) matches(session storage.SessionInfo) bool {
+	if !f.since.IsZero() && session.StartTime < f.since.Unix() {
+		return false
+	}
+	if f.hasErrors && session.ErrorCount == 0 {
+		return false
+	}
+	if len(f.actor) > 0 && !containsActor(session.Actors, f.actor) {
+		return false
+	}
+
+	metaFiltered := len(f.operator) > 0 || len(f.cluster) > 0 || len(f.status) > 0 || len(f.labels) > 0
+	meta := session.Meta
+	if meta == nil {
+		return !metaFiltered
+	}
+
+	if len(f.operator) > 0 && meta.OperatorName != f.operator {
+		return false
+	}
+	if len(f.cluster) > 0 && meta.ClusterName != f.cluster {
+		return false
+	}
+	if len(f.status) > 0 && string(meta.Status) != f.status {
+		return false
+	}
+	for key, value := range f.labels {
+		if got, ok := meta.Labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// containsActor reports whether actors holds actor.
+func containsActor(actors []string, actor string) bool {
+	for i := 0; i < len(actors); i++ {
+		if actors[i] == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// sortSessions orders sessions by key. Ties keep the store's order.
+func sortSessions(sessions []storage.SessionInfo, key string, reverse bool) {
+	less := func(a, b storage.SessionInfo) bool {
+		switch key {
+		case sortByEnd:
+			return a.EndTime > b.EndTime
+		case sortByDuration:
+			return sessionDuration(a) > sessionDuration(b)
+		case sortByOps:
+			return a.OpCount > b.OpCount
+		case sortBySpans:
+			return a.SpanCount > b.SpanCount
+		case sortByErrors:
+			return a.ErrorCount > b.ErrorCount
+		case sortByID:
+			return a.SessionID < b.SessionID
+		default:
+			return a.StartTime > b.StartTime
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if reverse {
+			return less(sessions[j], sessions[i])
+		}
+		return less(sessions[i], sessions[j])
+	})
+}
+
+// sessionDuration returns the time between a session's first and last
+// operation.
+func sessionDuration(session storage.SessionInfo) time.Duration {
+	if session.StartTime == 0 || session.EndTime < session.StartTime {
+		return 0
+	}
+	return time.Duration(session.EndTime-session.StartTime) * time.Second
+}
+
+// formatSessions renders sessions as a table, json, yaml or csv.
+func formatSessions(sessions []storage.SessionInfo, format string) (string, error) {
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(jsonSessions(sessions), "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("JSON encoding failed: %w", err)
+		}
+		return string(out) + "\n", nil
+	case "yaml":
+		out, err := yaml.Marshal(jsonSessions(sessions))
+		if err != nil {
+			return "", fmt.Errorf("YAML encoding failed: %w", err)
+		}
+		return string(out), nil
+	case "csv":
+		return formatSessionsCSV(jsonSessions(sessions))
+	default:
+		return formatSessionsTable(sessions)
+	}
+}
+
+// formatSessionsTable renders one aligned row per session.
+func formatSessionsTable(sessions []storage.SessionInfo) (string, error) {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tSTART\tEND\tDURATION\tOPS\tSPANS\tERRORS\tSTATUS\tACTORS")
+	for i := 0; i < len(sessions); i++ {
+		session := sessions[i]
+		status := "-"
+		if session.Meta != nil {
+			status = valueOrDash(string(session.Meta.Status))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			session.SessionID,
+			formatSessionTime(session.StartTime, sessionTimeFormat),
+			formatSessionTime(session.EndTime, sessionTimeFormat),
+			sessionDuration(session),
+			session.OpCount,
+			session.SpanCount,
+			session.ErrorCount,
+			status,
+			formatActors(session.Actors),
+		)
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return "", fmt.Errorf("failed to format sessions: %w", err)
+	}
+	return b.String(), nil
+}
+
+// formatSessionsCSV renders a header row and one row per session. Actors
+// and labels are joined with semicolons.
+func formatSessionsCSV(sessions []JSONSession) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	err := w.Write([]string{
+		"id", "start", "end", "duration_seconds", "operations", "spans", "errors",
+		"actors", "status", "operator_name", "operator_version", "cluster_name", "labels",
+	})
+	if err != nil {
+		return "", fmt.Errorf("CSV encoding failed: %w", err)
+	}
+
+	for i := 0; i < len(sessions); i++ {
+		s := sessions[i]
+		err = w.Write([]string{
+			s.ID,
+			s.Start,
+			s.End,
+			strconv.FormatInt(s.DurationSeconds, 10),
+			strconv.FormatInt(s.Operations, 10),
+			strconv.FormatInt(s.Spans, 10),
+			strconv.FormatInt(s.Errors, 10),
+			strings.Join(s.Actors, ";"),
+			s.Status,
+			s.OperatorName,
+			s.OperatorVersion,
+			s.ClusterName,
+			formatLabels(s.Labels),
+		})
+		if err != nil {
+			return "", fmt.Errorf("CSV encoding failed: %w", err)
+		}
+	}
+
+	w.Flush()
+	err = w.Error()
+	if err != nil {
+		return "", fmt.Errorf("CSV encoding failed: %w", err)
+	}
+	return b.String(), nil
+}
+
+// jsonSessions converts sessions for structured output.
+func jsonSessions(sessions []storage.SessionInfo) []JSONSession {
+	out := make([]JSONSession, 0, len(sessions))
+	for i := 0; i < len(sessions); i++ {
+		session := sessions[i]
+		entry := JSONSession{
+			ID:              session.SessionID,
+			Start:           formatSessionTime(session.StartTime, time.RFC3339),
+			End:             formatSessionTime(session.EndTime, time.RFC3339),
+			DurationSeconds: int64(sessionDuration(session) / time.Second),
+			Operations:      session.OpCount,
+			Spans:           session.SpanCount,
+			Errors:          session.ErrorCount,
+			Actors:          session.Actors,
+			Description:     session.Description,
+		}
+		if meta := session.Meta; meta != nil {
+			entry.Status = string(meta.Status)
+			entry.OperatorName = meta.OperatorName
+			entry.OperatorVersion = meta.OperatorVersion
+			entry.GitSHA = meta.GitSHA
+			entry.ClusterName = meta.ClusterName
+			entry.KubernetesVersion = meta.KubernetesVersion
+			entry.Labels = meta.Labels
+			entry.DroppedOperations = meta.DroppedOperations
+			entry.FilteredOperations = meta.FilteredOperations
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// formatSessionTime renders a Unix time in UTC, or "" when unset.
+func formatSessionTime(unix int64, layout string) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).UTC().Format(layout)
+}
+
+// formatActors lists up to maxActorsShown actors.
+func formatActors(actors []string) string {
+	if len(actors) == 0 {
+		return "-"
+	}
+	if len(actors) <= maxActorsShown {
+		return strings.Join(actors, ",")
+	}
+	return fmt.Sprintf("%s,+%d", strings.Join(actors[:maxActorsShown], ","), len(actors)-maxActorsShown)
+}
+
+// formatLabels renders labels as sorted key=value pairs.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// valueOrDash returns value, or "-" when it is empty.
+func valueOrDash(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
+
+// storageOptions returns the storage flags of the sessions command.
+func (cfg *SessionsConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+		ReadOnly:      true,
+	}
+}
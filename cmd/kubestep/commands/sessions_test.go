@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func testSessionInfos() []storage.SessionInfo {
+	return []storage.SessionInfo{
+		{SessionID: "bare", StartTime: 1700000000, EndTime: 1700000060, OpCount: 5, Actors: []string{"ctrl-a"}},
+		{SessionID: "prod", StartTime: 1700003600, EndTime: 1700007200, OpCount: 50, SpanCount: 4, ErrorCount: 3,
+			Actors: []string{"ctrl-a", "ctrl-b"},
+			Meta: &storage.Session{
+				OperatorName: "widget-operator",
+				ClusterName:  "prod",
+				Status:       storage.SessionCompleted,
+				Labels:       map[string]string{"env": "prod", "team": "a"},
+			}},
+		{SessionID: "kind", StartTime: 1700010000, EndTime: 1700010010, OpCount: 2,
+			Actors: []string{"ctrl-b"},
+			Meta: &storage.Session{
+				OperatorName: "widget-operator",
+				ClusterName:  "kind",
+				Status:       storage.SessionRunning,
+			}},
+	}
+}
+
+func TestFilterSessions(t *testing.T) {
+	now := time.Unix(1700010000, 0)
+	ids := func(cfg *SessionsConfig) []string {
+		filter, err := newSessionFilter(cfg, now)
+		require.NoError(t, err)
+		out := []string{}
+		for _, s := range filterSessions(testSessionInfos(), filter) {
+			out = append(out, s.SessionID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"bare", "prod", "kind"}, ids(&SessionsConfig{}))
+	assert.Equal(t, []string{"prod", "kind"}, ids(&SessionsConfig{Operator: "widget-operator"}))
+	assert.Equal(t, []string{"kind"}, ids(&SessionsConfig{Cluster: "kind"}))
+	assert.Equal(t, []string{"prod"}, ids(&SessionsConfig{Status: "completed"}))
+	assert.Equal(t, []string{"prod"}, ids(&SessionsConfig{Labels: []string{"env=prod", "team=a"}}))
+	assert.Empty(t, ids(&SessionsConfig{Labels: []string{"env=dev"}}))
+	assert.Equal(t, []string{"prod"}, ids(&SessionsConfig{HasErrors: true}))
+	assert.Equal(t, []string{"prod", "kind"}, ids(&SessionsConfig{Actor: "ctrl-b"}))
+	assert.Equal(t, []string{"prod", "kind"}, ids(&SessionsConfig{Since: "2h"}))
+	assert.Equal(t, []string{"kind"}, ids(&SessionsConfig{Since: "2023-11-15T01:00:00Z"}))
+	assert.Equal(t, []string{"bare", "prod", "kind"}, ids(&SessionsConfig{Since: "2023-11-14"}))
+
+	_, err := newSessionFilter(&SessionsConfig{Labels: []string{"env"}}, now)
+	require.Error(t, err)
+	_, err = newSessionFilter(&SessionsConfig{Since: "yesterday"}, now)
+	require.Error(t, err)
+}
+
+func TestSortSessions(t *testing.T) {
+	order := func(key string, reverse bool) []string {
+		sessions := testSessionInfos()
+		sortSessions(sessions, key, reverse)
+		out := []string{}
+		for _, s := range sessions {
+			out = append(out, s.SessionID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"kind", "prod", "bare"}, order(sortByStart, false))
+	assert.Equal(t, []string{"bare", "prod", "kind"}, order(sortByStart, true))
+	assert.Equal(t, []string{"prod", "bare", "kind"}, order(sortByDuration, false))
+	assert.Equal(t, []string{"prod", "bare", "kind"}, order(sortByOps, false))
+	assert.Equal(t, []string{"prod", "bare", "kind"}, order(sortByErrors, false))
+	assert.Equal(t, []string{"bare", "kind", "prod"}, order(sortByID, false))
+}
+
+func TestFormatSessions(t *testing.T) {
+	sessions := testSessionInfos()
+
+	out, err := formatSessions(sessions, "table")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "SESSION")
+	assert.Contains(t, lines[0], "ACTORS")
+	assert.Contains(t, lines[2], "1h0m0s")
+	assert.Contains(t, lines[2], "completed")
+	assert.Contains(t, lines[2], "ctrl-a,ctrl-b")
+
+	out, err = formatSessions(sessions, "json")
+	require.NoError(t, err)
+	var decoded []JSONSession
+	require.NoError(t, json.Unmarshal([]byte(out), &decoded))
+	require.Len(t, decoded, 3)
+	assert.Equal(t, "prod", decoded[1].ID)
+	assert.Equal(t, int64(3600), decoded[1].DurationSeconds)
+	assert.Equal(t, int64(4), decoded[1].Spans)
+	assert.Equal(t, "widget-operator", decoded[1].OperatorName)
+	assert.Equal(t, "2023-11-14T22:13:20Z", decoded[0].Start)
+
+	out, err = formatSessions(sessions, "yaml")
+	require.NoError(t, err)
+	decoded = nil
+	require.NoError(t, yaml.Unmarshal([]byte(out), &decoded))
+	require.Len(t, decoded, 3)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "a"}, decoded[1].Labels)
+
+	out, err = formatSessions(sessions, "csv")
+	require.NoError(t, err)
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "id", records[0][0])
+	assert.Equal(t, "ctrl-a;ctrl-b", records[2][7])
+	assert.Equal(t, "env=prod;team=a", records[2][12])
+}
+
+func TestRunSessionsFormatsAndValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	db, err := storage.NewDatabase(path, testMaxOps)
+	require.NoError(t, err)
+	require.NoError(t, db.InsertOperation(&storage.Operation{
+		SessionID:      "failing",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  storage.OperationUpdate,
+		ResourceKind:   "Pod",
+		Name:           "demo",
+		ActorID:        "ctrl",
+		Error:          "conflict",
+	}))
+	require.NoError(t, db.Close())
+
+	for _, format := range []string{"table", "json", "yaml", "csv"} {
+		require.NoError(t, runSessions(&SessionsConfig{
+			DatabasePath: path,
+			Format:       format,
+			HasErrors:    true,
+			Actor:        "ctrl",
+			Sort:         sortByErrors,
+		}))
+	}
+
+	require.Error(t, runSessions(&SessionsConfig{DatabasePath: path, Format: "xml"}))
+	require.Error(t, runSessions(&SessionsConfig{DatabasePath: path, Sort: "size"}))
+	require.Error(t, runSessions(&SessionsConfig{DatabasePath: path, Status: "paused"}))
+}
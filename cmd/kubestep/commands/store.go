@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultMongoURI      = "mongodb://localhost:27017"
+	defaultMongoDatabase = "kubestep"
+	maxStoreOperations   = 1000000
+)
+
+// StorageOptions selects the storage backend a command reads from.
+type StorageOptions struct {
+	DatabasePath  string
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
+	// ReadOnly is set by commands that never write, so they can run while
+	// a recording writes the same segment directory.
+	ReadOnly bool
+}
+
+// addStorageFlags registers the storage flags shared by every command.
+func addStorageFlags(
+	cmd *cobra.Command,
+	databasePath *string,
+	storageType *string,
+	mongoURI *string,
+	mongoDatabase *string,
+) {
+	cmd.Flags().StringVarP(
+		databasePath,
+		"database",
+		"d",
+		defaultDatabasePath,
+		"Path to SQLite database, or the recording directory with --storage segment",
+	)
+
+	cmd.Flags().StringVar(
+		storageType,
+		"storage",
+		storage.StorageSQLite,
+		"Storage backend: sqlite, mongodb or segment",
+	)
+
+	cmd.Flags().StringVar(
+		mongoURI,
+		"mongo-uri",
+		defaultMongoURI,
+		"MongoDB connection URI",
+	)
+
+	cmd.Flags().StringVar(
+		mongoDatabase,
+		"mongo-db",
+		defaultMongoDatabase,
+		"MongoDB database name",
+	)
+}
+
+// validateStorageOptions checks the settings the selected backend needs.
+// An empty storage type means SQLite.
+func validateStorageOptions(opts StorageOptions) error {
+	switch opts.StorageType {
+	case "", storage.StorageSQLite, storage.StorageSegment, storage.StorageFile:
+		return assert.AssertStringNotEmpty(opts.DatabasePath, "database path")
+	case storage.StorageMongoDB:
+		err := assert.AssertStringNotEmpty(opts.MongoURI, "mongo URI")
+		if err != nil {
+			return err
+		}
+		return assert.AssertStringNotEmpty(opts.MongoDatabase, "mongo database")
+	default:
+		return fmt.Errorf("invalid storage type: %s (must be 'sqlite', 'mongodb' or 'segment')", opts.StorageType)
+	}
+}
+
+// createStorageConfig maps command options to a storage config.
+func createStorageConfig(opts StorageOptions) storage.StorageConfig {
+	storeCfg := storage.StorageConfig{
+		Type:          opts.StorageType,
+		MaxOperations: maxStoreOperations,
+		ReadOnly:      opts.ReadOnly,
+	}
+
+	if len(storeCfg.Type) == 0 {
+		storeCfg.Type = storage.StorageSQLite
+	}
+
+	if storeCfg.Type == storage.StorageFile {
+		storeCfg.Type = storage.StorageSegment
+	}
+
+	if storeCfg.Type == storage.StorageSQLite || storeCfg.Type == storage.StorageSegment {
+		storeCfg.ConnectionURI = opts.DatabasePath
+	} else if storeCfg.Type == storage.StorageMongoDB {
+		storeCfg.ConnectionURI = opts.MongoURI
+		storeCfg.DatabaseName = opts.MongoDatabase
+		storeCfg.CollectionName = "operations"
+	}
+
+	return storeCfg
+}
+
+// openStore validates opts and opens the selected backend.
+func openStore(opts StorageOptions) (storage.OperationStore, error) {
+	err := validateStorageOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := storage.NewOperationStore(createStorageConfig(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage: %w", err)
+	}
+
+	return store, nil
+}
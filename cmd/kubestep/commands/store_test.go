@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStorageOptions(t *testing.T) {
+	require.NoError(t, validateStorageOptions(StorageOptions{DatabasePath: "db"}))
+	require.NoError(t, validateStorageOptions(StorageOptions{
+		StorageType:   storage.StorageMongoDB,
+		MongoURI:      defaultMongoURI,
+		MongoDatabase: defaultMongoDatabase,
+	}))
+
+	require.Error(t, validateStorageOptions(StorageOptions{StorageType: storage.StorageSQLite}))
+	require.Error(t, validateStorageOptions(StorageOptions{StorageType: storage.StorageMongoDB}))
+	require.NoError(t, validateStorageOptions(StorageOptions{StorageType: storage.StorageFile, DatabasePath: "rec"}))
+	require.Error(t, validateStorageOptions(StorageOptions{StorageType: storage.StorageSegment}))
+	require.Error(t, validateStorageOptions(StorageOptions{StorageType: "etcd", DatabasePath: "db"}))
+}
+
+func TestCreateStorageConfig(t *testing.T) {
+	cfg := createStorageConfig(StorageOptions{DatabasePath: "rec.db"})
+	require.Equal(t, storage.StorageSQLite, cfg.Type)
+	require.Equal(t, "rec.db", cfg.ConnectionURI)
+
+	cfg = createStorageConfig(StorageOptions{
+		StorageType:   storage.StorageMongoDB,
+		MongoURI:      "mongodb://db:27017",
+		MongoDatabase: "recordings",
+	})
+	require.Equal(t, "mongodb://db:27017", cfg.ConnectionURI)
+	require.Equal(t, "recordings", cfg.DatabaseName)
+	require.Equal(t, "operations", cfg.CollectionName)
+
+	cfg = createStorageConfig(StorageOptions{StorageType: storage.StorageFile, DatabasePath: "recordings"})
+	require.Equal(t, storage.StorageSegment, cfg.Type)
+	require.Equal(t, "recordings", cfg.ConnectionURI)
+}
+
+func TestEveryCommandHasStorageFlags(t *testing.T) {
+	cmds := []*cobra.Command{
+		NewReplayCommand(),
+		NewAnalyzeCommand(),
+		NewCausalityCommand(),
+		NewSessionsCommand(),
+		NewVerifyCommand(),
+		NewRecordCommand(),
+		NewImportAuditCommand(),
+	}
+	for _, cmd := range cmds {
+		for _, flag := range []string{"database", "storage", "mongo-uri", "mongo-db"} {
+			require.NotNil(t, cmd.Flags().Lookup(flag), "%s is missing --%s", cmd.Name(), flag)
+		}
+	}
+}
+
+func TestRunSessionsAndReplayThroughStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	db, err := storage.NewDatabase(path, testMaxOps)
+	require.NoError(t, err)
+	require.NoError(t, db.InsertOperation(&storage.Operation{
+		SessionID:      "listed-session",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  storage.OperationGet,
+		ResourceKind:   "Pod",
+		Namespace:      "default",
+		Name:           "demo",
+		ResourceData:   `{}`,
+	}))
+	require.NoError(t, db.BeginSession(&storage.Session{ID: "listed-session", OperatorName: "demo"}))
+	require.NoError(t, db.Close())
+
+	require.NoError(t, runSessions(&SessionsConfig{DatabasePath: path}))
+	require.NoError(t, runSessions(&SessionsConfig{DatabasePath: path, Operator: "demo"}))
+	require.Error(t, runSessions(&SessionsConfig{DatabasePath: path, Labels: []string{"bad"}}))
+	require.NoError(t, runReplay(&ReplayConfig{DatabasePath: path, Quiet: true}, []string{"listed-session"}))
+	require.NoError(t, runVerify(&VerifyConfig{DatabasePath: path}))
+}
+
+func TestRunCommandsOnSegmentStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "recordings")
+	store, err := storage.NewSegmentStore(storage.StorageConfig{ConnectionURI: dir, MaxOperations: testMaxOps})
+	require.NoError(t, err)
+	require.NoError(t, store.BeginSession(&storage.Session{ID: "segment-session", OperatorName: "demo"}))
+	require.NoError(t, store.InsertOperation(&storage.Operation{
+		SessionID:      "segment-session",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  storage.OperationGet,
+		ResourceKind:   "Pod",
+		Namespace:      "default",
+		Name:           "demo",
+		ResourceData:   `{}`,
+	}))
+	require.NoError(t, store.EndSession("segment-session", storage.SessionCompleted))
+	require.NoError(t, store.Close())
+
+	segment := storage.StorageSegment
+	require.NoError(t, runSessions(&SessionsConfig{DatabasePath: dir, StorageType: segment, Operator: "demo"}))
+	require.NoError(t, runReplay(&ReplayConfig{DatabasePath: dir, StorageType: segment, Quiet: true},
+		[]string{"segment-session"}))
+	require.NoError(t, runVerify(&VerifyConfig{DatabasePath: dir, StorageType: segment}))
+}
@@ -10,8 +10,11 @@ import (
 
 // VerifyConfig holds verify command configuration.
 type VerifyConfig struct {
-	DatabasePath string
-	Strict       bool
+	DatabasePath  string
+	Strict        bool
+	StorageType   string
+	MongoURI      string
+	MongoDatabase string
 }
 
 // NewVerifyCommand creates the verify subcommand.
@@ -22,18 +25,19 @@ func NewVerifyCommand() *cobra.Command {
 		Use:   "verify",
 		Short: "Verify database integrity",
 		Long: `Verify database schema and data consistency.
-Reports missing columns, sequence gaps, and span anomalies.`,
+Reports missing columns, sequence gaps, and span anomalies.
+Schema checks apply to SQLite only.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runVerify(cfg)
 		},
 	}
 
-	cmd.Flags().StringVarP(
+	addStorageFlags(
+		cmd,
 		&cfg.DatabasePath,
-		"database",
-		"d",
-		defaultDatabasePath,
-		"Path to SQLite database",
+		&cfg.StorageType,
+		&cfg.MongoURI,
+		&cfg.MongoDatabase,
 	)
 
 	cmd.Flags().BoolVar(
@@ -52,17 +56,22 @@ func runVerify(cfg *VerifyConfig) error {
 		return err
 	}
 
-	err = assert.AssertStringNotEmpty(cfg.DatabasePath, "database path")
+	opts := cfg.storageOptions()
+	err = validateStorageOptions(opts)
 	if err != nil {
 		return err
 	}
 
-	result, err := storage.VerifySQLite(cfg.DatabasePath, cfg.Strict)
+	result, err := verifyStorage(opts, cfg.Strict)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Database: %s\n", cfg.DatabasePath)
+	if cfg.StorageType == storage.StorageMongoDB {
+		fmt.Printf("Database: %s/%s\n", cfg.MongoURI, cfg.MongoDatabase)
+	} else {
+		fmt.Printf("Database: %s\n", cfg.DatabasePath)
+	}
 	fmt.Printf("Sessions: %d\n", result.Stats.Sessions)
 	fmt.Printf("Operations: %d\n", result.Stats.Operations)
 	if result.Stats.Spans > 0 {
@@ -87,3 +96,35 @@ func runVerify(cfg *VerifyConfig) error {
 	fmt.Println("\nVerify OK")
 	return nil
 }
+
+// verifyStorage runs the full SQLite verification, or the data checks
+// through the store for other backends.
+func verifyStorage(opts StorageOptions, strict bool) (*storage.VerifyResult, error) {
+	if opts.StorageType == "" || opts.StorageType == storage.StorageSQLite {
+		return storage.VerifySQLite(opts.DatabasePath, strict)
+	}
+
+	store, err := openStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := store.Close()
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close storage: %v\n", closeErr)
+		}
+	}()
+
+	return storage.VerifyStore(store)
+}
+
+// storageOptions returns the storage flags of the verify command.
+func (cfg *VerifyConfig) storageOptions() StorageOptions {
+	return StorageOptions{
+		DatabasePath:  cfg.DatabasePath,
+		StorageType:   cfg.StorageType,
+		MongoURI:      cfg.MongoURI,
+		MongoDatabase: cfg.MongoDatabase,
+		ReadOnly:      true,
+	}
+}
@@ -47,6 +47,8 @@ Helps debug operator behavior by capturing all API interactions.`,
 	rootCmd.AddCommand(commands.NewAnalyzeCommand())
 	rootCmd.AddCommand(commands.NewSessionsCommand())
 	rootCmd.AddCommand(commands.NewVerifyCommand())
+	rootCmd.AddCommand(commands.NewImportCommand())
+	rootCmd.AddCommand(commands.NewExportCommand())
 
 	return rootCmd
 }
@@ -39,7 +39,11 @@ func main() {
 		return
 	}
 
-	db, err := storage.NewDatabase("operator_recordings.db", 1000000)
+	db, err := storage.NewOperationStore(storage.StorageConfig{
+		Type:          storage.StorageSQLite,
+		ConnectionURI: "operator_recordings.db",
+		MaxOperations: 1000000,
+	})
 	if err != nil {
 		fmt.Printf("Failed to create database: %v\n", err)
 		return
@@ -2,6 +2,7 @@ package analysis
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/slyt3/kubestep/internal/assert"
@@ -211,8 +212,35 @@ func FindSlowOperations(
 type ErrorSummary struct {
 	TotalErrors  int
 	ErrorsByType map[string]int
-	FirstError   *storage.Operation
-	LastError    *storage.Operation
+	// Reasons groups errors by API StatusReason, most frequent first.
+	// Errors recorded without an API status are grouped under ReasonNone.
+	Reasons    []ReasonSummary
+	FirstError *storage.Operation
+	LastError  *storage.Operation
+}
+
+// ReasonNone groups errors that carry no API status, such as client-side
+// timeouts or operations recorded before reasons were stored.
+const ReasonNone = "None"
+
+const (
+	maxErrorReasons      = 50
+	maxReasonCauseFields = 10
+)
+
+// ReasonSummary aggregates the errors that share one StatusReason.
+type ReasonSummary struct {
+	Reason string
+	// Code is the HTTP status code of the first error with this reason.
+	Code  int32
+	Count int
+	// MaxRetryAfterSeconds is the longest retry delay the server asked for.
+	MaxRetryAfterSeconds int32
+	// Fields lists the distinct fields named in error causes, in order of
+	// first appearance.
+	Fields []string
+	// Example is the message of the first error with this reason.
+	Example string
 }
 
 // AnalyzeErrors summarizes all errors in operations.
@@ -231,6 +259,7 @@ func AnalyzeErrors(ops []storage.Operation) (*ErrorSummary, error) {
 	summary := &ErrorSummary{
 		ErrorsByType: make(map[string]int, 20),
 	}
+	reasons := make(map[string]*ReasonSummary, maxErrorReasons)
 
 	maxErrorTypes := 20
 	i := 0
@@ -251,13 +280,75 @@ func AnalyzeErrors(ops []storage.Operation) (*ErrorSummary, error) {
 				summary.ErrorsByType[errorType] =
 					summary.ErrorsByType[errorType] + 1
 			}
+
+			addErrorReason(reasons, op)
 		}
 		i = i + 1
 	}
 
+	summary.Reasons = sortedReasons(reasons)
 	return summary, nil
 }
 
+// addErrorReason counts op under its StatusReason. New reasons past
+// maxErrorReasons are not tracked.
+// Rule 2: Bounded by maxReasonCauseFields.
+func addErrorReason(reasons map[string]*ReasonSummary, op *storage.Operation) {
+	reason := op.ErrorReason
+	if len(reason) == 0 {
+		reason = ReasonNone
+	}
+
+	entry, ok := reasons[reason]
+	if !ok {
+		if len(reasons) >= maxErrorReasons {
+			return
+		}
+		entry = &ReasonSummary{Reason: reason, Code: op.ErrorCode, Example: op.Error}
+		reasons[reason] = entry
+	}
+
+	entry.Count = entry.Count + 1
+	if op.RetryAfterSeconds > entry.MaxRetryAfterSeconds {
+		entry.MaxRetryAfterSeconds = op.RetryAfterSeconds
+	}
+
+	for i := 0; i < len(op.ErrorCauses); i++ {
+		if len(entry.Fields) >= maxReasonCauseFields {
+			return
+		}
+		field := op.ErrorCauses[i].Field
+		if len(field) > 0 && !containsString(entry.Fields, field) {
+			entry.Fields = append(entry.Fields, field)
+		}
+	}
+}
+
+// sortedReasons orders reasons by count, then by name.
+func sortedReasons(reasons map[string]*ReasonSummary) []ReasonSummary {
+	out := make([]ReasonSummary, 0, len(reasons))
+	for _, entry := range reasons {
+		out = append(out, *entry)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Reason < out[j].Reason
+	})
+	return out
+}
+
+func containsString(values []string, value string) bool {
+	for i := 0; i < len(values); i++ {
+		if values[i] == value {
+			return true
+		}
+	}
+	return false
+}
+
 // ResourceAccessPattern tracks how resources are accessed.
 type ResourceAccessPattern struct {
 	ResourceKey string
@@ -322,7 +413,10 @@ func AnalyzeResourceAccess(
 
 // isReadOperation checks if operation is a read.
 func isReadOperation(opType storage.OperationType) bool {
-	return opType == storage.OperationGet || opType == storage.OperationList
+	return opType == storage.OperationGet ||
+		opType == storage.OperationList ||
+		opType == storage.OperationCacheGet ||
+		opType == storage.OperationCacheList
 }
 
 // isWriteOperation checks if operation is a write.
@@ -68,6 +68,33 @@ func TestAnalyzeErrors(t *testing.T) {
 	require.NotNil(t, summary.LastError)
 }
 
+func TestAnalyzeErrorsByReason(t *testing.T) {
+	ops := []storage.Operation{
+		{OperationType: storage.OperationUpdate, Error: "conflict 1", ErrorCode: 409, ErrorReason: "Conflict"},
+		{OperationType: storage.OperationPatch, Error: "conflict 2", ErrorCode: 409, ErrorReason: "Conflict"},
+		{OperationType: storage.OperationGet, Error: "slow", ErrorCode: 429, ErrorReason: "TooManyRequests",
+			RetryAfterSeconds: 3},
+		{OperationType: storage.OperationGet, Error: "slower", ErrorCode: 429, ErrorReason: "TooManyRequests",
+			RetryAfterSeconds: 9},
+		{OperationType: storage.OperationCreate, Error: "bad", ErrorCode: 422, ErrorReason: "Invalid",
+			ErrorCauses: []storage.ErrorCause{{Field: "spec.a"}, {Field: "spec.b"}, {Field: "spec.a"}}},
+		{OperationType: storage.OperationGet, Error: "dial tcp: timeout"},
+	}
+
+	summary, err := AnalyzeErrors(ops)
+	require.NoError(t, err)
+	require.Len(t, summary.Reasons, 4)
+
+	require.Equal(t, ReasonSummary{Reason: "Conflict", Code: 409, Count: 2, Example: "conflict 1"},
+		summary.Reasons[0])
+	require.Equal(t, "TooManyRequests", summary.Reasons[1].Reason)
+	require.Equal(t, int32(9), summary.Reasons[1].MaxRetryAfterSeconds)
+	require.Equal(t, "Invalid", summary.Reasons[2].Reason)
+	require.Equal(t, []string{"spec.a", "spec.b"}, summary.Reasons[2].Fields)
+	require.Equal(t, ReasonNone, summary.Reasons[3].Reason)
+	require.Equal(t, int32(0), summary.Reasons[3].Code)
+}
+
 func TestAnalyzeResourceAccess(t *testing.T) {
 	now := time.Now()
 	ops := []storage.Operation{
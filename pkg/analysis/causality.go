@@ -24,6 +24,8 @@ type CausalityNodeType string
 const (
 	NodeTypeOperation CausalityNodeType = "op"
 	NodeTypeSpan      CausalityNodeType = "span"
+	// NodeTypeEvent is a watch event the controller observed.
+	NodeTypeEvent CausalityNodeType = "event"
 )
 
 // CausalityEdgeType defines edge kinds in the graph.
@@ -32,6 +34,18 @@ type CausalityEdgeType string
 const (
 	EdgeTypeOpToSpan CausalityEdgeType = "op_to_span"
 	EdgeTypeSpanToOp CausalityEdgeType = "span_to_op"
+	// EdgeTypeOpObserved links a write to a later read (GET or LIST item)
+	// that returned exactly the uid/resourceVersion the write produced.
+	EdgeTypeOpObserved CausalityEdgeType = "op_observed"
+	// EdgeTypeOpToEvent links a write to the watch event that delivered it.
+	EdgeTypeOpToEvent CausalityEdgeType = "op_to_event"
+	// EdgeTypeEventToSpan links a watch event to the reconcile it triggered.
+	EdgeTypeEventToSpan CausalityEdgeType = "event_to_span"
+	// EdgeTypeStatusToSpan and EdgeTypeSpanToStatus are the op_to_span and
+	// span_to_op edges of status subresource writes, kept apart from spec
+	// writes so one controller's status updates triggering another stand out.
+	EdgeTypeStatusToSpan CausalityEdgeType = "status_to_span"
+	EdgeTypeSpanToStatus CausalityEdgeType = "span_to_status"
 )
 
 // CausalityNode represents a node in the causality graph.
@@ -45,9 +59,22 @@ type CausalityNode struct {
 	Timestamp    time.Time         `json:"ts,omitempty"`
 	ResourceVer  string            `json:"rv,omitempty"`
 	UID          string            `json:"uid,omitempty"`
+	Subresource  string            `json:"subresource,omitempty"`
 	DurationMs   int64             `json:"duration_ms,omitempty"`
 	Error        string            `json:"error,omitempty"`
 	ResourceData string            `json:"resource_data,omitempty"`
+	EventType    string            `json:"event_type,omitempty"`
+	// Events are the Kubernetes Events emitted about this node: by the
+	// reconcile itself, or about the object version a write produced.
+	Events []CausalityEvent `json:"events,omitempty"`
+}
+
+// CausalityEvent is an emitted Kubernetes Event annotating a node.
+type CausalityEvent struct {
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"ts"`
 }
 
 // CausalityEdge represents a directed edge in the graph.
@@ -89,8 +116,10 @@ type rvOp struct {
 type writeIndexes struct {
 	writeOps      []opWithIndex
 	writesByActor map[string][]opWithIndex
+	writesBySpan  map[string][]opWithIndex
 	exactByKey    map[string][]opWithIndex
 	rvByUID       map[string][]rvOp
+	eventsByKey   map[string][]opWithIndex
 }
 
 type causalityBuilder struct {
@@ -130,7 +159,10 @@ func BuildCausalityGraph(
 	sortRVIndexes(indexes.rvByUID)
 
 	builder := newCausalityBuilder(opts)
+	buildEventEdges(builder, indexes)
 	buildSpanEdges(builder, spans, indexes)
+	buildObservationEdges(builder, ops, indexes)
+	warnings = append(warnings, annotateKubeEvents(builder, ops, spans, indexes)...)
 
 	graph := builder.graph()
 	if len(graph.Edges) == 0 {
@@ -153,8 +185,10 @@ func collectWriteIndexes(ops []storage.Operation) (*writeIndexes, []string, erro
 	indexes := &writeIndexes{
 		writeOps:      make([]opWithIndex, 0, len(ops)),
 		writesByActor: make(map[string][]opWithIndex, 50),
+		writesBySpan:  make(map[string][]opWithIndex, 200),
 		exactByKey:    make(map[string][]opWithIndex, 200),
 		rvByUID:       make(map[string][]rvOp, 200),
+		eventsByKey:   make(map[string][]opWithIndex, 200),
 	}
 	populateWriteIndexes(indexes, ops)
 	return indexes, indexWarnings(indexes), nil
@@ -172,6 +206,13 @@ func populateWriteIndexes(indexes *writeIndexes, ops []storage.Operation) {
 
 	for i := 0; i < maxOps; i++ {
 		op := ops[i]
+		if op.OperationType == storage.OperationWatch {
+			if len(op.UID) > 0 && len(op.ResourceVersion) > 0 {
+				key := fmt.Sprintf("%s|%s", op.UID, op.ResourceVersion)
+				indexes.eventsByKey[key] = append(indexes.eventsByKey[key], opWithIndex{op: op, index: i})
+			}
+			continue
+		}
 		if !isWriteOperation(op.OperationType) {
 			continue
 		}
@@ -179,7 +220,9 @@ func populateWriteIndexes(indexes *writeIndexes, ops []storage.Operation) {
 		entry := opWithIndex{op: op, index: i}
 		indexes.writeOps = append(indexes.writeOps, entry)
 
-		if len(op.ActorID) > 0 {
+		if len(op.SpanID) > 0 {
+			indexes.writesBySpan[op.SpanID] = append(indexes.writesBySpan[op.SpanID], entry)
+		} else if len(op.ActorID) > 0 {
 			indexes.writesByActor[op.ActorID] = append(indexes.writesByActor[op.ActorID], entry)
 		}
 
@@ -211,6 +254,9 @@ func indexWarnings(indexes *writeIndexes) []string {
 	if len(indexes.exactByKey) == 0 {
 		warnings = append(warnings, "Operations missing uid/resource_version; write-to-reconcile linking limited.")
 	}
+	if len(indexes.writeOps) > 0 && len(indexes.writesBySpan) == 0 {
+		warnings = append(warnings, "Operations missing span_id; reconcile-to-write links inferred from span time windows.")
+	}
 
 	return warnings
 }
@@ -237,10 +283,16 @@ func sortRVIndexes(rvByUID map[string][]rvOp) {
 	for i := 0; i < maxKeys; i++ {
 		uid := keys[i]
 		sort.Slice(rvByUID[uid], func(i, j int) bool {
-			if rvByUID[uid][i].rv == rvByUID[uid][j].rv {
-				return rvByUID[uid][i].op.Timestamp.Before(rvByUID[uid][j].op.Timestamp)
+			a := rvByUID[uid][i]
+			b := rvByUID[uid][j]
+			if a.rv != b.rv {
+				return a.rv < b.rv
+			}
+			if !a.op.Timestamp.Equal(b.op.Timestamp) {
+				return a.op.Timestamp.Before(b.op.Timestamp)
 			}
-			return rvByUID[uid][i].rv < rvByUID[uid][j].rv
+			// Equal timestamps fall back to recording order.
+			return storage.OperationLess(&a.op, &b.op)
 		})
 	}
 }
@@ -267,39 +319,185 @@ func buildSpanEdges(builder *causalityBuilder, spans []storage.ReconcileSpan, in
 	for i := 0; i < maxSpans; i++ {
 		span := spans[i]
 		if len(span.TriggerUID) > 0 && len(span.TriggerResourceVersion) > 0 {
-			if match := findExactMatch(indexes.exactByKey, span); match != nil {
+			if event := findEventMatch(indexes.eventsByKey, span); event != nil {
+				eventID := builder.ensureOpNode(event.op, event.index)
+				spanID := builder.ensureSpanNode(span)
+				builder.addEdge(eventID, spanID, EdgeTypeEventToSpan)
+			} else if match := findExactMatch(indexes.exactByKey, span); match != nil {
 				opID := builder.ensureOpNode(match.op, match.index)
 				spanID := builder.ensureSpanNode(span)
-				builder.addEdge(opID, spanID, EdgeTypeOpToSpan)
+				builder.addEdge(opID, spanID, triggerEdgeType(match.op))
 			} else if fallback := findFallbackMatch(indexes.rvByUID, span); fallback != nil {
 				opID := builder.ensureOpNode(fallback.op, fallback.index)
 				spanID := builder.ensureSpanNode(span)
-				builder.addEdge(opID, spanID, EdgeTypeOpToSpan)
+				builder.addEdge(opID, spanID, triggerEdgeType(fallback.op))
 			}
 		}
 
+		buildSpanWriteEdges(builder, span, indexes)
+	}
+}
+
+// buildSpanWriteEdges links span to the writes it issued. Writes recorded
+// with a span ID belong to that span alone. Writes from older recordings,
+// which lack one, are matched by actor and the span's time window; that
+// guess is wrong when an actor runs reconciles concurrently.
+// Rule 2: Bounded by maxAnalysisOperations.
+func buildSpanWriteEdges(builder *causalityBuilder, span storage.ReconcileSpan, indexes *writeIndexes) {
+	spanOps := indexes.writesBySpan[span.ID]
+	windowed := false
+	if len(spanOps) == 0 {
 		if span.EndTime.IsZero() || span.EndTime.Before(span.StartTime) {
+			return
+		}
+		spanOps = indexes.writesByActor[span.ActorID]
+		windowed = true
+	}
+
+	maxSpanOps := len(spanOps)
+	if maxSpanOps > maxAnalysisOperations {
+		maxSpanOps = maxAnalysisOperations
+	}
+	for j := 0; j < maxSpanOps; j++ {
+		opEntry := spanOps[j]
+		op := opEntry.op
+		if windowed && (op.Timestamp.Before(span.StartTime) || op.Timestamp.After(span.EndTime)) {
+			continue
+		}
+		opID := builder.ensureOpNode(op, opEntry.index)
+		spanID := builder.ensureSpanNode(span)
+		edgeType := EdgeTypeSpanToOp
+		if IsStatusWrite(op) {
+			edgeType = EdgeTypeSpanToStatus
+		}
+		builder.addEdge(spanID, opID, edgeType)
+	}
+}
+
+// triggerEdgeType returns the edge type for a write that triggered a span.
+func triggerEdgeType(op storage.Operation) CausalityEdgeType {
+	if IsStatusWrite(op) {
+		return EdgeTypeStatusToSpan
+	}
+	return EdgeTypeOpToSpan
+}
+
+// buildEventEdges links each recorded watch event to the write that produced
+// the delivered uid/resourceVersion.
+// Rule 2: Bounded by maxAnalysisOperations and maxCausalityEdges.
+func buildEventEdges(builder *causalityBuilder, indexes *writeIndexes) {
+	if builder == nil || indexes == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(indexes.eventsByKey))
+	for key := range indexes.eventsByKey {
+		if len(keys) >= maxAnalysisOperations {
+			break
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i := 0; i < len(keys) && len(builder.edges) < maxCausalityEdges; i++ {
+		events := indexes.eventsByKey[keys[i]]
+		writes := indexes.exactByKey[keys[i]]
+		maxEvents := len(events)
+		if maxEvents > maxAnalysisOperations {
+			maxEvents = maxAnalysisOperations
+		}
+		for j := 0; j < maxEvents; j++ {
+			write := latestWriteBefore(writes, events[j].index)
+			if write == nil {
+				continue
+			}
+			writeID := builder.ensureOpNode(write.op, write.index)
+			eventID := builder.ensureOpNode(events[j].op, events[j].index)
+			builder.addEdge(writeID, eventID, EdgeTypeOpToEvent)
+		}
+	}
+}
+
+// latestWriteBefore returns the last write recorded before index.
+func latestWriteBefore(writes []opWithIndex, index int) *opWithIndex {
+	var best *opWithIndex
+	maxWrites := len(writes)
+	if maxWrites > maxAnalysisOperations {
+		maxWrites = maxAnalysisOperations
+	}
+	for i := 0; i < maxWrites; i++ {
+		if writes[i].index >= index {
+			continue
+		}
+		if best == nil || writes[i].index > best.index {
+			candidate := writes[i]
+			best = &candidate
+		}
+	}
+	return best
+}
+
+// buildObservationEdges links writes to the reads that saw their result.
+// Rule 2: Bounded by maxAnalysisOperations and maxCausalityEdges.
+func buildObservationEdges(builder *causalityBuilder, ops []storage.Operation, indexes *writeIndexes) {
+	if builder == nil || indexes == nil || len(indexes.exactByKey) == 0 {
+		return
+	}
+
+	maxOps := len(ops)
+	if maxOps > maxAnalysisOperations {
+		maxOps = maxAnalysisOperations
+	}
+
+	for i := 0; i < maxOps && len(builder.edges) < maxCausalityEdges; i++ {
+		op := ops[i]
+		if !isReadOperation(op.OperationType) {
 			continue
 		}
 
-		actorOps := indexes.writesByActor[span.ActorID]
-		maxActorOps := len(actorOps)
-		if maxActorOps > maxAnalysisOperations {
-			maxActorOps = maxAnalysisOperations
+		if len(op.UID) > 0 && len(op.ResourceVersion) > 0 {
+			linkObservedVersion(builder, indexes, op, i, op.UID, op.ResourceVersion)
+		}
+
+		maxItems := len(op.ListItems)
+		if maxItems > maxAnalysisOperations {
+			maxItems = maxAnalysisOperations
 		}
-		for j := 0; j < maxActorOps; j++ {
-			opEntry := actorOps[j]
-			op := opEntry.op
-			if op.Timestamp.Before(span.StartTime) || op.Timestamp.After(span.EndTime) {
+		for j := 0; j < maxItems; j++ {
+			item := op.ListItems[j]
+			if len(item.UID) == 0 || len(item.ResourceVersion) == 0 {
 				continue
 			}
-			opID := builder.ensureOpNode(op, opEntry.index)
-			spanID := builder.ensureSpanNode(span)
-			builder.addEdge(spanID, opID, EdgeTypeSpanToOp)
+			linkObservedVersion(builder, indexes, op, i, item.UID, item.ResourceVersion)
 		}
 	}
 }
 
+func linkObservedVersion(
+	builder *causalityBuilder,
+	indexes *writeIndexes,
+	read storage.Operation,
+	readIndex int,
+	uid string,
+	resourceVersion string,
+) {
+	writes := indexes.exactByKey[fmt.Sprintf("%s|%s", uid, resourceVersion)]
+	maxWrites := len(writes)
+	if maxWrites > maxAnalysisOperations {
+		maxWrites = maxAnalysisOperations
+	}
+
+	for k := 0; k < maxWrites; k++ {
+		write := writes[k]
+		if write.index >= readIndex {
+			continue
+		}
+		writeID := builder.ensureOpNode(write.op, write.index)
+		readID := builder.ensureOpNode(read, readIndex)
+		builder.addEdge(writeID, readID, EdgeTypeOpObserved)
+	}
+}
+
 func (b *causalityBuilder) addEdge(fromID, toID string, edgeType CausalityEdgeType) {
 	if b == nil {
 		return
@@ -333,9 +531,14 @@ func (b *causalityBuilder) ensureOpNode(op storage.Operation, index int) string
 		return id
 	}
 
+	nodeType := NodeTypeOperation
+	if op.OperationType == storage.OperationWatch {
+		nodeType = NodeTypeEvent
+	}
+
 	node := CausalityNode{
 		ID:          id,
-		Type:        NodeTypeOperation,
+		Type:        nodeType,
 		ActorID:     op.ActorID,
 		Kind:        op.ResourceKind,
 		Namespace:   op.Namespace,
@@ -343,8 +546,10 @@ func (b *causalityBuilder) ensureOpNode(op storage.Operation, index int) string
 		Timestamp:   op.Timestamp,
 		ResourceVer: op.ResourceVersion,
 		UID:         op.UID,
+		Subresource: operationSubresource(op),
 		DurationMs:  op.DurationMs,
 		Error:       op.Error,
+		EventType:   op.EventType,
 	}
 	if b.opts.IncludePayloads {
 		node.ResourceData = op.ResourceData
@@ -464,11 +669,26 @@ func buildAdjacency(edges []CausalityEdge) (map[string][]string, map[string]int)
 		maxEdges = maxCausalityEdges
 	}
 
+	eventFanOut := make(map[string]int, 50)
+	delivered := make(map[string]bool, 50)
 	for i := 0; i < maxEdges; i++ {
 		edge := edges[i]
 		adj[edge.From] = append(adj[edge.From], edge.To)
-		if edge.Type == EdgeTypeOpToSpan {
+		switch edge.Type {
+		case EdgeTypeOpToSpan, EdgeTypeStatusToSpan, EdgeTypeOpToEvent:
 			fanOut[edge.From] = fanOut[edge.From] + 1
+		case EdgeTypeEventToSpan:
+			eventFanOut[edge.From] = eventFanOut[edge.From] + 1
+		}
+		if edge.Type == EdgeTypeOpToEvent {
+			delivered[edge.To] = true
+		}
+	}
+
+	// Events whose write was not recorded start their own chains.
+	for eventID, count := range eventFanOut {
+		if !delivered[eventID] {
+			fanOut[eventID] = count
 		}
 	}
 
@@ -527,7 +747,8 @@ func collectRootNodes(
 		if count >= maxRoots {
 			break
 		}
-		if nodeByID[rootID].Type != NodeTypeOperation {
+		rootType := nodeByID[rootID].Type
+		if rootType != NodeTypeOperation && rootType != NodeTypeEvent {
 			continue
 		}
 		roots = append(roots, rootID)
@@ -647,6 +868,43 @@ func findExactMatch(
 	return best
 }
 
+// findEventMatch returns the latest watch event delivering the span's trigger
+// before the span started, preferring events observed by the span's actor.
+func findEventMatch(
+	eventsByKey map[string][]opWithIndex,
+	span storage.ReconcileSpan,
+) *opWithIndex {
+	key := fmt.Sprintf("%s|%s", span.TriggerUID, span.TriggerResourceVersion)
+	candidates := eventsByKey[key]
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var best *opWithIndex
+	bestSameActor := false
+	maxCandidates := len(candidates)
+	if maxCandidates > maxAnalysisOperations {
+		maxCandidates = maxAnalysisOperations
+	}
+	for i := 0; i < maxCandidates; i++ {
+		candidate := candidates[i]
+		if candidate.op.Timestamp.After(span.StartTime) {
+			continue
+		}
+		sameActor := candidate.op.ActorID == span.ActorID
+		if best != nil && bestSameActor && !sameActor {
+			continue
+		}
+		if best == nil || (sameActor && !bestSameActor) || candidate.index > best.index {
+			copyCandidate := candidate
+			best = &copyCandidate
+			bestSameActor = sameActor
+		}
+	}
+
+	return best
+}
+
 func findFallbackMatch(
 	rvByUID map[string][]rvOp,
 	span storage.ReconcileSpan,
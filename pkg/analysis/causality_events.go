@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	maxNodeEvents = 20
+)
+
+// annotateKubeEvents attaches each recorded Kubernetes Event to the node it
+// explains. An event belongs to the reconcile of its involved object that
+// was running when it was emitted; failing that, to the write that produced
+// the object version it names. Events matching neither are counted in a
+// warning.
+// Rule 2: Bounded by maxAnalysisOperations.
+func annotateKubeEvents(
+	builder *causalityBuilder,
+	ops []storage.Operation,
+	spans []storage.ReconcileSpan,
+	indexes *writeIndexes,
+) []string {
+	if builder == nil || indexes == nil {
+		return nil
+	}
+
+	maxSpans := len(spans)
+	if maxSpans > maxAnalysisOperations {
+		maxSpans = maxAnalysisOperations
+	}
+	spansByID := make(map[string]storage.ReconcileSpan, maxSpans)
+	spansByObject := make(map[string][]storage.ReconcileSpan, maxSpans)
+	for i := 0; i < maxSpans; i++ {
+		span := spans[i]
+		spansByID[span.ID] = span
+		key := eventObjectKey(span.Kind, span.Namespace, span.Name)
+		spansByObject[key] = append(spansByObject[key], span)
+	}
+
+	maxOps := len(ops)
+	if maxOps > maxAnalysisOperations {
+		maxOps = maxAnalysisOperations
+	}
+
+	unmatched := 0
+	for i := 0; i < maxOps; i++ {
+		op := ops[i]
+		if op.OperationType != storage.OperationEvent {
+			continue
+		}
+
+		event := CausalityEvent{
+			Type:      op.EventType,
+			Reason:    op.EventReason,
+			Message:   op.EventMessage,
+			Timestamp: op.Timestamp,
+		}
+
+		if span, ok := spansByID[op.SpanID]; ok && len(op.SpanID) > 0 {
+			builder.annotate(builder.ensureSpanNode(span), event)
+			continue
+		}
+
+		key := eventObjectKey(op.ResourceKind, op.Namespace, op.Name)
+		if span := activeSpan(spansByObject[key], op); span != nil {
+			builder.annotate(builder.ensureSpanNode(*span), event)
+			continue
+		}
+
+		writes := indexes.exactByKey[fmt.Sprintf("%s|%s", op.UID, op.ResourceVersion)]
+		if len(op.UID) > 0 && len(op.ResourceVersion) > 0 && len(writes) > 0 {
+			write := writes[len(writes)-1]
+			builder.annotate(builder.ensureOpNode(write.op, write.index), event)
+			continue
+		}
+
+		unmatched = unmatched + 1
+	}
+
+	if unmatched == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%d Kubernetes events matched no reconcile span or write.", unmatched)}
+}
+
+// activeSpan returns the latest span that had started when op was recorded
+// and had not yet ended.
+func activeSpan(spans []storage.ReconcileSpan, op storage.Operation) *storage.ReconcileSpan {
+	var found *storage.ReconcileSpan
+	for i := 0; i < len(spans); i++ {
+		span := &spans[i]
+		if op.Timestamp.Before(span.StartTime) {
+			continue
+		}
+		if !span.EndTime.IsZero() && op.Timestamp.After(span.EndTime) {
+			continue
+		}
+		if found == nil || span.StartTime.After(found.StartTime) {
+			found = span
+		}
+	}
+	return found
+}
+
+// eventObjectKey identifies the object a span reconciled or an event named.
+func eventObjectKey(kind, namespace, name string) string {
+	return kind + "|" + namespace + "|" + name
+}
+
+// annotate appends event to the node with id, up to maxNodeEvents.
+func (b *causalityBuilder) annotate(id string, event CausalityEvent) {
+	node, ok := b.nodes[id]
+	if !ok || len(node.Events) >= maxNodeEvents {
+		return
+	}
+
+	node.Events = append(node.Events, event)
+	b.nodes[id] = node
+}
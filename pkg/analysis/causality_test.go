@@ -86,6 +86,130 @@ func TestCausalitySpanToWriteEdge(t *testing.T) {
 	assert.True(t, found, "expected span->op edge for write within span window")
 }
 
+func TestCausalityUsesRecordedSpanMembership(t *testing.T) {
+	start := time.Now()
+
+	write := func(seq int64, name string, spanID string) storage.Operation {
+		return storage.Operation{
+			SequenceNumber: seq,
+			Timestamp:      start.Add(time.Duration(seq) * time.Second),
+			OperationType:  storage.OperationUpdate,
+			ResourceKind:   "ConfigMap",
+			Namespace:      "default",
+			Name:           name,
+			ActorID:        "controller",
+			SpanID:         spanID,
+		}
+	}
+	ops := []storage.Operation{
+		write(2, "a", "span-a"),
+		write(3, "b", "span-b"),
+		write(4, "a", "span-a"),
+	}
+
+	// Both reconciles cover every write, so only span IDs tell them apart.
+	span := func(id string, name string) storage.ReconcileSpan {
+		return storage.ReconcileSpan{
+			ID:        id,
+			ActorID:   "controller",
+			StartTime: start,
+			EndTime:   start.Add(10 * time.Second),
+			Kind:      "ConfigMap",
+			Namespace: "default",
+			Name:      name,
+		}
+	}
+	spans := []storage.ReconcileSpan{span("span-a", "a"), span("span-b", "b")}
+
+	graph, warnings, err := BuildCausalityGraph(ops, spans, CausalityOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, warnings,
+		"Operations missing span_id; reconcile-to-write links inferred from span time windows.")
+
+	assert.True(t, hasEdge(graph.Edges, "span:span-a", "op:2", EdgeTypeSpanToOp))
+	assert.True(t, hasEdge(graph.Edges, "span:span-a", "op:4", EdgeTypeSpanToOp))
+	assert.True(t, hasEdge(graph.Edges, "span:span-b", "op:3", EdgeTypeSpanToOp))
+	assert.False(t, hasEdge(graph.Edges, "span:span-a", "op:3", EdgeTypeSpanToOp))
+	assert.False(t, hasEdge(graph.Edges, "span:span-b", "op:2", EdgeTypeSpanToOp))
+
+	// Without span IDs the time window links every write to both spans.
+	for i := range ops {
+		ops[i].SpanID = ""
+	}
+	graph, warnings, err = BuildCausalityGraph(ops, spans, CausalityOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, warnings,
+		"Operations missing span_id; reconcile-to-write links inferred from span time windows.")
+	assert.True(t, hasEdge(graph.Edges, "span:span-a", "op:3", EdgeTypeSpanToOp))
+}
+
+func TestCausalityAnnotatesKubeEvents(t *testing.T) {
+	start := time.Now()
+
+	event := func(seq int64, offset time.Duration, name string, rv string, reason string) storage.Operation {
+		return storage.Operation{
+			SequenceNumber:  seq,
+			Timestamp:       start.Add(offset),
+			OperationType:   storage.OperationEvent,
+			ResourceKind:    "Deployment",
+			Namespace:       "default",
+			Name:            name,
+			UID:             "uid-" + name,
+			ResourceVersion: rv,
+			EventType:       storage.EventTypeWarning,
+			EventReason:     reason,
+		}
+	}
+
+	ops := []storage.Operation{
+		{
+			SequenceNumber:  1,
+			Timestamp:       start,
+			OperationType:   storage.OperationUpdate,
+			ResourceKind:    "Deployment",
+			Namespace:       "default",
+			Name:            "db",
+			UID:             "uid-db",
+			ResourceVersion: "5",
+		},
+		event(2, 2*time.Second, "web", "7", "FailedCreate"),
+		event(3, 20*time.Second, "db", "5", "Unhealthy"),
+		event(4, 20*time.Second, "cache", "1", "Lost"),
+	}
+
+	spans := []storage.ReconcileSpan{
+		{
+			ID:        "span-web",
+			ActorID:   "controller",
+			StartTime: start.Add(time.Second),
+			EndTime:   start.Add(3 * time.Second),
+			Kind:      "Deployment",
+			Namespace: "default",
+			Name:      "web",
+		},
+	}
+
+	graph, warnings, err := BuildCausalityGraph(ops, spans, CausalityOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, warnings, "1 Kubernetes events matched no reconcile span or write.")
+
+	nodes := make(map[string]CausalityNode, len(graph.Nodes))
+	for i := range graph.Nodes {
+		nodes[graph.Nodes[i].ID] = graph.Nodes[i]
+	}
+
+	spanNode := nodes["span:span-web"]
+	if assert.Len(t, spanNode.Events, 1) {
+		assert.Equal(t, "FailedCreate", spanNode.Events[0].Reason)
+		assert.Equal(t, storage.EventTypeWarning, spanNode.Events[0].Type)
+	}
+
+	writeNode := nodes["op:1"]
+	if assert.Len(t, writeNode.Events, 1) {
+		assert.Equal(t, "Unhealthy", writeNode.Events[0].Reason)
+	}
+}
+
 func hasEdge(edges []CausalityEdge, from, to string, edgeType CausalityEdgeType) bool {
 	for i := 0; i < len(edges); i++ {
 		edge := edges[i]
@@ -95,3 +219,117 @@ func hasEdge(edges []CausalityEdge, from, to string, edgeType CausalityEdgeType)
 	}
 	return false
 }
+
+func TestCausalityObservedByListItem(t *testing.T) {
+	start := time.Now()
+
+	ops := []storage.Operation{
+		{
+			SessionID:       "session-3",
+			SequenceNumber:  1,
+			Timestamp:       start,
+			OperationType:   storage.OperationUpdate,
+			ResourceKind:    "ConfigMap",
+			Namespace:       "default",
+			Name:            "cm",
+			UID:             "uid-1",
+			ResourceVersion: "7",
+			ActorID:         "controller-a",
+		},
+		{
+			SessionID:       "session-3",
+			SequenceNumber:  2,
+			Timestamp:       start.Add(time.Second),
+			OperationType:   storage.OperationList,
+			ResourceKind:    "ConfigMap",
+			Namespace:       "default",
+			ResourceVersion: "9",
+			ActorID:         "controller-b",
+			ListItems: []storage.ListItem{
+				{UID: "uid-1", ResourceVersion: "7", Namespace: "default", Name: "cm"},
+				{UID: "uid-2", ResourceVersion: "8", Namespace: "default", Name: "other"},
+			},
+		},
+		{
+			SessionID:       "session-3",
+			SequenceNumber:  3,
+			Timestamp:       start.Add(2 * time.Second),
+			OperationType:   storage.OperationList,
+			ResourceKind:    "ConfigMap",
+			Namespace:       "default",
+			ResourceVersion: "6",
+			ActorID:         "controller-c",
+			ListItems: []storage.ListItem{
+				{UID: "uid-1", ResourceVersion: "5", Namespace: "default", Name: "cm"},
+			},
+		},
+	}
+
+	graph, _, err := BuildCausalityGraph(ops, nil, CausalityOptions{})
+	assert.NoError(t, err)
+	assert.True(t, hasEdge(graph.Edges, "op:1", "op:2", EdgeTypeOpObserved),
+		"expected write->list edge for observed item version")
+	assert.False(t, hasEdge(graph.Edges, "op:1", "op:3", EdgeTypeOpObserved),
+		"stale list must not link to the newer write")
+}
+
+func TestCausalityWatchEventTriggersSpan(t *testing.T) {
+	start := time.Now()
+
+	ops := []storage.Operation{
+		{
+			SequenceNumber:  1,
+			Timestamp:       start,
+			OperationType:   storage.OperationUpdate,
+			ResourceKind:    "ConfigMap",
+			UID:             "uid-1",
+			ResourceVersion: "5",
+			ActorID:         "controller-a",
+		},
+		{
+			SequenceNumber:  2,
+			Timestamp:       start.Add(time.Second),
+			OperationType:   storage.OperationWatch,
+			EventType:       storage.WatchEventModified,
+			ResourceKind:    "ConfigMap",
+			UID:             "uid-1",
+			ResourceVersion: "5",
+			ActorID:         "controller-b",
+		},
+		{
+			SequenceNumber: 3,
+			Timestamp:      start.Add(3 * time.Second),
+			OperationType:  storage.OperationCreate,
+			ResourceKind:   "Pod",
+			ActorID:        "controller-b",
+		},
+	}
+
+	spans := []storage.ReconcileSpan{
+		{
+			ID:                     "span-1",
+			ActorID:                "controller-b",
+			StartTime:              start.Add(2 * time.Second),
+			EndTime:                start.Add(4 * time.Second),
+			Kind:                   "ConfigMap",
+			TriggerUID:             "uid-1",
+			TriggerResourceVersion: "5",
+		},
+	}
+
+	graph, _, err := BuildCausalityGraph(ops, spans, CausalityOptions{})
+	assert.NoError(t, err)
+
+	assert.True(t, hasEdge(graph.Edges, "op:1", "op:2", EdgeTypeOpToEvent))
+	assert.True(t, hasEdge(graph.Edges, "op:2", "span:span-1", EdgeTypeEventToSpan))
+	assert.False(t, hasEdge(graph.Edges, "op:1", "span:span-1", EdgeTypeOpToSpan),
+		"watch event should replace the direct write trigger")
+
+	nodes := indexNodes(graph.Nodes)
+	assert.Equal(t, NodeTypeEvent, nodes["op:2"].Type)
+	assert.Equal(t, storage.WatchEventModified, nodes["op:2"].EventType)
+
+	chains := BuildCausalityChains(graph, 0, 0)
+	assert.Len(t, chains, 1)
+	assert.Equal(t, []string{"op:1", "op:2", "span:span-1", "op:3"}, chains[0].NodeIDs)
+}
@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	maxChurnObjects   = 1000
+	maxChurnActors    = 10
+	statusSubresource = "status"
+)
+
+// StatusChurn summarizes the status writes made to one object.
+type StatusChurn struct {
+	ResourceKey  string
+	StatusWrites int
+	// SpecWrites counts writes to the object itself. Zero means the object
+	// only saw status churn.
+	SpecWrites int
+	// NoopWrites counts status writes that left the status as it was, when
+	// the recording has the prior state to compare with.
+	NoopWrites int
+	Actors     []string
+	FirstWrite time.Time
+	LastWrite  time.Time
+}
+
+// StatusOnly reports whether the object saw status writes and nothing else.
+func (c StatusChurn) StatusOnly() bool {
+	return c.StatusWrites > 0 && c.SpecWrites == 0
+}
+
+// IsStatusWrite reports whether op wrote the status subresource.
+func IsStatusWrite(op storage.Operation) bool {
+	return isWriteOperation(op.OperationType) && operationSubresource(op) == statusSubresource
+}
+
+// operationSubresource returns the subresource op addressed. Recordings made
+// before the subresource column existed carry it in Resource.
+func operationSubresource(op storage.Operation) string {
+	if len(op.Subresource) > 0 {
+		return op.Subresource
+	}
+	if idx := strings.Index(op.Resource, "/"); idx >= 0 {
+		return op.Resource[idx+1:]
+	}
+	return ""
+}
+
+// AnalyzeStatusChurn finds objects with at least minWrites status writes,
+// most written first. Spec writes to the same objects are counted so
+// status-only churn can be told apart from objects that are also changing.
+// Rule 2: Bounded by maxAnalysisOperations and maxChurnObjects.
+func AnalyzeStatusChurn(ops []storage.Operation, minWrites int) ([]StatusChurn, error) {
+	err := assert.AssertInRange(len(ops), 0, maxAnalysisOperations, "operation count")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(minWrites, 1, maxAnalysisOperations, "min status writes")
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*StatusChurn, 100)
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		if !isWriteOperation(op.OperationType) || len(op.Error) > 0 {
+			continue
+		}
+
+		subresource := operationSubresource(op)
+		if len(subresource) > 0 && subresource != statusSubresource {
+			continue
+		}
+
+		key := churnKey(op)
+		entry, ok := byKey[key]
+		if !ok {
+			if len(byKey) >= maxChurnObjects {
+				continue
+			}
+			entry = &StatusChurn{ResourceKey: key}
+			byKey[key] = entry
+		}
+
+		if subresource != statusSubresource {
+			entry.SpecWrites = entry.SpecWrites + 1
+			continue
+		}
+
+		entry.StatusWrites = entry.StatusWrites + 1
+		if entry.FirstWrite.IsZero() {
+			entry.FirstWrite = op.Timestamp
+		}
+		entry.LastWrite = op.Timestamp
+		if statusUnchanged(op) {
+			entry.NoopWrites = entry.NoopWrites + 1
+		}
+		if len(entry.Actors) < maxChurnActors && !containsString(entry.Actors, op.ActorID) {
+			entry.Actors = append(entry.Actors, op.ActorID)
+		}
+	}
+
+	out := make([]StatusChurn, 0, len(byKey))
+	for _, entry := range byKey {
+		if entry.StatusWrites >= minWrites {
+			out = append(out, *entry)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].StatusWrites != out[j].StatusWrites {
+			return out[i].StatusWrites > out[j].StatusWrites
+		}
+		return out[i].ResourceKey < out[j].ResourceKey
+	})
+	return out, nil
+}
+
+// churnKey identifies the object a write touched.
+func churnKey(op storage.Operation) string {
+	kind := strings.TrimSuffix(op.ResourceKind, "List")
+	if len(op.Namespace) == 0 {
+		return kind + "/" + op.Name
+	}
+	return kind + "/" + op.Namespace + "/" + op.Name
+}
+
+// statusUnchanged reports whether a status write kept the prior status. The
+// sent body is compared when it was recorded, otherwise the stored result.
+func statusUnchanged(op storage.Operation) bool {
+	if len(op.PriorData) == 0 {
+		return false
+	}
+
+	after := op.RequestData
+	if len(after) == 0 {
+		after = op.ResourceData
+	}
+	if len(after) == 0 {
+		return false
+	}
+
+	var prior, written struct {
+		Status interface{} `json:"status"`
+	}
+	if json.Unmarshal([]byte(op.PriorData), &prior) != nil {
+		return false
+	}
+	if json.Unmarshal([]byte(after), &written) != nil {
+		return false
+	}
+	return reflect.DeepEqual(prior.Status, written.Status)
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeStatusChurn(t *testing.T) {
+	start := time.Now()
+	statusWrite := func(seq int64, name string, prior string, sent string) storage.Operation {
+		return storage.Operation{
+			SequenceNumber: seq,
+			Timestamp:      start.Add(time.Duration(seq) * time.Second),
+			OperationType:  storage.OperationUpdate,
+			ResourceKind:   "Pod",
+			Resource:       "pods/status",
+			Subresource:    "status",
+			Namespace:      "default",
+			Name:           name,
+			ActorID:        "pod-controller",
+			PriorData:      prior,
+			RequestData:    sent,
+		}
+	}
+
+	ops := []storage.Operation{
+		statusWrite(1, "web", `{"status":{"phase":"Pending"}}`, `{"status":{"phase":"Running"}}`),
+		statusWrite(2, "web", `{"status":{"phase":"Running"}}`, `{"status":{"phase":"Running"}}`),
+		statusWrite(3, "web", "", `{"status":{"phase":"Running"}}`),
+		statusWrite(4, "db", "", ""),
+		statusWrite(5, "db", "", ""),
+		{
+			SequenceNumber: 6,
+			OperationType:  storage.OperationUpdate,
+			ResourceKind:   "Pod",
+			Namespace:      "default",
+			Name:           "db",
+			ActorID:        "operator",
+		},
+		// Legacy recordings only carry the subresource in Resource.
+		{
+			SequenceNumber: 7,
+			OperationType:  storage.OperationPatch,
+			ResourceKind:   "Pod",
+			Resource:       "pods/status",
+			Namespace:      "default",
+			Name:           "db",
+			ActorID:        "operator",
+		},
+		{
+			SequenceNumber: 8,
+			OperationType:  storage.OperationCreate,
+			ResourceKind:   "Pod",
+			Resource:       "pods/eviction",
+			Subresource:    "eviction",
+			Namespace:      "default",
+			Name:           "db",
+		},
+	}
+
+	churn, err := AnalyzeStatusChurn(ops, 3)
+	require.NoError(t, err)
+	require.Len(t, churn, 2)
+
+	assert.Equal(t, "Pod/default/db", churn[0].ResourceKey)
+	assert.Equal(t, 3, churn[0].StatusWrites)
+	assert.Equal(t, 1, churn[0].SpecWrites)
+	assert.False(t, churn[0].StatusOnly())
+	assert.Equal(t, []string{"pod-controller", "operator"}, churn[0].Actors)
+
+	assert.Equal(t, "Pod/default/web", churn[1].ResourceKey)
+	assert.Equal(t, 3, churn[1].StatusWrites)
+	assert.Equal(t, 1, churn[1].NoopWrites)
+	assert.True(t, churn[1].StatusOnly())
+
+	_, err = AnalyzeStatusChurn(ops, 0)
+	require.Error(t, err)
+}
+
+func TestCausalitySeparatesStatusWrites(t *testing.T) {
+	start := time.Now()
+
+	ops := []storage.Operation{
+		{
+			SequenceNumber:  1,
+			Timestamp:       start,
+			OperationType:   storage.OperationUpdate,
+			ResourceKind:    "Deployment",
+			Resource:        "deployments/status",
+			Subresource:     "status",
+			Namespace:       "default",
+			Name:            "api",
+			UID:             "uid-1",
+			ResourceVersion: "7",
+			ActorID:         "controller-a",
+		},
+		{
+			SequenceNumber: 2,
+			Timestamp:      start.Add(3 * time.Second),
+			OperationType:  storage.OperationUpdate,
+			ResourceKind:   "Deployment",
+			Resource:       "deployments/status",
+			Subresource:    "status",
+			Namespace:      "default",
+			Name:           "api",
+			ActorID:        "controller-b",
+		},
+	}
+
+	spans := []storage.ReconcileSpan{
+		{
+			ID:                     "span-1",
+			ActorID:                "controller-b",
+			StartTime:              start.Add(2 * time.Second),
+			EndTime:                start.Add(4 * time.Second),
+			Kind:                   "Deployment",
+			Namespace:              "default",
+			Name:                   "api",
+			TriggerUID:             "uid-1",
+			TriggerResourceVersion: "7",
+		},
+	}
+
+	graph, _, err := BuildCausalityGraph(ops, spans, CausalityOptions{})
+	require.NoError(t, err)
+
+	assert.True(t, hasEdge(graph.Edges, "op:1", "span:span-1", EdgeTypeStatusToSpan))
+	assert.False(t, hasEdge(graph.Edges, "op:1", "span:span-1", EdgeTypeOpToSpan))
+	assert.True(t, hasEdge(graph.Edges, "span:span-1", "op:2", EdgeTypeSpanToStatus))
+
+	for i := 0; i < len(graph.Nodes); i++ {
+		if graph.Nodes[i].ID == "op:1" {
+			assert.Equal(t, "status", graph.Nodes[i].Subresource)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Package bundle writes and reads session bundles: one recorded session in a
+// single compressed file, so a reproduction can be handed to another team
+// and loaded into any storage backend.
+//
+// A bundle is a gzip compressed tar archive. Its first entry is
+// manifest.json, which holds the schema version, the session metadata, the
+// record counts and the SHA-256 of every other entry. operations.jsonl,
+// spans.jsonl and events.jsonl follow with one JSON record per line.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	// Format names the bundle format in the manifest.
+	Format = "kubestep-bundle"
+	// SchemaVersion is the manifest schema this package writes. Bundles
+	// with a newer schema are rejected.
+	SchemaVersion = 1
+	// Extension is the conventional file extension of a bundle.
+	Extension = ".ksb"
+
+	manifestFile   = "manifest.json"
+	operationsFile = "operations.jsonl"
+	spansFile      = "spans.jsonl"
+	eventsFile     = "events.jsonl"
+
+	maxManifestBytes = 1048576
+	maxFileBytes     = 4 * 1073741824
+	maxRecordBytes   = 16 * 1048576
+	maxBundleRecords = 1000000
+	maxExportQueries = 100000
+)
+
+// dataFiles lists the record files of a bundle in archive order.
+var dataFiles = []string{operationsFile, spansFile, eventsFile}
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	Format        string    `json:"format"`
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	SessionID     string    `json:"session_id"`
+	// Session is the stored session metadata, nil for a session recorded
+	// before metadata existed.
+	Session *storage.Session `json:"session,omitempty"`
+	Counts  Counts           `json:"counts"`
+	Files   []FileEntry      `json:"files"`
+}
+
+// Counts holds the number of records of each kind in a bundle.
+type Counts struct {
+	Operations int64 `json:"operations"`
+	Spans      int64 `json:"spans"`
+	Events     int64 `json:"events"`
+}
+
+// FileEntry is the size, record count and checksum of one archive entry.
+type FileEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Records int64  `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+// Bundle is the decoded contents of a bundle. Events holds the
+// OperationEvent records; Operations holds every other operation.
+type Bundle struct {
+	Manifest   Manifest
+	Operations []storage.Operation
+	Spans      []storage.ReconcileSpan
+	Events     []storage.Operation
+}
+
+// Export writes the operations, spans, events and metadata of sessionID in
+// store to w as a bundle. It returns the manifest written.
+func Export(store storage.OperationStore, sessionID string, w io.Writer) (*Manifest, error) {
+	err := assert.AssertNotNil(store, "store")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := load(store, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Operations) == 0 && len(b.Events) == 0 && len(b.Spans) == 0 && b.Manifest.Session == nil {
+		return nil, fmt.Errorf("session %s: %w", sessionID, storage.ErrSessionNotFound)
+	}
+
+	err = b.Write(w)
+	if err != nil {
+		return nil, err
+	}
+	return &b.Manifest, nil
+}
+
+// load reads sessionID from store into a bundle.
+func load(store storage.OperationStore, sessionID string) (*Bundle, error) {
+	b := &Bundle{Manifest: Manifest{
+		Format:        Format,
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		SessionID:     sessionID,
+	}}
+
+	meta, err := store.GetSession(sessionID)
+	if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	b.Manifest.Session = meta
+
+	ops, err := loadOperations(store, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(ops); i++ {
+		if ops[i].OperationType == storage.OperationEvent {
+			b.Events = append(b.Events, ops[i])
+		} else {
+			b.Operations = append(b.Operations, ops[i])
+		}
+	}
+
+	b.Spans, err = store.QueryReconcileSpans(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reconcile spans: %w", err)
+	}
+	if len(b.Spans) >= storage.QueryLimit {
+		return nil, fmt.Errorf("session %s has %d or more reconcile spans, more than a store query returns",
+			sessionID, storage.QueryLimit)
+	}
+	return b, nil
+}
+
+// loadOperations reads every operation of sessionID. A store query returns
+// at most storage.QueryLimit rows, so it reads sequence number windows that
+// come back whole: a window that fills a query is narrowed and read again,
+// and one that comes back sparse is widened for the next read.
+// Rule 2: Bounded by maxExportQueries and maxBundleRecords.
+func loadOperations(store storage.OperationStore, sessionID string) ([]storage.Operation, error) {
+	ops := make([]storage.Operation, 0, 256)
+	start := int64(0)
+	width := int64(math.MaxInt64)
+	for i := 0; i < maxExportQueries; i++ {
+		end := int64(math.MaxInt64)
+		if width < math.MaxInt64-start {
+			end = start + width - 1
+		}
+
+		page, err := store.QueryOperationsByRange(sessionID, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query operations: %w", err)
+		}
+
+		if len(page) >= storage.QueryLimit {
+			if width == 1 {
+				return nil, fmt.Errorf("session %s has %d or more operations with sequence number %d",
+					sessionID, storage.QueryLimit, start)
+			}
+			width = narrowWindow(page, start, width)
+			continue
+		}
+
+		ops = append(ops, page...)
+		if len(ops) > maxBundleRecords {
+			return nil, fmt.Errorf("session %s has more than %d operations", sessionID, maxBundleRecords)
+		}
+		if end == math.MaxInt64 {
+			storage.SortOperations(ops)
+			return ops, nil
+		}
+
+		start = end + 1
+		if len(page) < storage.QueryLimit/4 && width <= math.MaxInt64/2 {
+			width = width * 2
+		}
+	}
+	return nil, fmt.Errorf("session %s: operations not read after %d queries", sessionID, maxExportQueries)
+}
+
+// narrowWindow returns the width of the next read after a window starting
+// at start filled a query. The page holds the earliest operations in
+// recording order, which mostly follows sequence numbers, so half the
+// sequence span it covers is a good guess.
+func narrowWindow(page []storage.Operation, start int64, width int64) int64 {
+	last := start
+	for i := 0; i < len(page); i++ {
+		if page[i].SequenceNumber > last {
+			last = page[i].SequenceNumber
+		}
+	}
+
+	next := width / 2
+	if guess := (last-start)/2 + 1; guess < next {
+		next = guess
+	}
+	if next < 1 {
+		next = 1
+	}
+	return next
+}
+
+// Write encodes b to w, filling in the manifest counts and checksums.
+func (b *Bundle) Write(w io.Writer) error {
+	err := assert.AssertNotNil(b, "bundle")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertNotNil(w, "writer")
+	if err != nil {
+		return err
+	}
+
+	files, err := b.encodeFiles()
+	if err != nil {
+		return err
+	}
+
+	b.Manifest.Counts = Counts{
+		Operations: int64(len(b.Operations)),
+		Spans:      int64(len(b.Spans)),
+		Events:     int64(len(b.Events)),
+	}
+	b.Manifest.Files = make([]FileEntry, 0, len(dataFiles))
+	for i := 0; i < len(dataFiles); i++ {
+		sum := sha256.Sum256(files[i].data)
+		b.Manifest.Files = append(b.Manifest.Files, FileEntry{
+			Name:    dataFiles[i],
+			Size:    int64(len(files[i].data)),
+			Records: files[i].records,
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifest, err := json.MarshalIndent(&b.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	err = writeEntry(tw, manifestFile, manifest, b.Manifest.CreatedAt)
+	for i := 0; i < len(dataFiles) && err == nil; i++ {
+		err = writeEntry(tw, dataFiles[i], files[i].data, b.Manifest.CreatedAt)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// encodedFile is the contents of one record file.
+type encodedFile struct {
+	data    []byte
+	records int64
+}
+
+// encodeFiles encodes the records of b in dataFiles order.
+func (b *Bundle) encodeFiles() ([]encodedFile, error) {
+	operations, err := encodeOperations(b.Operations)
+	if err != nil {
+		return nil, err
+	}
+
+	spans, err := encodeSpans(b.Spans)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := encodeOperations(b.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	return []encodedFile{operations, spans, events}, nil
+}
+
+// encodeOperations encodes ops as JSON lines.
+// Rule 2: Bounded by the number of operations.
+func encodeOperations(ops []storage.Operation) (encodedFile, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(ops); i++ {
+		line, err := storage.MarshalOperation(&ops[i])
+		if err != nil {
+			return encodedFile{}, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return encodedFile{data: buf.Bytes(), records: int64(len(ops))}, nil
+}
+
+// encodeSpans encodes spans as JSON lines.
+// Rule 2: Bounded by the number of spans.
+func encodeSpans(spans []storage.ReconcileSpan) (encodedFile, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(spans); i++ {
+		line, err := json.Marshal(&spans[i])
+		if err != nil {
+			return encodedFile{}, fmt.Errorf("failed to encode reconcile span: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return encodedFile{data: buf.Bytes(), records: int64(len(spans))}, nil
+}
+
+// writeEntry adds a regular file to the archive.
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
@@ -0,0 +1,240 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *storage.MemoryStore {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	return store
+}
+
+func testOperation(sessionID string, seq int64) *storage.Operation {
+	return &storage.Operation{
+		SessionID:      sessionID,
+		SequenceNumber: seq,
+		Timestamp:      time.Unix(1700000000+seq, 0).UTC(),
+		OperationType:  storage.OperationUpdate,
+		ResourceKind:   "ConfigMap",
+		Namespace:      "default",
+		Name:           "demo",
+		ResourceData:   `{"data":{"k":"v"}}`,
+		ActorID:        "controller-a",
+		SpanID:         "span-1",
+		DurationMs:     3,
+	}
+}
+
+// recordSession fills store with a finished session holding two
+// operations, one event and one span.
+func recordSession(t *testing.T, store storage.OperationStore, sessionID string) {
+	t.Helper()
+
+	require.NoError(t, store.BeginSession(&storage.Session{
+		ID:           sessionID,
+		OperatorName: "widget-operator",
+		Labels:       map[string]string{"env": "test"},
+		StartTime:    time.Unix(1700000000, 0),
+	}))
+	require.NoError(t, store.InsertReconcileSpan(&storage.ReconcileSpan{
+		ID:         "span-1",
+		SessionID:  sessionID,
+		ActorID:    "controller-a",
+		StartTime:  time.Unix(1700000001, 0).UTC(),
+		EndTime:    time.Unix(1700000003, 0).UTC(),
+		DurationMs: 2000,
+		Kind:       "Widget",
+		Name:       "demo",
+	}))
+
+	event := testOperation(sessionID, 3)
+	event.OperationType = storage.OperationEvent
+	event.ResourceKind = "Widget"
+	event.EventType = storage.EventTypeWarning
+	event.EventReason = "Conflict"
+	event.EventMessage = "retrying"
+	failed := testOperation(sessionID, 2)
+	failed.Error = "conflict"
+	failed.ErrorCode = 409
+	require.NoError(t, store.InsertOperations([]*storage.Operation{testOperation(sessionID, 1), failed, event}))
+
+	require.NoError(t, store.AddDroppedOperations(sessionID, 4))
+	require.NoError(t, store.SetSessionRedaction(sessionID, []string{"secrets"}))
+	require.NoError(t, store.EndSession(sessionID, storage.SessionFailed))
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := newTestStore(t)
+	recordSession(t, source, "repro")
+
+	var buf bytes.Buffer
+	manifest, err := Export(source, "repro", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, Counts{Operations: 2, Spans: 1, Events: 1}, manifest.Counts)
+	require.Len(t, manifest.Files, 3)
+
+	b, err := Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "repro", b.Manifest.SessionID)
+	assert.Equal(t, "widget-operator", b.Manifest.Session.OperatorName)
+
+	target := newTestStore(t)
+	result, err := Import(target, b, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "repro", result.SessionID)
+	assert.False(t, result.Remapped)
+
+	ops, err := target.QueryOperations("repro")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	assert.Equal(t, int32(409), ops[1].ErrorCode)
+	assert.Equal(t, "retrying", ops[2].EventMessage)
+	assert.Equal(t, "span-1", ops[0].SpanID)
+
+	session, err := target.GetSession("repro")
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionFailed, session.Status)
+	assert.Equal(t, int64(4), session.DroppedOperations)
+	assert.Equal(t, []string{"secrets"}, session.Redaction)
+	assert.Equal(t, "test", session.Labels["env"])
+	assert.Equal(t, int64(1700000000), session.StartTime.Unix())
+
+	// A second import of the same bundle is remapped to a new session with
+	// new span IDs.
+	result, err = Import(target, b, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "repro-import-1", result.SessionID)
+	assert.True(t, result.Remapped)
+
+	spans, err := target.QueryReconcileSpans("repro-import-1")
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.NotEqual(t, "span-1", spans[0].ID)
+	assert.Equal(t, int64(2000), spans[0].DurationMs)
+
+	ops, err = target.QueryOperations("repro-import-1")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	assert.Equal(t, spans[0].ID, ops[0].SpanID)
+
+	_, err = Import(target, b, ImportOptions{SessionID: "repro"})
+	require.Error(t, err)
+
+	result, err = Import(target, b, ImportOptions{SessionID: "copy"})
+	require.NoError(t, err)
+	assert.Equal(t, "copy", result.SessionID)
+
+	_, err = Export(source, "missing", io.Discard)
+	require.ErrorIs(t, err, storage.ErrSessionNotFound)
+}
+
+func TestExportPagesLargeSessions(t *testing.T) {
+	store := storage.NewMemoryStore()
+
+	// Two replicas record the same sequence numbers, so more operations than
+	// one query returns share a window of sequence numbers.
+	total := storage.QueryLimit + 2000
+	batch := make([]*storage.Operation, 0, 1000)
+	for i := 0; i < total; i++ {
+		op := testOperation("large", int64(i/2+1))
+		op.ReplicaID = fmt.Sprintf("replica-%d", i%2)
+		batch = append(batch, op)
+		if len(batch) == cap(batch) || i == total-1 {
+			require.NoError(t, store.InsertOperations(batch))
+			batch = batch[:0]
+		}
+	}
+
+	var buf bytes.Buffer
+	manifest, err := Export(store, "large", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(total), manifest.Counts.Operations)
+
+	b, err := Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, b.Operations, total)
+	assert.Equal(t, int64(total/2), b.Operations[total-1].SequenceNumber)
+}
+
+func TestReadRejectsDamagedBundles(t *testing.T) {
+	source := newTestStore(t)
+	recordSession(t, source, "repro")
+
+	var buf bytes.Buffer
+	_, err := Export(source, "repro", &buf)
+	require.NoError(t, err)
+	entries := readEntries(t, buf.Bytes())
+
+	tampered := append([]byte(nil), entries[operationsFile]...)
+	tampered[len(tampered)-3] = 'X'
+	_, err = Read(bytes.NewReader(writeEntries(t, entries, operationsFile, tampered)))
+	require.ErrorContains(t, err, "checksum mismatch")
+
+	_, err = Read(bytes.NewReader(writeEntries(t, entries, spansFile, nil)))
+	require.ErrorContains(t, err, "spans.jsonl")
+
+	newer := bytes.Replace(entries[manifestFile], []byte(`"schema_version": 1`), []byte(`"schema_version": 9`), 1)
+	_, err = Read(bytes.NewReader(writeEntries(t, entries, manifestFile, newer)))
+	require.ErrorContains(t, err, "schema version 9")
+
+	truncated := buf.Bytes()[:buf.Len()-12]
+	_, err = Read(bytes.NewReader(truncated))
+	require.Error(t, err)
+
+	_, err = Read(bytes.NewReader([]byte("SQLite format 3\x00")))
+	require.ErrorContains(t, err, "not a kubestep bundle")
+}
+
+// readEntries returns the archive entries of a bundle by name.
+func readEntries(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+
+	entries := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[hdr.Name] = body
+	}
+	return entries
+}
+
+// writeEntries builds a bundle from entries with name replaced by data.
+func writeEntries(t *testing.T, entries map[string][]byte, name string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	order := append([]string{manifestFile}, dataFiles...)
+	for _, entry := range order {
+		body := entries[entry]
+		if entry == name {
+			body = data
+		}
+		require.NoError(t, writeEntry(tw, entry, body, time.Unix(0, 0)))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
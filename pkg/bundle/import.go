@@ -0,0 +1,263 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	importBatchSize    = 1000
+	maxRemapAttempts   = 1000
+	spanAliasPrefixLen = 64
+)
+
+// ImportOptions controls how a bundle is loaded into a store.
+type ImportOptions struct {
+	// SessionID names the imported session. Empty keeps the bundle's
+	// session ID, or picks a free one when that ID is taken. A SessionID
+	// that is taken is an error.
+	SessionID string
+	// Description is used when the bundle carries no session metadata.
+	Description string
+}
+
+// ImportResult reports what Import stored.
+type ImportResult struct {
+	SessionID string
+	// Remapped is set when the session was stored under an ID other than
+	// the one it was exported with. Span IDs are then remapped too, and
+	// operations refer to the new span IDs.
+	Remapped   bool
+	Operations int
+	Spans      int
+	Events     int
+}
+
+// Import stores the session of b in store. Operation IDs are assigned by
+// the store. The session keeps its metadata, counters and final status;
+// one exported while still running is imported as aborted, since nothing
+// records into it any more.
+func Import(store storage.OperationStore, b *Bundle, opts ImportOptions) (*ImportResult, error) {
+	err := assert.AssertNotNil(store, "store")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertNotNil(b, "bundle")
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := targetSession(store, b.Manifest.SessionID, opts.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{
+		SessionID:  sessionID,
+		Remapped:   sessionID != b.Manifest.SessionID,
+		Operations: len(b.Operations),
+		Spans:      len(b.Spans),
+		Events:     len(b.Events),
+	}
+
+	meta := importedSession(b, sessionID, opts.Description)
+	err = store.BeginSession(&meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin session: %w", err)
+	}
+
+	err = importRecords(store, b, sessionID, result.Remapped)
+	if err != nil {
+		_ = store.EndSession(sessionID, storage.SessionFailed)
+		return nil, err
+	}
+
+	err = importCounters(store, sessionID, b.Manifest.Session)
+	if err != nil {
+		_ = store.EndSession(sessionID, storage.SessionFailed)
+		return nil, err
+	}
+
+	err = store.EndSession(sessionID, finalStatus(b.Manifest.Session))
+	if err != nil {
+		return nil, fmt.Errorf("failed to end session: %w", err)
+	}
+	return result, nil
+}
+
+// targetSession returns the session ID to import into: requested when
+// given and free, else bundled when free, else the first free
+// bundled-import-N.
+// Rule 2: Bounded by maxRemapAttempts.
+func targetSession(store storage.OperationStore, bundled string, requested string) (string, error) {
+	if len(requested) > 0 {
+		exists, err := sessionExists(store, requested)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return "", fmt.Errorf("session %s already exists", requested)
+		}
+		return requested, nil
+	}
+
+	candidate := bundled
+	for n := 1; n <= maxRemapAttempts; n++ {
+		exists, err := sessionExists(store, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-import-%d", bundled, n)
+	}
+	return "", fmt.Errorf("no free session ID for %s after %d attempts", bundled, maxRemapAttempts)
+}
+
+// sessionExists reports whether the store holds metadata, operations or
+// spans for sessionID.
+func sessionExists(store storage.OperationStore, sessionID string) (bool, error) {
+	_, err := store.GetSession(sessionID)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, storage.ErrSessionNotFound) {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+
+	ops, err := store.QueryOperations(sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	if len(ops) > 0 {
+		return true, nil
+	}
+
+	spans, err := store.QueryReconcileSpans(sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return len(spans) > 0, nil
+}
+
+// importedSession returns the metadata to begin the imported session with.
+func importedSession(b *Bundle, sessionID string, description string) storage.Session {
+	if b.Manifest.Session == nil {
+		if len(description) == 0 {
+			description = "Imported from bundle of session " + b.Manifest.SessionID
+		}
+		return storage.Session{ID: sessionID, Description: description}
+	}
+
+	meta := *b.Manifest.Session
+	meta.ID = sessionID
+	return meta
+}
+
+// importRecords inserts the operations, events and spans of b into
+// sessionID, remapping span IDs when the session was remapped.
+// Rule 2: Bounded by the number of records in the bundle.
+func importRecords(store storage.OperationStore, b *Bundle, sessionID string, remap bool) error {
+	spanIDs := make(map[string]string, len(b.Spans))
+	for i := 0; i < len(b.Spans); i++ {
+		span := b.Spans[i]
+		span.SessionID = sessionID
+		if remap {
+			span.ID = spanAlias(span.ID, sessionID)
+			spanIDs[b.Spans[i].ID] = span.ID
+		}
+		err := store.InsertReconcileSpan(&span)
+		if err != nil {
+			return fmt.Errorf("failed to insert reconcile span %s: %w", span.ID, err)
+		}
+	}
+
+	ops := make([]storage.Operation, 0, len(b.Operations)+len(b.Events))
+	ops = append(ops, b.Operations...)
+	ops = append(ops, b.Events...)
+	storage.SortOperations(ops)
+
+	batch := make([]*storage.Operation, 0, importBatchSize)
+	for i := 0; i < len(ops); i++ {
+		ops[i].ID = 0
+		ops[i].SessionID = sessionID
+		alias, ok := spanIDs[ops[i].SpanID]
+		if ok {
+			ops[i].SpanID = alias
+		}
+
+		batch = append(batch, &ops[i])
+		if len(batch) == importBatchSize || i == len(ops)-1 {
+			err := store.InsertOperations(batch)
+			if err != nil {
+				return fmt.Errorf("failed to insert operations: %w", err)
+			}
+			batch = batch[:0]
+		}
+	}
+	return nil
+}
+
+// importCounters restores the recorder counters and redaction rules.
+func importCounters(store storage.OperationStore, sessionID string, meta *storage.Session) error {
+	if meta == nil {
+		return nil
+	}
+
+	if meta.DroppedOperations > 0 {
+		err := store.AddDroppedOperations(sessionID, meta.DroppedOperations)
+		if err != nil {
+			return fmt.Errorf("failed to restore dropped operations: %w", err)
+		}
+	}
+
+	if meta.FilteredOperations > 0 {
+		err := store.AddFilteredOperations(sessionID, meta.FilteredOperations)
+		if err != nil {
+			return fmt.Errorf("failed to restore filtered operations: %w", err)
+		}
+	}
+
+	if len(meta.Redaction) > 0 {
+		err := store.SetSessionRedaction(sessionID, meta.Redaction)
+		if err != nil {
+			return fmt.Errorf("failed to restore redaction rules: %w", err)
+		}
+	}
+	return nil
+}
+
+// finalStatus returns the status to end the imported session with.
+func finalStatus(meta *storage.Session) storage.SessionStatus {
+	if meta == nil {
+		return storage.SessionCompleted
+	}
+
+	switch meta.Status {
+	case storage.SessionFailed, storage.SessionAborted:
+		return meta.Status
+	case storage.SessionRunning:
+		return storage.SessionAborted
+	default:
+		return storage.SessionCompleted
+	}
+}
+
+// spanAlias returns the ID of span id once imported into sessionID. It
+// keeps a readable prefix of id and adds a hash of both, so importing one
+// bundle several times gives distinct span IDs.
+func spanAlias(id string, sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID + "\x00" + id))
+	prefix := id
+	if len(prefix) > spanAliasPrefixLen {
+		prefix = prefix[:spanAliasPrefixLen]
+	}
+	return prefix + "-" + hex.EncodeToString(sum[:8])
+}
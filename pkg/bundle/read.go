@@ -0,0 +1,293 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+// Read decodes a bundle from r and checks its integrity: the archive and
+// compression checksums, the size, checksum and record count of every file
+// listed in the manifest, and the validity of every record.
+// Rule 2: Bounded by the number of files a bundle holds.
+func Read(r io.Reader) (*Bundle, error) {
+	err := assert.AssertNotNil(r, "reader")
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a kubestep bundle: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	manifest, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(dataFiles))
+	for i := 0; i <= len(dataFiles); i++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupt bundle: %w", err)
+		}
+
+		entry, ok := manifest.file(hdr.Name)
+		if !ok || files[hdr.Name] != nil || hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("corrupt bundle: unexpected entry %q", hdr.Name)
+		}
+		data, err := readEntry(tr, hdr, maxFileBytes)
+		if err != nil {
+			return nil, err
+		}
+		err = entry.verify(data)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = data
+	}
+
+	// Draining the stream makes gzip check its trailing checksum.
+	_, err = io.Copy(io.Discard, io.LimitReader(zr, maxManifestBytes))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt bundle: %w", err)
+	}
+
+	if len(files) != len(dataFiles) {
+		return nil, fmt.Errorf("corrupt bundle: %d of %d files present", len(files), len(dataFiles))
+	}
+
+	return decodeBundle(manifest, files)
+}
+
+// readManifest reads and checks the first archive entry.
+// Rule 5: Multiple assertions for validation.
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("not a kubestep bundle: %w", err)
+	}
+	if hdr.Name != manifestFile || hdr.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("not a kubestep bundle: first entry is %q, want %s", hdr.Name, manifestFile)
+	}
+
+	data, err := readEntry(tr, hdr, maxManifestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt bundle manifest: %w", err)
+	}
+
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("not a kubestep bundle: format %q", manifest.Format)
+	}
+	if manifest.SchemaVersion < 1 || manifest.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported bundle schema version %d (this kubestep reads up to %d)",
+			manifest.SchemaVersion, SchemaVersion)
+	}
+
+	err = assert.AssertStringNotEmpty(manifest.SessionID, "bundle session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(manifest.Files) != len(dataFiles) {
+		return nil, fmt.Errorf("corrupt bundle manifest: %d files listed, want %d", len(manifest.Files), len(dataFiles))
+	}
+	for i := 0; i < len(dataFiles); i++ {
+		_, ok := manifest.file(dataFiles[i])
+		if !ok {
+			return nil, fmt.Errorf("corrupt bundle manifest: %s not listed", dataFiles[i])
+		}
+	}
+
+	return &manifest, nil
+}
+
+// file returns the manifest entry of name.
+// Rule 2: Bounded by the number of files listed.
+func (m *Manifest) file(name string) (FileEntry, bool) {
+	for i := 0; i < len(m.Files); i++ {
+		if m.Files[i].Name == name {
+			return m.Files[i], true
+		}
+	}
+	return FileEntry{}, false
+}
+
+// verify checks data against the size and checksum the manifest lists.
+func (e FileEntry) verify(data []byte) error {
+	if int64(len(data)) != e.Size {
+		return fmt.Errorf("corrupt bundle: %s is %d bytes, manifest lists %d", e.Name, len(data), e.Size)
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != e.SHA256 {
+		return fmt.Errorf("corrupt bundle: checksum mismatch for %s", e.Name)
+	}
+	return nil
+}
+
+// readEntry reads the current archive entry, refusing one over limit bytes.
+func readEntry(tr *tar.Reader, hdr *tar.Header, limit int64) ([]byte, error) {
+	if hdr.Size < 0 || hdr.Size > limit {
+		return nil, fmt.Errorf("corrupt bundle: %s is %d bytes, limit %d", hdr.Name, hdr.Size, limit)
+	}
+
+	data := make([]byte, hdr.Size)
+	_, err := io.ReadFull(tr, data)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt bundle: failed to read %s: %w", hdr.Name, err)
+	}
+	return data, nil
+}
+
+// decodeBundle parses the record files and checks them against the manifest.
+func decodeBundle(manifest *Manifest, files map[string][]byte) (*Bundle, error) {
+	b := &Bundle{Manifest: *manifest}
+
+	if manifest.Session != nil {
+		if manifest.Session.ID != manifest.SessionID {
+			return nil, fmt.Errorf("corrupt bundle manifest: session metadata is for %q", manifest.Session.ID)
+		}
+		err := storage.ValidateSession(manifest.Session)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle session: %w", err)
+		}
+	}
+
+	var err error
+	b.Operations, err = decodeOperations(manifest, operationsFile, files[operationsFile], false)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Events, err = decodeOperations(manifest, eventsFile, files[eventsFile], true)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Spans, err = decodeSpans(manifest, files[spansFile])
+	if err != nil {
+		return nil, err
+	}
+
+	counts := Counts{
+		Operations: int64(len(b.Operations)),
+		Spans:      int64(len(b.Spans)),
+		Events:     int64(len(b.Events)),
+	}
+	if counts != manifest.Counts {
+		return nil, fmt.Errorf("corrupt bundle: counts %+v, manifest lists %+v", counts, manifest.Counts)
+	}
+	return b, nil
+}
+
+// decodeOperations parses and validates the operation records of one file.
+// events selects whether it holds only OperationEvent records or none.
+// Rule 2: Bounded by maxBundleRecords.
+func decodeOperations(manifest *Manifest, name string, data []byte, events bool) ([]storage.Operation, error) {
+	ops := make([]storage.Operation, 0, 64)
+	err := eachLine(name, data, func(line []byte) error {
+		op, err := storage.UnmarshalOperation(line)
+		if err != nil {
+			return err
+		}
+		if op.SessionID != manifest.SessionID {
+			return fmt.Errorf("operation %d belongs to session %q", op.SequenceNumber, op.SessionID)
+		}
+		if (op.OperationType == storage.OperationEvent) != events {
+			return fmt.Errorf("operation %d has type %s", op.SequenceNumber, op.OperationType)
+		}
+		err = storage.ValidateOperation(&op)
+		if err != nil {
+			return fmt.Errorf("invalid operation %d: %w", op.SequenceNumber, err)
+		}
+		ops = append(ops, op)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry, _ := manifest.file(name)
+	if int64(len(ops)) != entry.Records {
+		return nil, fmt.Errorf("corrupt bundle: %s has %d records, manifest lists %d", name, len(ops), entry.Records)
+	}
+	return ops, nil
+}
+
+// decodeSpans parses and validates the reconcile span records.
+// Rule 2: Bounded by maxBundleRecords.
+func decodeSpans(manifest *Manifest, data []byte) ([]storage.ReconcileSpan, error) {
+	spans := make([]storage.ReconcileSpan, 0, 16)
+	err := eachLine(spansFile, data, func(line []byte) error {
+		var span storage.ReconcileSpan
+		err := json.Unmarshal(line, &span)
+		if err != nil {
+			return fmt.Errorf("corrupt reconcile span record: %w", err)
+		}
+		if span.SessionID != manifest.SessionID {
+			return fmt.Errorf("reconcile span %s belongs to session %q", span.ID, span.SessionID)
+		}
+		err = storage.ValidateReconcileSpan(&span)
+		if err != nil {
+			return fmt.Errorf("invalid reconcile span %s: %w", span.ID, err)
+		}
+		spans = append(spans, span)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry, _ := manifest.file(spansFile)
+	if int64(len(spans)) != entry.Records {
+		return nil, fmt.Errorf("corrupt bundle: %s has %d records, manifest lists %d", spansFile, len(spans), entry.Records)
+	}
+	return spans, nil
+}
+
+// eachLine calls visit with every line of data.
+// Rule 2: Bounded by maxBundleRecords.
+func eachLine(name string, data []byte, visit func(line []byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 65536), maxRecordBytes)
+
+	line := 0
+	for scanner.Scan() {
+		line = line + 1
+		if line > maxBundleRecords {
+			return fmt.Errorf("%s: more than %d records", name, maxBundleRecords)
+		}
+		err := visit(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package proxy provides an HTTP handler that forwards Kubernetes API
+// requests to an upstream server and records them, so any client can be
+// recorded without changing it.
+package proxy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync/atomic"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/recorder"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"k8s.io/client-go/rest"
+)
+
+// unauthorizedStatus is the body of the response to a request without the
+// proxy token, a Status client-go reports as an ordinary 401.
+const unauthorizedStatus = `{"kind":"Status","apiVersion":"v1","metadata":{},` +
+	`"status":"Failure","message":"Unauthorized","reason":"Unauthorized","code":401}`
+
+// Config holds configuration for the recording proxy.
+type Config struct {
+	// Upstream is the API server requests are forwarded to. Its credentials
+	// replace any the client sends, and impersonation headers are dropped,
+	// so clients act only as the upstream user.
+	Upstream *rest.Config
+	// Token, when set, is the bearer token every client must send. The
+	// proxy forwards requests with the upstream credentials, so it must not
+	// be reachable by anyone else; requests without it get a 401.
+	Token       string
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	ActorID     string
+	ReplicaID   string
+	Async       *recorder.AsyncConfig
+	Redaction   *recorder.RedactionPolicy
+	Filter      *recorder.FilterSpec
+	Session     *storage.Session
+}
+
+// Proxy is an http.Handler that records each API request it forwards.
+// Watch streams are passed through as they arrive and every JSON watch
+// event is recorded as an OperationWatch after the WATCH request itself.
+type Proxy struct {
+	token     string
+	reverse   *httputil.ReverseProxy
+	recorder  *recorder.TransportRecorder
+	watches   *recorder.WatchRecorder
+	undecoded int64
+}
+
+// New creates a recording proxy for cfg.Upstream.
+// Rule 5: Multiple assertions for validation.
+func New(cfg Config) (*Proxy, error) {
+	err := assert.Assert(cfg.Upstream != nil, "upstream config must not be nil")
+	if err != nil {
+		return nil, err
+	}
+
+	target, _, err := rest.DefaultServerUrlFor(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream address: %w", err)
+	}
+
+	transport, err := rest.TransportFor(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream transport: %w", err)
+	}
+
+	rec, err := recorder.NewTransportRecorder(recorder.TransportConfig{
+		Database:    cfg.Database,
+		SessionID:   cfg.SessionID,
+		MaxSequence: cfg.MaxSequence,
+		ActorID:     cfg.ActorID,
+		ReplicaID:   cfg.ReplicaID,
+		Async:       cfg.Async,
+		Redaction:   cfg.Redaction,
+		Filter:      cfg.Filter,
+		Session:     cfg.Session,
+		BasePath:    target.Path,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watches, err := rec.Watches()
+	if err != nil {
+		_ = rec.Close()
+		return nil, err
+	}
+
+	p := &Proxy{token: cfg.Token, recorder: rec, watches: watches}
+	// FlushInterval -1 flushes after every write so watch events reach the
+	// client as soon as the upstream sends them.
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			stripClientAuth(r.Out.Header)
+		},
+		Transport:      rec.Wrap(transport),
+		FlushInterval:  -1,
+		ModifyResponse: p.recordWatchEvents,
+	}
+
+	return p, nil
+}
+
+// ServeHTTP forwards r upstream and records it. Requests without the proxy
+// token are rejected unrecorded.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, unauthorizedStatus)
+		return
+	}
+	p.reverse.ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries the proxy token, or no token is
+// required.
+func (p *Proxy) authorized(r *http.Request) bool {
+	if len(p.token) == 0 {
+		return true
+	}
+	want := "Bearer " + p.token
+	got := r.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// stripClientAuth removes the client credentials and impersonation headers
+// (Impersonate-User, -Group, -Uid and -Extra-*) from a forwarded request.
+// Rule 2: Bounded by the number of headers.
+func stripClientAuth(header http.Header) {
+	header.Del("Authorization")
+	for name := range header {
+		if strings.HasPrefix(name, "Impersonate-") {
+			delete(header, name)
+		}
+	}
+}
+
+// Enable turns recording on.
+func (p *Proxy) Enable() {
+	p.recorder.Enable()
+}
+
+// Disable turns recording off. Requests are still forwarded.
+func (p *Proxy) Disable() {
+	p.recorder.Disable()
+}
+
+// GetSequenceNumber returns current sequence number.
+func (p *Proxy) GetSequenceNumber() int64 {
+	return p.recorder.GetSequenceNumber()
+}
+
+// RecordFailures returns how many requests and watch events could not be
+// recorded, including watch events that could not be decoded.
+func (p *Proxy) RecordFailures() int64 {
+	return p.recorder.RecordFailures() + atomic.LoadInt64(&p.undecoded)
+}
+
+// Close flushes queued operations and stops recording. Requests forwarded
+// afterwards are no longer recorded.
+func (p *Proxy) Close() error {
+	return p.recorder.Close()
+}
+
+// recordWatchEvents taps successful JSON watch responses so each event is
+// recorded as it is read. Protobuf watch streams are forwarded unrecorded.
+func (p *Proxy) recordWatchEvents(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK || resp.Body == nil {
+		return nil
+	}
+
+	info := p.recorder.RequestInfo(resp.Request)
+	if !info.IsResourceRequest || info.Verb != "watch" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return nil
+	}
+
+	resp.Body = newWatchEventReader(resp.Body, p)
+	return nil
+}
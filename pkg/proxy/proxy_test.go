@@ -0,0 +1,282 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	testSessionID = "proxy-session"
+	upstreamToken = "upstream-token"
+	configMapJSON = `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo",` +
+		`"namespace":"default","uid":"uid-1","resourceVersion":"7"}}`
+	goneJSON = `{"kind":"Status","apiVersion":"v1","status":"Failure",` +
+		`"message":"too old resource version","reason":"Expired","code":410}`
+)
+
+func watchLine(eventType, object string) string {
+	return fmt.Sprintf("{\"type\":%q,\"object\":%s}\n", eventType, object)
+}
+
+// newUpstream serves a configmap and a watch that sends ADDED, MODIFIED
+// split across two writes, DELETED and an ERROR, rejecting requests without
+// the upstream token.
+func newUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps/demo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(configMapJSON))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		flusher := w.(http.Flusher)
+		modified := watchLine("MODIFIED", configMapJSON)
+		chunks := []string{
+			watchLine("ADDED", configMapJSON),
+			modified[:20],
+			modified[20:],
+			watchLine("DELETED", configMapJSON),
+			watchLine("ERROR", goneJSON),
+		}
+		for _, chunk := range chunks {
+			_, _ = io.WriteString(w, chunk)
+			flusher.Flush()
+		}
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+upstreamToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestProxy(t *testing.T, upstream string) (*Proxy, *storage.Database, *httptest.Server) {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "proxy.db"), 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+	})
+
+	p, err := New(Config{
+		Upstream:  &rest.Config{Host: upstream, BearerToken: upstreamToken},
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "proxy-test",
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return p, db, srv
+}
+
+func TestProxyRecordsRequestsAndWatchEvents(t *testing.T) {
+	ctx := context.Background()
+	p, db, srv := newTestProxy(t, newUpstream(t).URL)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, BearerToken: "client-token"})
+	require.NoError(t, err)
+
+	cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, "demo", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "uid-1", string(cm.UID))
+
+	watcher, err := client.CoreV1().ConfigMaps("default").Watch(ctx, metav1.ListOptions{LabelSelector: "app=demo"})
+	require.NoError(t, err)
+	received := []watch.EventType{}
+	for event := range watcher.ResultChan() {
+		received = append(received, event.Type)
+	}
+	assert.Equal(t, []watch.EventType{watch.Added, watch.Modified, watch.Deleted, watch.Error}, received)
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, int64(0), p.RecordFailures())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 6)
+
+	assert.Equal(t, storage.OperationGet, ops[0].OperationType)
+	assert.Equal(t, "configmaps", ops[0].Resource)
+	assert.Equal(t, "demo", ops[0].Name)
+	assert.Equal(t, "proxy-test", ops[0].ActorID)
+
+	assert.Equal(t, storage.OperationWatch, ops[1].OperationType)
+	assert.Equal(t, "watch", ops[1].Verb)
+	assert.Empty(t, ops[1].EventType)
+	assert.Equal(t, "app=demo", ops[1].LabelSelector)
+
+	for i, eventType := range []string{"ADDED", "MODIFIED", "DELETED"} {
+		op := ops[i+2]
+		assert.Equal(t, storage.OperationWatch, op.OperationType)
+		assert.Equal(t, eventType, op.EventType)
+		assert.Equal(t, "ConfigMap", op.ResourceKind)
+		assert.Equal(t, "default", op.Namespace)
+		assert.Equal(t, "demo", op.Name)
+		assert.Equal(t, "uid-1", op.UID)
+		assert.Equal(t, "7", op.ResourceVersion)
+	}
+
+	assert.Equal(t, "ERROR", ops[5].EventType)
+	assert.Equal(t, "too old resource version", ops[5].Error)
+}
+
+func TestProxyStreamsWatchEvents(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, watchLine("ADDED", configMapJSON))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = io.WriteString(w, watchLine("MODIFIED", configMapJSON))
+	}))
+	defer upstream.Close()
+
+	p, db, srv := newTestProxy(t, upstream.URL)
+
+	resp, err := http.Get(srv.URL + "/api/v1/namespaces/default/configmaps?watch=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// The first event must arrive while the upstream still holds the stream.
+	lines := make(chan string, 2)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, readErr := reader.ReadString('\n')
+			if readErr != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	select {
+	case line := <-lines:
+		assert.Contains(t, line, `"ADDED"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("first watch event was not streamed")
+	}
+	close(release)
+	assert.Contains(t, <-lines, `"MODIFIED"`)
+
+	require.NoError(t, p.Close())
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	assert.Equal(t, "ADDED", ops[1].EventType)
+	assert.Equal(t, "MODIFIED", ops[2].EventType)
+}
+
+func TestWatchEventReaderCountsBadEvents(t *testing.T) {
+	p, db, _ := newTestProxy(t, "http://127.0.0.1:1")
+
+	stream := "not json\n" + `{"type":"ADDED"}` + "\n" +
+		`{"type":"ADDED","object":{"metadata":` + strings.Repeat(" ", maxWatchEventSize) + "}}\n" +
+		strings.TrimSuffix(watchLine("ADDED", configMapJSON), "\n")
+	reader := newWatchEventReader(io.NopCloser(strings.NewReader(stream)), p)
+
+	out, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, stream, string(out))
+	assert.Equal(t, int64(3), p.RecordFailures())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "ADDED", ops[0].EventType)
+}
+
+func TestProxyRequiresTokenAndDropsImpersonation(t *testing.T) {
+	var forwarded http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(configMapJSON))
+	}))
+	defer upstream.Close()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "proxy.db"), 1000)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+	p, err := New(Config{
+		Upstream:  &rest.Config{Host: upstream.URL, BearerToken: upstreamToken},
+		Token:     "proxy-token",
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "proxy-test",
+	})
+	require.NoError(t, err)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	send := func(token string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/namespaces/default/configmaps/demo", nil)
+		require.NoError(t, err)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("Impersonate-User", "system:admin")
+		req.Header.Add("Impersonate-Group", "system:masters")
+		req.Header.Set("Impersonate-Uid", "uid-0")
+		req.Header.Set("Impersonate-Extra-Scopes", "all")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send("").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, send("wrong-token").StatusCode)
+	assert.Nil(t, forwarded, "unauthorized requests must not reach the upstream")
+
+	assert.Equal(t, http.StatusOK, send("proxy-token").StatusCode)
+	assert.Equal(t, "Bearer "+upstreamToken, forwarded.Get("Authorization"))
+	for name := range forwarded {
+		assert.False(t, strings.HasPrefix(name, "Impersonate-"), name)
+	}
+
+	require.NoError(t, p.Close())
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	assert.Len(t, ops, 1)
+}
+
+func TestNewRequiresUpstream(t *testing.T) {
+	_, err := New(Config{SessionID: testSessionID})
+	require.Error(t, err)
+}
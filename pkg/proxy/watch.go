@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	maxWatchEventSize = 2 * 1048576 // storage resource_data limit plus framing
+)
+
+// watchEventReader passes a JSON watch stream through unchanged while
+// recording each newline-delimited event once it is complete.
+type watchEventReader struct {
+	body    io.ReadCloser
+	proxy   *Proxy
+	pending []byte
+	// skipping discards the rest of an event that outgrew maxWatchEventSize.
+	skipping bool
+}
+
+func newWatchEventReader(body io.ReadCloser, p *Proxy) *watchEventReader {
+	return &watchEventReader{body: body, proxy: p}
+}
+
+// Read returns the upstream bytes as-is; recording never alters the stream.
+func (r *watchEventReader) Read(b []byte) (int, error) {
+	n, err := r.body.Read(b)
+	if n > 0 {
+		r.scan(b[:n])
+	}
+	if err == io.EOF {
+		r.emit()
+	}
+	return n, err
+}
+
+// Close closes the upstream body.
+func (r *watchEventReader) Close() error {
+	return r.body.Close()
+}
+
+// scan buffers data and records every event completed by a newline.
+// Rule 2: Bounded by len(data); each pass consumes at least one byte.
+func (r *watchEventReader) scan(data []byte) {
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			r.buffer(data)
+			return
+		}
+		r.buffer(data[:idx])
+		r.emit()
+		data = data[idx+1:]
+	}
+}
+
+// buffer appends part of an event, dropping events that are too large.
+func (r *watchEventReader) buffer(data []byte) {
+	if r.skipping {
+		return
+	}
+	if len(r.pending)+len(data) > maxWatchEventSize {
+		r.pending = r.pending[:0]
+		r.skipping = true
+		atomic.AddInt64(&r.proxy.undecoded, 1)
+		return
+	}
+	r.pending = append(r.pending, data...)
+}
+
+// emit records the buffered event, if any, and resets the buffer.
+func (r *watchEventReader) emit() {
+	line := bytes.TrimSpace(r.pending)
+	if len(line) > 0 && !r.skipping {
+		r.proxy.recordEvent(line)
+	}
+	r.pending = r.pending[:0]
+	r.skipping = false
+}
+
+// recordEvent decodes one watch event and records it. Events that cannot
+// be decoded are counted; the stream is unaffected.
+func (p *Proxy) recordEvent(line []byte) {
+	eventType, obj, err := decodeWatchEvent(line)
+	if err != nil {
+		atomic.AddInt64(&p.undecoded, 1)
+		return
+	}
+
+	_ = p.watches.RecordEvent(eventType, obj)
+}
+
+// decodeWatchEvent parses a metav1.WatchEvent. ERROR events carry a
+// metav1.Status; other objects are decoded as unstructured.
+func decodeWatchEvent(line []byte) (watch.EventType, runtime.Object, error) {
+	var event metav1.WatchEvent
+	err := json.Unmarshal(line, &event)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode watch event: %w", err)
+	}
+	if len(event.Type) == 0 || len(event.Object.Raw) == 0 {
+		return "", nil, fmt.Errorf("watch event without type or object")
+	}
+
+	eventType := watch.EventType(event.Type)
+	if eventType == watch.Error {
+		status := &metav1.Status{}
+		err = json.Unmarshal(event.Object.Raw, status)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode watch error: %w", err)
+		}
+		return eventType, status, nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	err = obj.UnmarshalJSON(event.Object.Raw)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode watch object: %w", err)
+	}
+	return eventType, obj, nil
+}
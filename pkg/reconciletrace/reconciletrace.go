@@ -13,11 +13,15 @@ import (
 
 type spanContextKey string
 
+// activeSpanKey holds the ID of the span a context belongs to.
+type activeSpanKey struct{}
+
 const (
 	defaultActorID = "unknown"
 )
 
-// Start begins a reconcile span and returns the span ID plus a context carrying span timing.
+// Start begins a reconcile span and returns the span ID plus a context carrying
+// span timing. Calls recorded with the returned context are linked to the span.
 func Start(
 	ctx context.Context,
 	store storage.ReconcileSpanStore,
@@ -78,9 +82,20 @@ func Start(
 	}
 
 	ctx = context.WithValue(ctx, spanContextKey(spanID), startTime)
+	ctx = context.WithValue(ctx, activeSpanKey{}, spanID)
 	return spanID, ctx
 }
 
+// SpanIDFromContext returns the ID of the innermost span started on ctx, or
+// "" when there is none.
+func SpanIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	spanID, _ := ctx.Value(activeSpanKey{}).(string)
+	return spanID
+}
+
 // End ends a reconcile span and records duration and error.
 func End(
 	ctx context.Context,
@@ -4,43 +4,21 @@ import (
 	"context"
 	"errors"
 	"testing"
-	"time"
 
 	"github.com/slyt3/kubestep/pkg/storage"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-type fakeSpanStore struct {
-	inserted *storage.ReconcileSpan
-	ended    bool
-	endID    string
-	endErr   string
-}
-
-func (f *fakeSpanStore) InsertReconcileSpan(span *storage.ReconcileSpan) error {
-	f.inserted = span
-	return nil
-}
-
-func (f *fakeSpanStore) EndReconcileSpan(
-	spanID string,
-	endTime time.Time,
-	durationMs int64,
-	errMsg string,
-) error {
-	f.ended = true
-	f.endID = spanID
-	f.endErr = errMsg
-	return nil
-}
+func newTestSpanStore(t *testing.T) *storage.MemoryStore {
+	t.Helper()
 
-func (f *fakeSpanStore) QueryReconcileSpans(sessionID string) ([]storage.ReconcileSpan, error) {
-	return nil, nil
+	store := storage.NewMemoryStore()
+	return store
 }
 
 func TestStartAndEndSpan(t *testing.T) {
-	store := &fakeSpanStore{}
+	store := newTestSpanStore(t)
 	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
 
 	spanID, ctx := Start(
@@ -58,14 +36,22 @@ func TestStartAndEndSpan(t *testing.T) {
 
 	require.NotEmpty(t, spanID)
 	require.NotNil(t, ctx)
-	require.NotNil(t, store.inserted)
-	require.Equal(t, "unknown", store.inserted.ActorID)
-	require.Equal(t, "Deployment", store.inserted.Kind)
+	spans, err := store.QueryReconcileSpans("session-1")
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	require.Equal(t, spanID, spans[0].ID)
+	require.Equal(t, "unknown", spans[0].ActorID)
+	require.Equal(t, "Deployment", spans[0].Kind)
+	require.True(t, spans[0].EndTime.IsZero())
+	require.Equal(t, spanID, SpanIDFromContext(ctx))
+	require.Empty(t, SpanIDFromContext(context.Background()))
 
 	End(ctx, store, spanID, errors.New("boom"))
-	require.True(t, store.ended)
-	require.Equal(t, spanID, store.endID)
-	require.Equal(t, "boom", store.endErr)
+	spans, err = store.QueryReconcileSpans("session-1")
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	require.False(t, spans[0].EndTime.IsZero())
+	require.Equal(t, "boom", spans[0].Error)
 }
 
 func TestStartValidationFailures(t *testing.T) {
@@ -73,12 +59,12 @@ func TestStartValidationFailures(t *testing.T) {
 	require.Empty(t, spanID)
 	require.NotNil(t, ctx)
 
-	store := &fakeSpanStore{}
+	store := newTestSpanStore(t)
 	spanID, _ = Start(context.Background(), store, "", "actor", schema.GroupVersionKind{}, "", "", "", "", "")
 	require.Empty(t, spanID)
 }
 
 func TestEndValidationFailures(t *testing.T) {
 	End(context.Background(), nil, "span-1", nil)
-	End(context.Background(), &fakeSpanStore{}, "", nil)
+	End(context.Background(), newTestSpanStore(t), "", nil)
 }
@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// maxRecordedCauses bounds the causes kept from one API error.
+const maxRecordedCauses = 100
+
+// setErrorDetails copies the metav1.Status carried by an API error onto op.
+// Errors that did not come from the API server, such as timeouts on the
+// client side, leave the structured fields empty.
+func setErrorDetails(op *storage.Operation, err error) {
+	if op == nil || err == nil {
+		return
+	}
+
+	var apiStatus apierrors.APIStatus
+	if !errors.As(err, &apiStatus) {
+		return
+	}
+	setStatusDetails(op, apiStatus.Status())
+}
+
+// setStatusDetails copies code, reason, causes and retry-after from status.
+// Rule 2: Bounded by maxRecordedCauses.
+func setStatusDetails(op *storage.Operation, status metav1.Status) {
+	op.ErrorCode = status.Code
+	op.ErrorReason = string(status.Reason)
+	if len(op.ErrorReason) == 0 && status.Code > 0 {
+		op.ErrorReason = string(reasonForCode(int(status.Code)))
+	}
+
+	details := status.Details
+	if details == nil {
+		return
+	}
+
+	if details.RetryAfterSeconds > 0 {
+		op.RetryAfterSeconds = details.RetryAfterSeconds
+	}
+
+	count := len(details.Causes)
+	if count > maxRecordedCauses {
+		count = maxRecordedCauses
+	}
+	if count == 0 {
+		return
+	}
+
+	op.ErrorCauses = make([]storage.ErrorCause, 0, count)
+	for i := 0; i < count; i++ {
+		cause := details.Causes[i]
+		op.ErrorCauses = append(op.ErrorCauses, storage.ErrorCause{
+			Type:    string(cause.Type),
+			Message: cause.Message,
+			Field:   cause.Field,
+		})
+	}
+}
+
+// responseStatus builds the metav1.Status for a failed HTTP response. A
+// Status body is used as is; any other body gets the status client-go would
+// derive from the response code. A Retry-After header fills in a missing
+// retry delay.
+func responseStatus(
+	info RequestInfo,
+	method string,
+	statusCode int,
+	header http.Header,
+	envelope *transportEnvelope,
+) metav1.Status {
+	retryAfter := 0
+	if value, err := strconv.Atoi(header.Get("Retry-After")); err == nil && value > 0 {
+		retryAfter = value
+	}
+
+	var status metav1.Status
+	if envelope != nil && envelope.Kind == "Status" {
+		status = metav1.Status{
+			Code:    envelope.Code,
+			Reason:  envelope.Reason,
+			Message: envelope.Message,
+			Details: envelope.Details,
+		}
+		if status.Code == 0 {
+			status.Code = int32(statusCode)
+		}
+	} else {
+		generic := apierrors.NewGenericServerResponse(
+			statusCode,
+			method,
+			schema.GroupResource{Group: info.APIGroup, Resource: info.Resource},
+			info.Name,
+			"",
+			retryAfter,
+			false,
+		)
+		status = generic.ErrStatus
+	}
+
+	if retryAfter > 0 {
+		if status.Details == nil {
+			status.Details = &metav1.StatusDetails{}
+		}
+		if status.Details.RetryAfterSeconds == 0 {
+			status.Details.RetryAfterSeconds = int32(retryAfter)
+		}
+	}
+	return status
+}
+
+// reasonForCode returns the StatusReason client-go assigns to an HTTP status
+// code when the server sends no Status body.
+func reasonForCode(code int) metav1.StatusReason {
+	generic := apierrors.NewGenericServerResponse(code, "", schema.GroupResource{}, "", "", 0, false)
+	return generic.ErrStatus.Reason
+}
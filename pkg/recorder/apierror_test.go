@@ -0,0 +1,119 @@
+package recorder
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const invalidJSON = `{"kind":"Status","apiVersion":"v1","status":"Failure",` +
+	`"message":"ConfigMap \"demo\" is invalid","reason":"Invalid","code":422,` +
+	`"details":{"name":"demo","kind":"configmaps","causes":[` +
+	`{"reason":"FieldValueInvalid","message":"bad key","field":"data.a b"}]}}`
+
+func TestRecordClientAPIErrorDetails(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInvalid(
+			schema.GroupKind{Kind: "ConfigMap"},
+			"demo",
+			field.ErrorList{field.Invalid(field.NewPath("data").Key("a b"), "x", "bad key")},
+		)
+	})
+	client.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewTooManyRequests("slow down", 7)
+	})
+	rec, db := newTestRecorder(t, client)
+
+	_, err := rec.RecordCreate(ctx, "ConfigMap", "default", &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+	}, metav1.CreateOptions{})
+	require.Error(t, err)
+
+	_, err = rec.RecordGet(ctx, "ConfigMap", "default", "demo", metav1.GetOptions{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	assert.Equal(t, int32(http.StatusUnprocessableEntity), ops[0].ErrorCode)
+	assert.Equal(t, string(metav1.StatusReasonInvalid), ops[0].ErrorReason)
+	require.Len(t, ops[0].ErrorCauses, 1)
+	assert.Equal(t, "data[a b]", ops[0].ErrorCauses[0].Field)
+	assert.Equal(t, string(metav1.CauseTypeFieldValueInvalid), ops[0].ErrorCauses[0].Type)
+
+	assert.Equal(t, int32(http.StatusTooManyRequests), ops[1].ErrorCode)
+	assert.Equal(t, string(metav1.StatusReasonTooManyRequests), ops[1].ErrorReason)
+	assert.Equal(t, int32(7), ops[1].RetryAfterSeconds)
+}
+
+func TestTransportRecordsAPIErrorDetails(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(invalidJSON))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps/busy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("slow down"))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps/taken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	rec, db := newTestTransportRecorder(t)
+	rt := rec.Wrap(http.DefaultTransport)
+
+	send := func(method string, path string, body string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		// The body is recorded as it is read, as client-go reads it.
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	send(http.MethodPost, "/api/v1/namespaces/default/configmaps", `{"metadata":{"name":"demo"}}`)
+	send(http.MethodGet, "/api/v1/namespaces/default/configmaps/busy", "")
+	send(http.MethodPut, "/api/v1/namespaces/default/configmaps/taken", `{}`)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	assert.Equal(t, `ConfigMap "demo" is invalid`, ops[0].Error)
+	assert.Equal(t, int32(422), ops[0].ErrorCode)
+	assert.Equal(t, "Invalid", ops[0].ErrorReason)
+	assert.Equal(t, []storage.ErrorCause{
+		{Type: "FieldValueInvalid", Message: "bad key", Field: "data.a b"},
+	}, ops[0].ErrorCauses)
+
+	assert.Equal(t, int32(429), ops[1].ErrorCode)
+	assert.Equal(t, "TooManyRequests", ops[1].ErrorReason)
+	assert.Equal(t, int32(5), ops[1].RetryAfterSeconds)
+
+	assert.Equal(t, int32(409), ops[2].ErrorCode)
+	assert.Equal(t, "Conflict", ops[2].ErrorReason)
+}
@@ -0,0 +1,398 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	auditAPIVersion   = "audit.k8s.io/v1"
+	maxAuditLineSize  = 16 * 1048576 // RequestResponse events carry two bodies
+	maxAuditLines     = 10000000
+	auditBatchSize    = 1000
+	defaultAuditActor = "audit"
+)
+
+// AuditConfig holds configuration for importing an API server audit log.
+type AuditConfig struct {
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	Redaction   *RedactionPolicy
+	// Users keeps events by these users, matched against the impersonated
+	// user when there is one. Service accounts appear as
+	// system:serviceaccount:<namespace>:<name>.
+	Users []string
+	Verbs []string
+	// Resources keeps events for these resources, written as pods,
+	// deployments.apps or pods/status.
+	Resources []string
+	// Since and Until bound the request received time. Zero values leave
+	// the range open.
+	Since time.Time
+	Until time.Time
+}
+
+// AuditImportResult counts the events an import read and stored.
+type AuditImportResult struct {
+	Events   int64
+	Imported int64
+	// Skipped counts events left out by the filters, non-resource requests
+	// and stages other than ResponseComplete and Panic.
+	Skipped int64
+	// Invalid counts lines that are not audit.k8s.io/v1 Events.
+	Invalid int64
+}
+
+// auditEvent holds the fields of an audit.k8s.io/v1 Event the import uses.
+type auditEvent struct {
+	Kind                     string           `json:"kind"`
+	APIVersion               string           `json:"apiVersion"`
+	Stage                    string           `json:"stage"`
+	RequestURI               string           `json:"requestURI"`
+	Verb                     string           `json:"verb"`
+	User                     auditUser        `json:"user"`
+	ImpersonatedUser         *auditUser       `json:"impersonatedUser,omitempty"`
+	ObjectRef                *auditObjectRef  `json:"objectRef,omitempty"`
+	ResponseStatus           *metav1.Status   `json:"responseStatus,omitempty"`
+	RequestObject            json.RawMessage  `json:"requestObject,omitempty"`
+	ResponseObject           json.RawMessage  `json:"responseObject,omitempty"`
+	RequestReceivedTimestamp metav1.MicroTime `json:"requestReceivedTimestamp"`
+	StageTimestamp           metav1.MicroTime `json:"stageTimestamp"`
+}
+
+type auditUser struct {
+	Username string `json:"username"`
+}
+
+type auditObjectRef struct {
+	Resource        string    `json:"resource,omitempty"`
+	Namespace       string    `json:"namespace,omitempty"`
+	Name            string    `json:"name,omitempty"`
+	UID             types.UID `json:"uid,omitempty"`
+	APIGroup        string    `json:"apiGroup,omitempty"`
+	APIVersion      string    `json:"apiVersion,omitempty"`
+	ResourceVersion string    `json:"resourceVersion,omitempty"`
+	Subresource     string    `json:"subresource,omitempty"`
+}
+
+// auditResource is one parsed entry of AuditConfig.Resources.
+type auditResource struct {
+	resource    string
+	group       string
+	anyGroup    bool
+	subresource string
+}
+
+// auditFilter is the parsed form of the AuditConfig filters.
+type auditFilter struct {
+	users     map[string]bool
+	verbs     map[string]bool
+	resources []auditResource
+	since     time.Time
+	until     time.Time
+}
+
+// ImportAudit reads JSON lines of audit.k8s.io/v1 Events from r and stores
+// the completed resource requests as operations of cfg.SessionID. Events are
+// recorded in batches of auditBatchSize as they are read, each batch ordered
+// by the time each request was received; the API server logs requests as
+// they complete, so requests outlasting a batch keep the log's order. An
+// import that fails keeps the batches recorded before the failure. Request
+// and response bodies are kept when the events were logged at the
+// RequestResponse level.
+// Rule 2: Bounded by maxAuditLines and the sink's maximum sequence.
+func ImportAudit(r io.Reader, cfg AuditConfig) (*AuditImportResult, error) {
+	err := assert.Assert(r != nil, "audit reader must not be nil")
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     defaultAuditActor,
+		redaction:   cfg.Redaction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := importAuditEvents(r, newAuditFilter(cfg), sink)
+	if err != nil {
+		_ = sink.close()
+		return result, err
+	}
+	return result, sink.close()
+}
+
+// importAuditEvents decodes and filters every line of r and records the
+// kept events through sink, one batch at a time.
+// Rule 2: Bounded by maxAuditLines and the sink's maximum sequence.
+func importAuditEvents(r io.Reader, filter *auditFilter, sink *recordSink) (*AuditImportResult, error) {
+	result := &AuditImportResult{}
+	kinds := &kindCache{}
+	batch := make([]*storage.Operation, 0, auditBatchSize)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 65536), maxAuditLineSize)
+	for lines := 0; lines < maxAuditLines && scanner.Scan(); lines++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		result.Events++
+
+		var event auditEvent
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil || event.Kind != "Event" || event.APIVersion != auditAPIVersion {
+			result.Invalid++
+			continue
+		}
+
+		if !filter.keep(&event) {
+			result.Skipped++
+			continue
+		}
+
+		if result.Imported+int64(len(batch)) >= sink.maxSequence {
+			return result, fmt.Errorf("audit log has more than %d operations", sink.maxSequence)
+		}
+		batch = append(batch, auditOperation(&event, kinds))
+		if len(batch) == auditBatchSize {
+			err = recordAuditBatch(sink, batch, result)
+			if err != nil {
+				return result, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return result, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return result, recordAuditBatch(sink, batch, result)
+}
+
+// recordAuditBatch stores batch with one insert, in the order the requests
+// were received.
+func recordAuditBatch(sink *recordSink, batch []*storage.Operation, result *AuditImportResult) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].Timestamp.Before(batch[j].Timestamp)
+	})
+
+	err := sink.recordBatch(batch)
+	if err != nil {
+		return fmt.Errorf("failed to import audit events: %w", err)
+	}
+	result.Imported = result.Imported + int64(len(batch))
+	return nil
+}
+
+// newAuditFilter parses the filters of cfg.
+// Rule 2: Bounded by the number of filters given.
+func newAuditFilter(cfg AuditConfig) *auditFilter {
+	filter := &auditFilter{
+		users: make(map[string]bool, len(cfg.Users)),
+		verbs: make(map[string]bool, len(cfg.Verbs)),
+		since: cfg.Since,
+		until: cfg.Until,
+	}
+	for i := 0; i < len(cfg.Users); i++ {
+		filter.users[cfg.Users[i]] = true
+	}
+	for i := 0; i < len(cfg.Verbs); i++ {
+		filter.verbs[strings.ToLower(cfg.Verbs[i])] = true
+	}
+	for i := 0; i < len(cfg.Resources); i++ {
+		filter.resources = append(filter.resources, parseAuditResource(cfg.Resources[i]))
+	}
+	return filter
+}
+
+// parseAuditResource parses resource[.group][/subresource]. Without a
+// group the resource matches in every group.
+func parseAuditResource(value string) auditResource {
+	spec := auditResource{anyGroup: true}
+	value, spec.subresource, _ = strings.Cut(value, "/")
+	spec.resource, spec.group, _ = strings.Cut(value, ".")
+	if len(spec.group) > 0 {
+		spec.anyGroup = false
+	}
+	if spec.group == "core" {
+		spec.group = ""
+	}
+	return spec
+}
+
+// keep reports whether event is a completed resource request matching
+// every filter.
+func (f *auditFilter) keep(event *auditEvent) bool {
+	if event.Stage != "ResponseComplete" && event.Stage != "Panic" {
+		return false
+	}
+
+	ref := event.ObjectRef
+	if ref == nil || len(ref.Resource) == 0 {
+		return false
+	}
+
+	if len(f.users) > 0 && !f.users[event.actor()] {
+		return false
+	}
+
+	if len(f.verbs) > 0 && !f.verbs[event.Verb] {
+		return false
+	}
+
+	received := event.RequestReceivedTimestamp.Time
+	if !f.since.IsZero() && received.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && received.After(f.until) {
+		return false
+	}
+
+	if len(f.resources) == 0 {
+		return true
+	}
+	for i := 0; i < len(f.resources); i++ {
+		if f.resources[i].matches(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether ref addresses the resource. A spec without a
+// subresource matches only the resource itself.
+func (r auditResource) matches(ref *auditObjectRef) bool {
+	if r.resource != ref.Resource || r.subresource != ref.Subresource {
+		return false
+	}
+	return r.anyGroup || r.group == ref.APIGroup
+}
+
+// actor returns the user the request acted as.
+func (e *auditEvent) actor() string {
+	if e.ImpersonatedUser != nil && len(e.ImpersonatedUser.Username) > 0 {
+		return e.ImpersonatedUser.Username
+	}
+	return e.User.Username
+}
+
+// auditOperation converts one audit event. Responses are decoded the way
+// the transport recorder decodes them, so kinds learned from earlier
+// events label later events without a body.
+func auditOperation(event *auditEvent, kinds *kindCache) *storage.Operation {
+	ref := event.ObjectRef
+	info := RequestInfo{
+		IsResourceRequest: true,
+		Verb:              event.Verb,
+		APIGroup:          ref.APIGroup,
+		APIVersion:        ref.APIVersion,
+		Resource:          ref.Resource,
+		Subresource:       ref.Subresource,
+		Namespace:         ref.Namespace,
+		Name:              ref.Name,
+	}
+
+	op := newRequestOperation(info, kinds)
+	op.Timestamp = event.RequestReceivedTimestamp.Time
+	op.ActorID = event.actor()
+	op.UID = string(ref.UID)
+	op.ResourceVersion = ref.ResourceVersion
+	if !event.StageTimestamp.IsZero() && event.StageTimestamp.After(op.Timestamp) {
+		op.DurationMs = event.StageTimestamp.Sub(op.Timestamp).Milliseconds()
+	}
+
+	requestURI, err := url.ParseRequestURI(event.RequestURI)
+	if err != nil {
+		requestURI = &url.URL{}
+	}
+	setAuditRequest(op, info.Verb, requestURI, event.RequestObject)
+
+	status := metav1.Status{Code: http.StatusOK}
+	if event.ResponseStatus != nil && event.ResponseStatus.Code > 0 {
+		status = *event.ResponseStatus
+	}
+	if event.Stage == "Panic" && status.Code < http.StatusBadRequest {
+		status = metav1.Status{Code: http.StatusInternalServerError, Message: "API server panicked"}
+	}
+
+	code := int(status.Code)
+	if code >= http.StatusBadRequest {
+		op.Error = status.Message
+		if len(op.Error) == 0 {
+			op.Error = http.StatusText(code)
+		}
+		setStatusDetails(op, status)
+		op.ResourceKind = kinds.kindFor(info, requestKind(event.RequestObject))
+		return op
+	}
+
+	if len(event.ResponseObject) > 0 {
+		applyResponse(op, info, "", &http.Response{StatusCode: code}, event.ResponseObject, kinds)
+		return op
+	}
+
+	op.ResourceKind = kinds.kindFor(info, requestKind(event.RequestObject))
+	return op
+}
+
+// setAuditRequest fills the request body, patch and list options.
+func setAuditRequest(op *storage.Operation, verb string, requestURI *url.URL, body []byte) {
+	if verb == "list" || verb == "watch" {
+		setListOptions(op, listOptionsFromQuery(requestURI))
+	}
+
+	if len(body) == 0 {
+		return
+	}
+
+	if verb == "patch" {
+		query := requestURI.Query()
+		var force *bool
+		if value := query.Get("force"); len(value) > 0 {
+			forced := value == "true" || value == "1"
+			force = &forced
+		}
+		// Audit events do not record the patch content type.
+		setPatch(op, "", body, query.Get("fieldManager"), force)
+		return
+	}
+
+	if sendsBody(verb) && len(body) <= maxCapturedBody {
+		op.RequestData = string(body)
+	}
+}
+
+// requestKind returns the kind of a request body, or "" without one.
+func requestKind(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var typeMeta metav1.TypeMeta
+	if json.Unmarshal(body, &typeMeta) != nil {
+		return ""
+	}
+	return typeMeta.Kind
+}
@@ -0,0 +1,265 @@
+package recorder
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	auditOperator = "system:serviceaccount:ops:widget-operator"
+	auditSession  = "audit-session"
+)
+
+// auditLog holds one line per case: a create, an earlier get, a status
+// patch, a metadata-level conflict, a list by a user, a watch, and lines
+// the import must skip or reject.
+var auditLog = strings.Join([]string{
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","stage":"ResponseComplete",` +
+		`"requestURI":"/api/v1/namespaces/default/configmaps","verb":"create",` +
+		`"user":{"username":"` + auditOperator + `"},` +
+		`"objectRef":{"resource":"configmaps","namespace":"default","name":"demo","apiVersion":"v1"},` +
+		`"responseStatus":{"metadata":{},"code":201},` +
+		`"requestObject":{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo"}},` +
+		`"responseObject":{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo",` +
+		`"namespace":"default","uid":"uid-1","resourceVersion":"10"}},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:01.000000Z","stageTimestamp":"2024-05-01T10:00:01.025000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","stage":"ResponseComplete",` +
+		`"requestURI":"/api/v1/namespaces/default/configmaps/demo","verb":"get",` +
+		`"user":{"username":"` + auditOperator + `"},` +
+		`"objectRef":{"resource":"configmaps","namespace":"default","name":"demo","apiVersion":"v1"},` +
+		`"responseStatus":{"metadata":{},"status":"Failure","reason":"NotFound","code":404,` +
+		`"message":"configmaps \"demo\" not found"},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:00.000000Z","stageTimestamp":"2024-05-01T10:00:00.002000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","stage":"ResponseComplete",` +
+		`"requestURI":"/apis/apps/v1/namespaces/default/deployments/web/status?fieldManager=widget&force=true",` +
+		`"verb":"patch","user":{"username":"` + auditOperator + `"},` +
+		`"objectRef":{"resource":"deployments","namespace":"default","name":"web","apiGroup":"apps",` +
+		`"apiVersion":"v1","subresource":"status"},"responseStatus":{"metadata":{},"code":200},` +
+		`"requestObject":{"status":{"replicas":2}},` +
+		`"responseObject":{"kind":"Deployment","apiVersion":"apps/v1","metadata":{"name":"web",` +
+		`"namespace":"default","uid":"uid-web","resourceVersion":"11","generation":4}},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:02.000000Z","stageTimestamp":"2024-05-01T10:00:02.010000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","stage":"ResponseComplete",` +
+		`"requestURI":"/api/v1/namespaces/default/configmaps/demo","verb":"update",` +
+		`"user":{"username":"` + auditOperator + `"},` +
+		`"objectRef":{"resource":"configmaps","namespace":"default","name":"demo","apiVersion":"v1"},` +
+		`"responseStatus":{"metadata":{},"status":"Failure","reason":"Conflict","code":409,` +
+		`"message":"the object has been modified"},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:03.000000Z","stageTimestamp":"2024-05-01T10:00:03.001000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","stage":"ResponseComplete",` +
+		`"requestURI":"/api/v1/namespaces/default/pods?labelSelector=app%3Dweb&limit=500","verb":"list",` +
+		`"user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"default","apiVersion":"v1"},` +
+		`"responseStatus":{"metadata":{},"code":200},` +
+		`"responseObject":{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"12"},` +
+		`"items":[{"metadata":{"name":"web-1","namespace":"default","uid":"uid-p1","resourceVersion":"9"}}]},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:04.000000Z","stageTimestamp":"2024-05-01T10:00:04.003000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","stage":"ResponseComplete",` +
+		`"requestURI":"/api/v1/namespaces/default/configmaps?watch=true","verb":"watch",` +
+		`"user":{"username":"admin"},"impersonatedUser":{"username":"` + auditOperator + `"},` +
+		`"objectRef":{"resource":"configmaps","namespace":"default","apiVersion":"v1"},` +
+		`"responseStatus":{"metadata":{},"code":200},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:05.000000Z","stageTimestamp":"2024-05-01T10:05:05.000000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","stage":"RequestReceived",` +
+		`"requestURI":"/api/v1/namespaces/default/configmaps/demo","verb":"get",` +
+		`"user":{"username":"alice"},"objectRef":{"resource":"configmaps","namespace":"default","name":"demo"},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:06.000000Z"}`,
+	`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","stage":"ResponseComplete",` +
+		`"requestURI":"/healthz","verb":"get","user":{"username":"alice"},"responseStatus":{"code":200},` +
+		`"requestReceivedTimestamp":"2024-05-01T10:00:07.000000Z"}`,
+	`not an audit event`,
+	``,
+}, "\n")
+
+func importTestAudit(t *testing.T, cfg AuditConfig) (*AuditImportResult, []storage.Operation) {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "audit.db"), 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+	})
+
+	cfg.Database = db
+	cfg.SessionID = auditSession
+	result, err := ImportAudit(strings.NewReader(auditLog), cfg)
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(auditSession)
+	require.NoError(t, err)
+	return result, ops
+}
+
+func TestImportAuditConvertsEvents(t *testing.T) {
+	result, ops := importTestAudit(t, AuditConfig{})
+	assert.Equal(t, AuditImportResult{Events: 9, Imported: 6, Skipped: 2, Invalid: 1}, *result)
+	require.Len(t, ops, 6)
+
+	get := ops[0]
+	assert.Equal(t, storage.OperationGet, get.OperationType)
+	assert.Equal(t, "ConfigMap", get.ResourceKind)
+	assert.Equal(t, `configmaps "demo" not found`, get.Error)
+	assert.Equal(t, int32(404), get.ErrorCode)
+	assert.Equal(t, "NotFound", get.ErrorReason)
+	assert.Equal(t, auditOperator, get.ActorID)
+	assert.Equal(t, int64(2), get.DurationMs)
+
+	create := ops[1]
+	assert.Equal(t, storage.OperationCreate, create.OperationType)
+	assert.Equal(t, "ConfigMap", create.ResourceKind)
+	assert.Equal(t, "uid-1", create.UID)
+	assert.Equal(t, "10", create.ResourceVersion)
+	assert.JSONEq(t, `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo"}}`, create.RequestData)
+	assert.Contains(t, create.ResourceData, `"uid":"uid-1"`)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC), create.Timestamp.UTC())
+	assert.Equal(t, int64(25), create.DurationMs)
+
+	patch := ops[2]
+	assert.Equal(t, storage.OperationPatch, patch.OperationType)
+	assert.Equal(t, "Deployment", patch.ResourceKind)
+	assert.Equal(t, "apps", patch.APIGroup)
+	assert.Equal(t, "deployments/status", patch.Resource)
+	assert.Equal(t, "status", patch.Subresource)
+	assert.JSONEq(t, `{"status":{"replicas":2}}`, patch.PatchData)
+	assert.Equal(t, "widget", patch.FieldManager)
+	require.NotNil(t, patch.Force)
+	assert.True(t, *patch.Force)
+	assert.Equal(t, int64(4), patch.Generation)
+
+	conflict := ops[3]
+	assert.Equal(t, storage.OperationUpdate, conflict.OperationType)
+	assert.Equal(t, "ConfigMap", conflict.ResourceKind)
+	assert.Equal(t, "the object has been modified", conflict.Error)
+	assert.Equal(t, "Conflict", conflict.ErrorReason)
+	assert.Empty(t, conflict.RequestData)
+
+	list := ops[4]
+	assert.Equal(t, storage.OperationList, list.OperationType)
+	assert.Equal(t, "Pod", list.ResourceKind)
+	assert.Equal(t, "alice", list.ActorID)
+	assert.Equal(t, "app=web", list.LabelSelector)
+	assert.Equal(t, int64(500), list.Limit)
+	require.Len(t, list.ListItems, 1)
+	assert.Equal(t, "uid-p1", list.ListItems[0].UID)
+
+	watch := ops[5]
+	assert.Equal(t, storage.OperationWatch, watch.OperationType)
+	assert.Equal(t, auditOperator, watch.ActorID)
+	assert.Equal(t, "ConfigMap", watch.ResourceKind)
+}
+
+func TestImportAuditFilters(t *testing.T) {
+	verbs := func(cfg AuditConfig) []string {
+		_, ops := importTestAudit(t, cfg)
+		out := []string{}
+		for _, op := range ops {
+			out = append(out, op.Verb)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"list"}, verbs(AuditConfig{Users: []string{"alice"}}))
+	assert.Equal(t, []string{"get", "create", "patch", "update", "watch"},
+		verbs(AuditConfig{Users: []string{auditOperator}}))
+	assert.Equal(t, []string{"create", "update"}, verbs(AuditConfig{Verbs: []string{"CREATE", "update"}}))
+	assert.Equal(t, []string{"patch"}, verbs(AuditConfig{Resources: []string{"deployments.apps/status"}}))
+	assert.Empty(t, verbs(AuditConfig{Resources: []string{"deployments"}}))
+	assert.Equal(t, []string{"list"}, verbs(AuditConfig{Resources: []string{"pods.core"}}))
+	assert.Equal(t, []string{"patch", "update"}, verbs(AuditConfig{
+		Since: time.Date(2024, 5, 1, 10, 0, 2, 0, time.UTC),
+		Until: time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC),
+	}))
+}
+
+func TestImportAuditRejectsOversizedLog(t *testing.T) {
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "audit.db"), 1000)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	_, err = ImportAudit(strings.NewReader(auditLog), AuditConfig{
+		Database:    db,
+		SessionID:   auditSession,
+		MaxSequence: 2,
+	})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(auditSession)
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+// countingInserts is a store that counts insert calls.
+type countingInserts struct {
+	storage.OperationStore
+	calls *int
+}
+
+func (c countingInserts) InsertOperation(op *storage.Operation) error {
+	*c.calls = *c.calls + 1
+	return c.OperationStore.InsertOperation(op)
+}
+
+func (c countingInserts) InsertOperations(ops []*storage.Operation) error {
+	*c.calls = *c.calls + 1
+	return c.OperationStore.InsertOperations(ops)
+}
+
+func TestImportAuditRecordsInBatches(t *testing.T) {
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "audit.db"), 10000)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	// Within a batch every event was received a second before the one
+	// logged ahead of it; each batch was received after the previous one.
+	total := auditBatchSize + auditBatchSize/2
+	lines := make([]string, 0, total)
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < total; i++ {
+		batchStart := i / auditBatchSize * auditBatchSize
+		received := base.Add(time.Duration(batchStart+auditBatchSize-i%auditBatchSize) * time.Second)
+		lines = append(lines, `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata",`+
+			`"stage":"ResponseComplete","requestURI":"/api/v1/namespaces/default/configmaps/demo","verb":"get",`+
+			`"user":{"username":"`+auditOperator+`"},`+
+			`"objectRef":{"resource":"configmaps","namespace":"default","name":"demo","apiVersion":"v1"},`+
+			`"responseStatus":{"metadata":{},"code":200},`+
+			`"requestReceivedTimestamp":"`+received.Format("2006-01-02T15:04:05.000000Z")+`"}`)
+	}
+	log := strings.Join(lines, "\n")
+
+	inserts := 0
+	result, err := ImportAudit(strings.NewReader(log), AuditConfig{
+		Database:  countingInserts{OperationStore: db, calls: &inserts},
+		SessionID: auditSession,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(total), result.Imported)
+	assert.Equal(t, 2, inserts, "one insert per batch")
+
+	ops, err := db.QueryOperations(auditSession)
+	require.NoError(t, err)
+	require.Len(t, ops, total)
+	for i := 1; i < len(ops); i++ {
+		assert.True(t, ops[i-1].Timestamp.Before(ops[i].Timestamp), "operation %d", i)
+	}
+
+	// A log over the limit keeps the batches recorded before it.
+	_, err = ImportAudit(strings.NewReader(log), AuditConfig{
+		Database:    db,
+		SessionID:   "limited",
+		MaxSequence: int64(auditBatchSize + 1),
+	})
+	require.ErrorContains(t, err, "more than")
+
+	ops, err = db.QueryOperations("limited")
+	require.NoError(t, err)
+	assert.Len(t, ops, auditBatchSize)
+}
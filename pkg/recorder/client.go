@@ -12,6 +12,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -25,23 +26,33 @@ const (
 // RecordingClient wraps a Kubernetes client to record all operations.
 // Rule 6: Minimal scope, all fields private.
 type RecordingClient struct {
-	client      kubernetes.Interface
-	db          *storage.Database
-	sessionID   string
-	sequenceNum int64
-	enabled     bool
-	maxSequence int64
-	actorID     string
+	client kubernetes.Interface
+	sink   *recordSink
 }
 
 // Config holds recorder configuration.
 // Rule 3: Pre-allocated configuration, no dynamic allocation.
 type Config struct {
 	Client      kubernetes.Interface
-	Database    *storage.Database
+	Database    storage.OperationStore
 	SessionID   string
 	MaxSequence int64
 	ActorID     string
+	// ReplicaID identifies this process when several replicas record into
+	// one session. Sequence numbers are then contiguous per replica and a
+	// shared Lamport clock orders the session.
+	ReplicaID string
+	// Async moves database writes off the caller's path. Nil records
+	// synchronously.
+	Async *AsyncConfig
+	// Redaction rewrites recorded payloads before they are stored. Nil
+	// drops Secret data and keeps everything else.
+	Redaction *RedactionPolicy
+	// Filter selects which operations are recorded. Nil records all.
+	Filter *FilterSpec
+	// Session, when set, is begun in the store and ended on Close. An
+	// unset KubernetesVersion is read from the API server.
+	Session *storage.Session
 }
 
 // NewRecordingClient creates a new recording client wrapper.
@@ -52,52 +63,24 @@ func NewRecordingClient(cfg Config) (*RecordingClient, error) {
 		return nil, err
 	}
 
-	err = assert.AssertNotNil(cfg.Database, "database")
-	if err != nil {
-		return nil, err
-	}
-
-	err = assert.AssertStringNotEmpty(cfg.SessionID, "session_id")
-	if err != nil {
-		return nil, err
-	}
-
-	err = assert.AssertInRange(
-		len(cfg.SessionID),
-		1,
-		maxSessionIDLength,
-		"session_id length",
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	if cfg.MaxSequence <= 0 {
-		cfg.MaxSequence = 1000000
-	}
-
-	if len(cfg.ActorID) == 0 {
-		cfg.ActorID = defaultActorID
-	}
-
-	err = assert.AssertInRange(
-		len(cfg.ActorID),
-		1,
-		maxActorIDLength,
-		"actor_id length",
-	)
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     cfg.ActorID,
+		replicaID:   cfg.ReplicaID,
+		async:       cfg.Async,
+		redaction:   cfg.Redaction,
+		filter:      cfg.Filter,
+		session:     withServerVersion(cfg.Session, cfg.Client.Discovery()),
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &RecordingClient{
-		client:      cfg.Client,
-		db:          cfg.Database,
-		sessionID:   cfg.SessionID,
-		sequenceNum: 0,
-		enabled:     true,
-		maxSequence: cfg.MaxSequence,
-		actorID:     cfg.ActorID,
+		client: cfg.Client,
+		sink:   sink,
 	}, nil
 }
 
@@ -108,7 +91,7 @@ func (r *RecordingClient) Enable() error {
 		return err
 	}
 
-	r.enabled = true
+	r.sink.setEnabled(true)
 	return nil
 }
 
@@ -119,48 +102,91 @@ func (r *RecordingClient) Disable() error {
 		return err
 	}
 
-	r.enabled = false
+	r.sink.setEnabled(false)
 	return nil
 }
 
+// Close flushes queued operations and stops recording. Wrappers sharing this
+// recorder's session stop with it.
+func (r *RecordingClient) Close() error {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return err
+	}
+
+	return r.sink.close()
+}
+
+// RecordFailures returns how many operations could not be stored.
+func (r *RecordingClient) RecordFailures() int64 {
+	return r.sink.failureCount()
+}
+
+// DroppedOperations returns how many operations the overflow policy discarded.
+func (r *RecordingClient) DroppedOperations() int64 {
+	return r.sink.droppedCount()
+}
+
+// FilteredOperations returns how many operations the recording filter left
+// out.
+func (r *RecordingClient) FilteredOperations() int64 {
+	return r.sink.filteredCount()
+}
+
 // GetClient returns the wrapped Kubernetes client.
 func (r *RecordingClient) GetClient() kubernetes.Interface {
 	return r.client
 }
 
-// recordOperation stores an operation in the database.
-// Rule 2: Bounded sequence number check.
+// recordOperation stores an operation in the database. requestData is the
+// body sent with a create or update and empty for other operations.
 // Rule 4: Function under 60 lines.
 func (r *RecordingClient) recordOperation(
+	ctx context.Context,
 	opType storage.OperationType,
 	kind string,
 	namespace string,
 	name string,
+	requestData string,
 	obj runtime.Object,
 	err error,
 	duration time.Duration,
-) error {
+) {
 	validationErr := assert.AssertNotNil(r, "recorder")
 	if validationErr != nil {
-		return validationErr
+		return
 	}
 
-	if !r.enabled {
-		return nil
+	// Typed clients return an empty object alongside errors; it is not
+	// server state.
+	if err != nil {
+		obj = nil
 	}
 
-	if r.sequenceNum >= r.maxSequence {
-		return fmt.Errorf("max sequence number reached: %d", r.maxSequence)
-	}
+	op := buildOperation(opType, kind, namespace, name, obj, err, duration)
+	op.Verb = string(opType)
+	op.RequestData = requestData
 
-	r.sequenceNum = r.sequenceNum + 1
+	r.sink.store(ctx, op)
+}
 
+// buildOperation serializes obj and fills the object metadata columns.
+// Payloads over the storage limit are left out so the operation still records.
+func buildOperation(
+	opType storage.OperationType,
+	kind string,
+	namespace string,
+	name string,
+	obj runtime.Object,
+	err error,
+	duration time.Duration,
+) *storage.Operation {
 	var resourceData string
 	if obj != nil {
 		jsonBytes, marshalErr := json.Marshal(obj)
 		if marshalErr != nil {
 			resourceData = fmt.Sprintf("marshal error: %v", marshalErr)
-		} else {
+		} else if len(jsonBytes) <= maxCapturedBody {
 			resourceData = string(jsonBytes)
 		}
 	}
@@ -171,11 +197,8 @@ func (r *RecordingClient) recordOperation(
 	}
 
 	uid, resourceVersion, generation := extractObjectMetadata(obj)
-	verb := string(opType)
 
 	op := &storage.Operation{
-		SessionID:       r.sessionID,
-		SequenceNumber:  r.sequenceNum,
 		Timestamp:       time.Now(),
 		OperationType:   opType,
 		ResourceKind:    kind,
@@ -184,19 +207,26 @@ func (r *RecordingClient) recordOperation(
 		ResourceData:    resourceData,
 		Error:           errorMsg,
 		DurationMs:      duration.Milliseconds(),
-		ActorID:         r.actorID,
 		UID:             uid,
 		ResourceVersion: resourceVersion,
 		Generation:      generation,
-		Verb:            verb,
 	}
+	setErrorDetails(op, err)
+	return op
+}
 
-	insertErr := r.db.InsertOperation(op)
-	if insertErr != nil {
-		return fmt.Errorf("failed to record operation: %w", insertErr)
+// requestPayload serializes the object a caller is about to send. Objects
+// that fail to encode or exceed the storage limit give an empty payload.
+func requestPayload(obj runtime.Object) string {
+	if obj == nil {
+		return ""
 	}
 
-	return nil
+	data, err := json.Marshal(obj)
+	if err != nil || len(data) > maxCapturedBody {
+		return ""
+	}
+	return string(data)
 }
 
 // RecordGet records a GET operation with timing.
@@ -240,21 +270,62 @@ func (r *RecordingClient) RecordGet(
 
 	duration := time.Since(start)
 
-	recordErr := r.recordOperation(
+	r.recordOperation(
+		ctx,
 		storage.OperationGet,
 		kind,
 		namespace,
 		name,
+		"",
 		obj,
 		getErr,
 		duration,
 	)
-	if recordErr != nil {
-		return obj, fmt.Errorf("record failed: %w (original error: %v)",
-			recordErr, getErr)
+	return obj, getErr
+}
+
+// RecordList records a LIST operation with its selectors, pagination and the
+// identity and version of every returned item.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordList(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	opts metav1.ListOptions,
+) (runtime.Object, error) {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return nil, err
 	}
 
-	return obj, getErr
+	err = assert.AssertStringNotEmpty(kind, "resource kind")
+	if err != nil {
+		return nil, err
+	}
+
+	if !supportedListKinds[kind] {
+		return nil, fmt.Errorf("unsupported resource kind: %s", kind)
+	}
+
+	start := time.Now()
+
+	list, listErr := r.listObjects(ctx, kind, namespace, opts)
+
+	op := buildOperation(
+		storage.OperationList,
+		kind,
+		namespace,
+		"",
+		list,
+		listErr,
+		time.Since(start),
+	)
+	op.Verb = string(storage.OperationList)
+	setListOptions(op, opts)
+	setListItems(op, list)
+
+	r.sink.store(ctx, op)
+	return list, listErr
 }
 
 // RecordCreate records a CREATE operation with timing.
@@ -295,26 +366,24 @@ func (r *RecordingClient) RecordCreate(
 		return nil, err
 	}
 
+	sent := requestPayload(obj)
 	start := time.Now()
 
 	created, createErr := r.createObject(ctx, kind, namespace, obj, opts)
 
 	duration := time.Since(start)
 
-	recordErr := r.recordOperation(
+	r.recordOperation(
+		ctx,
 		storage.OperationCreate,
 		kind,
 		namespace,
 		name,
+		sent,
 		created,
 		createErr,
 		duration,
 	)
-	if recordErr != nil {
-		return created, fmt.Errorf("record failed: %w (original error: %v)",
-			recordErr, createErr)
-	}
-
 	return created, createErr
 }
 
@@ -356,26 +425,24 @@ func (r *RecordingClient) RecordUpdate(
 		return nil, err
 	}
 
+	sent := requestPayload(obj)
 	start := time.Now()
 
 	updated, updateErr := r.updateObject(ctx, kind, namespace, obj, opts)
 
 	duration := time.Since(start)
 
-	recordErr := r.recordOperation(
+	r.recordOperation(
+		ctx,
 		storage.OperationUpdate,
 		kind,
 		namespace,
 		name,
+		sent,
 		updated,
 		updateErr,
 		duration,
 	)
-	if recordErr != nil {
-		return updated, fmt.Errorf("record failed: %w (original error: %v)",
-			recordErr, updateErr)
-	}
-
 	return updated, updateErr
 }
 
@@ -422,21 +489,149 @@ func (r *RecordingClient) RecordDelete(
 
 	duration := time.Since(start)
 
-	recordErr := r.recordOperation(
+	r.recordOperation(
+		ctx,
 		storage.OperationDelete,
 		kind,
 		namespace,
 		name,
+		"",
 		nil,
 		deleteErr,
 		duration,
 	)
-	if recordErr != nil {
-		return fmt.Errorf("record failed: %w (original error: %v)",
-			recordErr, deleteErr)
+	return deleteErr
+}
+
+// RecordPatch records a PATCH operation with the patch document and options.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordPatch(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	name string,
+	patchType types.PatchType,
+	data []byte,
+	opts metav1.PatchOptions,
+) (runtime.Object, error) {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return nil, err
 	}
 
-	return deleteErr
+	err = assert.AssertStringNotEmpty(kind, "resource kind")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(namespace, "namespace")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(name, "resource name")
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var patched runtime.Object
+	var patchErr error
+
+	switch kind {
+	case "ConfigMap":
+		cm, cmErr := r.client.CoreV1().ConfigMaps(namespace).Patch(
+			ctx, name, patchType, data, opts)
+		if cmErr == nil {
+			patched = cm
+		}
+		patchErr = cmErr
+	case "Secret":
+		secret, secretErr := r.client.CoreV1().Secrets(namespace).Patch(
+			ctx, name, patchType, data, opts)
+		if secretErr == nil {
+			patched = secret
+		}
+		patchErr = secretErr
+	default:
+		return nil, fmt.Errorf("unsupported resource kind: %s", kind)
+	}
+
+	op := buildOperation(
+		storage.OperationPatch,
+		kind,
+		namespace,
+		name,
+		patched,
+		patchErr,
+		time.Since(start),
+	)
+	op.Verb = string(storage.OperationPatch)
+	setPatch(op, string(patchType), data, opts.FieldManager, opts.Force)
+
+	r.sink.store(ctx, op)
+	return patched, patchErr
+}
+
+// setPatch stores the patch document and server-side apply options on op.
+// Documents larger than the storage limit are dropped, keeping the type.
+func setPatch(
+	op *storage.Operation,
+	patchType string,
+	data []byte,
+	fieldManager string,
+	force *bool,
+) {
+	op.PatchType = patchType
+	if len(data) <= maxCapturedBody {
+		op.PatchData = string(data)
+	}
+	op.FieldManager = fieldManager
+	if force != nil {
+		forced := *force
+		op.Force = &forced
+	}
+}
+
+var supportedListKinds = map[string]bool{
+	"Pod":        true,
+	"Service":    true,
+	"Deployment": true,
+	"ConfigMap":  true,
+	"Secret":     true,
+}
+
+// listObjects lists kind and drops typed nil results so callers only see a
+// non-nil object on success.
+func (r *RecordingClient) listObjects(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	opts metav1.ListOptions,
+) (runtime.Object, error) {
+	var list runtime.Object
+	var err error
+
+	switch kind {
+	case "Pod":
+		list, err = r.client.CoreV1().Pods(namespace).List(ctx, opts)
+	case "Service":
+		list, err = r.client.CoreV1().Services(namespace).List(ctx, opts)
+	case "Deployment":
+		list, err = r.client.AppsV1().Deployments(namespace).List(ctx, opts)
+	case "ConfigMap":
+		list, err = r.client.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+	case "Secret":
+		list, err = r.client.CoreV1().Secrets(namespace).List(ctx, opts)
+	default:
+		return nil, fmt.Errorf("unsupported resource kind: %s", kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
 }
 
 func (r *RecordingClient) createObject(
@@ -544,5 +739,5 @@ func extractObjectMetadata(obj runtime.Object) (string, string, int64) {
 
 // GetSequenceNumber returns current sequence number.
 func (r *RecordingClient) GetSequenceNumber() int64 {
-	return r.sequenceNum
+	return r.sink.sequence()
 }
@@ -5,11 +5,14 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/slyt3/kubestep/pkg/reconciletrace"
 	"github.com/slyt3/kubestep/pkg/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -231,3 +234,122 @@ func TestRecordDeleteConfigMapAndSecret(t *testing.T) {
 	assert.Equal(t, "secret-delete", ops[1].Name)
 	assert.Equal(t, "", ops[1].Error)
 }
+
+func TestRecordPatchConfigMap(t *testing.T) {
+	ctx := context.Background()
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "config-patch",
+			Namespace: "default",
+		},
+	}
+
+	client := fake.NewSimpleClientset(configMap)
+	rec, db := newTestRecorder(t, client)
+
+	patch := []byte(`{"data":{"mode":"on"}}`)
+	obj, err := rec.RecordPatch(ctx, "ConfigMap", "default", "config-patch",
+		types.MergePatchType, patch, metav1.PatchOptions{FieldManager: "test-manager"})
+	require.NoError(t, err)
+	require.NotNil(t, obj)
+
+	_, err = rec.RecordPatch(ctx, "Secret", "default", "missing",
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	assert.Equal(t, storage.OperationPatch, ops[0].OperationType)
+	assert.Equal(t, "config-patch", ops[0].Name)
+	assert.Equal(t, string(types.MergePatchType), ops[0].PatchType)
+	assert.Equal(t, string(patch), ops[0].PatchData)
+	assert.Equal(t, "test-manager", ops[0].FieldManager)
+	assert.Nil(t, ops[0].Force, "force was not sent")
+	assert.Contains(t, ops[0].ResourceData, `"mode":"on"`)
+
+	assert.Equal(t, storage.OperationPatch, ops[1].OperationType)
+	assert.NotEmpty(t, ops[1].Error)
+	assert.Empty(t, ops[1].ResourceData)
+}
+
+func TestRecordListConfigMaps(t *testing.T) {
+	ctx := context.Background()
+
+	matching := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "config-a",
+			Namespace:       "default",
+			UID:             "uid-a",
+			ResourceVersion: "11",
+			Labels:          map[string]string{"app": "demo"},
+		},
+	}
+	other := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "config-b",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "other"},
+		},
+	}
+
+	client := fake.NewSimpleClientset(matching, other)
+	rec, db := newTestRecorder(t, client)
+
+	opts := metav1.ListOptions{LabelSelector: "app=demo", FieldSelector: "metadata.namespace=default", Limit: 5}
+	list, err := rec.RecordList(ctx, "ConfigMap", "default", opts)
+	require.NoError(t, err)
+	require.NotNil(t, list)
+
+	_, err = rec.RecordList(ctx, "Widget", "default", metav1.ListOptions{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+
+	assert.Equal(t, storage.OperationList, ops[0].OperationType)
+	assert.Equal(t, "ConfigMap", ops[0].ResourceKind)
+	assert.Empty(t, ops[0].Name)
+	assert.Equal(t, "app=demo", ops[0].LabelSelector)
+	assert.Equal(t, "metadata.namespace=default", ops[0].FieldSelector)
+	assert.Equal(t, int64(5), ops[0].Limit)
+	require.Len(t, ops[0].ListItems, 1)
+	assert.Equal(t, storage.ListItem{UID: "uid-a", ResourceVersion: "11",
+		Namespace: "default", Name: "config-a"}, ops[0].ListItems[0])
+}
+
+func TestRecordLinksOperationsToSpan(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	rec, db := newTestRecorder(t, client)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	// Two reconciles by the same actor overlap in time.
+	firstID, firstCtx := reconciletrace.Start(ctx, db, testSessionID, "ctrl", gvk,
+		"default", "a", "", "", "")
+	secondID, secondCtx := reconciletrace.Start(ctx, db, testSessionID, "ctrl", gvk,
+		"default", "b", "", "", "")
+	require.NotEmpty(t, firstID)
+	require.NotEmpty(t, secondID)
+
+	_, err := rec.RecordCreate(secondCtx, "ConfigMap", "default", &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "b"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = rec.RecordCreate(firstCtx, "ConfigMap", "default", &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "a"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = rec.RecordGet(ctx, "ConfigMap", "default", "a", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	assert.Equal(t, secondID, ops[0].SpanID)
+	assert.Equal(t, firstID, ops[1].SpanID)
+	assert.Empty(t, ops[2].SpanID, "calls outside a reconcile have no span")
+}
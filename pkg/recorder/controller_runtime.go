@@ -0,0 +1,408 @@
+//go:build controller_runtime
+// +build controller_runtime
+
+package recorder
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ControllerClientConfig holds configuration for the controller-runtime
+// recording client.
+type ControllerClientConfig struct {
+	Client      client.Client
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	ActorID     string
+	ReplicaID   string
+	Async       *AsyncConfig
+	Redaction   *RedactionPolicy
+	Filter      *FilterSpec
+	// DirectReads records Get and List as API server reads instead of cache
+	// reads. Set it when wrapping a client that bypasses the informer cache.
+	DirectReads bool
+	Session     *storage.Session
+}
+
+// ControllerClient wraps a controller-runtime client.Client and records
+// every call. It is a drop-in replacement for mgr.GetClient().
+// Methods not overridden here are passed through unrecorded.
+type ControllerClient struct {
+	client.Client
+	sink        *recordSink
+	directReads bool
+}
+
+// NewControllerClient creates a recording controller-runtime client.
+// Rule 5: Multiple assertions for validation.
+func NewControllerClient(cfg ControllerClientConfig) (*ControllerClient, error) {
+	err := assert.AssertNotNil(cfg.Client, "controller-runtime client")
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     cfg.ActorID,
+		replicaID:   cfg.ReplicaID,
+		async:       cfg.Async,
+		redaction:   cfg.Redaction,
+		filter:      cfg.Filter,
+		session:     cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ControllerClient{
+		Client:      cfg.Client,
+		sink:        sink,
+		directReads: cfg.DirectReads,
+	}, nil
+}
+
+// Enable turns recording on.
+func (c *ControllerClient) Enable() {
+	c.sink.setEnabled(true)
+}
+
+// Disable turns recording off. Calls still pass through unchanged.
+func (c *ControllerClient) Disable() {
+	c.sink.setEnabled(false)
+}
+
+// GetSequenceNumber returns current sequence number.
+func (c *ControllerClient) GetSequenceNumber() int64 {
+	return c.sink.sequence()
+}
+
+// RecordFailures returns how many operations could not be stored.
+func (c *ControllerClient) RecordFailures() int64 {
+	return c.sink.failureCount()
+}
+
+// Close flushes queued operations and stops recording.
+func (c *ControllerClient) Close() error {
+	return c.sink.close()
+}
+
+// Get records a read, served from the cache unless DirectReads is set.
+func (c *ControllerClient) Get(
+	ctx context.Context,
+	key client.ObjectKey,
+	obj client.Object,
+	opts ...client.GetOption,
+) error {
+	start := time.Now()
+	err := c.Client.Get(ctx, key, obj, opts...)
+
+	opType := storage.OperationCacheGet
+	if c.directReads {
+		opType = storage.OperationGet
+	}
+
+	op := c.newOperation(opType, "get", "", obj, err, start)
+	op.Namespace = key.Namespace
+	op.Name = key.Name
+	c.sink.store(ctx, op)
+	return err
+}
+
+// List records a list, served from the cache unless DirectReads is set.
+func (c *ControllerClient) List(
+	ctx context.Context,
+	list client.ObjectList,
+	opts ...client.ListOption,
+) error {
+	start := time.Now()
+	err := c.Client.List(ctx, list, opts...)
+
+	opType := storage.OperationCacheList
+	if c.directReads {
+		opType = storage.OperationList
+	}
+
+	op := c.newOperation(opType, "list", "", list, err, start)
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	op.Namespace = listOpts.Namespace
+	op.Name = ""
+	setListOptions(op, *listOpts.AsListOptions())
+	if err == nil {
+		setListItems(op, list)
+	}
+	c.sink.store(ctx, op)
+	return err
+}
+
+// Create records a create sent to the API server. The request body is
+// serialized before the call, since the client overwrites obj with the
+// server's response.
+func (c *ControllerClient) Create(
+	ctx context.Context,
+	obj client.Object,
+	opts ...client.CreateOption,
+) error {
+	sent := requestPayload(obj)
+	start := time.Now()
+	err := c.Client.Create(ctx, obj, opts...)
+	op := c.newOperation(storage.OperationCreate, "create", "", obj, err, start)
+	op.RequestData = sent
+	c.sink.store(ctx, op)
+	return err
+}
+
+// Update records an update sent to the API server.
+func (c *ControllerClient) Update(
+	ctx context.Context,
+	obj client.Object,
+	opts ...client.UpdateOption,
+) error {
+	sent := requestPayload(obj)
+	start := time.Now()
+	err := c.Client.Update(ctx, obj, opts...)
+	op := c.newOperation(storage.OperationUpdate, "update", "", obj, err, start)
+	op.RequestData = sent
+	c.sink.store(ctx, op)
+	return err
+}
+
+// Patch records a patch sent to the API server. The patch document is
+// computed before the call, while obj still holds the caller's changes.
+func (c *ControllerClient) Patch(
+	ctx context.Context,
+	obj client.Object,
+	patch client.Patch,
+	opts ...client.PatchOption,
+) error {
+	data, _ := patch.Data(obj)
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+
+	start := time.Now()
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	op := c.newOperation(storage.OperationPatch, "patch", "", obj, err, start)
+	setPatch(op, string(patch.Type()), data, patchOpts.FieldManager, patchOpts.Force)
+	c.sink.store(ctx, op)
+	return err
+}
+
+// Delete records a delete sent to the API server.
+func (c *ControllerClient) Delete(
+	ctx context.Context,
+	obj client.Object,
+	opts ...client.DeleteOption,
+) error {
+	start := time.Now()
+	err := c.Client.Delete(ctx, obj, opts...)
+	op := c.newOperation(storage.OperationDelete, "delete", "", obj, err, start)
+	op.ResourceData = ""
+	c.sink.store(ctx, op)
+	return err
+}
+
+// DeleteAllOf records a collection delete sent to the API server.
+func (c *ControllerClient) DeleteAllOf(
+	ctx context.Context,
+	obj client.Object,
+	opts ...client.DeleteAllOfOption,
+) error {
+	start := time.Now()
+	err := c.Client.DeleteAllOf(ctx, obj, opts...)
+
+	op := c.newOperation(storage.OperationDelete, "deletecollection", "", obj, err, start)
+	deleteOpts := &client.DeleteAllOfOptions{}
+	deleteOpts.ApplyOptions(opts)
+	op.Namespace = deleteOpts.Namespace
+	op.Name = ""
+	op.ResourceData = ""
+	c.sink.store(ctx, op)
+	return err
+}
+
+// Status returns a recording writer for the status subresource.
+func (c *ControllerClient) Status() client.SubResourceWriter {
+	return &controllerSubResourceClient{
+		SubResourceClient: c.Client.SubResource("status"),
+		writer:            c.Client.Status(),
+		parent:            c,
+		subResource:       "status",
+	}
+}
+
+// SubResource returns a recording client for the named subresource.
+func (c *ControllerClient) SubResource(subResource string) client.SubResourceClient {
+	inner := c.Client.SubResource(subResource)
+	return &controllerSubResourceClient{
+		SubResourceClient: inner,
+		writer:            inner,
+		parent:            c,
+		subResource:       subResource,
+	}
+}
+
+// newOperation builds the operation for obj after the call has returned.
+// The object is only serialized when the call succeeded, since on failure it
+// still holds the caller's input rather than server state.
+func (c *ControllerClient) newOperation(
+	opType storage.OperationType,
+	verb string,
+	subResource string,
+	obj runtime.Object,
+	callErr error,
+	start time.Time,
+) *storage.Operation {
+	kind, group, version, resource := c.describe(obj)
+
+	data := obj
+	if callErr != nil {
+		data = nil
+	}
+
+	namespace, name := "", ""
+	if accessor, ok := obj.(client.Object); ok && accessor != nil {
+		namespace = accessor.GetNamespace()
+		name = accessor.GetName()
+	}
+
+	op := buildOperation(opType, kind, namespace, name, data, callErr, time.Since(start))
+	op.Verb = verb
+	op.APIGroup = group
+	op.APIVersion = version
+	setResource(op, resource, subResource)
+	return op
+}
+
+// describe resolves Kind and resource through the client's scheme and
+// REST mapper. Unmapped kinds get a guessed plural; types missing from the
+// scheme fall back to the object's own TypeMeta.
+func (c *ControllerClient) describe(obj runtime.Object) (string, string, string, string) {
+	gvk, err := c.Client.GroupVersionKindFor(obj)
+	if err != nil {
+		return fallbackKind(obj), "", "", ""
+	}
+
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	if len(gvk.Kind) == 0 {
+		return fallbackKind(obj), gvk.Group, gvk.Version, ""
+	}
+
+	mapping, err := c.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		return gvk.Kind, gvk.Group, gvk.Version, plural.Resource
+	}
+
+	return gvk.Kind, gvk.Group, gvk.Version, mapping.Resource.Resource
+}
+
+func fallbackKind(obj runtime.Object) string {
+	if obj == nil {
+		return "Unknown"
+	}
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if len(kind) == 0 {
+		return "Unknown"
+	}
+	return strings.TrimSuffix(kind, "List")
+}
+
+// controllerSubResourceClient records Status() and SubResource() calls.
+// Subresource reads always go to the API server.
+type controllerSubResourceClient struct {
+	client.SubResourceClient
+	writer      client.SubResourceWriter
+	parent      *ControllerClient
+	subResource string
+}
+
+func (s *controllerSubResourceClient) Get(
+	ctx context.Context,
+	obj client.Object,
+	subResource client.Object,
+	opts ...client.SubResourceGetOption,
+) error {
+	start := time.Now()
+	err := s.SubResourceClient.Get(ctx, obj, subResource, opts...)
+	op := s.parent.newOperation(storage.OperationGet, "get", s.subResource, obj, err, start)
+	if err == nil {
+		op = s.withSubResourceData(op, subResource)
+	}
+	s.parent.sink.store(ctx, op)
+	return err
+}
+
+func (s *controllerSubResourceClient) Create(
+	ctx context.Context,
+	obj client.Object,
+	subResource client.Object,
+	opts ...client.SubResourceCreateOption,
+) error {
+	sent := requestPayload(subResource)
+	start := time.Now()
+	err := s.writer.Create(ctx, obj, subResource, opts...)
+	op := s.parent.newOperation(storage.OperationCreate, "create", s.subResource, obj, err, start)
+	op.RequestData = sent
+	if err == nil {
+		op = s.withSubResourceData(op, subResource)
+	}
+	s.parent.sink.store(ctx, op)
+	return err
+}
+
+func (s *controllerSubResourceClient) Update(
+	ctx context.Context,
+	obj client.Object,
+	opts ...client.SubResourceUpdateOption,
+) error {
+	sent := requestPayload(obj)
+	start := time.Now()
+	err := s.writer.Update(ctx, obj, opts...)
+	op := s.parent.newOperation(storage.OperationUpdate, "update", s.subResource, obj, err, start)
+	op.RequestData = sent
+	s.parent.sink.store(ctx, op)
+	return err
+}
+
+func (s *controllerSubResourceClient) Patch(
+	ctx context.Context,
+	obj client.Object,
+	patch client.Patch,
+	opts ...client.SubResourcePatchOption,
+) error {
+	data, _ := patch.Data(obj)
+	patchOpts := &client.SubResourcePatchOptions{}
+	patchOpts.ApplyOptions(opts)
+
+	start := time.Now()
+	err := s.writer.Patch(ctx, obj, patch, opts...)
+	op := s.parent.newOperation(storage.OperationPatch, "patch", s.subResource, obj, err, start)
+	setPatch(op, string(patch.Type()), data, patchOpts.FieldManager, patchOpts.Force)
+	s.parent.sink.store(ctx, op)
+	return err
+}
+
+// withSubResourceData stores the subresource payload (for example an
+// Eviction or Scale) in place of the parent object.
+func (s *controllerSubResourceClient) withSubResourceData(
+	op *storage.Operation,
+	subResource client.Object,
+) *storage.Operation {
+	if subResource == nil {
+		return op
+	}
+	data := buildOperation(op.OperationType, op.ResourceKind, "", "", subResource, nil, 0)
+	op.ResourceData = data.ResourceData
+	return op
+}
@@ -0,0 +1,161 @@
+//go:build controller_runtime
+// +build controller_runtime
+
+package recorder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestControllerClient(t *testing.T, objects ...client.Object) (*ControllerClient, *storage.Database) {
+	t.Helper()
+
+	_, db := newTestRecorder(t, fake.NewSimpleClientset())
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	inner := crfake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&corev1.Pod{}).
+		Build()
+
+	c, err := NewControllerClient(ControllerClientConfig{
+		Client:    inner,
+		Database:  db,
+		SessionID: "controller-session",
+		ActorID:   "widget-controller",
+	})
+	require.NoError(t, err)
+
+	return c, db
+}
+
+func TestControllerClientRecordsReadsAndWrites(t *testing.T) {
+	ctx := context.Background()
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default", UID: "uid-cfg"},
+	}
+	c, db := newTestControllerClient(t, existing)
+
+	var cm corev1.ConfigMap
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "cfg"}, &cm))
+
+	var list corev1.ConfigMapList
+	require.NoError(t, c.List(ctx, &list, client.InNamespace("default"),
+		client.MatchingLabels{}, client.Limit(20)))
+
+	created := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"}}
+	require.NoError(t, c.Create(ctx, created))
+
+	cm.Data = map[string]string{"mode": "on"}
+	require.NoError(t, c.Update(ctx, &cm))
+
+	before := cm.DeepCopy()
+	cm.Labels = map[string]string{"app": "demo"}
+	require.NoError(t, c.Patch(ctx, &cm, client.MergeFrom(before)))
+
+	require.NoError(t, c.Delete(ctx, created))
+
+	err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "missing"}, &corev1.ConfigMap{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations("controller-session")
+	require.NoError(t, err)
+	require.Len(t, ops, 7)
+
+	assert.Equal(t, storage.OperationCacheGet, ops[0].OperationType)
+	assert.Equal(t, "ConfigMap", ops[0].ResourceKind)
+	assert.Equal(t, "configmaps", ops[0].Resource)
+	assert.Equal(t, "v1", ops[0].APIVersion)
+	assert.Equal(t, "cfg", ops[0].Name)
+	assert.Equal(t, "uid-cfg", ops[0].UID)
+	assert.Equal(t, "widget-controller", ops[0].ActorID)
+
+	assert.Equal(t, storage.OperationCacheList, ops[1].OperationType)
+	assert.Equal(t, "ConfigMap", ops[1].ResourceKind)
+	assert.Equal(t, "default", ops[1].Namespace)
+	assert.Equal(t, int64(20), ops[1].Limit)
+	require.Len(t, ops[1].ListItems, 1)
+	assert.Equal(t, "uid-cfg", ops[1].ListItems[0].UID)
+	assert.NotEmpty(t, ops[1].ListItems[0].ResourceVersion)
+
+	assert.Equal(t, storage.OperationCreate, ops[2].OperationType)
+	assert.Equal(t, "new", ops[2].Name)
+	assert.NotEmpty(t, ops[2].ResourceVersion)
+
+	assert.Equal(t, storage.OperationUpdate, ops[3].OperationType)
+	assert.Contains(t, ops[3].ResourceData, `"mode":"on"`)
+
+	assert.Equal(t, storage.OperationPatch, ops[4].OperationType)
+	assert.Equal(t, "patch", ops[4].Verb)
+	assert.Equal(t, "application/merge-patch+json", ops[4].PatchType)
+	assert.JSONEq(t, `{"metadata":{"labels":{"app":"demo"}}}`, ops[4].PatchData)
+
+	assert.Equal(t, storage.OperationDelete, ops[5].OperationType)
+	assert.Empty(t, ops[5].ResourceData)
+
+	assert.Equal(t, storage.OperationCacheGet, ops[6].OperationType)
+	assert.Equal(t, "missing", ops[6].Name)
+	assert.NotEmpty(t, ops[6].Error)
+	assert.Empty(t, ops[6].ResourceData)
+}
+
+func TestControllerClientRecordsSubresources(t *testing.T) {
+	ctx := context.Background()
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}}
+	c, db := newTestControllerClient(t, pod)
+
+	pod.Status.Phase = corev1.PodRunning
+	require.NoError(t, c.Status().Update(ctx, pod))
+
+	before := pod.DeepCopy()
+	pod.Status.Message = "ready"
+	require.NoError(t, c.Status().Patch(ctx, pod, client.MergeFrom(before)))
+
+	ops, err := db.QueryOperations("controller-session")
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	assert.Equal(t, storage.OperationUpdate, ops[0].OperationType)
+	assert.Equal(t, "pods/status", ops[0].Resource)
+	assert.Equal(t, SubresourceStatus, ops[0].Subresource)
+	assert.Equal(t, "Pod", ops[0].ResourceKind)
+	assert.Equal(t, storage.OperationPatch, ops[1].OperationType)
+	assert.Equal(t, "pods/status", ops[1].Resource)
+	assert.JSONEq(t, `{"status":{"message":"ready"}}`, ops[1].PatchData)
+}
+
+func TestControllerClientDirectReads(t *testing.T) {
+	ctx := context.Background()
+	_, db := newTestRecorder(t, fake.NewSimpleClientset())
+
+	c, err := NewControllerClient(ControllerClientConfig{
+		Client:      crfake.NewClientBuilder().Build(),
+		Database:    db,
+		SessionID:   "direct-session",
+		DirectReads: true,
+	})
+	require.NoError(t, err)
+
+	var list corev1.ConfigMapList
+	require.NoError(t, c.List(ctx, &list))
+
+	ops, err := db.QueryOperations("direct-session")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, storage.OperationList, ops[0].OperationType)
+}
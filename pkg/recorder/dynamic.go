@@ -0,0 +1,477 @@
+package recorder
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// DynamicConfig holds configuration for the dynamic recording client.
+type DynamicConfig struct {
+	Client      dynamic.Interface
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	ActorID     string
+	ReplicaID   string
+	Async       *AsyncConfig
+	Redaction   *RedactionPolicy
+	Filter      *FilterSpec
+	Session     *storage.Session
+}
+
+// RecordingDynamicClient wraps a dynamic client to record operations on any
+// resource, including custom resources.
+type RecordingDynamicClient struct {
+	client dynamic.Interface
+	sink   *recordSink
+}
+
+// NewRecordingDynamicClient creates a new dynamic recording client.
+// Rule 5: Multiple assertions for validation.
+func NewRecordingDynamicClient(cfg DynamicConfig) (*RecordingDynamicClient, error) {
+	err := assert.AssertNotNil(cfg.Client, "dynamic client")
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     cfg.ActorID,
+		replicaID:   cfg.ReplicaID,
+		async:       cfg.Async,
+		redaction:   cfg.Redaction,
+		filter:      cfg.Filter,
+		session:     cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordingDynamicClient{client: cfg.Client, sink: sink}, nil
+}
+
+// Dynamic wraps client so that it records into the same session and sequence
+// as r.
+func (r *RecordingClient) Dynamic(client dynamic.Interface) (*RecordingDynamicClient, error) {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertNotNil(client, "dynamic client")
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordingDynamicClient{client: client, sink: r.sink}, nil
+}
+
+// Resource returns a recording interface for the given resource.
+func (d *RecordingDynamicClient) Resource(
+	gvr schema.GroupVersionResource,
+) dynamic.NamespaceableResourceInterface {
+	inner := d.client.Resource(gvr)
+	return &recordingResource{
+		sink:  d.sink,
+		gvr:   gvr,
+		base:  inner,
+		inner: inner,
+	}
+}
+
+// GetSequenceNumber returns current sequence number.
+func (d *RecordingDynamicClient) GetSequenceNumber() int64 {
+	return d.sink.sequence()
+}
+
+// Close flushes queued operations and stops recording.
+func (d *RecordingDynamicClient) Close() error {
+	return d.sink.close()
+}
+
+// recordingResource implements dynamic.NamespaceableResourceInterface.
+type recordingResource struct {
+	sink      *recordSink
+	gvr       schema.GroupVersionResource
+	namespace string
+	base      dynamic.NamespaceableResourceInterface
+	inner     dynamic.ResourceInterface
+}
+
+func (r *recordingResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &recordingResource{
+		sink:      r.sink,
+		gvr:       r.gvr,
+		namespace: namespace,
+		base:      r.base,
+		inner:     r.base.Namespace(namespace),
+	}
+}
+
+func (r *recordingResource) Create(
+	ctx context.Context,
+	obj *unstructured.Unstructured,
+	options metav1.CreateOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	sent := requestPayload(unstructuredObject(obj))
+	start := time.Now()
+	created, err := r.inner.Create(ctx, obj, options, subresources...)
+	r.recordWrite(
+		ctx,
+		"create",
+		unstructuredName(obj),
+		firstSubresource(subresources),
+		sent,
+		unstructuredObject(created),
+		err,
+		start,
+	)
+	return created, err
+}
+
+func (r *recordingResource) Update(
+	ctx context.Context,
+	obj *unstructured.Unstructured,
+	options metav1.UpdateOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	sent := requestPayload(unstructuredObject(obj))
+	start := time.Now()
+	updated, err := r.inner.Update(ctx, obj, options, subresources...)
+	r.recordWrite(
+		ctx,
+		"update",
+		unstructuredName(obj),
+		firstSubresource(subresources),
+		sent,
+		unstructuredObject(updated),
+		err,
+		start,
+	)
+	return updated, err
+}
+
+func (r *recordingResource) UpdateStatus(
+	ctx context.Context,
+	obj *unstructured.Unstructured,
+	options metav1.UpdateOptions,
+) (*unstructured.Unstructured, error) {
+	sent := requestPayload(unstructuredObject(obj))
+	start := time.Now()
+	updated, err := r.inner.UpdateStatus(ctx, obj, options)
+	r.recordWrite(
+		ctx,
+		"update",
+		unstructuredName(obj),
+		"status",
+		sent,
+		unstructuredObject(updated),
+		err,
+		start,
+	)
+	return updated, err
+}
+
+func (r *recordingResource) Delete(
+	ctx context.Context,
+	name string,
+	options metav1.DeleteOptions,
+	subresources ...string,
+) error {
+	start := time.Now()
+	err := r.inner.Delete(ctx, name, options, subresources...)
+	r.record(ctx, "delete", name, firstSubresource(subresources), nil, err, start)
+	return err
+}
+
+func (r *recordingResource) DeleteCollection(
+	ctx context.Context,
+	options metav1.DeleteOptions,
+	listOptions metav1.ListOptions,
+) error {
+	start := time.Now()
+	err := r.inner.DeleteCollection(ctx, options, listOptions)
+	r.record(ctx, "deletecollection", "", "", nil, err, start)
+	return err
+}
+
+func (r *recordingResource) Get(
+	ctx context.Context,
+	name string,
+	options metav1.GetOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	start := time.Now()
+	obj, err := r.inner.Get(ctx, name, options, subresources...)
+	r.record(
+		ctx,
+		"get",
+		name,
+		firstSubresource(subresources),
+		unstructuredObject(obj),
+		err,
+		start,
+	)
+	return obj, err
+}
+
+func (r *recordingResource) List(
+	ctx context.Context,
+	opts metav1.ListOptions,
+) (*unstructured.UnstructuredList, error) {
+	start := time.Now()
+	list, err := r.inner.List(ctx, opts)
+
+	var obj runtime.Object
+	if list != nil {
+		obj = list
+	}
+
+	op, opErr := r.operation("list", "", "", obj, err, start)
+	if opErr == nil {
+		setListOptions(op, opts)
+		setListItems(op, obj)
+		r.sink.store(ctx, op)
+	}
+	return list, err
+}
+
+// Watch records each delivered event as an OperationWatch in the session.
+func (r *recordingResource) Watch(
+	ctx context.Context,
+	opts metav1.ListOptions,
+) (watch.Interface, error) {
+	w, err := r.inner.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newWatchRecorder(r.sink, nil).Watch(w), nil
+}
+
+func (r *recordingResource) Patch(
+	ctx context.Context,
+	name string,
+	pt types.PatchType,
+	data []byte,
+	options metav1.PatchOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	start := time.Now()
+	patched, err := r.inner.Patch(ctx, name, pt, data, options, subresources...)
+	r.recordPatch(
+		ctx,
+		name,
+		firstSubresource(subresources),
+		unstructuredObject(patched),
+		err,
+		start,
+		string(pt),
+		data,
+		options.FieldManager,
+		options.Force,
+	)
+	return patched, err
+}
+
+func (r *recordingResource) Apply(
+	ctx context.Context,
+	name string,
+	obj *unstructured.Unstructured,
+	options metav1.ApplyOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	start := time.Now()
+	applied, err := r.inner.Apply(ctx, name, obj, options, subresources...)
+	r.recordPatch(
+		ctx,
+		name,
+		firstSubresource(subresources),
+		unstructuredObject(applied),
+		err,
+		start,
+		string(types.ApplyPatchType),
+		applyDocument(obj),
+		options.FieldManager,
+		&options.Force,
+	)
+	return applied, err
+}
+
+func (r *recordingResource) ApplyStatus(
+	ctx context.Context,
+	name string,
+	obj *unstructured.Unstructured,
+	options metav1.ApplyOptions,
+) (*unstructured.Unstructured, error) {
+	start := time.Now()
+	applied, err := r.inner.ApplyStatus(ctx, name, obj, options)
+	r.recordPatch(
+		ctx,
+		name,
+		"status",
+		unstructuredObject(applied),
+		err,
+		start,
+		string(types.ApplyPatchType),
+		applyDocument(obj),
+		options.FieldManager,
+		&options.Force,
+	)
+	return applied, err
+}
+
+// record builds the operation for a dynamic call and hands it to the sink.
+// Recording failures are counted by the sink and never returned.
+func (r *recordingResource) record(
+	ctx context.Context,
+	verb string,
+	name string,
+	subresource string,
+	obj runtime.Object,
+	callErr error,
+	start time.Time,
+) {
+	op, err := r.operation(verb, name, subresource, obj, callErr, start)
+	if err != nil {
+		return
+	}
+
+	r.sink.store(ctx, op)
+}
+
+// recordWrite records a create or update together with the body sent.
+func (r *recordingResource) recordWrite(
+	ctx context.Context,
+	verb string,
+	name string,
+	subresource string,
+	sent string,
+	obj runtime.Object,
+	callErr error,
+	start time.Time,
+) {
+	op, err := r.operation(verb, name, subresource, obj, callErr, start)
+	if err != nil {
+		return
+	}
+
+	op.RequestData = sent
+	r.sink.store(ctx, op)
+}
+
+// recordPatch records a patch or apply together with the patch document.
+func (r *recordingResource) recordPatch(
+	ctx context.Context,
+	name string,
+	subresource string,
+	obj runtime.Object,
+	callErr error,
+	start time.Time,
+	patchType string,
+	data []byte,
+	fieldManager string,
+	force *bool,
+) {
+	op, err := r.operation("patch", name, subresource, obj, callErr, start)
+	if err != nil {
+		return
+	}
+
+	setPatch(op, patchType, data, fieldManager, force)
+	r.sink.store(ctx, op)
+}
+
+func (r *recordingResource) operation(
+	verb string,
+	name string,
+	subresource string,
+	obj runtime.Object,
+	callErr error,
+	start time.Time,
+) (*storage.Operation, error) {
+	err := assert.AssertNotNil(r, "recording resource")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(verb, "verb")
+	if err != nil {
+		return nil, err
+	}
+
+	op := buildOperation(
+		OperationTypeForVerb(verb),
+		r.kindOf(obj),
+		r.namespace,
+		name,
+		obj,
+		callErr,
+		time.Since(start),
+	)
+	op.Verb = verb
+	op.APIGroup = r.gvr.Group
+	op.APIVersion = r.gvr.Version
+	setResource(op, r.gvr.Resource, subresource)
+
+	return op, nil
+}
+
+// kindOf returns the Kind of a returned object, falling back to the resource.
+func (r *recordingResource) kindOf(obj runtime.Object) string {
+	if obj != nil {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		kind = strings.TrimSuffix(kind, "List")
+		if len(kind) > 0 {
+			return kind
+		}
+	}
+	return r.gvr.Resource
+}
+
+// unstructuredObject avoids wrapping a nil pointer in a non-nil interface.
+func unstructuredObject(obj *unstructured.Unstructured) runtime.Object {
+	if obj == nil {
+		return nil
+	}
+	return obj
+}
+
+// applyDocument serializes the apply configuration sent by the caller.
+func applyDocument(obj *unstructured.Unstructured) []byte {
+	if obj == nil {
+		return nil
+	}
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func firstSubresource(subresources []string) string {
+	if len(subresources) == 0 {
+		return ""
+	}
+	return subresources[0]
+}
+
+func unstructuredName(obj *unstructured.Unstructured) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.GetName()
+}
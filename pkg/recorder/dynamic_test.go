@@ -0,0 +1,153 @@
+package recorder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var widgetGVR = schema.GroupVersionResource{
+	Group:    "example.com",
+	Version:  "v1",
+	Resource: "widgets",
+}
+
+func newWidget(name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Widget")
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetUID(types.UID("uid-" + name))
+	obj.SetResourceVersion("5")
+	obj.SetGeneration(2)
+	return obj
+}
+
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{
+		widgetGVR: "WidgetList",
+	}
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		listKinds,
+		objects...,
+	)
+}
+
+func TestRecordDynamicClientOperations(t *testing.T) {
+	ctx := context.Background()
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset())
+
+	dyn, err := rec.Dynamic(newFakeDynamicClient(newWidget("w1")))
+	require.NoError(t, err)
+	widgets := dyn.Resource(widgetGVR).Namespace("default")
+
+	obj, err := widgets.Get(ctx, "w1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "w1", obj.GetName())
+
+	_, err = widgets.Create(ctx, newWidget("w2"), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = widgets.List(ctx, metav1.ListOptions{Limit: 10, Continue: "token-1"})
+	require.NoError(t, err)
+
+	_, err = widgets.Patch(ctx, "w1", types.MergePatchType,
+		[]byte(`{"spec":{"size":3}}`), metav1.PatchOptions{})
+	require.NoError(t, err)
+
+	err = widgets.Delete(ctx, "w2", metav1.DeleteOptions{})
+	require.NoError(t, err)
+
+	_, err = widgets.Get(ctx, "missing", metav1.GetOptions{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 6)
+
+	assert.Equal(t, storage.OperationGet, ops[0].OperationType)
+	assert.Equal(t, "Widget", ops[0].ResourceKind)
+	assert.Equal(t, "default", ops[0].Namespace)
+	assert.Equal(t, "w1", ops[0].Name)
+	assert.Equal(t, "uid-w1", ops[0].UID)
+	assert.Equal(t, "5", ops[0].ResourceVersion)
+	assert.Equal(t, int64(2), ops[0].Generation)
+	assert.Equal(t, "example.com", ops[0].APIGroup)
+	assert.Equal(t, "v1", ops[0].APIVersion)
+	assert.Equal(t, "widgets", ops[0].Resource)
+	assert.Contains(t, ops[0].ResourceData, `"kind":"Widget"`)
+
+	assert.Equal(t, storage.OperationCreate, ops[1].OperationType)
+	assert.Equal(t, "w2", ops[1].Name)
+
+	assert.Equal(t, storage.OperationList, ops[2].OperationType)
+	assert.Equal(t, "Widget", ops[2].ResourceKind)
+	assert.Empty(t, ops[2].Name)
+	assert.Equal(t, int64(10), ops[2].Limit)
+	assert.Equal(t, "token-1", ops[2].Continue)
+	require.Len(t, ops[2].ListItems, 2)
+	assert.ElementsMatch(t, []string{"uid-w1", "uid-w2"},
+		[]string{ops[2].ListItems[0].UID, ops[2].ListItems[1].UID})
+
+	assert.Equal(t, storage.OperationPatch, ops[3].OperationType)
+	assert.Equal(t, "patch", ops[3].Verb)
+	assert.Equal(t, string(types.MergePatchType), ops[3].PatchType)
+	assert.JSONEq(t, `{"spec":{"size":3}}`, ops[3].PatchData)
+
+	assert.Equal(t, storage.OperationDelete, ops[4].OperationType)
+	assert.Equal(t, "w2", ops[4].Name)
+	assert.Empty(t, ops[4].ResourceData)
+
+	assert.Equal(t, storage.OperationGet, ops[5].OperationType)
+	assert.Equal(t, "widgets", ops[5].ResourceKind)
+	assert.NotEmpty(t, ops[5].Error)
+}
+
+func TestRecordDynamicSharesSequenceWithTypedClient(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset(configMap))
+
+	dyn, err := rec.Dynamic(newFakeDynamicClient(newWidget("w1")))
+	require.NoError(t, err)
+
+	_, err = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	_, err = dyn.Resource(widgetGVR).Namespace("default").Get(ctx, "w1", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, int64(1), ops[0].SequenceNumber)
+	assert.Equal(t, int64(2), ops[1].SequenceNumber)
+	assert.Equal(t, int64(2), dyn.GetSequenceNumber())
+	assert.Equal(t, int64(2), rec.GetSequenceNumber())
+}
+
+func TestNewRecordingDynamicClientValidation(t *testing.T) {
+	_, err := NewRecordingDynamicClient(DynamicConfig{SessionID: testSessionID})
+	require.Error(t, err)
+
+	_, err = NewRecordingDynamicClient(DynamicConfig{
+		Client:    newFakeDynamicClient(),
+		SessionID: testSessionID,
+	})
+	require.Error(t, err)
+}
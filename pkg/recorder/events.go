@@ -0,0 +1,242 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// maxEventReason and maxEventMessage match the storage column limits.
+	// Longer values are truncated rather than dropped.
+	maxEventReason  = 128
+	maxEventMessage = 4096
+)
+
+// KubeEventConfig holds configuration for recording the Kubernetes Events a
+// process emits.
+type KubeEventConfig struct {
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	ActorID     string
+	ReplicaID   string
+	Async       *AsyncConfig
+	Redaction   *RedactionPolicy
+	Filter      *FilterSpec
+	Session     *storage.Session
+}
+
+// KubeEventRecorder stores the Events an operator emits through
+// record.EventRecorder as OperationEvent records, so a session shows how
+// the controller explained itself next to the calls it made.
+type KubeEventRecorder struct {
+	sink     *recordSink
+	failures int64
+}
+
+// NewKubeEventRecorder creates a Kubernetes Event recorder.
+func NewKubeEventRecorder(cfg KubeEventConfig) (*KubeEventRecorder, error) {
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     cfg.ActorID,
+		replicaID:   cfg.ReplicaID,
+		async:       cfg.Async,
+		redaction:   cfg.Redaction,
+		filter:      cfg.Filter,
+		session:     cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubeEventRecorder{sink: sink}, nil
+}
+
+// KubeEvents returns a Kubernetes Event recorder sharing this recorder's
+// session and sequence, so events interleave with the calls around them.
+func (r *RecordingClient) KubeEvents() (*KubeEventRecorder, error) {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubeEventRecorder{sink: r.sink}, nil
+}
+
+// RecordKubeEvent stores one emitted event. Its signature fits
+// record.EventBroadcaster.StartEventWatcher.
+func (e *KubeEventRecorder) RecordKubeEvent(event *corev1.Event) {
+	_ = e.record(event, nil)
+}
+
+// Sink wraps an event sink, such as the EventSinkImpl handed to
+// record.EventBroadcaster.StartRecordingToSink. Every event written through
+// it is recorded with the result of the write. inner may be nil to record
+// only.
+func (e *KubeEventRecorder) Sink(inner record.EventSink) record.EventSink {
+	return &recordingEventSink{recorder: e, inner: inner}
+}
+
+// Enable turns recording on.
+func (e *KubeEventRecorder) Enable() {
+	e.sink.setEnabled(true)
+}
+
+// Disable turns recording off. Events still reach a wrapped sink.
+func (e *KubeEventRecorder) Disable() {
+	e.sink.setEnabled(false)
+}
+
+// RecordFailures returns how many events could not be stored.
+func (e *KubeEventRecorder) RecordFailures() int64 {
+	return atomic.LoadInt64(&e.failures) + e.sink.failureCount()
+}
+
+// Close flushes queued events and stops recording.
+func (e *KubeEventRecorder) Close() error {
+	return e.sink.close()
+}
+
+// record stores event as an OperationEvent about its involved object.
+// callErr is the error the wrapped sink returned, if any. Failures are
+// counted here or by the sink.
+func (e *KubeEventRecorder) record(event *corev1.Event, callErr error) error {
+	err := assert.AssertNotNil(e, "event recorder")
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(event != nil, "event must not be nil")
+	if err != nil {
+		atomic.AddInt64(&e.failures, 1)
+		return err
+	}
+
+	return e.sink.record(eventOperation(event, callErr))
+}
+
+// eventOperation builds the OperationEvent record for event. The identity
+// columns name the involved object; the Event itself is the payload.
+func eventOperation(event *corev1.Event, callErr error) *storage.Operation {
+	involved := event.InvolvedObject
+	op := buildOperation(storage.OperationEvent, involved.Kind, involved.Namespace,
+		involved.Name, event, callErr, 0)
+	op.Verb = "event"
+	op.UID = string(involved.UID)
+	op.ResourceVersion = involved.ResourceVersion
+	op.Generation = 0
+	op.EventType = event.Type
+	if len(op.EventType) == 0 {
+		op.EventType = corev1.EventTypeNormal
+	}
+	op.EventReason = truncateString(event.Reason, maxEventReason)
+	op.EventMessage = truncateString(event.Message, maxEventMessage)
+
+	gv, err := schema.ParseGroupVersion(involved.APIVersion)
+	if err == nil {
+		op.APIGroup = gv.Group
+		op.APIVersion = gv.Version
+	}
+	return op
+}
+
+// truncateString cuts s to at most limit bytes.
+func truncateString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit]
+}
+
+// recordingEventSink records each event written through it. Recording
+// failures are counted and never change what the broadcaster sees.
+type recordingEventSink struct {
+	recorder *KubeEventRecorder
+	inner    record.EventSink
+}
+
+func (s *recordingEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	if s.inner == nil {
+		s.recorder.RecordKubeEvent(event)
+		return event, nil
+	}
+
+	created, err := s.inner.Create(event)
+	s.recordResult(event, created, err)
+	return created, err
+}
+
+func (s *recordingEventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	if s.inner == nil {
+		s.recorder.RecordKubeEvent(event)
+		return event, nil
+	}
+
+	updated, err := s.inner.Update(event)
+	s.recordResult(event, updated, err)
+	return updated, err
+}
+
+// Patch records the event as the patch leaves it. The broadcaster patches
+// repeated events to bump their count and timestamps.
+func (s *recordingEventSink) Patch(oldEvent *corev1.Event, data []byte) (*corev1.Event, error) {
+	if s.inner == nil {
+		patched, err := patchEvent(oldEvent, data)
+		if err != nil {
+			atomic.AddInt64(&s.recorder.failures, 1)
+			return nil, err
+		}
+		s.recorder.RecordKubeEvent(patched)
+		return patched, nil
+	}
+
+	patched, err := s.inner.Patch(oldEvent, data)
+	s.recordResult(oldEvent, patched, err)
+	return patched, err
+}
+
+// recordResult records the stored event, or the one sent when the write
+// failed.
+func (s *recordingEventSink) recordResult(sent *corev1.Event, stored *corev1.Event, callErr error) {
+	event := stored
+	if callErr != nil || event == nil {
+		event = sent
+	}
+
+	_ = s.recorder.record(event, callErr)
+}
+
+// patchEvent applies a strategic merge patch to a copy of event.
+func patchEvent(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	err := assert.Assert(event != nil, "event must not be nil")
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(original, data, &corev1.Event{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply event patch: %w", err)
+	}
+
+	patched := &corev1.Event{}
+	err = json.Unmarshal(merged, patched)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode patched event: %w", err)
+	}
+	return patched, nil
+}
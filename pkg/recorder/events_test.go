@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func testEvent(eventType string, reason string, message string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "web.1", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Deployment",
+			APIVersion:      "apps/v1",
+			Namespace:       "default",
+			Name:            "web",
+			UID:             "uid-web",
+			ResourceVersion: "42",
+		},
+		Type:    eventType,
+		Reason:  reason,
+		Message: message,
+		Count:   1,
+	}
+}
+
+func TestKubeEventSinkRecordsEvents(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	rec, db := newTestRecorder(t, client)
+	events, err := rec.KubeEvents()
+	require.NoError(t, err)
+
+	sink := events.Sink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	_, err = sink.Create(testEvent(corev1.EventTypeWarning, "FailedCreate", "quota exceeded"))
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+
+	op := ops[0]
+	assert.Equal(t, storage.OperationEvent, op.OperationType)
+	assert.Equal(t, "event", op.Verb)
+	assert.Equal(t, "Deployment", op.ResourceKind)
+	assert.Equal(t, "apps", op.APIGroup)
+	assert.Equal(t, "v1", op.APIVersion)
+	assert.Equal(t, "web", op.Name)
+	assert.Equal(t, "uid-web", op.UID)
+	assert.Equal(t, "42", op.ResourceVersion)
+	assert.Equal(t, corev1.EventTypeWarning, op.EventType)
+	assert.Equal(t, "FailedCreate", op.EventReason)
+	assert.Equal(t, "quota exceeded", op.EventMessage)
+	assert.Contains(t, op.ResourceData, `"reason":"FailedCreate"`)
+
+	stored, err := client.CoreV1().Events("default").Get(context.Background(), "web.1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "FailedCreate", stored.Reason, "the wrapped sink still receives the event")
+}
+
+func TestKubeEventSinkRecordOnlyPatch(t *testing.T) {
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset())
+	events, err := rec.KubeEvents()
+	require.NoError(t, err)
+
+	sink := events.Sink(nil)
+	event := testEvent("", "Scaled", "scaled to 3")
+	_, err = sink.Create(event)
+	require.NoError(t, err)
+
+	patched, err := sink.Patch(event, []byte(`{"count":2,"message":"scaled to 4"}`))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), patched.Count)
+
+	_, err = sink.Patch(event, []byte(`not json`))
+	require.Error(t, err)
+	assert.Equal(t, int64(1), events.RecordFailures())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, corev1.EventTypeNormal, ops[0].EventType, "an empty type is recorded as Normal")
+	assert.Equal(t, "scaled to 4", ops[1].EventMessage)
+}
+
+func TestKubeEventRecorderWithBroadcaster(t *testing.T) {
+	db := newTestDatabase(t)
+	events, err := NewKubeEventRecorder(KubeEventConfig{
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "widget-controller",
+	})
+	require.NoError(t, err)
+
+	broadcaster := record.NewBroadcaster()
+	defer broadcaster.Shutdown()
+	broadcaster.StartEventWatcher(events.RecordKubeEvent)
+
+	emitter := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "widget-controller"})
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "web-0", Namespace: "default", UID: "uid-pod", ResourceVersion: "9"}}
+	emitter.Eventf(pod, corev1.EventTypeWarning, "BackOff", "restarting %s", "web")
+
+	require.Eventually(t, func() bool {
+		ops, queryErr := db.QueryOperations(testSessionID)
+		return queryErr == nil && len(ops) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, "Pod", ops[0].ResourceKind)
+	assert.Equal(t, "9", ops[0].ResourceVersion)
+	assert.Equal(t, "BackOff", ops[0].EventReason)
+	assert.Equal(t, "restarting web", ops[0].EventMessage)
+	assert.Equal(t, "widget-controller", ops[0].ActorID)
+}
@@ -0,0 +1,285 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	maxFilterRules = 256
+)
+
+// FilterRule matches operations by namespace, resource, verb, actor and
+// labels. Empty fields match everything.
+type FilterRule struct {
+	// Namespace is a glob in path.Match syntax, for example "kube-*".
+	// Cluster-scoped operations have an empty namespace.
+	Namespace string
+	// Group, Version and Kind select the resource. Operations recorded
+	// without group or version (typed client calls) match on Kind alone.
+	Group   string
+	Version string
+	Kind    string
+	// Verbs lists Kubernetes verbs (get, list, watch, create, update, patch,
+	// delete). Matching ignores case.
+	Verbs []string
+	// Actors lists the actor IDs operations are recorded under, for example
+	// the ActorID of a recorder or the user of an audit event.
+	Actors []string
+	// LabelSelector matches the labels of the recorded object. Operations
+	// without an object, such as deletes and lists, never match it.
+	LabelSelector string
+	// SampleRate is the fraction of matching operations an Include rule
+	// records, in (0, 1]. Zero records all of them. Exclude rules ignore it.
+	SampleRate float64
+}
+
+// FilterSpec selects which operations are recorded. An operation is recorded
+// when it matches no Exclude rule and either Include is empty or the first
+// Include rule it matches samples it. Filtered operations take no sequence
+// number; their count is stored with the session.
+type FilterSpec struct {
+	Include []FilterRule
+	Exclude []FilterRule
+}
+
+type compiledFilterRule struct {
+	rule     FilterRule
+	verbs    map[string]bool
+	actors   map[string]bool
+	selector labels.Selector
+	// credit accumulates SampleRate; an operation is kept each time it
+	// reaches one, so sampling keeps an evenly spaced fraction.
+	credit float64
+}
+
+// operationFilter applies a compiled FilterSpec. It is safe for concurrent
+// use.
+type operationFilter struct {
+	// mu guards the sampling credit of the include rules.
+	mu      sync.Mutex
+	include []*compiledFilterRule
+	exclude []*compiledFilterRule
+}
+
+// newOperationFilter compiles spec. A nil spec records everything and
+// returns a nil filter.
+// Rule 5: Multiple assertions for validation.
+func newOperationFilter(spec *FilterSpec) (*operationFilter, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	err := assert.AssertInRange(
+		len(spec.Include)+len(spec.Exclude),
+		0,
+		maxFilterRules,
+		"filter rules",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &operationFilter{}
+	f.include, err = compileFilterRules(spec.Include, "include")
+	if err != nil {
+		return nil, err
+	}
+	f.exclude, err = compileFilterRules(spec.Exclude, "exclude")
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func compileFilterRules(rules []FilterRule, list string) ([]*compiledFilterRule, error) {
+	out := make([]*compiledFilterRule, 0, len(rules))
+	for i := 0; i < len(rules); i++ {
+		compiled, err := compileFilterRule(rules[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s filter rule %d: %w", list, i, err)
+		}
+		out = append(out, compiled)
+	}
+	return out, nil
+}
+
+func compileFilterRule(rule FilterRule) (*compiledFilterRule, error) {
+	_, err := path.Match(rule.Namespace, "")
+	if err != nil {
+		return nil, fmt.Errorf("bad namespace pattern %q: %w", rule.Namespace, err)
+	}
+
+	err = assert.Assert(
+		rule.SampleRate >= 0 && rule.SampleRate <= 1,
+		"sample rate must be between 0 and 1",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &compiledFilterRule{rule: rule}
+	if compiled.rule.SampleRate == 0 {
+		compiled.rule.SampleRate = 1
+	}
+
+	if len(rule.Verbs) > 0 {
+		compiled.verbs = make(map[string]bool, len(rule.Verbs))
+		for i := 0; i < len(rule.Verbs); i++ {
+			compiled.verbs[strings.ToLower(rule.Verbs[i])] = true
+		}
+	}
+
+	if len(rule.Actors) > 0 {
+		compiled.actors = make(map[string]bool, len(rule.Actors))
+		for i := 0; i < len(rule.Actors); i++ {
+			compiled.actors[rule.Actors[i]] = true
+		}
+	}
+
+	if len(rule.LabelSelector) > 0 {
+		compiled.selector, err = labels.Parse(rule.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("bad label selector %q: %w", rule.LabelSelector, err)
+		}
+	}
+
+	return compiled, nil
+}
+
+// keep reports whether op should be recorded.
+func (f *operationFilter) keep(op *storage.Operation) bool {
+	if f == nil || op == nil {
+		return true
+	}
+
+	var objectLabels labels.Set
+	loaded := false
+	labelsOf := func() labels.Set {
+		if !loaded {
+			objectLabels = operationLabels(op)
+			loaded = true
+		}
+		return objectLabels
+	}
+
+	for i := 0; i < len(f.exclude); i++ {
+		if f.exclude[i].matches(op, labelsOf) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for i := 0; i < len(f.include); i++ {
+		rule := f.include[i]
+		if !rule.matches(op, labelsOf) {
+			continue
+		}
+		return f.sample(rule)
+	}
+
+	return false
+}
+
+// sample adds the rule's SampleRate to its credit and reports whether the
+// credit kept the operation.
+func (f *operationFilter) sample(rule *compiledFilterRule) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rule.credit = rule.credit + rule.rule.SampleRate
+	if rule.credit >= 1 {
+		rule.credit = rule.credit - 1
+		return true
+	}
+	return false
+}
+
+// matches reports whether op matches every field set on the rule.
+func (c *compiledFilterRule) matches(op *storage.Operation, labelsOf func() labels.Set) bool {
+	rule := c.rule
+
+	if len(rule.Namespace) > 0 {
+		ok, err := path.Match(rule.Namespace, op.Namespace)
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	if len(rule.Kind) > 0 && rule.Kind != strings.TrimSuffix(op.ResourceKind, "List") {
+		return false
+	}
+
+	unknownGroup := len(op.APIGroup) == 0 && len(op.APIVersion) == 0
+	if !unknownGroup {
+		if len(rule.Group) > 0 && rule.Group != op.APIGroup {
+			return false
+		}
+		if len(rule.Version) > 0 && rule.Version != op.APIVersion {
+			return false
+		}
+	}
+
+	if c.verbs != nil && !c.verbs[operationVerb(op)] {
+		return false
+	}
+
+	if c.actors != nil && !c.actors[op.ActorID] {
+		return false
+	}
+
+	if c.selector != nil {
+		set := labelsOf()
+		if set == nil || !c.selector.Matches(set) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// operationVerb returns the lower-case Kubernetes verb of op.
+func operationVerb(op *storage.Operation) string {
+	verb := op.Verb
+	if len(verb) == 0 {
+		verb = string(op.OperationType)
+	}
+	verb = strings.ToLower(verb)
+	return strings.TrimPrefix(verb, "cache_")
+}
+
+// operationLabels reads metadata.labels from the recorded object. It returns
+// nil when the operation carries no object.
+func operationLabels(op *storage.Operation) labels.Set {
+	if len(op.ResourceData) == 0 {
+		return nil
+	}
+
+	var doc struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Items []json.RawMessage `json:"items"`
+	}
+	err := json.Unmarshal([]byte(op.ResourceData), &doc)
+	if err != nil || doc.Items != nil || strings.HasSuffix(doc.Kind, "List") {
+		return nil
+	}
+
+	if doc.Metadata.Labels == nil {
+		return labels.Set{}
+	}
+	return labels.Set(doc.Metadata.Labels)
+}
@@ -0,0 +1,169 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFilterExcludesAndCountsOperations(t *testing.T) {
+	ctx := context.Background()
+	objects := []*corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Labels: map[string]string{"tier": "web"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "noise", Namespace: "default", Labels: map[string]string{"tier": "batch"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "leader", Namespace: "kube-system"}},
+	}
+	client := fake.NewSimpleClientset(objects[0], objects[1], objects[2])
+	db := newTestDatabase(t)
+
+	rec, err := NewRecordingClient(Config{
+		Client:    client,
+		Database:  db,
+		SessionID: testSessionID,
+		Filter: &FilterSpec{
+			Exclude: []FilterRule{
+				{Namespace: "kube-*"},
+				{Kind: "ConfigMap", LabelSelector: "tier=batch"},
+				{Verbs: []string{"list"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, cm := range objects {
+		_, err = rec.RecordGet(ctx, "ConfigMap", cm.Namespace, cm.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+	}
+	_, err = rec.RecordList(ctx, "ConfigMap", "default", metav1.ListOptions{})
+	require.NoError(t, err)
+	require.NoError(t, rec.Close())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "app", ops[0].Name)
+	assert.Equal(t, int64(1), ops[0].SequenceNumber, "filtered operations take no sequence number")
+	assert.Equal(t, int64(3), rec.FilteredOperations())
+
+	stats, err := db.GetSessionStats(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.FilteredOperations)
+}
+
+func TestFilterIncludeRulesAndSampling(t *testing.T) {
+	filter, err := newOperationFilter(&FilterSpec{
+		Include: []FilterRule{
+			{Group: "apps", Kind: "Deployment", Verbs: []string{"UPDATE", "patch"}},
+			{Kind: "Pod", SampleRate: 0.25},
+		},
+	})
+	require.NoError(t, err)
+
+	deployment := func(verb string, group string) *storage.Operation {
+		return &storage.Operation{ResourceKind: "Deployment", APIGroup: group, APIVersion: "v1", Verb: verb}
+	}
+	assert.True(t, filter.keep(deployment("update", "apps")))
+	assert.True(t, filter.keep(deployment("patch", "apps")))
+	assert.False(t, filter.keep(deployment("get", "apps")))
+	assert.False(t, filter.keep(deployment("update", "extensions")))
+	assert.True(t, filter.keep(&storage.Operation{ResourceKind: "Deployment", OperationType: storage.OperationUpdate}),
+		"typed client operations match on kind")
+	assert.False(t, filter.keep(&storage.Operation{ResourceKind: "Service", Verb: "update"}))
+
+	kept := 0
+	for i := 0; i < 100; i++ {
+		if filter.keep(&storage.Operation{ResourceKind: "Pod", Name: fmt.Sprintf("p%d", i)}) {
+			kept = kept + 1
+		}
+	}
+	assert.Equal(t, 25, kept)
+}
+
+func TestFilterMatchesActors(t *testing.T) {
+	filter, err := newOperationFilter(&FilterSpec{
+		Include: []FilterRule{{Actors: []string{"widget-controller", "system:serviceaccount:ops:widget"}}},
+		Exclude: []FilterRule{{Actors: []string{"widget-controller"}, Verbs: []string{"watch"}}},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, filter.keep(&storage.Operation{ActorID: "widget-controller", Verb: "get"}))
+	assert.True(t, filter.keep(&storage.Operation{ActorID: "system:serviceaccount:ops:widget", Verb: "watch"}))
+	assert.False(t, filter.keep(&storage.Operation{ActorID: "widget-controller", Verb: "watch"}))
+	assert.False(t, filter.keep(&storage.Operation{ActorID: "gadget-controller", Verb: "get"}))
+	assert.False(t, filter.keep(&storage.Operation{Verb: "get"}))
+
+	// The recorder's actor applies to operations recorded without one.
+	ctx := context.Background()
+	db := newTestDatabase(t)
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(),
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "noisy-controller",
+		Filter:    &FilterSpec{Exclude: []FilterRule{{Actors: []string{"noisy-controller"}}}},
+	})
+	require.NoError(t, err)
+
+	_, _ = rec.RecordGet(ctx, "ConfigMap", "default", "missing", metav1.GetOptions{})
+	require.NoError(t, rec.Close())
+	assert.Equal(t, int64(1), rec.FilteredOperations())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+func TestFilterFlushesCountWhileRecording(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	// The asynchronous writer stores the count; nothing is queued, so only
+	// its flush interval writes it.
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(),
+		Database:  db,
+		SessionID: testSessionID,
+		Filter:    &FilterSpec{Exclude: []FilterRule{{Kind: "ConfigMap"}}},
+		Async:     &AsyncConfig{FlushInterval: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, _ = rec.RecordGet(ctx, "ConfigMap", "default", "missing", metav1.GetOptions{})
+	}
+
+	require.Eventually(t, func() bool {
+		stats, err := db.GetSessionStats(testSessionID)
+		return err == nil && stats.FilteredOperations == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, rec.Close())
+
+	stats, err := db.GetSessionStats(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.FilteredOperations, "close stores no count twice")
+}
+
+func TestFilterSpecValidation(t *testing.T) {
+	invalid := []FilterRule{
+		{Namespace: "[kube"},
+		{SampleRate: 1.5},
+		{SampleRate: -0.1},
+		{LabelSelector: "tier in (web"},
+	}
+	for _, rule := range invalid {
+		_, err := newOperationFilter(&FilterSpec{Include: []FilterRule{rule}})
+		assert.Error(t, err)
+	}
+
+	filter, err := newOperationFilter(nil)
+	require.NoError(t, err)
+	assert.True(t, filter.keep(&storage.Operation{ResourceKind: "Pod"}))
+}
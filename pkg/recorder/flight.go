@@ -0,0 +1,737 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+// DumpReason names what made a flight recorder write its buffer.
+type DumpReason string
+
+const (
+	DumpManual         DumpReason = "manual"
+	DumpReconcileError DumpReason = "reconcile-error"
+	DumpPanic          DumpReason = "panic"
+	DumpSignal         DumpReason = "signal"
+	DumpErrorRate      DumpReason = "error-rate"
+)
+
+const (
+	defaultFlightCapacity     = 5000
+	defaultFlightSpanCapacity = 1000
+	defaultFlightCooldown     = time.Minute
+	maxFlightCapacity         = 1000000
+	maxErrorRateCount         = 10000
+	dumpTimeFormat            = "20060102T150405"
+)
+
+// DumpReasonLabel is the session label naming what made a flight recorder
+// write a dump.
+const DumpReasonLabel = "kubestep.io/dump-reason"
+
+// ErrorRateTrigger dumps the buffer when Errors failed operations are
+// recorded within Window.
+type ErrorRateTrigger struct {
+	Errors int
+	Window time.Duration
+}
+
+// FlightRecorderConfig holds configuration for a flight recorder.
+type FlightRecorderConfig struct {
+	// Store receives each dump as a new session.
+	Store storage.OperationStore
+	// SessionID is the session recorders write into. Dumps are named
+	// <SessionID>-<reason>-<time>-<n>.
+	SessionID string
+	// Capacity and SpanCapacity bound the buffered operations and spans.
+	Capacity     int
+	SpanCapacity int
+	// DumpOnReconcileError dumps when a reconcile span ends with an error.
+	DumpOnReconcileError bool
+	// DumpOnSignal dumps when the process receives SIGUSR1.
+	DumpOnSignal bool
+	ErrorRate    *ErrorRateTrigger
+	// Cooldown is the minimum time between triggered dumps. Dump ignores it.
+	Cooldown time.Duration
+	// OnDump is called after every dump attempt.
+	OnDump func(sessionID string, reason DumpReason, err error)
+}
+
+// FlightRecorder keeps the most recent operations and reconcile spans in
+// memory and writes them to a store only when something goes wrong.
+//
+// It is a storage.OperationStore: pass it as the Database of any recording
+// wrapper and as the store of reconciletrace.Start. All methods are safe for
+// concurrent use.
+type FlightRecorder struct {
+	cfg FlightRecorderConfig
+
+	mu        sync.Mutex
+	ops       []storage.Operation
+	opHead    int
+	opCount   int
+	spans     []storage.ReconcileSpan
+	spanHead  int
+	spanCount int
+	// errorTimes holds the times of the most recent failed operations.
+	errorTimes []time.Time
+	errorHead  int
+	dropped    int64
+	filtered   int64
+	redaction  []string
+	// session is the metadata begun for the buffered session, written
+	// with every dump. Nil until BeginSession.
+	session *storage.Session
+
+	// dumpMu serializes dumps and guards lastDump.
+	dumpMu   sync.Mutex
+	lastDump time.Time
+	dumps    int64
+
+	// triggers holds at most one pending triggered dump for runDumps.
+	triggers  chan DumpReason
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFlightRecorder creates a flight recorder.
+// Rule 5: Multiple assertions for validation.
+func NewFlightRecorder(cfg FlightRecorderConfig) (*FlightRecorder, error) {
+	err := assert.Assert(cfg.Store != nil, "store must not be nil")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(len(cfg.SessionID), 1, maxSessionIDLength/2, "session_id length")
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = defaultFlightCapacity
+	}
+	if cfg.SpanCapacity <= 0 {
+		cfg.SpanCapacity = defaultFlightSpanCapacity
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultFlightCooldown
+	}
+
+	err = assert.AssertInRange(cfg.Capacity, 1, maxFlightCapacity, "capacity")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(cfg.SpanCapacity, 1, maxFlightCapacity, "span capacity")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FlightRecorder{
+		cfg:      cfg,
+		ops:      make([]storage.Operation, cfg.Capacity),
+		spans:    make([]storage.ReconcileSpan, cfg.SpanCapacity),
+		triggers: make(chan DumpReason, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	if cfg.ErrorRate != nil {
+		err = assert.AssertInRange(cfg.ErrorRate.Errors, 1, maxErrorRateCount, "error rate count")
+		if err != nil {
+			return nil, err
+		}
+		err = assert.Assert(cfg.ErrorRate.Window > 0, "error rate window must be positive")
+		if err != nil {
+			return nil, err
+		}
+		f.errorTimes = make([]time.Time, cfg.ErrorRate.Errors)
+	}
+
+	if cfg.DumpOnSignal {
+		err = f.watchSignals()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go f.runDumps()
+	return f, nil
+}
+
+// Dump writes the buffer to the store as a new session and returns its ID.
+func (f *FlightRecorder) Dump() (string, error) {
+	err := assert.AssertNotNil(f, "flight recorder")
+	if err != nil {
+		return "", err
+	}
+
+	f.dumpMu.Lock()
+	defer f.dumpMu.Unlock()
+	return f.dumpLocked(DumpManual)
+}
+
+// DumpOnPanic dumps the buffer when the calling goroutine panics, then
+// panics again. Use it with defer at the top of Reconcile.
+func (f *FlightRecorder) DumpOnPanic() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	f.dumpMu.Lock()
+	_, _ = f.dumpLocked(DumpPanic)
+	f.dumpMu.Unlock()
+	panic(recovered)
+}
+
+// Dumps returns how many dumps were written.
+func (f *FlightRecorder) Dumps() int64 {
+	return atomic.LoadInt64(&f.dumps)
+}
+
+// trigger hands a dump for reason to runDumps without waiting for it. A
+// trigger arriving while another is pending is dropped, so a burst of
+// failures writes one dump.
+func (f *FlightRecorder) trigger(reason DumpReason) {
+	select {
+	case f.triggers <- reason:
+	default:
+	}
+}
+
+// runDumps writes triggered dumps one at a time, off the recording path,
+// until Close. A trigger still pending at Close is written before it
+// returns.
+func (f *FlightRecorder) runDumps() {
+	defer close(f.stopped)
+
+	for {
+		select {
+		case reason := <-f.triggers:
+			f.triggeredDump(reason)
+		case <-f.done:
+			select {
+			case reason := <-f.triggers:
+				f.triggeredDump(reason)
+			default:
+			}
+			return
+		}
+	}
+}
+
+// triggeredDump dumps for reason unless the previous dump is within the
+// cooldown.
+func (f *FlightRecorder) triggeredDump(reason DumpReason) {
+	f.dumpMu.Lock()
+	defer f.dumpMu.Unlock()
+
+	if !f.lastDump.IsZero() && time.Since(f.lastDump) < f.cfg.Cooldown {
+		return
+	}
+	_, _ = f.dumpLocked(reason)
+}
+
+// dumpLocked copies the buffer and writes it to the store. The caller holds
+// dumpMu.
+func (f *FlightRecorder) dumpLocked(reason DumpReason) (string, error) {
+	n := atomic.AddInt64(&f.dumps, 1)
+	now := time.Now()
+	f.lastDump = now
+	dumpID := fmt.Sprintf("%s-%s-%s-%d", f.cfg.SessionID, reason, now.UTC().Format(dumpTimeFormat), n)
+
+	snap := f.snapshot()
+	snap.reason = reason
+	err := f.write(dumpID, snap)
+	if err != nil {
+		atomic.AddInt64(&f.dumps, -1)
+		err = fmt.Errorf("flight recorder dump failed: %w", err)
+	}
+
+	if f.cfg.OnDump != nil {
+		f.cfg.OnDump(dumpID, reason, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return dumpID, nil
+}
+
+// flightSnapshot is a copy of the buffer taken for one dump.
+type flightSnapshot struct {
+	ops       []*storage.Operation
+	spans     []storage.ReconcileSpan
+	dropped   int64
+	filtered  int64
+	redaction []string
+	session   *storage.Session
+	reason    DumpReason
+}
+
+// snapshot copies the buffered operations and spans, oldest first.
+func (f *FlightRecorder) snapshot() flightSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	snap := flightSnapshot{
+		ops:       make([]*storage.Operation, 0, f.opCount),
+		spans:     make([]storage.ReconcileSpan, 0, f.spanCount),
+		dropped:   f.dropped,
+		filtered:  f.filtered,
+		redaction: append([]string(nil), f.redaction...),
+		session:   copySession(f.session),
+	}
+
+	start := (f.opHead - f.opCount + len(f.ops)) % len(f.ops)
+	for i := 0; i < f.opCount; i++ {
+		op := f.ops[(start+i)%len(f.ops)]
+		snap.ops = append(snap.ops, &op)
+	}
+
+	start = (f.spanHead - f.spanCount + len(f.spans)) % len(f.spans)
+	for i := 0; i < f.spanCount; i++ {
+		snap.spans = append(snap.spans, f.spans[(start+i)%len(f.spans)])
+	}
+
+	return snap
+}
+
+// write stores one dump under dumpID. A dump with session metadata that
+// fails after its session began is ended as failed.
+func (f *FlightRecorder) write(dumpID string, snap flightSnapshot) error {
+	store := f.cfg.Store
+	if snap.session == nil {
+		return f.writeRecords(dumpID, snap)
+	}
+
+	err := store.BeginSession(dumpSession(dumpID, snap))
+	if err != nil {
+		return err
+	}
+
+	err = f.writeRecords(dumpID, snap)
+	if err != nil {
+		_ = store.EndSession(dumpID, storage.SessionFailed)
+		return err
+	}
+	return store.EndSession(dumpID, storage.SessionCompleted)
+}
+
+// writeRecords stores the operations, spans and counters of one dump.
+// Operations are inserted in batches the stores accept. Span IDs are
+// remapped, on spans and on the operations linked to them, so a span held
+// by several dumps stays unique in the store.
+// Rule 2: Bounded by the snapshot contents.
+func (f *FlightRecorder) writeRecords(dumpID string, snap flightSnapshot) error {
+	store := f.cfg.Store
+	ops := snap.ops
+	spans := snap.spans
+	redaction := snap.redaction
+
+	if len(redaction) > 0 {
+		err := store.SetSessionRedaction(dumpID, redaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(ops); i++ {
+		ops[i].ID = 0
+		ops[i].SessionID = dumpID
+		if len(ops[i].SpanID) > 0 {
+			ops[i].SpanID = dumpSpanID(dumpID, ops[i].SpanID)
+		}
+	}
+	for start := 0; start < len(ops); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+		err := store.InsertOperations(ops[start:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(spans); i++ {
+		span := spans[i]
+		span.ID = dumpSpanID(dumpID, span.ID)
+		span.SessionID = dumpID
+		err := store.InsertReconcileSpan(&span)
+		if err != nil {
+			return err
+		}
+	}
+
+	if snap.dropped > 0 {
+		err := store.AddDroppedOperations(dumpID, snap.dropped)
+		if err != nil {
+			return err
+		}
+	}
+	if snap.filtered > 0 {
+		err := store.AddFilteredOperations(dumpID, snap.filtered)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpSession returns the metadata stored for one dump: the begun session's,
+// labeled with the dump reason and starting at the oldest buffered operation.
+func dumpSession(dumpID string, snap flightSnapshot) *storage.Session {
+	meta := copySession(snap.session)
+	meta.ID = dumpID
+	meta.Labels[DumpReasonLabel] = string(snap.reason)
+	if len(snap.ops) > 0 {
+		meta.StartTime = snap.ops[0].Timestamp
+	}
+	return meta
+}
+
+// copySession copies meta and its labels. The copy always has a label map.
+func copySession(meta *storage.Session) *storage.Session {
+	if meta == nil {
+		return nil
+	}
+
+	out := *meta
+	out.Labels = make(map[string]string, len(meta.Labels)+1)
+	for key, value := range meta.Labels {
+		out.Labels[key] = value
+	}
+	out.Redaction = append([]string(nil), meta.Redaction...)
+	return &out
+}
+
+// dumpSpanID derives the stored ID of a buffered span in one dump.
+func dumpSpanID(dumpID string, spanID string) string {
+	sum := sha256.Sum256([]byte(dumpID + "/" + spanID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Close stops the signal handler and waits for triggered dumps in progress
+// or pending. It does not close the store.
+func (f *FlightRecorder) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+		<-f.stopped
+	})
+	return nil
+}
+
+// InsertOperation buffers op, evicting the oldest operation when full.
+func (f *FlightRecorder) InsertOperation(op *storage.Operation) error {
+	err := storage.ValidateOperation(op)
+	if err != nil {
+		return fmt.Errorf("operation validation failed: %w", err)
+	}
+
+	f.mu.Lock()
+	f.ops[f.opHead] = *op
+	f.opHead = (f.opHead + 1) % len(f.ops)
+	if f.opCount < len(f.ops) {
+		f.opCount = f.opCount + 1
+	}
+	rateExceeded := len(op.Error) > 0 && f.countErrorLocked(op.Timestamp)
+	f.mu.Unlock()
+
+	if rateExceeded {
+		f.trigger(DumpErrorRate)
+	}
+	return nil
+}
+
+// countErrorLocked notes a failed operation and reports whether the error
+// rate trigger fired. The caller holds mu.
+func (f *FlightRecorder) countErrorLocked(at time.Time) bool {
+	if f.errorTimes == nil {
+		return false
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	f.errorTimes[f.errorHead] = at
+	f.errorHead = (f.errorHead + 1) % len(f.errorTimes)
+
+	// errorHead now points at the oldest of the last Errors failures.
+	oldest := f.errorTimes[f.errorHead]
+	return !oldest.IsZero() && at.Sub(oldest) <= f.cfg.ErrorRate.Window
+}
+
+// InsertOperations buffers ops in order.
+// Rule 2: Bounded by the batch length.
+func (f *FlightRecorder) InsertOperations(ops []*storage.Operation) error {
+	err := assert.Assert(len(ops) > 0, "operation batch must not be empty")
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ops); i++ {
+		err = f.InsertOperation(ops[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryOperations returns the buffered operations of a session.
+func (f *FlightRecorder) QueryOperations(sessionID string) ([]storage.Operation, error) {
+	return f.QueryOperationsByRange(sessionID, 0, math.MaxInt64)
+}
+
+// QueryOperationsByRange returns buffered operations within a sequence range.
+func (f *FlightRecorder) QueryOperationsByRange(
+	sessionID string,
+	start, end int64,
+) ([]storage.Operation, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	ops := f.snapshot().ops
+	out := make([]storage.Operation, 0, len(ops))
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		if op.SessionID == sessionID && op.SequenceNumber >= start && op.SequenceNumber <= end {
+			out = append(out, *op)
+		}
+	}
+	storage.SortOperations(out)
+	return out, nil
+}
+
+// ListSessions describes the buffered session.
+func (f *FlightRecorder) ListSessions() ([]storage.SessionInfo, error) {
+	snap := f.snapshot()
+	ops := snap.ops
+	if len(ops) == 0 {
+		return []storage.SessionInfo{}, nil
+	}
+
+	info := storage.SessionInfo{
+		SessionID: f.cfg.SessionID,
+		StartTime: ops[0].Timestamp.Unix(),
+		EndTime:   ops[len(ops)-1].Timestamp.Unix(),
+		OpCount:   int64(len(ops)),
+		SpanCount: int64(len(snap.spans)),
+	}
+	seen := make(map[string]bool, 4)
+	for i := 0; i < len(ops); i++ {
+		if len(ops[i].Error) > 0 {
+			info.ErrorCount = info.ErrorCount + 1
+		}
+		if len(ops[i].ActorID) > 0 && !seen[ops[i].ActorID] {
+			seen[ops[i].ActorID] = true
+			info.Actors = append(info.Actors, ops[i].ActorID)
+		}
+	}
+	sort.Strings(info.Actors)
+	meta, err := f.GetSession(f.cfg.SessionID)
+	if err == nil {
+		info.Meta = meta
+		info.Description = meta.Description
+	}
+	return []storage.SessionInfo{info}, nil
+}
+
+// MaxLamport returns the highest buffered logical clock of a session.
+func (f *FlightRecorder) MaxLamport(sessionID string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	clock := int64(0)
+	for i := 0; i < f.opCount; i++ {
+		op := &f.ops[i]
+		if op.SessionID != sessionID {
+			continue
+		}
+		value := op.Lamport
+		if value == 0 {
+			value = op.SequenceNumber
+		}
+		if value > clock {
+			clock = value
+		}
+	}
+	return clock, nil
+}
+
+// BeginSession keeps the session metadata to store with every dump. Dumps
+// carry it as their own session, labeled with DumpReasonLabel.
+func (f *FlightRecorder) BeginSession(meta *storage.Session) error {
+	err := storage.ValidateSession(meta)
+	if err != nil {
+		return fmt.Errorf("invalid session: %w", err)
+	}
+
+	f.mu.Lock()
+	f.session = copySession(meta)
+	f.session.Status = storage.SessionRunning
+	if f.session.StartTime.IsZero() {
+		f.session.StartTime = time.Now()
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+// EndSession records the final status of the buffered session. Dumps
+// written afterwards are still stored as completed.
+func (f *FlightRecorder) EndSession(sessionID string, status storage.SessionStatus) error {
+	err := storage.ValidateEndStatus(status)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.session == nil || f.session.ID != sessionID {
+		return fmt.Errorf("%w: %s", storage.ErrSessionNotFound, sessionID)
+	}
+	f.session.Status = status
+	f.session.EndTime = time.Now()
+	return nil
+}
+
+// GetSession returns the metadata begun for the buffered session.
+func (f *FlightRecorder) GetSession(sessionID string) (*storage.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.session == nil || f.session.ID != sessionID {
+		return nil, fmt.Errorf("%w: %s", storage.ErrSessionNotFound, sessionID)
+	}
+	meta := copySession(f.session)
+	meta.DroppedOperations = f.dropped
+	meta.FilteredOperations = f.filtered
+	meta.Redaction = append([]string(nil), f.redaction...)
+	return meta, nil
+}
+
+// AddDroppedOperations counts operations the recorder dropped.
+func (f *FlightRecorder) AddDroppedOperations(sessionID string, count int64) error {
+	err := assert.Assert(count >= 0, "dropped count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.dropped = f.dropped + count
+	f.mu.Unlock()
+	return nil
+}
+
+// AddFilteredOperations counts operations recording filters left out.
+func (f *FlightRecorder) AddFilteredOperations(sessionID string, count int64) error {
+	err := assert.Assert(count >= 0, "filtered count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.filtered = f.filtered + count
+	f.mu.Unlock()
+	return nil
+}
+
+// SetSessionRedaction keeps the redaction rules to store with every dump.
+func (f *FlightRecorder) SetSessionRedaction(sessionID string, rules []string) error {
+	f.mu.Lock()
+	f.redaction = append([]string(nil), rules...)
+	f.mu.Unlock()
+	return nil
+}
+
+// GetSessionStats returns the counters kept for the buffered session.
+func (f *FlightRecorder) GetSessionStats(sessionID string) (*storage.SessionStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &storage.SessionStats{
+		SessionID:          sessionID,
+		DroppedOperations:  f.dropped,
+		FilteredOperations: f.filtered,
+		Redaction:          append([]string(nil), f.redaction...),
+		UpdatedAt:          time.Now(),
+	}, nil
+}
+
+// InsertReconcileSpan buffers span, evicting the oldest span when full.
+func (f *FlightRecorder) InsertReconcileSpan(span *storage.ReconcileSpan) error {
+	err := storage.ValidateReconcileSpan(span)
+	if err != nil {
+		return fmt.Errorf("span validation failed: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.spans[f.spanHead] = *span
+	f.spanHead = (f.spanHead + 1) % len(f.spans)
+	if f.spanCount < len(f.spans) {
+		f.spanCount = f.spanCount + 1
+	}
+	return nil
+}
+
+// EndReconcileSpan completes a buffered span. A span that ends with an
+// error fires the reconcile error trigger.
+func (f *FlightRecorder) EndReconcileSpan(
+	spanID string,
+	endTime time.Time,
+	durationMs int64,
+	errMsg string,
+) error {
+	err := assert.AssertStringNotEmpty(spanID, "span ID")
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	for i := 0; i < f.spanCount; i++ {
+		span := &f.spans[i]
+		if span.ID != spanID {
+			continue
+		}
+		span.EndTime = endTime
+		span.DurationMs = durationMs
+		span.Error = errMsg
+		break
+	}
+	f.mu.Unlock()
+
+	if len(errMsg) > 0 && f.cfg.DumpOnReconcileError {
+		f.trigger(DumpReconcileError)
+	}
+	return nil
+}
+
+// QueryReconcileSpans returns the buffered spans of a session.
+func (f *FlightRecorder) QueryReconcileSpans(sessionID string) ([]storage.ReconcileSpan, error) {
+	spans := f.snapshot().spans
+	out := make([]storage.ReconcileSpan, 0, len(spans))
+	for i := 0; i < len(spans); i++ {
+		if spans[i].SessionID == sessionID {
+			out = append(out, spans[i])
+		}
+	}
+	return out, nil
+}
+
+var _ storage.OperationStore = (*FlightRecorder)(nil)
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package recorder
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSignals dumps the buffer on SIGUSR1 until Close is called.
+func (f *FlightRecorder) watchSignals() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				f.trigger(DumpSignal)
+			case <-f.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
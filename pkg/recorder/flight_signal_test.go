@@ -0,0 +1,28 @@
+//go:build !windows
+
+package recorder
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlightRecorderDumpsOnSignal(t *testing.T) {
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{DumpOnSignal: true})
+	op := testOperation(1)
+	op.SessionID = flightSessionID
+	require.NoError(t, flight.InsertOperation(op))
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	require.Eventually(t, func() bool {
+		return flight.Dumps() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Contains(t, sessions[0].SessionID, "flight-signal-")
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package recorder
+
+import "fmt"
+
+// watchSignals is unsupported: Windows has no SIGUSR1.
+func (f *FlightRecorder) watchSignals() error {
+	return fmt.Errorf("dump on signal is not supported on windows")
+}
@@ -0,0 +1,302 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/reconciletrace"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const flightSessionID = "flight"
+
+func newTestFlightRecorder(t *testing.T, cfg FlightRecorderConfig) (*FlightRecorder, *storage.Database) {
+	t.Helper()
+
+	db := newTestDatabase(t)
+	cfg.Store = db
+	cfg.SessionID = flightSessionID
+	flight, err := NewFlightRecorder(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, flight.Close())
+	})
+	return flight, db
+}
+
+func flightClient(t *testing.T, flight *FlightRecorder) *RecordingClient {
+	t.Helper()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(secret),
+		Database:  flight,
+		SessionID: flightSessionID,
+	})
+	require.NoError(t, err)
+	return rec
+}
+
+func TestFlightRecorderKeepsLastOperations(t *testing.T) {
+	ctx := context.Background()
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{Capacity: 3})
+	rec := flightClient(t, flight)
+
+	for i := 0; i < 5; i++ {
+		_, err := rec.RecordGet(ctx, "Secret", "default", "creds", metav1.GetOptions{})
+		require.NoError(t, err)
+	}
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "nothing is written before a dump")
+
+	buffered, err := flight.QueryOperations(flightSessionID)
+	require.NoError(t, err)
+	require.Len(t, buffered, 3)
+
+	dumpID, err := flight.Dump()
+	require.NoError(t, err)
+	assert.Contains(t, dumpID, "flight-manual-")
+	assert.Equal(t, int64(1), flight.Dumps())
+
+	ops, err := db.QueryOperations(dumpID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	for i := range ops {
+		assert.Equal(t, int64(i+3), ops[i].SequenceNumber)
+		assert.NotContains(t, ops[i].ResourceData, "c2VjcmV0")
+	}
+
+	stats, err := db.GetSessionStats(dumpID)
+	require.NoError(t, err)
+	assert.Contains(t, stats.Redaction, "drop Secret $.data")
+
+	second, err := flight.Dump()
+	require.NoError(t, err)
+	assert.NotEqual(t, dumpID, second, "every dump is a new session")
+}
+
+func TestFlightRecorderDumpsOnReconcileError(t *testing.T) {
+	ctx := context.Background()
+	var reasons []DumpReason
+	dumped := make(chan struct{}, 2)
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{
+		DumpOnReconcileError: true,
+		OnDump: func(sessionID string, reason DumpReason, err error) {
+			assert.NoError(t, err)
+			reasons = append(reasons, reason)
+			dumped <- struct{}{}
+		},
+	})
+	rec := flightClient(t, flight)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+	spanID, spanCtx := reconciletrace.Start(ctx, flight, flightSessionID, "ctrl", gvk,
+		"default", "creds", "", "", "update")
+	require.NotEmpty(t, spanID)
+	_, err := rec.RecordGet(spanCtx, "Secret", "default", "creds", metav1.GetOptions{})
+	require.NoError(t, err)
+	reconciletrace.End(spanCtx, flight, spanID, nil)
+	assert.Empty(t, reasons, "a successful reconcile does not dump")
+
+	for i := 0; i < 2; i++ {
+		spanID, spanCtx = reconciletrace.Start(ctx, flight, flightSessionID, "ctrl", gvk,
+			"default", "creds", "", "", "update")
+		reconciletrace.End(spanCtx, flight, spanID, errors.New("conflict"))
+		if i == 0 {
+			// Dumps are written in the background.
+			<-dumped
+		}
+	}
+	require.NoError(t, flight.Close())
+	require.Equal(t, []DumpReason{DumpReconcileError}, reasons, "the cooldown suppresses the second dump")
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	spans, err := db.QueryReconcileSpans(sessions[0].SessionID)
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+	assert.NotEqual(t, spanID, spans[1].ID)
+	assert.Empty(t, spans[0].Error)
+	assert.Equal(t, "conflict", spans[1].Error)
+
+	ops, err := db.QueryOperations(sessions[0].SessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, spans[0].ID, ops[0].SpanID, "operations follow their span's remapped ID")
+}
+
+func TestFlightRecorderDumpsOnErrorRate(t *testing.T) {
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{
+		ErrorRate: &ErrorRateTrigger{Errors: 3, Window: time.Minute},
+	})
+
+	now := time.Now()
+	for seq := int64(1); seq <= 4; seq++ {
+		op := testOperation(seq)
+		op.SessionID = flightSessionID
+		op.Timestamp = now
+		if seq%2 == 0 {
+			op.Error = "forbidden"
+		}
+		require.NoError(t, flight.InsertOperation(op))
+	}
+	assert.Equal(t, int64(0), flight.Dumps(), "two errors stay under the threshold")
+
+	op := testOperation(5)
+	op.SessionID = flightSessionID
+	op.Timestamp = now
+	op.Error = "forbidden"
+	require.NoError(t, flight.InsertOperation(op))
+	require.NoError(t, flight.Close())
+	assert.Equal(t, int64(1), flight.Dumps())
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Contains(t, sessions[0].SessionID, "flight-error-rate-")
+	assert.Equal(t, int64(5), sessions[0].OpCount)
+}
+
+func TestFlightRecorderDumpsOnPanic(t *testing.T) {
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{})
+	op := testOperation(1)
+	op.SessionID = flightSessionID
+	require.NoError(t, flight.InsertOperation(op))
+
+	reconcile := func() {
+		defer flight.DumpOnPanic()
+		panic("nil map")
+	}
+	assert.PanicsWithValue(t, "nil map", reconcile)
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Contains(t, sessions[0].SessionID, "flight-panic-")
+}
+
+func TestFlightRecorderDumpsLargeBuffers(t *testing.T) {
+	total := maxBatchSize + maxBatchSize/2
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{Capacity: total})
+	for seq := int64(1); seq <= int64(total); seq++ {
+		op := testOperation(seq)
+		op.SessionID = flightSessionID
+		require.NoError(t, flight.InsertOperation(op))
+	}
+
+	dumpID, err := flight.Dump()
+	require.NoError(t, err)
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, dumpID, sessions[0].SessionID)
+	assert.Equal(t, int64(total), sessions[0].OpCount)
+}
+
+// blockingInserts is a store whose operation inserts wait for release.
+type blockingInserts struct {
+	storage.OperationStore
+	release chan struct{}
+}
+
+func (b blockingInserts) InsertOperations(ops []*storage.Operation) error {
+	<-b.release
+	return b.OperationStore.InsertOperations(ops)
+}
+
+func TestFlightRecorderDumpsOffTheRecordingPath(t *testing.T) {
+	memory := storage.NewMemoryStore()
+	store := blockingInserts{OperationStore: memory, release: make(chan struct{})}
+	total := maxBatchSize + maxBatchSize/2
+	flight, err := NewFlightRecorder(FlightRecorderConfig{
+		Store:     store,
+		SessionID: flightSessionID,
+		Capacity:  total,
+		ErrorRate: &ErrorRateTrigger{Errors: 1, Window: time.Minute},
+	})
+	require.NoError(t, err)
+
+	for seq := int64(1); seq <= int64(total)+1; seq++ {
+		op := testOperation(seq)
+		op.SessionID = flightSessionID
+		op.Error = "forbidden"
+		inserted := make(chan error, 1)
+		go func() {
+			inserted <- flight.InsertOperation(op)
+		}()
+		select {
+		case err = <-inserted:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("a triggered dump blocked insert %d", seq)
+		}
+	}
+
+	close(store.release)
+	require.NoError(t, flight.Close())
+	assert.Equal(t, int64(1), flight.Dumps(), "triggers during a dump are coalesced or within the cooldown")
+
+	sessions, err := memory.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Contains(t, sessions[0].SessionID, "flight-error-rate-")
+}
+
+func TestFlightRecorderEndsFailedDumps(t *testing.T) {
+	memory := storage.NewMemoryStore()
+	flight, err := NewFlightRecorder(FlightRecorderConfig{
+		Store:     failingInserts{OperationStore: memory},
+		SessionID: flightSessionID,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, flight.Close())
+	}()
+
+	require.NoError(t, flight.BeginSession(&storage.Session{ID: flightSessionID}))
+	op := testOperation(1)
+	op.SessionID = flightSessionID
+	require.NoError(t, flight.InsertOperation(op))
+
+	_, err = flight.Dump()
+	require.ErrorContains(t, err, "disk full")
+
+	sessions, err := memory.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.NotNil(t, sessions[0].Meta)
+	assert.Equal(t, storage.SessionFailed, sessions[0].Meta.Status)
+}
+
+func TestFlightRecorderConfigValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := NewFlightRecorder(FlightRecorderConfig{SessionID: flightSessionID})
+	assert.Error(t, err)
+	_, err = NewFlightRecorder(FlightRecorderConfig{Store: db})
+	assert.Error(t, err)
+	_, err = NewFlightRecorder(FlightRecorderConfig{Store: db, SessionID: flightSessionID, Capacity: maxFlightCapacity + 1})
+	assert.Error(t, err)
+	_, err = NewFlightRecorder(FlightRecorderConfig{
+		Store:     db,
+		SessionID: flightSessionID,
+		ErrorRate: &ErrorRateTrigger{Errors: 3},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package recorder
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	maxRecordedListItems = 10000 // matches storage list_items limit
+)
+
+// setListOptions stores the selectors and pagination of a LIST request.
+func setListOptions(op *storage.Operation, opts metav1.ListOptions) {
+	op.LabelSelector = opts.LabelSelector
+	op.FieldSelector = opts.FieldSelector
+	op.Limit = opts.Limit
+	op.Continue = opts.Continue
+}
+
+// listOptionsFromQuery reads LIST options from request query parameters.
+func listOptionsFromQuery(u *url.URL) metav1.ListOptions {
+	opts := metav1.ListOptions{}
+	if u == nil {
+		return opts
+	}
+
+	query := u.Query()
+	opts.LabelSelector = query.Get("labelSelector")
+	opts.FieldSelector = query.Get("fieldSelector")
+	opts.Continue = query.Get("continue")
+
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err == nil && limit > 0 {
+		opts.Limit = limit
+	}
+
+	return opts
+}
+
+// setListItems stores the list resourceVersion and the identity and version
+// of every returned item, so readers can tell which versions were observed.
+// Rule 2: Bounded by maxRecordedListItems.
+func setListItems(op *storage.Operation, list runtime.Object) {
+	if list == nil {
+		return
+	}
+
+	listMeta, err := meta.ListAccessor(list)
+	if err == nil {
+		op.ResourceVersion = listMeta.GetResourceVersion()
+	}
+
+	items := make([]storage.ListItem, 0, 16)
+	_ = meta.EachListItem(list, func(item runtime.Object) error {
+		if len(items) >= maxRecordedListItems {
+			return nil
+		}
+
+		accessor, accessErr := meta.Accessor(item)
+		if accessErr != nil {
+			return nil
+		}
+
+		items = append(items, storage.ListItem{
+			UID:             string(accessor.GetUID()),
+			ResourceVersion: accessor.GetResourceVersion(),
+			Namespace:       accessor.GetNamespace(),
+			Name:            accessor.GetName(),
+		})
+		return nil
+	})
+
+	if len(items) > 0 {
+		op.ListItems = items
+	}
+}
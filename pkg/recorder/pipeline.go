@@ -0,0 +1,276 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	defaultQueueSize     = 1024
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	maxQueueSize         = 1000000
+	maxBatchSize         = 10000 // matches storage batch limit
+	maxEnqueueAttempts   = 2
+)
+
+// OverflowPolicy decides what happens when the recording queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits for queue space. Nothing is lost, but a slow
+	// database slows down the caller.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest discards the operation being recorded.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowDropOldest discards the oldest queued operation to make room.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+)
+
+// AsyncConfig enables background recording. Operations are queued on the
+// caller's path and written in batches, one transaction per batch, by a
+// single writer goroutine.
+type AsyncConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Overflow      OverflowPolicy
+}
+
+// asyncWriter owns the queue and the writer goroutine for one sink.
+type asyncWriter struct {
+	db            storage.OperationStore
+	sessionID     string
+	queue         chan *storage.Operation
+	policy        OverflowPolicy
+	batchSize     int
+	flushInterval time.Duration
+	dropped       int64
+	failures      int64
+	persisted     int64
+	done          chan struct{}
+	stopped       chan struct{}
+	closeOnce     sync.Once
+	closeErr      error
+	// filtered counts operations the sink's filter left out; the writer
+	// adds them to the session like drops.
+	filtered          int64
+	persistedFiltered int64
+}
+
+// newAsyncWriter validates cfg, applies defaults and starts the writer.
+// Rule 5: Multiple assertions for validation.
+func newAsyncWriter(db storage.OperationStore, sessionID string, cfg AsyncConfig) (*asyncWriter, error) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if len(cfg.Overflow) == 0 {
+		cfg.Overflow = OverflowBlock
+	}
+
+	err := assert.AssertInRange(cfg.QueueSize, 1, maxQueueSize, "queue size")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(cfg.BatchSize, 1, maxBatchSize, "batch size")
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Overflow {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+	default:
+		return nil, fmt.Errorf("unknown overflow policy: %s", cfg.Overflow)
+	}
+
+	w := &asyncWriter{
+		db:            db,
+		sessionID:     sessionID,
+		queue:         make(chan *storage.Operation, cfg.QueueSize),
+		policy:        cfg.Overflow,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go w.run()
+
+	return w, nil
+}
+
+// enqueue hands op to the writer according to the overflow policy.
+// Rule 2: Bounded by maxEnqueueAttempts for drop-oldest.
+func (w *asyncWriter) enqueue(op *storage.Operation) {
+	switch w.policy {
+	case OverflowDropNewest:
+		select {
+		case w.queue <- op:
+		default:
+			atomic.AddInt64(&w.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for attempt := 0; attempt < maxEnqueueAttempts; attempt++ {
+			select {
+			case w.queue <- op:
+				return
+			default:
+			}
+
+			select {
+			case <-w.queue:
+				atomic.AddInt64(&w.dropped, 1)
+			default:
+			}
+		}
+		atomic.AddInt64(&w.dropped, 1)
+	default:
+		w.queue <- op
+	}
+}
+
+// run writes batches until close is requested, then drains the queue.
+func (w *asyncWriter) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*storage.Operation, 0, w.batchSize)
+	for {
+		select {
+		case op := <-w.queue:
+			batch = append(batch, op)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-w.done:
+			w.closeErr = w.shutdown(batch)
+			return
+		}
+	}
+}
+
+// shutdown writes batch and everything still queued, then stores the drop
+// and filter counts. It fails when any of those writes fails, so the
+// session can be ended as failed.
+func (w *asyncWriter) shutdown(batch []*storage.Operation) error {
+	failed := atomic.LoadInt64(&w.failures)
+	batch = w.drain(batch)
+	w.flush(batch)
+
+	err := w.persistDropped()
+	filteredErr := w.persistFiltered()
+	lost := atomic.LoadInt64(&w.failures) - failed
+	if lost > 0 {
+		return fmt.Errorf("failed to write %d queued operations", lost)
+	}
+	if err != nil {
+		return err
+	}
+	return filteredErr
+}
+
+// drain moves everything still queued into batches and writes them.
+// Rule 2: Bounded by queue capacity.
+func (w *asyncWriter) drain(batch []*storage.Operation) []*storage.Operation {
+	maxOps := cap(w.queue)
+	for i := 0; i < maxOps; i++ {
+		select {
+		case op := <-w.queue:
+			batch = append(batch, op)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush writes batch in one transaction, then the drop and filter counts,
+// and returns batch emptied. A failed batch is counted, never retried, so a
+// broken database cannot stall callers.
+func (w *asyncWriter) flush(batch []*storage.Operation) []*storage.Operation {
+	if len(batch) > 0 {
+		err := w.db.InsertOperations(batch)
+		if err != nil {
+			atomic.AddInt64(&w.failures, int64(len(batch)))
+		}
+	}
+
+	_ = w.persistDropped()
+	_ = w.persistFiltered()
+	return batch[:0]
+}
+
+// persistDropped adds drops seen since the last call to the session stats.
+// Only the writer goroutine calls it.
+func (w *asyncWriter) persistDropped() error {
+	delta := atomic.LoadInt64(&w.dropped) - w.persisted
+	if delta <= 0 {
+		return nil
+	}
+
+	err := w.db.AddDroppedOperations(w.sessionID, delta)
+	if err != nil {
+		return fmt.Errorf("failed to store dropped count: %w", err)
+	}
+
+	w.persisted = w.persisted + delta
+	return nil
+}
+
+// persistFiltered adds filtered operations counted since the last call to
+// the session stats. Only the writer goroutine calls it.
+func (w *asyncWriter) persistFiltered() error {
+	delta := atomic.LoadInt64(&w.filtered) - w.persistedFiltered
+	if delta <= 0 {
+		return nil
+	}
+
+	err := w.db.AddFilteredOperations(w.sessionID, delta)
+	if err != nil {
+		return fmt.Errorf("failed to store filtered count: %w", err)
+	}
+
+	w.persistedFiltered = w.persistedFiltered + delta
+	return nil
+}
+
+// countFiltered counts an operation the sink's filter left out.
+func (w *asyncWriter) countFiltered() {
+	atomic.AddInt64(&w.filtered, 1)
+}
+
+// close stops the writer after flushing everything queued. It returns the
+// error of shutdown.
+func (w *asyncWriter) close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		<-w.stopped
+	})
+	return w.closeErr
+}
+
+func (w *asyncWriter) droppedCount() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+func (w *asyncWriter) failureCount() int64 {
+	return atomic.LoadInt64(&w.failures)
+}
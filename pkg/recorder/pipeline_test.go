@@ -0,0 +1,249 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestDatabase(t *testing.T) *storage.Database {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "recordings.db"), 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func testOperation(seq int64) *storage.Operation {
+	return &storage.Operation{
+		SessionID:      testSessionID,
+		SequenceNumber: seq,
+		Timestamp:      time.Now(),
+		OperationType:  storage.OperationGet,
+		ResourceKind:   "ConfigMap",
+		Name:           fmt.Sprintf("cfg-%d", seq),
+	}
+}
+
+func queuedSequences(w *asyncWriter) []int64 {
+	seqs := make([]int64, 0, len(w.queue))
+	for len(w.queue) > 0 {
+		seqs = append(seqs, (<-w.queue).SequenceNumber)
+	}
+	return seqs
+}
+
+func TestAsyncRecordingFlushesOnClose(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	db := newTestDatabase(t)
+
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(configMap),
+		Database:  db,
+		SessionID: testSessionID,
+		Async: &AsyncConfig{
+			QueueSize:     16,
+			BatchSize:     2,
+			FlushInterval: time.Hour,
+		},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+		require.NoError(t, err)
+	}
+	require.NoError(t, rec.Close())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 5)
+	for i := range ops {
+		assert.Equal(t, int64(i+1), ops[i].SequenceNumber)
+	}
+	assert.Equal(t, int64(0), rec.DroppedOperations())
+	assert.Equal(t, int64(0), rec.RecordFailures())
+
+	_, err = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+	require.NoError(t, err, "recording after close must not fail the call")
+	assert.Equal(t, int64(1), rec.RecordFailures())
+}
+
+func TestAsyncOverflowPolicies(t *testing.T) {
+	newest := &asyncWriter{queue: make(chan *storage.Operation, 2), policy: OverflowDropNewest}
+	oldest := &asyncWriter{queue: make(chan *storage.Operation, 2), policy: OverflowDropOldest}
+
+	for seq := int64(1); seq <= 3; seq++ {
+		newest.enqueue(testOperation(seq))
+		oldest.enqueue(testOperation(seq))
+	}
+
+	assert.Equal(t, int64(1), newest.droppedCount())
+	assert.Equal(t, []int64{1, 2}, queuedSequences(newest))
+	assert.Equal(t, int64(1), oldest.droppedCount())
+	assert.Equal(t, []int64{2, 3}, queuedSequences(oldest))
+}
+
+func TestAsyncDroppedCountStoredInSession(t *testing.T) {
+	db := newTestDatabase(t)
+
+	w := &asyncWriter{
+		db:            db,
+		sessionID:     testSessionID,
+		queue:         make(chan *storage.Operation, 2),
+		policy:        OverflowDropOldest,
+		batchSize:     10,
+		flushInterval: time.Hour,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	for seq := int64(1); seq <= 5; seq++ {
+		w.enqueue(testOperation(seq))
+	}
+	go w.run()
+	require.NoError(t, w.close())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, int64(4), ops[0].SequenceNumber)
+
+	stats, err := db.GetSessionStats(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.DroppedOperations)
+}
+
+func TestRecordingNeverChangesCallerError(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+
+	for _, async := range []*AsyncConfig{nil, {BatchSize: 1}} {
+		db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "broken.db"), 1000)
+		require.NoError(t, err)
+
+		rec, err := NewRecordingClient(Config{
+			Client:    fake.NewSimpleClientset(configMap),
+			Database:  db,
+			SessionID: testSessionID,
+			Async:     async,
+		})
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		_, err = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+		assert.NoError(t, err)
+
+		_, err = rec.RecordGet(ctx, "ConfigMap", "default", "missing", metav1.GetOptions{})
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "record")
+
+		_ = rec.Close()
+		assert.Equal(t, int64(2), rec.RecordFailures())
+	}
+}
+
+func TestAsyncConcurrentRecording(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	db := newTestDatabase(t)
+
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(configMap),
+		Database:  db,
+		SessionID: testSessionID,
+		Async:     &AsyncConfig{QueueSize: 8, BatchSize: 4, Overflow: OverflowBlock},
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				_, _ = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, rec.Close())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 100)
+	assert.Equal(t, int64(0), rec.DroppedOperations())
+	// Rows are inserted in sequence order, so row IDs follow sequence numbers.
+	for i := 1; i < len(ops); i++ {
+		assert.Greater(t, ops[i].ID, ops[i-1].ID, "sequence %d", ops[i].SequenceNumber)
+	}
+}
+
+// failingInserts is a store whose operation inserts always fail.
+type failingInserts struct {
+	storage.OperationStore
+}
+
+func (f failingInserts) InsertOperations(ops []*storage.Operation) error {
+	return fmt.Errorf("disk full")
+}
+
+func TestAsyncCloseFailsSessionWhenFlushFails(t *testing.T) {
+	memory := storage.NewMemoryStore()
+
+	sink, err := newRecordSink(sinkConfig{
+		db:        failingInserts{OperationStore: memory},
+		sessionID: testSessionID,
+		async:     &AsyncConfig{BatchSize: 10, FlushInterval: time.Hour},
+		session:   &storage.Session{ID: testSessionID},
+	})
+	require.NoError(t, err)
+
+	for seq := int64(1); seq <= 3; seq++ {
+		require.NoError(t, sink.record(testOperation(seq)))
+	}
+	require.ErrorContains(t, sink.close(), "failed to write 3 queued operations")
+
+	session, err := memory.GetSession(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionFailed, session.Status)
+}
+
+func TestAsyncConfigValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(),
+		Database:  db,
+		SessionID: testSessionID,
+		Async:     &AsyncConfig{Overflow: "spill"},
+	})
+	require.Error(t, err)
+
+	_, err = NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(),
+		Database:  db,
+		SessionID: testSessionID,
+		Async:     &AsyncConfig{BatchSize: maxBatchSize + 1},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package recorder
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	// maxPriorObjects and maxPriorBytes bound the last-seen object cache.
+	maxPriorObjects = 1000
+	maxPriorBytes   = 32 * 1024 * 1024
+)
+
+// priorStates remembers the last payload recorded for each object so writes
+// can carry the state they replaced. Payloads are stored after redaction.
+// Eviction is first in, first out. It is safe for concurrent use.
+type priorStates struct {
+	mu      sync.Mutex
+	objects map[string]string
+	order   []string
+	bytes   int
+}
+
+func newPriorStates() *priorStates {
+	return &priorStates{objects: make(map[string]string)}
+}
+
+// observe sets PriorData on writes and updates the cache from op.
+func (p *priorStates) observe(op *storage.Operation) {
+	if p == nil || op == nil || len(op.Name) == 0 {
+		return
+	}
+
+	key := priorKey(op)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch op.OperationType {
+	case storage.OperationUpdate, storage.OperationPatch, storage.OperationDelete:
+		if len(op.PriorData) == 0 {
+			op.PriorData = p.objects[key]
+		}
+	}
+
+	if len(op.Error) > 0 {
+		return
+	}
+
+	switch op.OperationType {
+	case storage.OperationDelete:
+		p.remove(key)
+	case storage.OperationWatch:
+		if op.EventType == "DELETED" {
+			p.remove(key)
+			return
+		}
+		p.put(key, op.ResourceData)
+	case storage.OperationGet, storage.OperationCacheGet, storage.OperationCreate,
+		storage.OperationUpdate, storage.OperationPatch:
+		p.put(key, op.ResourceData)
+	}
+}
+
+// put stores data under key, evicting the oldest entries past the bounds.
+// Rule 2: Bounded by maxPriorObjects.
+func (p *priorStates) put(key string, data string) {
+	if len(data) == 0 || len(data) > maxPriorBytes {
+		return
+	}
+
+	p.remove(key)
+	p.objects[key] = data
+	p.order = append(p.order, key)
+	p.bytes = p.bytes + len(data)
+
+	for i := 0; i < maxPriorObjects+1; i++ {
+		if len(p.order) <= maxPriorObjects && p.bytes <= maxPriorBytes {
+			return
+		}
+		p.remove(p.order[0])
+	}
+}
+
+// remove drops key from the cache.
+func (p *priorStates) remove(key string) {
+	data, ok := p.objects[key]
+	if !ok {
+		return
+	}
+
+	delete(p.objects, key)
+	p.bytes = p.bytes - len(data)
+	for i := 0; i < len(p.order); i++ {
+		if p.order[i] == key {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// priorKey identifies the object an operation touched. Status writes share
+// the key of their parent object, since they return it; other subresources
+// such as scale return a different object and get their own key.
+func priorKey(op *storage.Operation) string {
+	kind := strings.TrimSuffix(op.ResourceKind, "List")
+	key := op.APIGroup + "/" + kind + "/" + op.Namespace + "/" + op.Name
+	if len(op.Subresource) > 0 && op.Subresource != SubresourceStatus {
+		key = key + "/" + op.Subresource
+	}
+	return key
+}
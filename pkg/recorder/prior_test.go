@@ -0,0 +1,106 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRecordWriteKeepsRequestAndPriorState(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+		Data:       map[string]string{"mode": "before"},
+	}
+	client := fake.NewSimpleClientset(configMap)
+	rec, db := newTestRecorder(t, client)
+
+	_, err := rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	first := configMap.DeepCopy()
+	first.Data["mode"] = "first"
+	_, err = rec.RecordUpdate(ctx, "ConfigMap", "default", first, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(
+			schema.GroupResource{Resource: "configmaps"}, "cfg", nil)
+	})
+	second := configMap.DeepCopy()
+	second.Data["mode"] = "second"
+	_, err = rec.RecordUpdate(ctx, "ConfigMap", "default", second, metav1.UpdateOptions{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	assert.Empty(t, ops[0].RequestData)
+	assert.Empty(t, ops[0].PriorData)
+
+	assert.Contains(t, ops[1].RequestData, `"mode":"first"`)
+	assert.Contains(t, ops[1].ResourceData, `"mode":"first"`)
+	assert.Contains(t, ops[1].PriorData, `"mode":"before"`)
+
+	conflict := ops[2]
+	assert.NotEmpty(t, conflict.Error)
+	assert.Contains(t, conflict.RequestData, `"mode":"second"`)
+	assert.Empty(t, conflict.ResourceData, "a rejected write has no stored state")
+	assert.Contains(t, conflict.PriorData, `"mode":"first"`,
+		"the prior state is the last one the server returned")
+}
+
+func TestRecordWriteRedactsRequestData(t *testing.T) {
+	ctx := context.Background()
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset())
+
+	_, err := rec.RecordCreate(ctx, "Secret", "default", testSecret(), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Contains(t, ops[0].RequestData, "db-creds")
+	assert.NotContains(t, ops[0].RequestData, "c2VjcmV0")
+	assert.NotContains(t, ops[0].RequestData, "admin")
+}
+
+func TestPriorStatesEviction(t *testing.T) {
+	p := newPriorStates()
+	op := func(opType storage.OperationType, name string, data string) *storage.Operation {
+		return &storage.Operation{
+			OperationType: opType,
+			ResourceKind:  "ConfigMap",
+			Namespace:     "default",
+			Name:          name,
+			ResourceData:  data,
+		}
+	}
+
+	for i := 0; i < maxPriorObjects+10; i++ {
+		p.observe(op(storage.OperationGet, fmt.Sprintf("cm-%d", i), "{}"))
+	}
+	assert.Len(t, p.objects, maxPriorObjects)
+	assert.Len(t, p.order, maxPriorObjects)
+
+	p.observe(op(storage.OperationGet, "cfg", `{"v":1}`))
+	deleted := op(storage.OperationDelete, "cfg", "")
+	p.observe(deleted)
+	assert.Equal(t, `{"v":1}`, deleted.PriorData)
+
+	update := op(storage.OperationUpdate, "cfg", `{"v":2}`)
+	p.observe(update)
+	assert.Empty(t, update.PriorData, "a delete forgets the object")
+}
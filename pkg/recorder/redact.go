@@ -0,0 +1,509 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+// RedactionAction says what happens to a field matched by a RedactionRule.
+type RedactionAction string
+
+const (
+	// RedactDrop removes the field. Matched array elements become null.
+	RedactDrop RedactionAction = "drop"
+	// RedactMask replaces the value with a fixed marker.
+	RedactMask RedactionAction = "mask"
+	// RedactHash replaces the value with a salted SHA-256 digest, so equal
+	// values can still be compared across operations.
+	RedactHash RedactionAction = "hash"
+)
+
+const (
+	redactedValue        = "[REDACTED]"
+	anyKind              = "*"
+	maxRedactionRules    = 256
+	maxRedactionSegments = 32
+	maxRedactionMatches  = 10000
+	lastAppliedConfig    = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// RedactionRule selects fields of one kind of resource to redact.
+type RedactionRule struct {
+	// Group and Version select the API group and version. An empty Version
+	// matches every version. Operations recorded without group or version
+	// (typed client calls) match on Kind alone.
+	Group   string
+	Version string
+	// Kind is the resource kind, or "*" for every kind. A "*" rule without
+	// Group matches every group.
+	Kind string
+	// Resource optionally matches the plural resource name, for operations
+	// whose kind is unknown, such as failed patches.
+	Resource string
+	// Path is a JSONPath into the object: $.spec.token,
+	// $.metadata.annotations['example.com/key'] or
+	// $.spec.containers[*].env[*].value.
+	Path   string
+	Action RedactionAction
+}
+
+// RedactionPolicy controls which recorded payload fields are redacted before
+// they are stored. A nil policy applies only the default Secret rules.
+type RedactionPolicy struct {
+	Rules []RedactionRule
+	// KeepSecretData disables the default rules that drop Secret data,
+	// stringData and the kubectl last-applied annotation.
+	KeepSecretData bool
+	// HashSalt is prepended to values before RedactHash digests them.
+	HashSalt string
+}
+
+// DefaultRedactionRules returns the rules applied unless KeepSecretData is set.
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{Kind: "Secret", Resource: "secrets", Path: "$.data", Action: RedactDrop},
+		{Kind: "Secret", Resource: "secrets", Path: "$.stringData", Action: RedactDrop},
+		{
+			Kind:     "Secret",
+			Resource: "secrets",
+			Path:     "$.metadata.annotations['" + lastAppliedConfig + "']",
+			Action:   RedactDrop,
+		},
+	}
+}
+
+// String describes the rule as stored in session metadata.
+func (r RedactionRule) String() string {
+	target := r.Kind
+	if len(r.Group) > 0 {
+		target = target + "." + r.Group
+	}
+	if len(r.Version) > 0 {
+		target = target + "/" + r.Version
+	}
+	return fmt.Sprintf("%s %s %s", r.Action, target, r.Path)
+}
+
+// pathSegment is one step of a compiled JSONPath.
+type pathSegment struct {
+	key      string
+	wildcard bool
+}
+
+type compiledRule struct {
+	rule     RedactionRule
+	segments []pathSegment
+}
+
+// redactor applies a compiled RedactionPolicy to operations.
+type redactor struct {
+	rules []compiledRule
+	salt  string
+}
+
+// newRedactor compiles policy together with the default rules.
+// Rule 5: Multiple assertions for validation.
+func newRedactor(policy *RedactionPolicy) (*redactor, error) {
+	rules := make([]RedactionRule, 0, 8)
+	salt := ""
+	if policy == nil || !policy.KeepSecretData {
+		rules = append(rules, DefaultRedactionRules()...)
+	}
+	if policy != nil {
+		rules = append(rules, policy.Rules...)
+		salt = policy.HashSalt
+	}
+
+	err := assert.AssertInRange(len(rules), 0, maxRedactionRules, "redaction rules")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &redactor{rules: make([]compiledRule, 0, len(rules)), salt: salt}
+	for i := 0; i < len(rules); i++ {
+		compiled, err := compileRule(rules[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %d: %w", i, err)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+
+	return r, nil
+}
+
+func compileRule(rule RedactionRule) (compiledRule, error) {
+	err := assert.AssertStringNotEmpty(rule.Kind, "kind")
+	if err != nil {
+		return compiledRule{}, err
+	}
+
+	switch rule.Action {
+	case RedactDrop, RedactMask, RedactHash:
+	default:
+		return compiledRule{}, fmt.Errorf("unknown redaction action: %q", rule.Action)
+	}
+
+	segments, err := parseRedactionPath(rule.Path)
+	if err != nil {
+		return compiledRule{}, err
+	}
+
+	return compiledRule{rule: rule, segments: segments}, nil
+}
+
+// parseRedactionPath parses the JSONPath subset used by redaction rules:
+// dotted names, bracketed quoted names, [N] indexes and * wildcards.
+// Rule 2: Bounded by maxRedactionSegments.
+func parseRedactionPath(path string) ([]pathSegment, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if len(p) == 0 {
+		return nil, fmt.Errorf("redaction path is empty")
+	}
+	if p[0] != '.' && p[0] != '[' {
+		p = "." + p
+	}
+
+	segments := make([]pathSegment, 0, 4)
+	i := 0
+	for i < len(p) && len(segments) < maxRedactionSegments {
+		switch p[i] {
+		case '.':
+			end := i + 1
+			for end < len(p) && p[end] != '.' && p[end] != '[' {
+				end = end + 1
+			}
+			name := p[i+1 : end]
+			if len(name) == 0 {
+				return nil, fmt.Errorf("empty name in path %q", path)
+			}
+			segments = append(segments, pathSegment{key: name, wildcard: name == "*"})
+			i = end
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in path %q", path)
+			}
+			inner := p[i+1 : i+end]
+			wildcard := inner == "*"
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				inner = inner[1 : len(inner)-1]
+				wildcard = false
+			}
+			if len(inner) == 0 {
+				return nil, fmt.Errorf("empty bracket in path %q", path)
+			}
+			segments = append(segments, pathSegment{key: inner, wildcard: wildcard})
+			i = i + end + 1
+		default:
+			return nil, fmt.Errorf("unexpected %q in path %q", p[i], path)
+		}
+	}
+
+	if i < len(p) {
+		return nil, fmt.Errorf("path %q has more than %d segments", path, maxRedactionSegments)
+	}
+
+	return segments, nil
+}
+
+// descriptions lists the rules in the form stored with the session.
+func (r *redactor) descriptions() []string {
+	out := make([]string, 0, len(r.rules))
+	for i := 0; i < len(r.rules); i++ {
+		out = append(out, r.rules[i].rule.String())
+	}
+	return out
+}
+
+// redact rewrites the payload, request body and patch document of op in
+// place. Payloads that cannot be decoded are dropped when any rule matches
+// op. PriorData is left alone: it comes from payloads already redacted.
+func (r *redactor) redact(op *storage.Operation) {
+	if r == nil || op == nil {
+		return
+	}
+	if len(op.ResourceData) == 0 && len(op.RequestData) == 0 && len(op.PatchData) == 0 {
+		return
+	}
+
+	rules := r.matching(op)
+	if len(rules) == 0 {
+		return
+	}
+
+	op.ResourceData = r.redactDocument(op.ResourceData, rules)
+	op.RequestData = r.redactDocument(op.RequestData, rules)
+	op.PatchData = r.redactPatch(op.PatchData, rules)
+}
+
+// matching returns the rules that apply to op's resource.
+func (r *redactor) matching(op *storage.Operation) []compiledRule {
+	kind := strings.TrimSuffix(op.ResourceKind, "List")
+	resource := op.Resource
+	if idx := strings.Index(resource, "/"); idx >= 0 {
+		resource = resource[:idx]
+	}
+	unknownGroup := len(op.APIGroup) == 0 && len(op.APIVersion) == 0
+
+	var out []compiledRule
+	for i := 0; i < len(r.rules); i++ {
+		rule := r.rules[i].rule
+		kindMatch := rule.Kind == anyKind || rule.Kind == kind
+		resourceMatch := len(rule.Resource) > 0 && rule.Resource == resource
+		if !kindMatch && !resourceMatch {
+			continue
+		}
+		anyGroup := rule.Kind == anyKind && len(rule.Group) == 0
+		if !unknownGroup {
+			if !anyGroup && rule.Group != op.APIGroup {
+				continue
+			}
+			if len(rule.Version) > 0 && rule.Version != op.APIVersion {
+				continue
+			}
+		}
+		out = append(out, r.rules[i])
+	}
+	return out
+}
+
+// redactDocument applies rules to a JSON object and to the items of a list.
+func (r *redactor) redactDocument(data string, rules []compiledRule) string {
+	if len(data) == 0 {
+		return data
+	}
+
+	var doc interface{}
+	err := json.Unmarshal([]byte(data), &doc)
+	if err != nil {
+		return ""
+	}
+
+	targets := []interface{}{doc}
+	if obj, ok := doc.(map[string]interface{}); ok {
+		if items, ok := obj["items"].([]interface{}); ok {
+			targets = append(targets, items...)
+		}
+	}
+
+	changed := false
+	for i := 0; i < len(targets); i++ {
+		for j := 0; j < len(rules); j++ {
+			if r.apply(targets[i], rules[j].segments, rules[j].rule.Action) {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return data
+	}
+
+	return r.encode(doc)
+}
+
+// redactPatch applies rules to a merge or apply patch document, and to the
+// values of JSON Patch operations whose path falls under a rule.
+func (r *redactor) redactPatch(data string, rules []compiledRule) string {
+	if len(data) == 0 {
+		return data
+	}
+
+	var doc interface{}
+	err := json.Unmarshal([]byte(data), &doc)
+	if err != nil {
+		return ""
+	}
+
+	ops, ok := doc.([]interface{})
+	if !ok {
+		return r.redactDocument(data, rules)
+	}
+
+	changed := false
+	for i := 0; i < len(ops); i++ {
+		patchOp, ok := ops[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pointer, _ := patchOp["path"].(string)
+		if _, hasValue := patchOp["value"]; !hasValue {
+			continue
+		}
+		tokens := pointerTokens(pointer)
+		for j := 0; j < len(rules); j++ {
+			if r.redactPatchValue(patchOp, tokens, rules[j]) {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return data
+	}
+
+	return r.encode(doc)
+}
+
+// redactPatchValue redacts the value of one JSON Patch operation. A pointer
+// at or below the rule path redacts the whole value; a pointer above it
+// applies the rest of the rule path inside the value.
+func (r *redactor) redactPatchValue(
+	patchOp map[string]interface{},
+	tokens []string,
+	rule compiledRule,
+) bool {
+	segments := rule.segments
+	shared := len(tokens)
+	if len(segments) < shared {
+		shared = len(segments)
+	}
+	for i := 0; i < shared; i++ {
+		if !segments[i].wildcard && segments[i].key != tokens[i] {
+			return false
+		}
+	}
+
+	if len(tokens) >= len(segments) {
+		return r.apply(patchOp, []pathSegment{{key: "value"}}, rule.rule.Action)
+	}
+
+	return r.apply(patchOp["value"], segments[len(tokens):], rule.rule.Action)
+}
+
+// apply redacts every match of segments in doc.
+// Rule 1: No recursion; the path is walked level by level.
+// Rule 2: Bounded by maxRedactionMatches.
+func (r *redactor) apply(doc interface{}, segments []pathSegment, action RedactionAction) bool {
+	if len(segments) == 0 {
+		return false
+	}
+
+	nodes := []interface{}{doc}
+	for depth := 0; depth < len(segments)-1 && len(nodes) > 0; depth++ {
+		next := make([]interface{}, 0, len(nodes))
+		for i := 0; i < len(nodes) && len(next) < maxRedactionMatches; i++ {
+			next = appendChildren(next, nodes[i], segments[depth])
+		}
+		nodes = next
+	}
+
+	last := segments[len(segments)-1]
+	changed := false
+	for i := 0; i < len(nodes); i++ {
+		if r.redactChildren(nodes[i], last, action) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// appendChildren appends the children of node selected by seg.
+func appendChildren(out []interface{}, node interface{}, seg pathSegment) []interface{} {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if !seg.wildcard {
+			if child, ok := typed[seg.key]; ok {
+				out = append(out, child)
+			}
+			return out
+		}
+		for _, child := range typed {
+			if len(out) >= maxRedactionMatches {
+				break
+			}
+			out = append(out, child)
+		}
+	case []interface{}:
+		if !seg.wildcard {
+			idx, err := strconv.Atoi(seg.key)
+			if err == nil && idx >= 0 && idx < len(typed) {
+				out = append(out, typed[idx])
+			}
+			return out
+		}
+		for i := 0; i < len(typed) && len(out) < maxRedactionMatches; i++ {
+			out = append(out, typed[i])
+		}
+	}
+	return out
+}
+
+// redactChildren applies action to the children of node selected by seg.
+func (r *redactor) redactChildren(node interface{}, seg pathSegment, action RedactionAction) bool {
+	changed := false
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, 1)
+		if seg.wildcard {
+			for key := range typed {
+				keys = append(keys, key)
+			}
+		} else if _, ok := typed[seg.key]; ok {
+			keys = append(keys, seg.key)
+		}
+		for i := 0; i < len(keys); i++ {
+			if action == RedactDrop {
+				delete(typed, keys[i])
+			} else {
+				typed[keys[i]] = r.replacement(typed[keys[i]], action)
+			}
+			changed = true
+		}
+	case []interface{}:
+		for i := 0; i < len(typed); i++ {
+			if !seg.wildcard && seg.key != strconv.Itoa(i) {
+				continue
+			}
+			if action == RedactDrop {
+				typed[i] = nil
+			} else {
+				typed[i] = r.replacement(typed[i], action)
+			}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// replacement returns the masked or hashed form of value.
+func (r *redactor) replacement(value interface{}, action RedactionAction) interface{} {
+	if action != RedactHash {
+		return redactedValue
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return redactedValue
+	}
+	sum := sha256.Sum256(append([]byte(r.salt), raw...))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (r *redactor) encode(doc interface{}) string {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// pointerTokens splits a JSON Pointer into unescaped reference tokens.
+func pointerTokens(pointer string) []string {
+	pointer = strings.TrimPrefix(pointer, "/")
+	if len(pointer) == 0 {
+		return nil
+	}
+
+	tokens := strings.Split(pointer, "/")
+	for i := 0; i < len(tokens); i++ {
+		tokens[i] = strings.ReplaceAll(tokens[i], "~1", "/")
+		tokens[i] = strings.ReplaceAll(tokens[i], "~0", "~")
+	}
+	return tokens
+}
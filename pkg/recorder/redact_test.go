@@ -0,0 +1,220 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db-creds",
+			Namespace: "default",
+			Annotations: map[string]string{
+				lastAppliedConfig: `{"data":{"password":"c2VjcmV0"}}`,
+				"team":            "storage",
+			},
+		},
+		Data:       map[string][]byte{"password": []byte("secret")},
+		StringData: map[string]string{"user": "admin"},
+	}
+}
+
+func decodePayload(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &doc))
+	return doc
+}
+
+func TestRedactionDropsSecretDataByDefault(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+		Data:       map[string]string{"mode": "on"},
+	}
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset(testSecret(), configMap))
+
+	secret, err := rec.RecordGet(ctx, "Secret", "default", "db-creds", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), secret.(*corev1.Secret).Data["password"],
+		"the caller must see the unredacted object")
+
+	_, err = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = rec.RecordList(ctx, "Secret", "default", metav1.ListOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	doc := decodePayload(t, ops[0].ResourceData)
+	assert.NotContains(t, doc, "data")
+	assert.NotContains(t, doc, "stringData")
+	annotations := doc["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	assert.NotContains(t, annotations, lastAppliedConfig)
+	assert.Equal(t, "storage", annotations["team"])
+	assert.NotContains(t, ops[0].ResourceData, "c2VjcmV0")
+
+	assert.Contains(t, ops[1].ResourceData, `"mode":"on"`)
+	assert.NotContains(t, ops[2].ResourceData, "c2VjcmV0")
+	assert.Contains(t, ops[2].ResourceData, "db-creds")
+
+	stats, err := db.GetSessionStats(testSessionID)
+	require.NoError(t, err)
+	assert.Contains(t, stats.Redaction, "drop Secret $.data")
+	assert.Contains(t, stats.Redaction, "drop Secret $.stringData")
+}
+
+func TestRedactionKeepSecretData(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(testSecret()),
+		Database:  db,
+		SessionID: testSessionID,
+		Redaction: &RedactionPolicy{KeepSecretData: true},
+	})
+	require.NoError(t, err)
+
+	_, err = rec.RecordGet(ctx, "Secret", "default", "db-creds", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Contains(t, ops[0].ResourceData, "c2VjcmV0")
+
+	stats, err := db.GetSessionStats(testSessionID)
+	require.NoError(t, err)
+	assert.Empty(t, stats.Redaction)
+}
+
+func TestRedactionRulesPerKind(t *testing.T) {
+	r, err := newRedactor(&RedactionPolicy{
+		HashSalt: "salt",
+		Rules: []RedactionRule{
+			{Group: "example.com", Kind: "Widget", Path: "$.spec.token", Action: RedactHash},
+			{Group: "example.com", Version: "v2", Kind: "Widget", Path: "spec.size", Action: RedactDrop},
+			{Group: "apps", Kind: "Deployment", Path: "$.spec.template.spec.containers[*].env[*].value", Action: RedactMask},
+			{Kind: "*", Path: "$.metadata.annotations['example.com/api-key']", Action: RedactDrop},
+		},
+	})
+	require.NoError(t, err)
+
+	widget := func() *storage.Operation {
+		return &storage.Operation{
+			ResourceKind: "Widget",
+			APIGroup:     "example.com",
+			APIVersion:   "v1",
+			ResourceData: `{"metadata":{"annotations":{"example.com/api-key":"k","keep":"v"}},` +
+				`"spec":{"token":"t0ken","size":3}}`,
+		}
+	}
+
+	first := widget()
+	second := widget()
+	r.redact(first)
+	r.redact(second)
+	assert.Equal(t, first.ResourceData, second.ResourceData, "hashing must be stable")
+
+	doc := decodePayload(t, first.ResourceData)
+	spec := doc["spec"].(map[string]interface{})
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, spec["token"])
+	assert.Equal(t, float64(3), spec["size"], "the v2 rule must not apply to v1")
+	annotations := doc["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"keep": "v"}, annotations)
+
+	other := widget()
+	other.APIGroup = "other.io"
+	r.redact(other)
+	assert.Contains(t, other.ResourceData, "t0ken")
+
+	deployment := &storage.Operation{
+		ResourceKind: "Deployment",
+		ResourceData: `{"spec":{"template":{"spec":{"containers":[` +
+			`{"name":"a","env":[{"name":"TOKEN","value":"x"},{"name":"MODE","value":"y"}]},` +
+			`{"name":"b","env":[{"name":"PASS","value":"z"}]}]}}}}`,
+	}
+	r.redact(deployment)
+	assert.NotContains(t, deployment.ResourceData, `"x"`)
+	assert.NotContains(t, deployment.ResourceData, `"z"`)
+	assert.Contains(t, deployment.ResourceData, `"name":"TOKEN"`)
+	assert.Contains(t, deployment.ResourceData, redactedValue)
+
+	list := &storage.Operation{
+		ResourceKind: "WidgetList",
+		APIGroup:     "example.com",
+		APIVersion:   "v1",
+		ResourceData: `{"items":[{"spec":{"token":"a"}},{"spec":{"token":"b"}}]}`,
+	}
+	r.redact(list)
+	assert.NotContains(t, list.ResourceData, `"a"`)
+	assert.NotContains(t, list.ResourceData, `"b"`)
+}
+
+func TestRedactionPatchDocuments(t *testing.T) {
+	r, err := newRedactor(nil)
+	require.NoError(t, err)
+
+	merge := &storage.Operation{
+		ResourceKind: "Secret",
+		PatchData:    `{"stringData":{"password":"new"},"metadata":{"labels":{"a":"b"}}}`,
+	}
+	r.redact(merge)
+	assert.JSONEq(t, `{"metadata":{"labels":{"a":"b"}}}`, merge.PatchData)
+
+	jsonPatch := &storage.Operation{
+		ResourceKind: "secrets",
+		Resource:     "secrets",
+		PatchData: `[{"op":"replace","path":"/data/password","value":"bmV3"},` +
+			`{"op":"add","path":"/data","value":{"token":"dG9r"}},` +
+			`{"op":"add","path":"/metadata/labels/a","value":"b"}]`,
+	}
+	r.redact(jsonPatch)
+	assert.NotContains(t, jsonPatch.PatchData, "bmV3")
+	assert.NotContains(t, jsonPatch.PatchData, "dG9r")
+	assert.Contains(t, jsonPatch.PatchData, `"value":"b"`)
+
+	opaque := &storage.Operation{ResourceKind: "Secret", ResourceData: "\x0a\x02k8s"}
+	r.redact(opaque)
+	assert.Empty(t, opaque.ResourceData, "undecodable Secret payloads must not be stored")
+}
+
+func TestRedactionPolicyValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	invalid := []RedactionRule{
+		{Kind: "Widget", Path: "$.spec.token", Action: "encrypt"},
+		{Kind: "", Path: "$.spec.token", Action: RedactDrop},
+		{Kind: "Widget", Path: "$", Action: RedactDrop},
+		{Kind: "Widget", Path: "$.spec['token'", Action: RedactDrop},
+		{Kind: "Widget", Path: "$.spec..token", Action: RedactDrop},
+	}
+	for _, rule := range invalid {
+		_, err := NewRecordingClient(Config{
+			Client:    fake.NewSimpleClientset(),
+			Database:  db,
+			SessionID: testSessionID,
+			Redaction: &RedactionPolicy{Rules: []RedactionRule{rule}},
+		})
+		assert.Error(t, err, rule.Path)
+	}
+
+	segments, err := parseRedactionPath(`$.metadata.annotations["a.b/c"].x[0]`)
+	require.NoError(t, err)
+	assert.Equal(t, []pathSegment{
+		{key: "metadata"}, {key: "annotations"}, {key: "a.b/c"}, {key: "x"}, {key: "0"},
+	}, segments)
+}
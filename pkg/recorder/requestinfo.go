@@ -0,0 +1,196 @@
+package recorder
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	maxPathSegments = 16
+)
+
+// RequestInfo describes a Kubernetes API request parsed from its URL.
+type RequestInfo struct {
+	IsResourceRequest bool
+	Verb              string
+	APIGroup          string
+	APIVersion        string
+	Resource          string
+	Subresource       string
+	Namespace         string
+	Name              string
+}
+
+// ParseRequestInfo parses a Kubernetes API path into GVR, namespace, name,
+// subresource and the Kubernetes verb.
+// Paths outside /api and /apis, and discovery paths, are not resource requests.
+// Rule 2: Bounded by maxPathSegments.
+func ParseRequestInfo(method string, u *url.URL) RequestInfo {
+	info := RequestInfo{}
+	if u == nil {
+		return info
+	}
+
+	parts := splitPath(u.Path)
+	if len(parts) == 0 || len(parts) > maxPathSegments {
+		return info
+	}
+
+	switch parts[0] {
+	case "api":
+		if len(parts) < 3 {
+			return info
+		}
+		info.APIVersion = parts[1]
+		parts = parts[2:]
+	case "apis":
+		if len(parts) < 4 {
+			return info
+		}
+		info.APIGroup = parts[1]
+		info.APIVersion = parts[2]
+		parts = parts[3:]
+	default:
+		return info
+	}
+
+	watchPath := false
+	if parts[0] == "watch" {
+		watchPath = true
+		parts = parts[1:]
+		if len(parts) == 0 {
+			return info
+		}
+	}
+
+	if parts[0] == "namespaces" && len(parts) > 2 && !isNamespaceSubresource(parts) {
+		info.Namespace = parts[1]
+		parts = parts[2:]
+	}
+
+	info.Resource = parts[0]
+	if len(parts) > 1 {
+		info.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		info.Subresource = parts[2]
+	}
+
+	info.IsResourceRequest = true
+	info.Verb = requestVerb(method, info.Name, watchPath || isWatchQuery(u))
+	return info
+}
+
+// ConfigBasePath returns the path of the API server URL in config, such as
+// the /k8s/clusters/<id> prefix of a cluster reached through Rancher.
+// client-go puts it in front of every API path.
+func ConfigBasePath(config *rest.Config) (string, error) {
+	host, _, err := rest.DefaultServerUrlFor(config)
+	if err != nil {
+		return "", fmt.Errorf("invalid API server address: %w", err)
+	}
+	return host.Path, nil
+}
+
+// trimBasePath returns u with basePath removed from the front of its path.
+// Paths outside basePath are returned unchanged.
+func trimBasePath(u *url.URL, basePath string) *url.URL {
+	basePath = strings.TrimSuffix(basePath, "/")
+	if u == nil || len(basePath) == 0 || !strings.HasPrefix(u.Path, basePath+"/") {
+		return u
+	}
+
+	trimmed := *u
+	trimmed.Path = strings.TrimPrefix(u.Path, basePath)
+	trimmed.RawPath = ""
+	return &trimmed
+}
+
+// OperationTypeForVerb maps a Kubernetes verb to the recorded operation type.
+func OperationTypeForVerb(verb string) storage.OperationType {
+	switch verb {
+	case "get":
+		return storage.OperationGet
+	case "list":
+		return storage.OperationList
+	case "watch":
+		return storage.OperationWatch
+	case "create":
+		return storage.OperationCreate
+	case "update":
+		return storage.OperationUpdate
+	case "patch":
+		return storage.OperationPatch
+	case "delete", "deletecollection":
+		return storage.OperationDelete
+	default:
+		return storage.OperationType(strings.ToUpper(verb))
+	}
+}
+
+// setResource records the resource and subresource an operation addressed.
+func setResource(op *storage.Operation, resource string, subresource string) {
+	op.Resource = qualifiedResource(resource, subresource)
+	op.Subresource = subresource
+}
+
+// qualifiedResource returns resource/subresource, the form RBAC rules use.
+func qualifiedResource(resource string, subresource string) string {
+	if len(resource) == 0 || len(subresource) == 0 {
+		return resource
+	}
+	return resource + "/" + subresource
+}
+
+func requestVerb(method string, name string, watch bool) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		if watch {
+			return "watch"
+		}
+		if len(name) == 0 {
+			return "list"
+		}
+		return "get"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		if len(name) == 0 {
+			return "deletecollection"
+		}
+		return "delete"
+	default:
+		return strings.ToLower(method)
+	}
+}
+
+func isWatchQuery(u *url.URL) bool {
+	value := u.Query().Get("watch")
+	return value == "true" || value == "1"
+}
+
+// isNamespaceSubresource reports paths like /namespaces/foo/status that
+// address the Namespace object itself rather than a namespaced resource.
+func isNamespaceSubresource(parts []string) bool {
+	if len(parts) != 3 {
+		return false
+	}
+	return parts[2] == "status" || parts[2] == "finalize"
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if len(trimmed) == 0 {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
@@ -0,0 +1,86 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"k8s.io/client-go/discovery"
+)
+
+// recorderSettings is the recorder configuration stored with a session.
+// Redaction holds rule descriptions; the hash salt is never stored.
+type recorderSettings struct {
+	ActorID     string       `json:"actor_id"`
+	ReplicaID   string       `json:"replica_id,omitempty"`
+	MaxSequence int64        `json:"max_sequence"`
+	Async       *AsyncConfig `json:"async,omitempty"`
+	Filter      *FilterSpec  `json:"filter,omitempty"`
+	Redaction   []string     `json:"redaction,omitempty"`
+}
+
+// beginSession stores the session metadata of cfg, filling in the recorder
+// settings and the git revision of the running binary when unset.
+func beginSession(cfg sinkConfig, rules []string) error {
+	meta := *cfg.session
+	meta.ID = cfg.sessionID
+
+	if len(meta.RecorderConfig) == 0 {
+		encoded, err := json.Marshal(recorderSettings{
+			ActorID:     cfg.actorID,
+			ReplicaID:   cfg.replicaID,
+			MaxSequence: cfg.maxSequence,
+			Async:       cfg.async,
+			Filter:      cfg.filter,
+			Redaction:   rules,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode recorder config: %w", err)
+		}
+		meta.RecorderConfig = string(encoded)
+	}
+
+	if len(meta.GitSHA) == 0 {
+		meta.GitSHA = buildRevision()
+	}
+
+	err := cfg.db.BeginSession(&meta)
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+	return nil
+}
+
+// buildRevision returns the VCS revision stamped into the running binary,
+// or "" when it was built without one.
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for i := 0; i < len(info.Settings); i++ {
+		if info.Settings[i].Key == "vcs.revision" {
+			return info.Settings[i].Value
+		}
+	}
+	return ""
+}
+
+// withServerVersion returns meta with KubernetesVersion read from the API
+// server when unset. A failed lookup leaves it empty.
+func withServerVersion(meta *storage.Session, client discovery.ServerVersionInterface) *storage.Session {
+	if meta == nil || len(meta.KubernetesVersion) > 0 || client == nil {
+		return meta
+	}
+
+	info, err := client.ServerVersion()
+	if err != nil || info == nil {
+		return meta
+	}
+
+	out := *meta
+	out.KubernetesVersion = info.GitVersion
+	return &out
+}
@@ -0,0 +1,95 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecorderBeginsAndEndsSession(t *testing.T) {
+	db := newTestDatabase(t)
+	client := fake.NewSimpleClientset()
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.2"}
+
+	rec, err := NewRecordingClient(Config{
+		Client:    client,
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "widget-controller",
+		Filter:    &FilterSpec{Exclude: []FilterRule{{Kind: "Lease"}}},
+		Session: &storage.Session{
+			OperatorName: "widget-operator",
+			ClusterName:  "kind",
+			Labels:       map[string]string{"env": "test"},
+		},
+	})
+	require.NoError(t, err)
+
+	meta, err := db.GetSession(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionRunning, meta.Status)
+	assert.Equal(t, "widget-operator", meta.OperatorName)
+	assert.Equal(t, "v1.30.2", meta.KubernetesVersion)
+
+	var settings recorderSettings
+	require.NoError(t, json.Unmarshal([]byte(meta.RecorderConfig), &settings))
+	assert.Equal(t, "widget-controller", settings.ActorID)
+	require.NotNil(t, settings.Filter)
+	assert.Equal(t, "Lease", settings.Filter.Exclude[0].Kind)
+	assert.Contains(t, settings.Redaction, "drop Secret $.data")
+
+	_, err = rec.RecordCreate(context.Background(), "ConfigMap", "default", &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "a"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, rec.Close())
+
+	meta, err = db.GetSession(testSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionCompleted, meta.Status)
+	assert.False(t, meta.EndTime.IsZero())
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, int64(1), sessions[0].OpCount)
+	require.NotNil(t, sessions[0].Meta)
+	assert.Equal(t, map[string]string{"env": "test"}, sessions[0].Meta.Labels)
+}
+
+func TestFlightRecorderDumpCarriesSession(t *testing.T) {
+	flight, db := newTestFlightRecorder(t, FlightRecorderConfig{})
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(),
+		Database:  flight,
+		SessionID: flightSessionID,
+		Session:   &storage.Session{OperatorName: "widget-operator"},
+	})
+	require.NoError(t, err)
+
+	_, err = rec.RecordList(context.Background(), "ConfigMap", "default", metav1.ListOptions{})
+	require.NoError(t, err)
+
+	dumpID, err := flight.Dump()
+	require.NoError(t, err)
+
+	meta, err := db.GetSession(dumpID)
+	require.NoError(t, err)
+	assert.Equal(t, "widget-operator", meta.OperatorName)
+	assert.Equal(t, storage.SessionCompleted, meta.Status)
+	assert.Equal(t, string(DumpManual), meta.Labels[DumpReasonLabel])
+
+	require.NoError(t, rec.Close())
+	buffered, err := flight.GetSession(flightSessionID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.SessionCompleted, buffered.Status)
+}
@@ -0,0 +1,495 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/reconciletrace"
+	"github.com/slyt3/kubestep/pkg/storage"
+)
+
+const (
+	defaultMaxSequence = 1000000
+	maxReplicaIDLength = 253
+	maxCASAttempts     = 1000
+	// clockSyncInterval is how many operations a replica records between
+	// reading the session's stored clock.
+	clockSyncInterval = 64
+)
+
+// sinkConfig holds the settings shared by every recording wrapper.
+type sinkConfig struct {
+	db          storage.OperationStore
+	sessionID   string
+	maxSequence int64
+	actorID     string
+	replicaID   string
+	async       *AsyncConfig
+	redaction   *RedactionPolicy
+	filter      *FilterSpec
+	session     *storage.Session
+}
+
+// recordSink assigns sequence numbers and persists operations for one session.
+// Every wrapper recording into the same session shares a single sink, and all
+// of its methods are safe for concurrent use.
+//
+// Sequence numbers are allocated atomically and are contiguous per sink.
+// Each operation also gets a Lamport clock value, so operations recorded by
+// several replicas into one session have a single global order.
+type recordSink struct {
+	// mu guards closed. record holds it shared so close waits for in-flight
+	// operations before flushing.
+	mu sync.RWMutex
+	// writeMu serializes stamping with the insert or enqueue that follows,
+	// so operations reach the store in sequence order.
+	writeMu     sync.Mutex
+	db          storage.OperationStore
+	writer      *asyncWriter
+	redactor    *redactor
+	filter      *operationFilter
+	prior       *priorStates
+	sessionID   string
+	sequenceNum int64
+	clock       int64
+	enabled     atomic.Bool
+	closed      bool
+	maxSequence int64
+	actorID     string
+	replicaID   string
+	failures    int64
+	// filtered counts operations left out by the filter; pendingFiltered
+	// holds the part a synchronous sink writes to the session on close.
+	filtered        int64
+	pendingFiltered int64
+	// began is set when the sink began the session and ends it on close.
+	began bool
+}
+
+// newRecordSink validates the common recorder settings. A non-nil async
+// config moves database writes to a background writer.
+// Rule 5: Multiple assertions for validation.
+func newRecordSink(cfg sinkConfig) (*recordSink, error) {
+	err := assert.Assert(cfg.db != nil, "database must not be nil")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(cfg.sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(
+		len(cfg.sessionID),
+		1,
+		maxSessionIDLength,
+		"session_id length",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.maxSequence <= 0 {
+		cfg.maxSequence = defaultMaxSequence
+	}
+
+	if len(cfg.actorID) == 0 {
+		cfg.actorID = defaultActorID
+	}
+
+	err = assert.AssertInRange(
+		len(cfg.actorID),
+		1,
+		maxActorIDLength,
+		"actor_id length",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(
+		len(cfg.replicaID),
+		0,
+		maxReplicaIDLength,
+		"replica_id length",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := newOperationFilter(cfg.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := newRedactor(cfg.redaction)
+	if err != nil {
+		return nil, err
+	}
+
+	// Readers need to know the stored payloads differ from the cluster's.
+	rules := redactor.descriptions()
+	if cfg.session != nil {
+		err = beginSession(cfg, rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rules) > 0 {
+		err = cfg.db.SetSessionRedaction(cfg.sessionID, rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record redaction policy: %w", err)
+		}
+	}
+
+	clock, err := cfg.db.MaxLamport(cfg.sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session clock: %w", err)
+	}
+
+	var writer *asyncWriter
+	if cfg.async != nil {
+		writer, err = newAsyncWriter(cfg.db, cfg.sessionID, *cfg.async)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &recordSink{
+		db:          cfg.db,
+		writer:      writer,
+		redactor:    redactor,
+		filter:      filter,
+		prior:       newPriorStates(),
+		sessionID:   cfg.sessionID,
+		clock:       clock,
+		maxSequence: cfg.maxSequence,
+		actorID:     cfg.actorID,
+		replicaID:   cfg.replicaID,
+		began:       cfg.session != nil,
+	}
+	s.enabled.Store(true)
+	return s, nil
+}
+
+// record filters and redacts op, attaches the object's prior state to
+// writes, stamps session, sequence, clock and actor on it and stores it, or
+// queues it when the sink writes asynchronously. Failures are counted.
+// Rule 2: Bounded sequence number check.
+func (s *recordSink) record(op *storage.Operation) error {
+	err := assert.AssertNotNil(s, "record sink")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertNotNil(op, "operation")
+	if err != nil {
+		return err
+	}
+
+	if !s.enabled.Load() {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		atomic.AddInt64(&s.failures, 1)
+		return fmt.Errorf("recorder is closed")
+	}
+
+	if !s.admit(op) {
+		return nil
+	}
+
+	// Allocation and insert or enqueue happen together so a reader never
+	// sees a sequence number before the ones allocated ahead of it.
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err = s.stamp(op)
+	if err != nil {
+		return err
+	}
+
+	if s.writer != nil {
+		s.writer.enqueue(op)
+		return nil
+	}
+
+	err = s.db.InsertOperation(op)
+	if err != nil {
+		atomic.AddInt64(&s.failures, 1)
+		return fmt.Errorf("failed to record operation: %w", err)
+	}
+
+	return nil
+}
+
+// recordBatch records ops like record, but stores the kept operations with
+// one InsertOperations call, or queues them when the sink writes
+// asynchronously. Operations are stamped in the order given.
+// Rule 2: Bounded by maxBatchSize.
+func (s *recordSink) recordBatch(ops []*storage.Operation) error {
+	err := assert.AssertNotNil(s, "record sink")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(ops), 1, maxBatchSize, "batch size")
+	if err != nil {
+		return err
+	}
+
+	if !s.enabled.Load() {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		atomic.AddInt64(&s.failures, int64(len(ops)))
+		return fmt.Errorf("recorder is closed")
+	}
+
+	kept := make([]*storage.Operation, 0, len(ops))
+	for i := 0; i < len(ops); i++ {
+		err = assert.AssertNotNil(ops[i], "operation")
+		if err != nil {
+			return err
+		}
+		if s.admit(ops[i]) {
+			kept = append(kept, ops[i])
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	for i := 0; i < len(kept); i++ {
+		err = s.stamp(kept[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.writer != nil {
+		for i := 0; i < len(kept); i++ {
+			s.writer.enqueue(kept[i])
+		}
+		return nil
+	}
+
+	err = s.db.InsertOperations(kept)
+	if err != nil {
+		atomic.AddInt64(&s.failures, int64(len(kept)))
+		return fmt.Errorf("failed to record operations: %w", err)
+	}
+	return nil
+}
+
+// admit applies the filter to op and, when it is kept, redacts it and
+// notes its prior state. The caller holds mu shared.
+func (s *recordSink) admit(op *storage.Operation) bool {
+	// Filter rules match on the actor, so it is set before filtering.
+	if len(op.ActorID) == 0 {
+		op.ActorID = s.actorID
+	}
+
+	if !s.filter.keep(op) {
+		s.countFiltered()
+		return false
+	}
+
+	s.redactor.redact(op)
+	s.prior.observe(op)
+	return true
+}
+
+// stamp allocates the next sequence number and clock value for op.
+func (s *recordSink) stamp(op *storage.Operation) error {
+	seq, err := s.nextSequence()
+	if err != nil {
+		atomic.AddInt64(&s.failures, 1)
+		return err
+	}
+
+	if len(s.replicaID) > 0 && seq%clockSyncInterval == 0 {
+		s.syncClock()
+	}
+
+	op.SessionID = s.sessionID
+	op.SequenceNumber = seq
+	op.ReplicaID = s.replicaID
+	op.Lamport = s.tick(op.Lamport)
+	if op.Timestamp.IsZero() {
+		op.Timestamp = time.Now()
+	}
+	return nil
+}
+
+// nextSequence atomically allocates a sequence number.
+// Rule 2: Bounded by maxCASAttempts.
+func (s *recordSink) nextSequence() (int64, error) {
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		current := atomic.LoadInt64(&s.sequenceNum)
+		if current >= s.maxSequence {
+			return 0, fmt.Errorf("max sequence number reached: %d", s.maxSequence)
+		}
+		if atomic.CompareAndSwapInt64(&s.sequenceNum, current, current+1) {
+			return current + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("sequence allocation contended after %d attempts", maxCASAttempts)
+}
+
+// tick advances the Lamport clock past both its own value and observed, a
+// clock value the operation already carries from another replica.
+// Rule 2: Bounded by maxCASAttempts.
+func (s *recordSink) tick(observed int64) int64 {
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		current := atomic.LoadInt64(&s.clock)
+		next := current
+		if observed > next {
+			next = observed
+		}
+		next = next + 1
+		if atomic.CompareAndSwapInt64(&s.clock, current, next) {
+			return next
+		}
+	}
+	return atomic.AddInt64(&s.clock, 1)
+}
+
+// syncClock moves the clock forward to the highest value other replicas
+// have stored for the session. Read failures keep the local clock.
+// Rule 2: Bounded by maxCASAttempts.
+func (s *recordSink) syncClock() {
+	stored, err := s.db.MaxLamport(s.sessionID)
+	if err != nil {
+		return
+	}
+
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		current := atomic.LoadInt64(&s.clock)
+		if stored <= current {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&s.clock, current, stored) {
+			return
+		}
+	}
+}
+
+// countFiltered counts a filtered operation. The asynchronous writer adds
+// the count to the session with its batches; a synchronous sink adds it on
+// close, so the caller's path never waits on the store.
+func (s *recordSink) countFiltered() {
+	atomic.AddInt64(&s.filtered, 1)
+	if s.writer != nil {
+		s.writer.countFiltered()
+		return
+	}
+	atomic.AddInt64(&s.pendingFiltered, 1)
+}
+
+// flushFiltered writes the filtered count not yet stored. A failed write
+// is counted as a failure.
+func (s *recordSink) flushFiltered() {
+	pending := atomic.SwapInt64(&s.pendingFiltered, 0)
+	if pending == 0 {
+		return
+	}
+
+	err := s.db.AddFilteredOperations(s.sessionID, pending)
+	if err != nil {
+		atomic.AddInt64(&s.failures, 1)
+	}
+}
+
+// store records op on a caller's path, linking it to the reconcile span
+// carried by ctx. Failures are counted, never returned, so recording cannot
+// change the error the caller sees.
+func (s *recordSink) store(ctx context.Context, op *storage.Operation) {
+	if op != nil && len(op.SpanID) == 0 {
+		op.SpanID = reconciletrace.SpanIDFromContext(ctx)
+	}
+	_ = s.record(op)
+}
+
+// close stops accepting operations and flushes queued ones. It waits for
+// operations already being recorded. A session the sink began is ended as
+// completed, or failed when queued operations could not be flushed.
+func (s *recordSink) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.flushFiltered()
+
+	var err error
+	if s.writer != nil {
+		err = s.writer.close()
+	}
+	if !s.began {
+		return err
+	}
+
+	status := storage.SessionCompleted
+	if err != nil {
+		status = storage.SessionFailed
+	}
+	endErr := s.db.EndSession(s.sessionID, status)
+	if err != nil {
+		return err
+	}
+	if endErr != nil {
+		return fmt.Errorf("failed to end session: %w", endErr)
+	}
+	return nil
+}
+
+func (s *recordSink) setEnabled(enabled bool) {
+	s.enabled.Store(enabled)
+}
+
+func (s *recordSink) sequence() int64 {
+	return atomic.LoadInt64(&s.sequenceNum)
+}
+
+// failureCount returns operations that could not be stored.
+func (s *recordSink) failureCount() int64 {
+	count := atomic.LoadInt64(&s.failures)
+	if s.writer != nil {
+		count = count + s.writer.failureCount()
+	}
+	return count
+}
+
+// filteredCount returns operations left out by the recording filter.
+func (s *recordSink) filteredCount() int64 {
+	return atomic.LoadInt64(&s.filtered)
+}
+
+// droppedCount returns operations discarded by the overflow policy.
+func (s *recordSink) droppedCount() int64 {
+	if s.writer == nil {
+		return 0
+	}
+	return s.writer.droppedCount()
+}
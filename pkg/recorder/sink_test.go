@@ -0,0 +1,241 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func requireContiguous(t *testing.T, ops []storage.Operation) {
+	t.Helper()
+
+	seen := make(map[int64]bool, len(ops))
+	for i := range ops {
+		seq := ops[i].SequenceNumber
+		require.False(t, seen[seq], "duplicate sequence %d", seq)
+		seen[seq] = true
+	}
+	for seq := int64(1); seq <= int64(len(ops)); seq++ {
+		require.True(t, seen[seq], "missing sequence %d", seq)
+	}
+}
+
+func TestConcurrentWrappersShareSequence(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	db := newTestDatabase(t)
+
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(configMap),
+		Database:  db,
+		SessionID: testSessionID,
+	})
+	require.NoError(t, err)
+	dyn, err := rec.Dynamic(newFakeDynamicClient(newWidget("w1")))
+	require.NoError(t, err)
+	watches, err := rec.Watches()
+	require.NoError(t, err)
+
+	const workers = 8
+	const perWorker = 25
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				switch (worker + i) % 3 {
+				case 0:
+					_, _ = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+				case 1:
+					_, _ = dyn.Resource(widgetGVR).Namespace("default").Get(ctx, "w1", metav1.GetOptions{})
+				default:
+					_ = watches.RecordEvent(watch.Modified, newConfigMap("cfg", "5"))
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, workers*perWorker)
+	requireContiguous(t, ops)
+	assert.Equal(t, int64(workers*perWorker), rec.sink.sequence())
+	assert.Equal(t, int64(0), rec.RecordFailures())
+
+	for i := 1; i < len(ops); i++ {
+		assert.Less(t, ops[i-1].Lamport, ops[i].Lamport)
+	}
+}
+
+func TestConcurrentEnableDisableAndClose(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	db := newTestDatabase(t)
+
+	rec, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(configMap),
+		Database:  db,
+		SessionID: testSessionID,
+		Async:     &AsyncConfig{QueueSize: 16, BatchSize: 4},
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, _ = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if i%2 == 0 {
+				_ = rec.Disable()
+			} else {
+				_ = rec.Enable()
+			}
+		}
+	}()
+	wg.Wait()
+	require.NoError(t, rec.Close())
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.NotEmpty(t, ops)
+	requireContiguous(t, ops)
+	assert.Equal(t, int64(len(ops)), rec.sink.sequence())
+
+	_, err = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rec.RecordFailures())
+}
+
+func TestReplicasRecordOneOrderedSession(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	path := filepath.Join(t.TempDir(), "replicas.db")
+	db, err := storage.NewDatabase(path, 10000)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	replicas := make([]*RecordingClient, 0, 3)
+	for i := 0; i < 3; i++ {
+		rec, recErr := NewRecordingClient(Config{
+			Client:    fake.NewSimpleClientset(configMap),
+			Database:  db,
+			SessionID: testSessionID,
+			ReplicaID: fmt.Sprintf("operator-%d", i),
+		})
+		require.NoError(t, recErr)
+		replicas = append(replicas, rec)
+	}
+
+	var wg sync.WaitGroup
+	for i := range replicas {
+		wg.Add(1)
+		go func(rec *RecordingClient) {
+			defer wg.Done()
+			for j := 0; j < 40; j++ {
+				_, _ = rec.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+			}
+		}(replicas[i])
+	}
+	wg.Wait()
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 120)
+
+	byReplica := make(map[string][]storage.Operation, 3)
+	for i := range ops {
+		byReplica[ops[i].ReplicaID] = append(byReplica[ops[i].ReplicaID], ops[i])
+		if i > 0 {
+			assert.True(t, storage.OperationLess(&ops[i-1], &ops[i]))
+		}
+	}
+	require.Len(t, byReplica, 3)
+	for replica, replicaOps := range byReplica {
+		require.Len(t, replicaOps, 40, replica)
+		requireContiguous(t, replicaOps)
+	}
+
+	result, err := storage.VerifySQLite(path, true)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	for i := range result.Warnings {
+		assert.NotContains(t, result.Warnings[i], "sequence gaps")
+	}
+}
+
+func TestReplicaJoiningSessionOrdersAfterStoredOperations(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+	}
+	db := newTestDatabase(t)
+
+	first, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(configMap),
+		Database:  db,
+		SessionID: testSessionID,
+		ReplicaID: "leader",
+	})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = first.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+		require.NoError(t, err)
+	}
+
+	second, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(configMap),
+		Database:  db,
+		SessionID: testSessionID,
+		ReplicaID: "standby",
+	})
+	require.NoError(t, err)
+	_, err = second.RecordGet(ctx, "ConfigMap", "default", "cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 6)
+	last := ops[len(ops)-1]
+	assert.Equal(t, "standby", last.ReplicaID)
+	assert.Equal(t, int64(1), last.SequenceNumber)
+	assert.Equal(t, int64(6), last.Lamport)
+}
+
+func TestNewRecordingClientRejectsLongReplicaID(t *testing.T) {
+	_, err := NewRecordingClient(Config{
+		Client:    fake.NewSimpleClientset(),
+		Database:  newTestDatabase(t),
+		SessionID: testSessionID,
+		ReplicaID: string(make([]byte, maxReplicaIDLength+1)),
+	})
+	require.Error(t, err)
+}
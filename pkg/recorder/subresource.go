@@ -0,0 +1,255 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Subresources recorded by the typed client.
+const (
+	SubresourceStatus   = "status"
+	SubresourceScale    = "scale"
+	SubresourceEviction = "eviction"
+	SubresourceBinding  = "binding"
+)
+
+// subresourceKinds maps the kinds with status or scale support to their
+// resource names.
+var subresourceKinds = map[string]string{
+	"Pod":         "pods",
+	"Service":     "services",
+	"Deployment":  "deployments",
+	"StatefulSet": "statefulsets",
+	"ReplicaSet":  "replicasets",
+}
+
+// RecordUpdateStatus records an update of the status subresource. Pods,
+// Services and Deployments are supported.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordUpdateStatus(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	obj runtime.Object,
+	opts metav1.UpdateOptions,
+) (runtime.Object, error) {
+	err := r.validateSubresourceCall(kind, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := extractObjectName(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := requestPayload(obj)
+	start := time.Now()
+
+	var updated runtime.Object
+	var updateErr error
+
+	switch typed := obj.(type) {
+	case *corev1.Pod:
+		updated, updateErr = r.client.CoreV1().Pods(namespace).UpdateStatus(ctx, typed, opts)
+	case *corev1.Service:
+		updated, updateErr = r.client.CoreV1().Services(namespace).UpdateStatus(ctx, typed, opts)
+	case *appsv1.Deployment:
+		updated, updateErr = r.client.AppsV1().Deployments(namespace).UpdateStatus(ctx, typed, opts)
+	default:
+		return nil, fmt.Errorf("unsupported status kind: %s", kind)
+	}
+
+	r.recordSubresource(ctx, storage.OperationUpdate, kind, namespace, name,
+		SubresourceStatus, sent, updated, updateErr, time.Since(start))
+	return updated, updateErr
+}
+
+// RecordGetScale records a read of the scale subresource of a Deployment,
+// StatefulSet or ReplicaSet.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordGetScale(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	name string,
+	opts metav1.GetOptions,
+) (*autoscalingv1.Scale, error) {
+	err := r.validateSubresourceCall(kind, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	var scale *autoscalingv1.Scale
+	switch kind {
+	case "Deployment":
+		scale, err = r.client.AppsV1().Deployments(namespace).GetScale(ctx, name, opts)
+	case "StatefulSet":
+		scale, err = r.client.AppsV1().StatefulSets(namespace).GetScale(ctx, name, opts)
+	case "ReplicaSet":
+		scale, err = r.client.AppsV1().ReplicaSets(namespace).GetScale(ctx, name, opts)
+	default:
+		return nil, fmt.Errorf("unsupported scale kind: %s", kind)
+	}
+
+	r.recordSubresource(ctx, storage.OperationGet, kind, namespace, name,
+		SubresourceScale, "", scaleObject(scale), err, time.Since(start))
+	return scale, err
+}
+
+// RecordUpdateScale records an update of the scale subresource of a
+// Deployment, StatefulSet or ReplicaSet.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordUpdateScale(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	name string,
+	scale *autoscalingv1.Scale,
+	opts metav1.UpdateOptions,
+) (*autoscalingv1.Scale, error) {
+	err := r.validateSubresourceCall(kind, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.Assert(scale != nil, "scale must not be nil")
+	if err != nil {
+		return nil, err
+	}
+
+	sent := requestPayload(scale)
+	start := time.Now()
+
+	var updated *autoscalingv1.Scale
+	switch kind {
+	case "Deployment":
+		updated, err = r.client.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, opts)
+	case "StatefulSet":
+		updated, err = r.client.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, opts)
+	case "ReplicaSet":
+		updated, err = r.client.AppsV1().ReplicaSets(namespace).UpdateScale(ctx, name, scale, opts)
+	default:
+		return nil, fmt.Errorf("unsupported scale kind: %s", kind)
+	}
+
+	r.recordSubresource(ctx, storage.OperationUpdate, kind, namespace, name,
+		SubresourceScale, sent, scaleObject(updated), err, time.Since(start))
+	return updated, err
+}
+
+// RecordEvict records a pod eviction. The Eviction sent is stored as the
+// request body; the API server returns no object.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordEvict(
+	ctx context.Context,
+	namespace string,
+	eviction *policyv1.Eviction,
+) error {
+	err := r.validateSubresourceCall("Pod", namespace)
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(eviction != nil, "eviction must not be nil")
+	if err != nil {
+		return err
+	}
+
+	sent := requestPayload(eviction)
+	start := time.Now()
+	evictErr := r.client.PolicyV1().Evictions(namespace).Evict(ctx, eviction)
+
+	r.recordSubresource(ctx, storage.OperationCreate, "Pod", namespace, eviction.Name,
+		SubresourceEviction, sent, nil, evictErr, time.Since(start))
+	return evictErr
+}
+
+// RecordBind records a pod binding, the write a scheduler makes to assign a
+// pod to a node.
+// Rule 7: All return values checked.
+func (r *RecordingClient) RecordBind(
+	ctx context.Context,
+	namespace string,
+	binding *corev1.Binding,
+	opts metav1.CreateOptions,
+) error {
+	err := r.validateSubresourceCall("Pod", namespace)
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(binding != nil, "binding must not be nil")
+	if err != nil {
+		return err
+	}
+
+	sent := requestPayload(binding)
+	start := time.Now()
+	bindErr := r.client.CoreV1().Pods(namespace).Bind(ctx, binding, opts)
+
+	r.recordSubresource(ctx, storage.OperationCreate, "Pod", namespace, binding.Name,
+		SubresourceBinding, sent, nil, bindErr, time.Since(start))
+	return bindErr
+}
+
+// validateSubresourceCall checks the arguments shared by subresource calls.
+// Rule 5: Multiple assertions for validation.
+func (r *RecordingClient) validateSubresourceCall(kind string, namespace string) error {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(kind, "resource kind")
+	if err != nil {
+		return err
+	}
+
+	return assert.AssertStringNotEmpty(namespace, "namespace")
+}
+
+// recordSubresource stores an operation on a subresource of kind.
+func (r *RecordingClient) recordSubresource(
+	ctx context.Context,
+	opType storage.OperationType,
+	kind string,
+	namespace string,
+	name string,
+	subresource string,
+	requestData string,
+	obj runtime.Object,
+	err error,
+	duration time.Duration,
+) {
+	if err != nil {
+		obj = nil
+	}
+
+	op := buildOperation(opType, kind, namespace, name, obj, err, duration)
+	op.Verb = string(opType)
+	op.RequestData = requestData
+	setResource(op, subresourceKinds[kind], subresource)
+
+	r.sink.store(ctx, op)
+}
+
+// scaleObject drops typed nil results so a failed call stores no payload.
+func scaleObject(scale *autoscalingv1.Scale) runtime.Object {
+	if scale == nil {
+		return nil
+	}
+	return scale
+}
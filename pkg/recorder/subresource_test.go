@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRecordUpdateStatus(t *testing.T) {
+	ctx := context.Background()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+	}
+	client := fake.NewSimpleClientset(pod)
+	rec, db := newTestRecorder(t, client)
+
+	_, err := rec.RecordGet(ctx, "Pod", "default", "web", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	updated := pod.DeepCopy()
+	updated.Status.Phase = corev1.PodRunning
+	_, err = rec.RecordUpdateStatus(ctx, "Pod", "default", updated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	status := ops[1]
+	assert.Equal(t, storage.OperationUpdate, status.OperationType)
+	assert.Equal(t, "pods/status", status.Resource)
+	assert.Equal(t, SubresourceStatus, status.Subresource)
+	assert.Equal(t, "web", status.Name)
+	assert.Contains(t, status.RequestData, `"phase":"Running"`)
+	assert.NotEmpty(t, status.PriorData, "status writes share the parent object's prior state")
+
+	_, err = rec.RecordUpdateStatus(ctx, "ConfigMap", "default",
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cfg"}}, metav1.UpdateOptions{})
+	require.Error(t, err)
+}
+
+func TestRecordScale(t *testing.T) {
+	ctx := context.Background()
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+	}
+	client := fake.NewSimpleClientset(deployment)
+	client.PrependReactor("*", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != SubresourceScale {
+			return false, nil, nil
+		}
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: 3},
+		}, nil
+	})
+	rec, db := newTestRecorder(t, client)
+
+	scale, err := rec.RecordGetScale(ctx, "Deployment", "default", "api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), scale.Spec.Replicas)
+
+	_, err = rec.RecordUpdateScale(ctx, "Deployment", "default", "api", scale, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	assert.Equal(t, storage.OperationGet, ops[0].OperationType)
+	assert.Equal(t, "deployments/scale", ops[0].Resource)
+	assert.Equal(t, SubresourceScale, ops[0].Subresource)
+	assert.Equal(t, storage.OperationUpdate, ops[1].OperationType)
+	assert.Equal(t, SubresourceScale, ops[1].Subresource)
+	assert.Contains(t, ops[1].PriorData, `"replicas":3`)
+
+	_, err = rec.RecordGetScale(ctx, "Pod", "default", "api", metav1.GetOptions{})
+	require.Error(t, err)
+}
+
+func TestRecordEvictAndBind(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return action.GetSubresource() != "", nil, nil
+	})
+	rec, db := newTestRecorder(t, client)
+
+	err := rec.RecordEvict(ctx, "default", &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	err = rec.RecordBind(ctx, "default", &corev1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Target:     corev1.ObjectReference{Kind: "Node", Name: "node-1"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	assert.Equal(t, storage.OperationCreate, ops[0].OperationType)
+	assert.Equal(t, "pods/eviction", ops[0].Resource)
+	assert.Equal(t, SubresourceEviction, ops[0].Subresource)
+	assert.Equal(t, "web", ops[0].Name)
+
+	assert.Equal(t, "pods/binding", ops[1].Resource)
+	assert.Equal(t, SubresourceBinding, ops[1].Subresource)
+	assert.Contains(t, ops[1].RequestData, `"node-1"`)
+
+	require.Error(t, rec.RecordEvict(ctx, "default", nil))
+}
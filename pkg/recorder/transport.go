@@ -0,0 +1,487 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/transport"
+)
+
+const (
+	maxCapturedBody = 1048576 // matches storage resource_data limit
+	maxKnownKinds   = 1000
+)
+
+// TransportConfig holds configuration for the transport-level recorder.
+type TransportConfig struct {
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	ActorID     string
+	ReplicaID   string
+	Async       *AsyncConfig
+	Redaction   *RedactionPolicy
+	Filter      *FilterSpec
+	Session     *storage.Session
+	// BasePath is the path of the API server URL the wrapped transport
+	// sends to, as returned by ConfigBasePath. It is removed from request
+	// paths before they are parsed.
+	BasePath string
+}
+
+// TransportRecorder records every API request sent through a wrapped
+// http.RoundTripper, regardless of which client issued it.
+type TransportRecorder struct {
+	sink     *recordSink
+	kinds    kindCache
+	basePath string
+}
+
+// kindCache remembers the Kind decoded for each resource, so errors and
+// Status bodies, which name no kind of their own, are labelled consistently.
+// It is safe for concurrent use; the zero value is empty.
+type kindCache struct {
+	kinds sync.Map
+	count int64
+}
+
+// NewTransportRecorder creates a recorder for use with rest.Config.WrapTransport.
+// Rule 5: Multiple assertions for validation.
+func NewTransportRecorder(cfg TransportConfig) (*TransportRecorder, error) {
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     cfg.ActorID,
+		replicaID:   cfg.ReplicaID,
+		async:       cfg.Async,
+		redaction:   cfg.Redaction,
+		filter:      cfg.Filter,
+		session:     cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TransportRecorder{sink: sink, basePath: cfg.BasePath}, nil
+}
+
+// WrapTransport returns a function suitable for rest.Config.WrapTransport.
+// Typed, dynamic and controller-runtime clients built from that config are
+// all recorded into the same session.
+func WrapTransport(cfg TransportConfig) (transport.WrapperFunc, error) {
+	rec, err := NewTransportRecorder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Wrap, nil
+}
+
+// Wrap returns a RoundTripper that records each request passing through rt.
+func (t *TransportRecorder) Wrap(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &recordingRoundTripper{next: rt, recorder: t}
+}
+
+// RequestInfo parses the API request req, leaving out the base path.
+func (t *TransportRecorder) RequestInfo(req *http.Request) RequestInfo {
+	return ParseRequestInfo(req.Method, trimBasePath(req.URL, t.basePath))
+}
+
+// Enable turns recording on.
+func (t *TransportRecorder) Enable() {
+	t.sink.setEnabled(true)
+}
+
+// Disable turns recording off. Requests still pass through unchanged.
+func (t *TransportRecorder) Disable() {
+	t.sink.setEnabled(false)
+}
+
+// GetSequenceNumber returns current sequence number.
+func (t *TransportRecorder) GetSequenceNumber() int64 {
+	return t.sink.sequence()
+}
+
+// RecordFailures returns how many operations could not be stored.
+func (t *TransportRecorder) RecordFailures() int64 {
+	return t.sink.failureCount()
+}
+
+// DroppedOperations returns how many operations the overflow policy discarded.
+func (t *TransportRecorder) DroppedOperations() int64 {
+	return t.sink.droppedCount()
+}
+
+// FilteredOperations returns how many requests the recording filter left out.
+func (t *TransportRecorder) FilteredOperations() int64 {
+	return t.sink.filteredCount()
+}
+
+// Close flushes queued operations and stops recording.
+func (t *TransportRecorder) Close() error {
+	return t.sink.close()
+}
+
+type recordingRoundTripper struct {
+	next     http.RoundTripper
+	recorder *TransportRecorder
+}
+
+// RoundTrip forwards the request and records it.
+// Recording never changes the response or error returned to the caller.
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	info := rt.recorder.RequestInfo(req)
+
+	var requestBody []byte
+	if info.IsResourceRequest && sendsBody(info.Verb) {
+		req, requestBody = captureRequestBody(req)
+	}
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	if !info.IsResourceRequest {
+		return resp, err
+	}
+
+	op := newRequestOperation(info, &rt.recorder.kinds)
+	if info.Verb == "patch" {
+		setRequestPatch(op, req, requestBody)
+	} else if len(requestBody) > 0 && len(requestBody) <= maxCapturedBody {
+		op.RequestData = string(requestBody)
+	}
+	if info.Verb == "list" || info.Verb == "watch" {
+		setListOptions(op, listOptionsFromQuery(req.URL))
+	}
+	if err != nil {
+		op.Error = err.Error()
+		op.DurationMs = time.Since(start).Milliseconds()
+		rt.recorder.store(req.Context(), op)
+		return resp, err
+	}
+
+	if resp.Body == nil || !capturesBody(info, resp) {
+		op.DurationMs = time.Since(start).Milliseconds()
+		applyStatus(op, info, req.Method, resp)
+		rt.recorder.store(req.Context(), op)
+		return resp, nil
+	}
+
+	ctx := req.Context()
+	resp.Body = &capturingBody{
+		body: resp.Body,
+		done: func(body []byte, complete bool, readErr error) {
+			op.DurationMs = time.Since(start).Milliseconds()
+			if readErr != nil {
+				op.Error = readErr.Error()
+			} else if complete {
+				applyResponse(op, info, req.Method, resp, body, &rt.recorder.kinds)
+			} else {
+				applyStatus(op, info, req.Method, resp)
+			}
+			rt.recorder.store(ctx, op)
+		},
+	}
+	return resp, nil
+}
+
+// WrappedRoundTripper exposes the inner transport for client-go utilities.
+func (rt *recordingRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.next
+}
+
+// newRequestOperation builds the operation for a resource request, labelled
+// with the kind kinds knows for the resource.
+func newRequestOperation(info RequestInfo, kinds *kindCache) *storage.Operation {
+	op := &storage.Operation{
+		Timestamp:     time.Now(),
+		OperationType: OperationTypeForVerb(info.Verb),
+		ResourceKind:  kinds.kindFor(info, ""),
+		Namespace:     info.Namespace,
+		Name:          info.Name,
+		Verb:          info.Verb,
+		APIGroup:      info.APIGroup,
+		APIVersion:    info.APIVersion,
+	}
+	setResource(op, info.Resource, info.Subresource)
+	return op
+}
+
+// streamingSubresources never end with a complete object: they stream
+// logs or carry an upgraded connection.
+var streamingSubresources = map[string]bool{
+	"log":         true,
+	"exec":        true,
+	"attach":      true,
+	"portforward": true,
+	"proxy":       true,
+}
+
+// capturesBody reports whether the response body of info is recorded.
+// Watches, upgraded connections, streaming subresources and bodies that are
+// not JSON are forwarded untouched.
+func capturesBody(info RequestInfo, resp *http.Response) bool {
+	if info.Verb == "watch" || resp.StatusCode == http.StatusSwitchingProtocols {
+		return false
+	}
+	if streamingSubresources[info.Subresource] {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// capturingBody copies up to maxCapturedBody+1 bytes of a response body as
+// the caller reads it, so the caller gets the response as soon as the
+// headers arrive. done runs once: at the end of the body, on a read error,
+// or on Close, which leaves the body incomplete when it comes first.
+type capturingBody struct {
+	body     io.ReadCloser
+	captured bytes.Buffer
+	once     sync.Once
+	done     func(body []byte, complete bool, err error)
+}
+
+// Read reads from the response body and keeps a copy of what was read.
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	room := maxCapturedBody + 1 - b.captured.Len()
+	if n > 0 && room > 0 {
+		if room > n {
+			room = n
+		}
+		b.captured.Write(p[:room])
+	}
+
+	if errors.Is(err, io.EOF) {
+		b.finish(true, nil)
+	} else if err != nil {
+		b.finish(false, err)
+	}
+	return n, err
+}
+
+// Close records the operation if the body was not read to the end.
+func (b *capturingBody) Close() error {
+	b.finish(false, nil)
+	return b.body.Close()
+}
+
+func (b *capturingBody) finish(complete bool, err error) {
+	b.once.Do(func() {
+		b.done(b.captured.Bytes(), complete, err)
+	})
+}
+
+// sendsBody reports whether requests with verb carry an object or patch.
+func sendsBody(verb string) bool {
+	return verb == "create" || verb == "update" || verb == "patch"
+}
+
+// captureRequestBody reads up to maxCapturedBody bytes of the request body.
+// It prefers GetBody so the caller's request is left untouched; otherwise the
+// request is cloned with a body that replays what was read.
+func captureRequestBody(req *http.Request) (*http.Request, []byte) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			data, readErr := io.ReadAll(io.LimitReader(body, maxCapturedBody+1))
+			_ = body.Close()
+			if readErr == nil {
+				return req, data
+			}
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(req.Body, maxCapturedBody+1))
+	clone := req.Clone(req.Context())
+	clone.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(data), req.Body),
+		Closer: req.Body,
+	}
+	if err != nil {
+		return clone, nil
+	}
+
+	return clone, data
+}
+
+// setRequestPatch fills the patch columns from a PATCH request.
+func setRequestPatch(op *storage.Operation, req *http.Request, body []byte) {
+	patchType := req.Header.Get("Content-Type")
+	if idx := strings.Index(patchType, ";"); idx >= 0 {
+		patchType = strings.TrimSpace(patchType[:idx])
+	}
+
+	query := req.URL.Query()
+	var force *bool
+	if value := query.Get("force"); len(value) > 0 {
+		forced := value == "true" || value == "1"
+		force = &forced
+	}
+
+	setPatch(op, patchType, body, query.Get("fieldManager"), force)
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// transportEnvelope holds the fields the recorder needs from a response body.
+type transportEnvelope struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        metav1.ObjectMeta `json:"metadata"`
+	Message         string            `json:"message,omitempty"`
+	Items           []transportItem   `json:"items,omitempty"`
+	// Code, Reason and Details are set when the body is a metav1.Status.
+	Code    int32                 `json:"code,omitempty"`
+	Reason  metav1.StatusReason   `json:"reason,omitempty"`
+	Details *metav1.StatusDetails `json:"details,omitempty"`
+}
+
+type transportItem struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+}
+
+// applyStatus fills the error and status details of a failed response
+// whose body is not recorded.
+func applyStatus(op *storage.Operation, info RequestInfo, method string, resp *http.Response) {
+	if resp.StatusCode < http.StatusBadRequest {
+		return
+	}
+	op.Error = http.StatusText(resp.StatusCode)
+	setStatusDetails(op, responseStatus(info, method, resp.StatusCode, resp.Header, nil))
+}
+
+// applyResponse fills payload, object metadata and status details on op,
+// remembering the decoded kind in kinds.
+func applyResponse(
+	op *storage.Operation,
+	info RequestInfo,
+	method string,
+	resp *http.Response,
+	body []byte,
+	kinds *kindCache,
+) {
+	var envelope transportEnvelope
+	decodeErr := json.Unmarshal(body, &envelope)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		op.Error = http.StatusText(resp.StatusCode)
+		decoded := &envelope
+		if decodeErr != nil {
+			decoded = nil
+		} else if len(envelope.Message) > 0 {
+			op.Error = envelope.Message
+		}
+		setStatusDetails(op, responseStatus(info, method, resp.StatusCode, resp.Header, decoded))
+		return
+	}
+
+	if len(body) <= maxCapturedBody {
+		op.ResourceData = string(body)
+	}
+
+	if decodeErr != nil {
+		return
+	}
+
+	op.ResourceKind = kinds.kindFor(info, envelope.Kind)
+	op.ResourceVersion = envelope.Metadata.ResourceVersion
+	if envelope.Kind == "Status" {
+		return
+	}
+
+	if info.Verb == "list" {
+		setTransportListItems(op, envelope.Items)
+		return
+	}
+
+	op.UID = string(envelope.Metadata.UID)
+	op.Generation = envelope.Metadata.Generation
+	if len(op.Name) == 0 && !strings.HasSuffix(envelope.Kind, "List") {
+		op.Name = envelope.Metadata.Name
+	}
+	if len(op.Namespace) == 0 {
+		op.Namespace = envelope.Metadata.Namespace
+	}
+}
+
+// setTransportListItems records the identity and version of listed items.
+// Rule 2: Bounded by maxRecordedListItems.
+func setTransportListItems(op *storage.Operation, items []transportItem) {
+	count := len(items)
+	if count > maxRecordedListItems {
+		count = maxRecordedListItems
+	}
+	if count == 0 {
+		return
+	}
+
+	op.ListItems = make([]storage.ListItem, 0, count)
+	for i := 0; i < count; i++ {
+		item := items[i].Metadata
+		op.ListItems = append(op.ListItems, storage.ListItem{
+			UID:             string(item.UID),
+			ResourceVersion: item.ResourceVersion,
+			Namespace:       item.Namespace,
+			Name:            item.Name,
+		})
+	}
+}
+
+// kindFor resolves the Kind for a resource, remembering responseKind for
+// later calls. Up to maxKnownKinds resources are remembered.
+func (c *kindCache) kindFor(info RequestInfo, responseKind string) string {
+	key := info.APIGroup + "/" + info.Resource
+	if len(info.Subresource) > 0 {
+		key = key + "/" + info.Subresource
+	}
+
+	kind := strings.TrimSuffix(responseKind, "List")
+	if len(kind) > 0 && kind != "Status" {
+		if _, loaded := c.kinds.Load(key); !loaded {
+			if atomic.AddInt64(&c.count, 1) <= maxKnownKinds {
+				c.kinds.Store(key, kind)
+			}
+		}
+		return kind
+	}
+
+	if value, ok := c.kinds.Load(key); ok {
+		if known, isString := value.(string); isString {
+			return known
+		}
+	}
+
+	return info.Resource
+}
+
+// store persists op and counts failures without surfacing them to callers.
+// client-go passes the caller's context on the request, so the span it
+// carries links the call.
+func (t *TransportRecorder) store(ctx context.Context, op *storage.Operation) {
+	t.sink.store(ctx, op)
+}
@@ -0,0 +1,411 @@
+package recorder
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slyt3/kubestep/pkg/reconciletrace"
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	configMapJSON = `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"demo",` +
+		`"namespace":"default","uid":"uid-1","resourceVersion":"7"}}`
+	widgetJSON = `{"kind":"Widget","apiVersion":"example.com/v1","metadata":{"name":"w1",` +
+		`"namespace":"default","uid":"uid-w1","resourceVersion":"12","generation":3}}`
+	notFoundJSON = `{"kind":"Status","apiVersion":"v1","status":"Failure",` +
+		`"message":"configmaps \"missing\" not found","reason":"NotFound","code":404}`
+)
+
+func newFakeAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps/demo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(configMapJSON))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(notFoundJSON))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/configmaps", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(configMapJSON))
+			return
+		}
+		_, _ = w.Write([]byte(`{"kind":"ConfigMapList","apiVersion":"v1","metadata":{"resourceVersion":"9"},` +
+			`"items":[{"metadata":{"name":"demo","namespace":"default","uid":"uid-1","resourceVersion":"7"}}]}`))
+	})
+	mux.HandleFunc("/apis/example.com/v1/namespaces/default/widgets/w1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(widgetJSON))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestTransportRecorder(t *testing.T) (*TransportRecorder, *storage.Database) {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "transport.db")
+	db, err := storage.NewDatabase(dbPath, 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+	})
+
+	rec, err := NewTransportRecorder(TransportConfig{
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "transport-test",
+	})
+	require.NoError(t, err)
+
+	return rec, db
+}
+
+func TestTransportRecordsTypedClient(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeAPIServer(t)
+	rec, db := newTestTransportRecorder(t)
+
+	cfg := &rest.Config{Host: srv.URL, WrapTransport: rec.Wrap}
+	client, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+
+	cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, "demo", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "demo", cm.Name)
+
+	_, err = client.CoreV1().ConfigMaps("default").List(ctx, metav1.ListOptions{
+		LabelSelector: "app=demo",
+		Limit:         50,
+	})
+	require.NoError(t, err)
+
+	_, err = client.CoreV1().ConfigMaps("default").Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "missing", metav1.GetOptions{})
+	require.Error(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+
+	assert.Equal(t, storage.OperationGet, ops[0].OperationType)
+	assert.Equal(t, "get", ops[0].Verb)
+	assert.Equal(t, "ConfigMap", ops[0].ResourceKind)
+	assert.Equal(t, "configmaps", ops[0].Resource)
+	assert.Equal(t, "v1", ops[0].APIVersion)
+	assert.Equal(t, "uid-1", ops[0].UID)
+	assert.Equal(t, "7", ops[0].ResourceVersion)
+	assert.Equal(t, "transport-test", ops[0].ActorID)
+	assert.JSONEq(t, configMapJSON, ops[0].ResourceData)
+
+	assert.Equal(t, storage.OperationList, ops[1].OperationType)
+	assert.Equal(t, "ConfigMap", ops[1].ResourceKind)
+	assert.Equal(t, "9", ops[1].ResourceVersion)
+	assert.Equal(t, "app=demo", ops[1].LabelSelector)
+	assert.Equal(t, int64(50), ops[1].Limit)
+	require.Len(t, ops[1].ListItems, 1)
+	assert.Equal(t, storage.ListItem{UID: "uid-1", ResourceVersion: "7",
+		Namespace: "default", Name: "demo"}, ops[1].ListItems[0])
+
+	assert.Equal(t, storage.OperationCreate, ops[2].OperationType)
+	assert.Equal(t, "demo", ops[2].Name)
+
+	assert.Equal(t, storage.OperationGet, ops[3].OperationType)
+	assert.Equal(t, "ConfigMap", ops[3].ResourceKind)
+	assert.Equal(t, `configmaps "missing" not found`, ops[3].Error)
+	assert.Empty(t, ops[3].ResourceData)
+	assert.Equal(t, int64(4), rec.GetSequenceNumber())
+}
+
+func TestTransportRecordsDynamicClient(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeAPIServer(t)
+	_, db := newTestTransportRecorder(t)
+
+	wrap, err := WrapTransport(TransportConfig{
+		Database:  db,
+		SessionID: "dynamic-session",
+	})
+	require.NoError(t, err)
+
+	cfg := &rest.Config{Host: srv.URL, WrapTransport: wrap}
+	client, err := dynamic.NewForConfig(cfg)
+	require.NoError(t, err)
+
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	obj, err := client.Resource(gvr).Namespace("default").Get(ctx, "w1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "w1", obj.GetName())
+
+	ops, err := db.QueryOperations("dynamic-session")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "Widget", ops[0].ResourceKind)
+	assert.Equal(t, "example.com", ops[0].APIGroup)
+	assert.Equal(t, "widgets", ops[0].Resource)
+	assert.Equal(t, int64(3), ops[0].Generation)
+	assert.Equal(t, defaultActorID, ops[0].ActorID)
+}
+
+func TestTransportRecordsPatch(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeAPIServer(t)
+	rec, db := newTestTransportRecorder(t)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, WrapTransport: rec.Wrap})
+	require.NoError(t, err)
+
+	spanID, spanCtx := reconciletrace.Start(ctx, db, testSessionID, "demo-controller",
+		schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, "default", "demo", "", "", "")
+	require.NotEmpty(t, spanID)
+
+	force := true
+	patch := []byte(`{"data":{"mode":"on"}}`)
+	_, err = client.CoreV1().ConfigMaps("default").Patch(spanCtx, "demo", types.ApplyPatchType,
+		patch, metav1.PatchOptions{FieldManager: "demo-controller", Force: &force})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, storage.OperationPatch, ops[0].OperationType)
+	assert.Equal(t, string(types.ApplyPatchType), ops[0].PatchType)
+	assert.Equal(t, string(patch), ops[0].PatchData)
+	assert.Equal(t, "demo-controller", ops[0].FieldManager)
+	assert.Equal(t, &force, ops[0].Force)
+	assert.JSONEq(t, configMapJSON, ops[0].ResourceData)
+	assert.Equal(t, spanID, ops[0].SpanID)
+}
+
+func TestTransportSkipsNonResourceRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"major":"1","minor":"28"}`))
+	}))
+	defer srv.Close()
+
+	rec, db := newTestTransportRecorder(t)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, WrapTransport: rec.Wrap})
+	require.NoError(t, err)
+
+	_, err = client.Discovery().ServerVersion()
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+func TestParseRequestInfo(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   RequestInfo
+	}{
+		{
+			method: http.MethodGet,
+			path:   "/api/v1/namespaces/default/pods/web-0",
+			want: RequestInfo{IsResourceRequest: true, Verb: "get", APIVersion: "v1",
+				Resource: "pods", Namespace: "default", Name: "web-0"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/apis/apps/v1/deployments",
+			want: RequestInfo{IsResourceRequest: true, Verb: "list", APIGroup: "apps",
+				APIVersion: "v1", Resource: "deployments"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/apis/batch/v1/namespaces/ci/jobs?watch=true",
+			want: RequestInfo{IsResourceRequest: true, Verb: "watch", APIGroup: "batch",
+				APIVersion: "v1", Resource: "jobs", Namespace: "ci"},
+		},
+		{
+			method: http.MethodPut,
+			path:   "/apis/apps/v1/namespaces/default/deployments/web/status",
+			want: RequestInfo{IsResourceRequest: true, Verb: "update", APIGroup: "apps",
+				APIVersion: "v1", Resource: "deployments", Namespace: "default",
+				Name: "web", Subresource: "status"},
+		},
+		{
+			method: http.MethodDelete,
+			path:   "/api/v1/namespaces/default/configmaps",
+			want: RequestInfo{IsResourceRequest: true, Verb: "deletecollection",
+				APIVersion: "v1", Resource: "configmaps", Namespace: "default"},
+		},
+		{
+			method: http.MethodPut,
+			path:   "/api/v1/namespaces/team-a/finalize",
+			want: RequestInfo{IsResourceRequest: true, Verb: "update", APIVersion: "v1",
+				Resource: "namespaces", Name: "team-a", Subresource: "finalize"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/apis/apps/v1",
+			want:   RequestInfo{},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/version",
+			want:   RequestInfo{},
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		tc := tests[i]
+		u, err := url.Parse(tc.path)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, ParseRequestInfo(tc.method, u), tc.path)
+	}
+}
+
+func TestTransportRecordsPrefixedHost(t *testing.T) {
+	ctx := context.Background()
+	const prefix = "/k8s/clusters/c-abc"
+	upstream := newFakeAPIServer(t)
+	srv := httptest.NewServer(http.StripPrefix(prefix, upstream.Config.Handler))
+	t.Cleanup(srv.Close)
+
+	cfg := &rest.Config{Host: srv.URL + prefix}
+	basePath, err := ConfigBasePath(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, basePath)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "transport.db"), 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+	})
+	rec, err := NewTransportRecorder(TransportConfig{Database: db, SessionID: testSessionID, BasePath: basePath})
+	require.NoError(t, err)
+
+	cfg.WrapTransport = rec.Wrap
+	client, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "demo", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "configmaps", ops[0].Resource)
+	assert.Equal(t, "default", ops[0].Namespace)
+	assert.Equal(t, "demo", ops[0].Name)
+	assert.Equal(t, "ConfigMap", ops[0].ResourceKind)
+
+	// Paths outside the base path are parsed as they are.
+	u, err := url.Parse("/api/v1/namespaces/default/pods/web-0")
+	require.NoError(t, err)
+	assert.Equal(t, "pods", ParseRequestInfo(http.MethodGet, trimBasePath(u, prefix)).Resource)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// upgradedConn stands in for the connection of a 101 response.
+type upgradedConn struct {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+func TestTransportStreamsResponseBodies(t *testing.T) {
+	rec, db := newTestTransportRecorder(t)
+	logs, logWriter := io.Pipe()
+	defer func() {
+		assert.NoError(t, logWriter.Close())
+	}()
+	conn := &upgradedConn{Reader: strings.NewReader(""), Writer: io.Discard, Closer: io.NopCloser(nil)}
+
+	rt := rec.Wrap(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{"Content-Type": []string{"application/json"}}
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/log"):
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{
+				"Content-Type": []string{"text/plain"},
+			}, Body: logs, Request: req}, nil
+		case strings.HasSuffix(req.URL.Path, "/exec"):
+			return &http.Response{StatusCode: http.StatusSwitchingProtocols, Header: http.Header{},
+				Body: conn, Request: req}, nil
+		default:
+			return &http.Response{StatusCode: http.StatusOK, Header: header,
+				Body: io.NopCloser(strings.NewReader(configMapJSON)), Request: req}, nil
+		}
+	}))
+	send := func(method string, path string) *http.Response {
+		req, err := http.NewRequest(method, "https://cluster.local"+path, nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// A followed log returns at once and is passed through untouched.
+	resp := send(http.MethodGet, "/api/v1/namespaces/default/pods/demo/log?follow=true")
+	assert.Same(t, logs, resp.Body)
+
+	resp = send(http.MethodPost, "/api/v1/namespaces/default/pods/demo/exec?command=sh")
+	_, upgraded := resp.Body.(io.ReadWriteCloser)
+	assert.True(t, upgraded, "the upgraded connection must stay writable")
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, "log", ops[0].Subresource)
+	assert.Empty(t, ops[0].ResourceData)
+
+	// A JSON body is recorded once the caller has read it.
+	resp = send(http.MethodGet, "/api/v1/namespaces/default/configmaps/demo")
+	ops, err = db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.JSONEq(t, configMapJSON, string(body))
+
+	ops, err = db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	assert.JSONEq(t, configMapJSON, ops[2].ResourceData)
+	assert.Equal(t, "uid-1", ops[2].UID)
+
+	// Closing before the end records the call without a partial body.
+	resp = send(http.MethodGet, "/api/v1/namespaces/default/configmaps/demo")
+	require.NoError(t, resp.Body.Close())
+	ops, err = db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	assert.Empty(t, ops[3].ResourceData)
+}
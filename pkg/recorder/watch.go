@@ -0,0 +1,296 @@
+package recorder
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/slyt3/kubestep/internal/assert"
+	"github.com/slyt3/kubestep/pkg/storage"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	unknownWatchKind = "Unknown"
+)
+
+// WatchConfig holds configuration for recording observed watch events.
+type WatchConfig struct {
+	Database    storage.OperationStore
+	SessionID   string
+	MaxSequence int64
+	ActorID     string
+	ReplicaID   string
+	Async       *AsyncConfig
+	Redaction   *RedactionPolicy
+	Filter      *FilterSpec
+	// Scheme resolves the Kind of typed objects, which informers deliver
+	// without TypeMeta. Defaults to the client-go scheme.
+	Scheme  *runtime.Scheme
+	Session *storage.Session
+}
+
+// WatchRecorder stores the watch events a controller observed as
+// OperationWatch records, so a session shows what triggered each reconcile.
+type WatchRecorder struct {
+	sink     *recordSink
+	scheme   *runtime.Scheme
+	failures int64
+}
+
+// NewWatchRecorder creates a watch event recorder.
+// Rule 5: Multiple assertions for validation.
+func NewWatchRecorder(cfg WatchConfig) (*WatchRecorder, error) {
+	sink, err := newRecordSink(sinkConfig{
+		db:          cfg.Database,
+		sessionID:   cfg.SessionID,
+		maxSequence: cfg.MaxSequence,
+		actorID:     cfg.ActorID,
+		replicaID:   cfg.ReplicaID,
+		async:       cfg.Async,
+		redaction:   cfg.Redaction,
+		filter:      cfg.Filter,
+		session:     cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newWatchRecorder(sink, cfg.Scheme), nil
+}
+
+// Watches returns a watch event recorder sharing this recorder's session and
+// sequence, so events interleave with the calls they caused.
+func (r *RecordingClient) Watches() (*WatchRecorder, error) {
+	err := assert.AssertNotNil(r, "recorder")
+	if err != nil {
+		return nil, err
+	}
+
+	return newWatchRecorder(r.sink, nil), nil
+}
+
+// Watches returns a watch event recorder sharing this recorder's session and
+// sequence, for callers that decode watch streams passing through it.
+func (t *TransportRecorder) Watches() (*WatchRecorder, error) {
+	err := assert.AssertNotNil(t, "recorder")
+	if err != nil {
+		return nil, err
+	}
+
+	return newWatchRecorder(t.sink, nil), nil
+}
+
+func newWatchRecorder(sink *recordSink, kindScheme *runtime.Scheme) *WatchRecorder {
+	if kindScheme == nil {
+		kindScheme = scheme.Scheme
+	}
+	return &WatchRecorder{sink: sink, scheme: kindScheme}
+}
+
+// RecordEvent stores one watch event with the object's identity, version
+// and payload.
+func (w *WatchRecorder) RecordEvent(eventType watch.EventType, obj runtime.Object) error {
+	err := assert.AssertNotNil(w, "watch recorder")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(string(eventType), "event type")
+	if err != nil {
+		return err
+	}
+
+	op := w.eventOperation(eventType, obj)
+	return w.sink.record(op)
+}
+
+// EventHandler wraps an informer event handler. Each event is recorded before
+// it is handed to inner; inner may be nil to record only.
+func (w *WatchRecorder) EventHandler(inner cache.ResourceEventHandler) cache.ResourceEventHandler {
+	return &recordingEventHandler{recorder: w, inner: inner}
+}
+
+// Watch wraps a watch.Interface so every delivered event is recorded.
+func (w *WatchRecorder) Watch(inner watch.Interface) watch.Interface {
+	if inner == nil {
+		return nil
+	}
+
+	rw := &recordingWatch{
+		inner:    inner,
+		recorder: w,
+		result:   make(chan watch.Event),
+		done:     make(chan struct{}),
+	}
+	go rw.forward()
+	return rw
+}
+
+// Enable turns recording on.
+func (w *WatchRecorder) Enable() {
+	w.sink.setEnabled(true)
+}
+
+// Disable turns recording off. Events still reach the wrapped handler.
+func (w *WatchRecorder) Disable() {
+	w.sink.setEnabled(false)
+}
+
+// GetSequenceNumber returns current sequence number.
+func (w *WatchRecorder) GetSequenceNumber() int64 {
+	return w.sink.sequence()
+}
+
+// RecordFailures returns how many events could not be stored.
+func (w *WatchRecorder) RecordFailures() int64 {
+	return atomic.LoadInt64(&w.failures) + w.sink.failureCount()
+}
+
+// Close flushes queued events and stops recording.
+func (w *WatchRecorder) Close() error {
+	return w.sink.close()
+}
+
+// eventOperation builds the OperationWatch record for one event.
+func (w *WatchRecorder) eventOperation(eventType watch.EventType, obj runtime.Object) *storage.Operation {
+	gvk := w.kindOf(obj)
+	kind := gvk.Kind
+	if len(kind) == 0 {
+		kind = unknownWatchKind
+	}
+
+	var callErr error
+	if status, ok := obj.(*metav1.Status); ok && eventType == watch.Error {
+		callErr = &apierrors.StatusError{ErrStatus: *status}
+	}
+
+	namespace, name := objectKey(obj)
+	op := buildOperation(storage.OperationWatch, kind, namespace, name, obj, callErr, 0)
+	op.Verb = "watch"
+	op.EventType = string(eventType)
+	op.APIGroup = gvk.Group
+	op.APIVersion = gvk.Version
+	return op
+}
+
+// kindOf resolves the GroupVersionKind from TypeMeta or the scheme.
+func (w *WatchRecorder) kindOf(obj runtime.Object) schema.GroupVersionKind {
+	if obj == nil {
+		return schema.GroupVersionKind{}
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if len(gvk.Kind) > 0 {
+		return gvk
+	}
+
+	kinds, _, err := w.scheme.ObjectKinds(obj)
+	if err != nil || len(kinds) == 0 {
+		return gvk
+	}
+	return kinds[0]
+}
+
+func objectKey(obj runtime.Object) (string, string) {
+	if obj == nil {
+		return "", ""
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", ""
+	}
+	return accessor.GetNamespace(), accessor.GetName()
+}
+
+// recordingEventHandler adapts WatchRecorder to cache.ResourceEventHandler.
+// Handler methods cannot return errors, so failures are only counted.
+type recordingEventHandler struct {
+	recorder *WatchRecorder
+	inner    cache.ResourceEventHandler
+}
+
+func (h *recordingEventHandler) OnAdd(obj interface{}, isInInitialList bool) {
+	h.record(watch.Added, obj)
+	if h.inner != nil {
+		h.inner.OnAdd(obj, isInInitialList)
+	}
+}
+
+func (h *recordingEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	h.record(watch.Modified, newObj)
+	if h.inner != nil {
+		h.inner.OnUpdate(oldObj, newObj)
+	}
+}
+
+func (h *recordingEventHandler) OnDelete(obj interface{}) {
+	h.record(watch.Deleted, obj)
+	if h.inner != nil {
+		h.inner.OnDelete(obj)
+	}
+}
+
+func (h *recordingEventHandler) record(eventType watch.EventType, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		atomic.AddInt64(&h.recorder.failures, 1)
+		return
+	}
+
+	_ = h.recorder.RecordEvent(eventType, runtimeObj)
+}
+
+// recordingWatch forwards events from inner after recording them.
+type recordingWatch struct {
+	inner    watch.Interface
+	recorder *WatchRecorder
+	result   chan watch.Event
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (rw *recordingWatch) ResultChan() <-chan watch.Event {
+	return rw.result
+}
+
+func (rw *recordingWatch) Stop() {
+	rw.stopOnce.Do(func() {
+		close(rw.done)
+		rw.inner.Stop()
+	})
+}
+
+// forward runs until the inner watch closes or Stop is called.
+func (rw *recordingWatch) forward() {
+	defer close(rw.result)
+
+	events := rw.inner.ResultChan()
+	for {
+		select {
+		case <-rw.done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			_ = rw.recorder.RecordEvent(event.Type, event.Object)
+
+			select {
+			case rw.result <- event:
+			case <-rw.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package recorder
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/slyt3/kubestep/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newConfigMap(name string, rv string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			UID:             types.UID("uid-" + name),
+			ResourceVersion: rv,
+		},
+		Data: map[string]string{"mode": "on"},
+	}
+}
+
+type countingHandler struct {
+	adds, updates, deletes int
+}
+
+func (c *countingHandler) OnAdd(obj interface{}, isInInitialList bool) { c.adds++ }
+func (c *countingHandler) OnUpdate(oldObj, newObj interface{})         { c.updates++ }
+func (c *countingHandler) OnDelete(obj interface{})                    { c.deletes++ }
+
+func TestWatchEventHandlerRecordsEvents(t *testing.T) {
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset())
+	watches, err := rec.Watches()
+	require.NoError(t, err)
+
+	inner := &countingHandler{}
+	handler := watches.EventHandler(inner)
+
+	handler.OnAdd(newConfigMap("cfg", "10"), true)
+	handler.OnUpdate(newConfigMap("cfg", "10"), newConfigMap("cfg", "11"))
+	handler.OnDelete(cache.DeletedFinalStateUnknown{
+		Key: "default/cfg",
+		Obj: newConfigMap("cfg", "12"),
+	})
+
+	assert.Equal(t, 1, inner.adds)
+	assert.Equal(t, 1, inner.updates)
+	assert.Equal(t, 1, inner.deletes)
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	expected := []struct {
+		event string
+		rv    string
+	}{
+		{storage.WatchEventAdded, "10"},
+		{storage.WatchEventModified, "11"},
+		{storage.WatchEventDeleted, "12"},
+	}
+	for i, want := range expected {
+		assert.Equal(t, storage.OperationWatch, ops[i].OperationType)
+		assert.Equal(t, want.event, ops[i].EventType)
+		assert.Equal(t, want.rv, ops[i].ResourceVersion)
+		assert.Equal(t, "ConfigMap", ops[i].ResourceKind)
+		assert.Equal(t, "default", ops[i].Namespace)
+		assert.Equal(t, "cfg", ops[i].Name)
+		assert.Equal(t, "uid-cfg", ops[i].UID)
+		assert.Equal(t, "v1", ops[i].APIVersion)
+		assert.Contains(t, ops[i].ResourceData, `"mode":"on"`)
+	}
+	assert.Equal(t, int64(0), watches.RecordFailures())
+}
+
+func TestWatchWrapperRecordsBookmarks(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "recordings.db")
+	db, err := storage.NewDatabase(dbPath, 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+	})
+
+	watches, err := NewWatchRecorder(WatchConfig{
+		Database:  db,
+		SessionID: testSessionID,
+		ActorID:   "controller-a",
+	})
+	require.NoError(t, err)
+
+	fakeWatch := watch.NewFake()
+	w := watches.Watch(fakeWatch)
+
+	go func() {
+		fakeWatch.Add(newConfigMap("cfg", "20"))
+		fakeWatch.Action(watch.Bookmark, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{ResourceVersion: "25"},
+		})
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-w.ResultChan():
+			assert.NotNil(t, event.Object)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for watch event")
+		}
+	}
+	w.Stop()
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, storage.WatchEventAdded, ops[0].EventType)
+	assert.Equal(t, "controller-a", ops[0].ActorID)
+	assert.Equal(t, storage.WatchEventBookmark, ops[1].EventType)
+	assert.Equal(t, "25", ops[1].ResourceVersion)
+	assert.Equal(t, "ConfigMap", ops[1].ResourceKind)
+}
+
+func TestDynamicWatchRecordsEvents(t *testing.T) {
+	ctx := context.Background()
+	rec, db := newTestRecorder(t, fake.NewSimpleClientset())
+
+	client := newFakeDynamicClient()
+	dyn, err := rec.Dynamic(client)
+	require.NoError(t, err)
+
+	w, err := dyn.Resource(widgetGVR).Namespace("default").Watch(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	_, err = client.Resource(widgetGVR).Namespace("default").Create(ctx, newWidget("w1"), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	select {
+	case event := <-w.ResultChan():
+		assert.Equal(t, watch.Added, event.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch event")
+	}
+
+	ops, err := db.QueryOperations(testSessionID)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, storage.OperationWatch, ops[0].OperationType)
+	assert.Equal(t, "Widget", ops[0].ResourceKind)
+	assert.Equal(t, "example.com", ops[0].APIGroup)
+	assert.Equal(t, "uid-w1", ops[0].UID)
+}
@@ -0,0 +1,150 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+const (
+	maxDiffNodes   = 100000
+	maxDiffChanges = 1000
+)
+
+// serverManagedFields are set by the API server on every write. They always
+// differ between what a client sent and what was stored, so diffs skip them.
+var serverManagedFields = map[string]bool{
+	"metadata.resourceVersion":   true,
+	"metadata.uid":               true,
+	"metadata.creationTimestamp": true,
+	"metadata.generation":        true,
+	"metadata.managedFields":     true,
+	"metadata.selfLink":          true,
+}
+
+// FieldChange is one field that differs between two versions of an object.
+// Values are JSON encoded; an empty value means the field is absent.
+type FieldChange struct {
+	Path   string
+	Before string
+	After  string
+}
+
+// DiffObjects compares two JSON objects field by field and returns the
+// changes from before to after, sorted by path. Server-managed metadata is
+// ignored. Arrays are compared as whole values.
+// Rule 1: No recursion, uses an explicit stack.
+func DiffObjects(before string, after string) ([]FieldChange, error) {
+	var beforeDoc, afterDoc interface{}
+
+	err := json.Unmarshal([]byte(before), &beforeDoc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode first object: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(after), &afterDoc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode second object: %w", err)
+	}
+
+	type node struct {
+		path   string
+		before interface{}
+		after  interface{}
+	}
+
+	changes := make([]FieldChange, 0)
+	stack := []node{{before: beforeDoc, after: afterDoc}}
+
+	for visited := 0; len(stack) > 0; visited++ {
+		err = assert.Assert(visited < maxDiffNodes, "diff exceeds max nodes")
+		if err != nil {
+			return nil, err
+		}
+
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if serverManagedFields[current.path] {
+			continue
+		}
+
+		beforeMap, beforeIsMap := current.before.(map[string]interface{})
+		afterMap, afterIsMap := current.after.(map[string]interface{})
+		if beforeIsMap && afterIsMap {
+			keys := unionKeys(beforeMap, afterMap)
+			for i := 0; i < len(keys); i++ {
+				stack = append(stack, node{
+					path:   joinFieldPath(current.path, keys[i]),
+					before: beforeMap[keys[i]],
+					after:  afterMap[keys[i]],
+				})
+			}
+			continue
+		}
+
+		beforeValue := encodeValue(current.before)
+		afterValue := encodeValue(current.after)
+		if beforeValue == afterValue {
+			continue
+		}
+
+		if len(changes) >= maxDiffChanges {
+			break
+		}
+		changes = append(changes, FieldChange{
+			Path:   current.path,
+			Before: beforeValue,
+			After:  afterValue,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// unionKeys returns the keys of both maps, deduplicated and sorted.
+func unionKeys(a map[string]interface{}, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinFieldPath appends key to a dotted path, quoting keys that contain dots
+// such as annotation names.
+func joinFieldPath(parent string, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		key = "[" + strconv.Quote(key) + "]"
+		return parent + key
+	}
+	if len(parent) == 0 {
+		return key
+	}
+	return parent + "." + key
+}
+
+// encodeValue renders a decoded JSON value; absent fields give "".
+func encodeValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
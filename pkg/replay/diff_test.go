@@ -0,0 +1,32 @@
+package replay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffObjects(t *testing.T) {
+	sent := `{"metadata":{"name":"web","labels":{"tier":"web"},` +
+		`"annotations":{"example.com/owner":"a"}},"spec":{"replicas":3,"paused":false}}`
+	stored := `{"metadata":{"name":"web","resourceVersion":"42","uid":"u-1",` +
+		`"annotations":{"example.com/owner":"b"}},` +
+		`"spec":{"replicas":5,"paused":false,"strategy":{"type":"RollingUpdate"}}}`
+
+	changes, err := DiffObjects(sent, stored)
+	require.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Path: `metadata.annotations["example.com/owner"]`, Before: `"a"`, After: `"b"`},
+		{Path: "metadata.labels", Before: `{"tier":"web"}`, After: ""},
+		{Path: "spec.replicas", Before: "3", After: "5"},
+		{Path: "spec.strategy", Before: "", After: `{"type":"RollingUpdate"}`},
+	}, changes)
+
+	changes, err = DiffObjects(stored, stored)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = DiffObjects("not json", stored)
+	assert.Error(t, err)
+}
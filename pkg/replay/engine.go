@@ -193,7 +193,9 @@ func (r *ReplayEngine) updateCache(op *storage.Operation) error {
 		return err
 	}
 
-	if len(op.ResourceData) == 0 {
+	// An emitted Event carries the Event as its payload, not the state of
+	// the object it names.
+	if len(op.ResourceData) == 0 || op.OperationType == storage.OperationEvent {
 		return nil
 	}
 
@@ -237,11 +239,17 @@ func (r *ReplayEngine) GetCachedObject(
 
 // OperationStats holds statistics about operations.
 type OperationStats struct {
-	TotalOps      int
-	GetOps        int
-	UpdateOps     int
-	CreateOps     int
-	DeleteOps     int
+	TotalOps    int
+	GetOps      int
+	UpdateOps   int
+	PatchOps    int
+	CreateOps   int
+	DeleteOps   int
+	WatchEvents int
+	// KubeEvents counts emitted Kubernetes Events, WarningEvents the
+	// Warning ones among them.
+	KubeEvents    int
+	WarningEvents int
 	ErrorCount    int
 	AvgDurationMs int64
 	MaxDurationMs int64
@@ -269,14 +277,23 @@ func (r *ReplayEngine) CalculateStats() (*OperationStats, error) {
 		op := &r.operations[count]
 
 		switch op.OperationType {
-		case storage.OperationGet:
+		case storage.OperationGet, storage.OperationCacheGet:
 			stats.GetOps = stats.GetOps + 1
 		case storage.OperationUpdate:
 			stats.UpdateOps = stats.UpdateOps + 1
+		case storage.OperationPatch:
+			stats.PatchOps = stats.PatchOps + 1
 		case storage.OperationCreate:
 			stats.CreateOps = stats.CreateOps + 1
 		case storage.OperationDelete:
 			stats.DeleteOps = stats.DeleteOps + 1
+		case storage.OperationWatch:
+			stats.WatchEvents = stats.WatchEvents + 1
+		case storage.OperationEvent:
+			stats.KubeEvents = stats.KubeEvents + 1
+			if op.EventType == storage.EventTypeWarning {
+				stats.WarningEvents = stats.WarningEvents + 1
+			}
 		}
 
 		if len(op.Error) > 0 {
@@ -318,6 +335,41 @@ func (r *ReplayEngine) GetOperationAt(index int) (*storage.Operation, error) {
 	return &r.operations[index], nil
 }
 
+// FindTrigger returns the watch event that delivered a reconcile's trigger:
+// the last WATCH operation carrying the span's trigger uid/resourceVersion
+// recorded no later than the span start.
+// Rule 2: Bounded by maxIndex.
+func (r *ReplayEngine) FindTrigger(span storage.ReconcileSpan) (*storage.Operation, error) {
+	err := assert.AssertNotNil(r, "replay engine")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(span.TriggerUID, "trigger uid")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := r.maxIndex - 1; i >= 0; i-- {
+		op := &r.operations[i]
+		if op.OperationType != storage.OperationWatch {
+			continue
+		}
+		if op.UID != span.TriggerUID {
+			continue
+		}
+		if len(span.TriggerResourceVersion) > 0 && op.ResourceVersion != span.TriggerResourceVersion {
+			continue
+		}
+		if !span.StartTime.IsZero() && op.Timestamp.After(span.StartTime) {
+			continue
+		}
+		return op, nil
+	}
+
+	return nil, fmt.Errorf("no watch event for trigger %s@%s", span.TriggerUID, span.TriggerResourceVersion)
+}
+
 // MockClient provides a mock Kubernetes client for replay.
 type MockClient struct {
 	engine *ReplayEngine
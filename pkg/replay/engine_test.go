@@ -232,3 +232,65 @@ func TestMockClient(t *testing.T) {
 	assert.NoError(t, err, "mock client creation should succeed")
 	assert.NotNil(t, client, "mock client should not be nil")
 }
+
+func TestFindTrigger(t *testing.T) {
+	start := time.Now()
+	ops := []storage.Operation{
+		{SequenceNumber: 1, Timestamp: start, OperationType: storage.OperationUpdate,
+			ResourceKind: "ConfigMap", UID: "uid-1", ResourceVersion: "5"},
+		{SequenceNumber: 2, Timestamp: start, OperationType: storage.OperationWatch,
+			EventType: storage.WatchEventModified, ResourceKind: "ConfigMap",
+			UID: "uid-1", ResourceVersion: "5"},
+		{SequenceNumber: 3, Timestamp: start.Add(time.Minute), OperationType: storage.OperationWatch,
+			EventType: storage.WatchEventModified, ResourceKind: "ConfigMap",
+			UID: "uid-1", ResourceVersion: "5"},
+	}
+
+	engine, err := NewReplayEngine(Config{Operations: ops, SessionID: "session-1"})
+	require.NoError(t, err)
+
+	trigger, err := engine.FindTrigger(storage.ReconcileSpan{
+		StartTime:              start.Add(time.Second),
+		TriggerUID:             "uid-1",
+		TriggerResourceVersion: "5",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), trigger.SequenceNumber)
+
+	_, err = engine.FindTrigger(storage.ReconcileSpan{TriggerUID: "uid-1", TriggerResourceVersion: "6"})
+	assert.Error(t, err)
+
+	stats, err := engine.CalculateStats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.WatchEvents)
+}
+
+func TestKubeEventsInTimeline(t *testing.T) {
+	ops := []storage.Operation{
+		{SequenceNumber: 1, OperationType: storage.OperationUpdate, ResourceKind: "Deployment",
+			Name: "web", ResourceData: `{"kind":"Deployment"}`},
+		{SequenceNumber: 2, OperationType: storage.OperationEvent, ResourceKind: "Deployment",
+			Name: "web", EventType: storage.EventTypeWarning, EventReason: "FailedCreate",
+			ResourceData: `{"kind":"Event"}`},
+		{SequenceNumber: 3, OperationType: storage.OperationEvent, ResourceKind: "Pod",
+			Name: "web-0", EventType: storage.EventTypeNormal, EventReason: "Pulled",
+			ResourceData: `{"kind":"Event"}`},
+	}
+
+	engine, err := NewReplayEngine(Config{Operations: ops, SessionID: "session-1", MaxCacheSize: 100})
+	require.NoError(t, err)
+
+	for i := 0; i < len(ops); i++ {
+		op, stepErr := engine.StepForward()
+		require.NoError(t, stepErr)
+		assert.Equal(t, int64(i+1), op.SequenceNumber, "events replay in recorded order")
+	}
+
+	_, err = engine.GetCachedObject("Pod", "", "web-0")
+	assert.Error(t, err, "an event's payload is not the involved object's state")
+
+	stats, err := engine.CalculateStats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.KubeEvents)
+	assert.Equal(t, 1, stats.WarningEvents)
+}
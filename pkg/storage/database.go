@@ -13,6 +13,7 @@ const (
 	maxDatabasePathLength = 4096
 	defaultMaxOperations  = 1000000
 	maxQueryResults       = 10000
+	maxBatchOperations    = 10000
 )
 
 // NewDatabase creates and initializes a database connection.
@@ -134,8 +135,14 @@ func prepareInsertStatement(db *sql.DB) (*sql.Stmt, error) {
 	query := `INSERT INTO operations 
 		(session_id, sequence_number, timestamp, operation_type, 
 		 resource_kind, namespace, name, resource_data, error, duration_ms,
-		 actor_id, uid, resource_version, generation, verb)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		 actor_id, uid, resource_version, generation, verb,
+		 api_group, api_version, resource, patch_type, patch_data,
+		 field_manager, force, label_selector, field_selector, list_limit,
+		 list_continue, list_items, event_type, replica_id, lamport,
+		 request_data, prior_data, error_code, error_reason, error_causes,
+		 retry_after_seconds, subresource, span_id, event_reason, event_message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+		        ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	stmt, err := db.Prepare(query)
 	if err != nil {
@@ -151,12 +158,9 @@ func prepareQueryStatement(db *sql.DB) (*sql.Stmt, error) {
 		return nil, err
 	}
 
-	query := `SELECT id, session_id, sequence_number, timestamp, 
-		operation_type, resource_kind, namespace, name, 
-		resource_data, error, duration_ms, actor_id, uid, resource_version,
-		generation, verb
-		FROM operations WHERE session_id = ? 
-		ORDER BY sequence_number LIMIT ?`
+	query := `SELECT ` + operationColumns + `
+		FROM operations WHERE session_id = ?
+		` + operationOrder + ` LIMIT ?`
 
 	stmt, err := db.Prepare(query)
 	if err != nil {
@@ -172,12 +176,15 @@ func prepareSessionStatement(db *sql.DB) (*sql.Stmt, error) {
 		return nil, err
 	}
 
-	query := `SELECT DISTINCT session_id, 
+	query := `SELECT session_id,
 		MIN(timestamp) as start_time,
-		COUNT(*) as op_count
-		FROM operations 
-		GROUP BY session_id 
-		ORDER BY start_time DESC 
+		MAX(timestamp) as end_time,
+		COUNT(*) as op_count,
+		SUM(CASE WHEN length(error) > 0 THEN 1 ELSE 0 END) as error_count,
+		GROUP_CONCAT(DISTINCT actor_id) as actors
+		FROM operations
+		GROUP BY session_id
+		ORDER BY start_time DESC
 		LIMIT ?`
 
 	stmt, err := db.Prepare(query)
@@ -281,14 +288,74 @@ func (d *Database) InsertOperation(op *Operation) error {
 		return err
 	}
 
+	return execInsert(d.insertStmt, op)
+}
+
+// InsertOperations stores a batch of operations in a single transaction.
+// Either every operation is stored or none is.
+// Rule 2: Bounded by maxBatchOperations.
+func (d *Database) InsertOperations(ops []*Operation) error {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(ops), 1, maxBatchOperations, "batch size")
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin batch: %w", err)
+	}
+
+	stmt := tx.Stmt(d.insertStmt)
+	for i := 0; i < len(ops); i++ {
+		err = execInsert(stmt, ops[i])
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				return fmt.Errorf("batch insert failed: %w, rollback failed: %v", err, rollbackErr)
+			}
+			return fmt.Errorf("batch insert failed: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	return nil
+}
+
+// execInsert validates op and runs the insert statement for it.
+// Rule 4: Function under 60 lines.
+func execInsert(stmt *sql.Stmt, op *Operation) error {
+	err := assert.AssertNotNil(stmt, "insert statement")
+	if err != nil {
+		return err
+	}
+
 	err = ValidateOperation(op)
 	if err != nil {
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
+	listItems, err := encodeListItems(op.ListItems)
+	if err != nil {
+		return err
+	}
+
+	errorCauses, err := encodeErrorCauses(op.ErrorCauses)
+	if err != nil {
+		return err
+	}
+
 	timestampUnix := op.Timestamp.Unix()
 
-	_, err = d.insertStmt.Exec(
+	_, err = stmt.Exec(
 		op.SessionID,
 		op.SequenceNumber,
 		timestampUnix,
@@ -304,6 +371,31 @@ func (d *Database) InsertOperation(op *Operation) error {
 		op.ResourceVersion,
 		op.Generation,
 		op.Verb,
+		op.APIGroup,
+		op.APIVersion,
+		op.Resource,
+		op.PatchType,
+		op.PatchData,
+		op.FieldManager,
+		op.Force,
+		op.LabelSelector,
+		op.FieldSelector,
+		op.Limit,
+		op.Continue,
+		listItems,
+		op.EventType,
+		op.ReplicaID,
+		op.Lamport,
+		op.RequestData,
+		op.PriorData,
+		op.ErrorCode,
+		op.ErrorReason,
+		errorCauses,
+		op.RetryAfterSeconds,
+		op.Subresource,
+		op.SpanID,
+		op.EventReason,
+		op.EventMessage,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert operation: %w", err)
@@ -394,73 +486,11 @@ func (d *Database) QueryOperations(sessionID string) ([]Operation, error) {
 	defer func() {
 		closeErr := rows.Close()
 		if closeErr != nil {
-			err = closeErr
+			fmt.Printf("Warning: failed to close rows: %v\n", closeErr)
 		}
 	}()
 
-	operations := make([]Operation, 0, maxQueryResults)
-	count := 0
-
-	for count < maxQueryResults && rows.Next() {
-		var op Operation
-		var timestampUnix int64
-		var opType string
-		var actorID sql.NullString
-		var uid sql.NullString
-		var resourceVersion sql.NullString
-		var generation sql.NullInt64
-		var verb sql.NullString
-
-		err = rows.Scan(
-			&op.ID,
-			&op.SessionID,
-			&op.SequenceNumber,
-			&timestampUnix,
-			&opType,
-			&op.ResourceKind,
-			&op.Namespace,
-			&op.Name,
-			&op.ResourceData,
-			&op.Error,
-			&op.DurationMs,
-			&actorID,
-			&uid,
-			&resourceVersion,
-			&generation,
-			&verb,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
-		}
-
-		op.Timestamp = time.Unix(timestampUnix, 0)
-		op.OperationType = OperationType(opType)
-		if actorID.Valid {
-			op.ActorID = actorID.String
-		}
-		if uid.Valid {
-			op.UID = uid.String
-		}
-		if resourceVersion.Valid {
-			op.ResourceVersion = resourceVersion.String
-		}
-		if generation.Valid {
-			op.Generation = generation.Int64
-		}
-		if verb.Valid {
-			op.Verb = verb.String
-		}
-
-		operations = append(operations, op)
-		count = count + 1
-	}
-
-	err = rows.Err()
-	if err != nil {
-		return nil, fmt.Errorf("row iteration failed: %w", err)
-	}
-
-	return operations, nil
+	return scanOperations(rows)
 }
 
 // InsertReconcileSpan inserts a reconcile span record.
@@ -137,6 +137,26 @@ func TestValidateOperation(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "watch event",
+			op: &Operation{
+				SessionID:     "session-1",
+				OperationType: OperationWatch,
+				ResourceKind:  "Pod",
+				EventType:     WatchEventBookmark,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown watch event type",
+			op: &Operation{
+				SessionID:     "session-1",
+				OperationType: OperationWatch,
+				ResourceKind:  "Pod",
+				EventType:     "RESYNC",
+			},
+			wantErr: true,
+		},
 	}
 
 	maxTests := len(tests)
@@ -9,43 +9,80 @@ import (
 )
 
 // OperationStore defines the interface for storing and retrieving operations.
+// The recorder, reconciletrace and every kubestep command use it, so each
+// backend supports the same features.
 type OperationStore interface {
 	InsertOperation(op *Operation) error
+	// InsertOperations stores a batch atomically where the backend allows.
+	InsertOperations(ops []*Operation) error
 	QueryOperations(sessionID string) ([]Operation, error)
 	QueryOperationsByRange(sessionID string, start, end int64) ([]Operation, error)
-	ListSessions() ([]SessionInfo, error)
-	InsertReconcileSpan(span *ReconcileSpan) error
-	EndReconcileSpan(spanID string, endTime time.Time, durationMs int64, errMsg string) error
-	QueryReconcileSpans(sessionID string) ([]ReconcileSpan, error)
+	// MaxLamport returns the highest logical clock stored for a session.
+	MaxLamport(sessionID string) (int64, error)
+	SessionStore
+	ReconcileSpanStore
 	Close() error
 }
 
 // ReconcileSpanStore defines the interface for storing reconcile spans.
+// Every OperationStore is one; reconciletrace needs only this subset.
 type ReconcileSpanStore interface {
 	InsertReconcileSpan(span *ReconcileSpan) error
 	EndReconcileSpan(spanID string, endTime time.Time, durationMs int64, errMsg string) error
 	QueryReconcileSpans(sessionID string) ([]ReconcileSpan, error)
 }
 
-// SessionInfo holds basic session metadata.
+var (
+	_ OperationStore = (*Database)(nil)
+	_ OperationStore = (*MongoStore)(nil)
+	_ OperationStore = (*SegmentStore)(nil)
+	_ OperationStore = (*MemoryStore)(nil)
+)
+
+// SessionInfo summarizes one session. Times span its recorded operations,
+// or come from Meta for a session with none yet.
 type SessionInfo struct {
-	SessionID   string
-	StartTime   int64
-	EndTime     int64
-	OpCount     int64
+	SessionID string
+	StartTime int64
+	EndTime   int64
+	OpCount   int64
+	SpanCount int64
+	// ErrorCount counts operations that returned an error.
+	ErrorCount int64
+	// Actors lists the distinct actors that recorded operations, sorted.
+	Actors      []string
 	Description string
+	// Meta is the stored session metadata, nil when the session has none.
+	Meta *Session
 }
 
 // StorageConfig holds configuration for storage backends.
 type StorageConfig struct {
-	Type           string // "sqlite" or "mongodb"
+	Type           string // StorageSQLite, StorageMongoDB or StorageSegment
 	ConnectionURI  string
 	DatabaseName   string
 	CollectionName string
 	MaxOperations  int
 	Context        context.Context
+	// ReadOnly opens a segment directory for queries only, without taking
+	// the writer lock or repairing torn writes. Other backends ignore it.
+	ReadOnly bool
 }
 
+// QueryLimit is the most rows one query of any backend returns. Longer
+// sessions are read in sequence number ranges with QueryOperationsByRange.
+const QueryLimit = maxQueryResults
+
+// Storage backend names accepted by NewOperationStore.
+const (
+	StorageSQLite  = "sqlite"
+	StorageMongoDB = "mongodb"
+	// StorageSegment stores each session as append-only segment files
+	// under the ConnectionURI directory. StorageFile is an alias.
+	StorageSegment = "segment"
+	StorageFile    = "file"
+)
+
 // NewOperationStore creates a new storage implementation based on config.
 // Multiple assertions for validation.
 func NewOperationStore(cfg StorageConfig) (OperationStore, error) {
@@ -55,10 +92,12 @@ func NewOperationStore(cfg StorageConfig) (OperationStore, error) {
 	}
 
 	switch cfg.Type {
-	case "sqlite":
+	case StorageSQLite:
 		return NewSQLiteStore(cfg)
-	case "mongodb":
+	case StorageMongoDB:
 		return NewMongoStore(cfg)
+	case StorageSegment, StorageFile:
+		return NewSegmentStore(cfg)
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Type)
 	}
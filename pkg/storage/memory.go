@@ -0,0 +1,652 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+// MemoryStore implements OperationStore in memory, for tests and for
+// programs that embed the recorder without a database. It applies the
+// validation rules of the other stores and, like them, leaves the number of
+// operations to the recorder's maximum sequence. It is safe for concurrent
+// use.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	nextID       int64
+	operations   map[string][]Operation
+	spans        map[string][]ReconcileSpan
+	spanSessions map[string]string
+	sessions     map[string]*memorySession
+	closed       bool
+}
+
+// memorySession is the stored metadata of a session with the time it last
+// changed.
+type memorySession struct {
+	meta      Session
+	updatedAt time.Time
+}
+
+// MemorySnapshot is a copy of the contents of a MemoryStore. Operations
+// keep the order they were inserted in.
+type MemorySnapshot struct {
+	Operations []Operation
+	Spans      []ReconcileSpan
+	// Sessions holds session metadata together with the recorder counters.
+	Sessions []Session
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		operations:   make(map[string][]Operation, 4),
+		spans:        make(map[string][]ReconcileSpan, 4),
+		spanSessions: make(map[string]string, 64),
+		sessions:     make(map[string]*memorySession, 4),
+	}
+}
+
+// checkOpen returns an error once the store is closed. Callers hold m.mu.
+func (m *MemoryStore) checkOpen() error {
+	err := assert.AssertNotNil(m, "memory store")
+	if err != nil {
+		return err
+	}
+	if m.closed {
+		return fmt.Errorf("memory store is closed")
+	}
+	return nil
+}
+
+// InsertOperation stores a copy of op.
+func (m *MemoryStore) InsertOperation(op *Operation) error {
+	return m.InsertOperations([]*Operation{op})
+}
+
+// InsertOperations stores copies of a batch. Every operation is validated
+// first, so an invalid one stores nothing.
+// Rule 2: Bounded by maxBatchOperations.
+func (m *MemoryStore) InsertOperations(ops []*Operation) error {
+	err := assert.AssertInRange(len(ops), 1, maxBatchOperations, "batch size")
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ops); i++ {
+		err = assert.AssertNotNil(ops[i], "operation")
+		if err != nil {
+			return err
+		}
+
+		err = ValidateOperation(ops[i])
+		if err != nil {
+			return fmt.Errorf("invalid operation: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ops); i++ {
+		m.nextID = m.nextID + 1
+		stored := cloneOperation(ops[i])
+		stored.ID = m.nextID
+		m.operations[stored.SessionID] = append(m.operations[stored.SessionID], stored)
+	}
+
+	return nil
+}
+
+// QueryOperations retrieves the operations of a session in recording
+// order.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MemoryStore) QueryOperations(sessionID string) ([]Operation, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.selectOperations(sessionID, func(op *Operation) bool { return true }), nil
+}
+
+// QueryOperationsByRange retrieves operations within sequence range.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MemoryStore) QueryOperationsByRange(
+	sessionID string,
+	start, end int64,
+) ([]Operation, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(int(start), 0, int(end), "start sequence")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.selectOperations(sessionID, func(op *Operation) bool {
+		return op.SequenceNumber >= start && op.SequenceNumber <= end
+	}), nil
+}
+
+// selectOperations copies the operations of a session that keep accepts,
+// sorted with SortOperations. Callers hold m.mu.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MemoryStore) selectOperations(sessionID string, keep func(op *Operation) bool) []Operation {
+	stored := m.operations[sessionID]
+	ops := make([]Operation, 0, len(stored))
+	for i := 0; i < len(stored); i++ {
+		if keep(&stored[i]) {
+			ops = append(ops, cloneOperation(&stored[i]))
+		}
+	}
+
+	SortOperations(ops)
+	if len(ops) > maxQueryResults {
+		ops = ops[:maxQueryResults]
+	}
+	return ops
+}
+
+// MaxLamport returns the highest logical clock stored for a session.
+// Operations without a clock count with their sequence number.
+func (m *MemoryStore) MaxLamport(sessionID string) (int64, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return 0, err
+	}
+
+	var maxClock int64
+	stored := m.operations[sessionID]
+	for i := 0; i < len(stored); i++ {
+		if clock := orderKey(&stored[i]); clock > maxClock {
+			maxClock = clock
+		}
+	}
+	return maxClock, nil
+}
+
+// InsertReconcileSpan stores a copy of span. Span IDs are unique across
+// sessions.
+func (m *MemoryStore) InsertReconcileSpan(span *ReconcileSpan) error {
+	err := ValidateReconcileSpan(span)
+	if err != nil {
+		return fmt.Errorf("invalid span: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := m.spanSessions[span.ID]; exists {
+		return fmt.Errorf("failed to insert reconcile span: span %s already exists", span.ID)
+	}
+
+	m.spans[span.SessionID] = append(m.spans[span.SessionID], *span)
+	m.spanSessions[span.ID] = span.SessionID
+	return nil
+}
+
+// EndReconcileSpan records the end time and error of a span. Ending an
+// unknown span does nothing, as in the other stores.
+// Rule 2: Bounded by the spans of the span's session.
+func (m *MemoryStore) EndReconcileSpan(
+	spanID string,
+	endTime time.Time,
+	durationMs int64,
+	errMsg string,
+) error {
+	err := assert.AssertStringNotEmpty(spanID, "span ID")
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	spans := m.spans[m.spanSessions[spanID]]
+	for i := 0; i < len(spans); i++ {
+		if spans[i].ID == spanID {
+			spans[i].EndTime = endTime
+			spans[i].DurationMs = durationMs
+			spans[i].Error = errMsg
+			return nil
+		}
+	}
+	return nil
+}
+
+// QueryReconcileSpans retrieves the spans of a session by start time.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MemoryStore) QueryReconcileSpans(sessionID string) ([]ReconcileSpan, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	spans := make([]ReconcileSpan, len(m.spans[sessionID]))
+	copy(spans, m.spans[sessionID])
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+	if len(spans) > maxQueryResults {
+		spans = spans[:maxQueryResults]
+	}
+	return spans, nil
+}
+
+// ListSessions returns every session with recorded operations or stored
+// metadata, newest first.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MemoryStore) ListSessions() ([]SessionInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err := m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, 0, len(m.operations))
+	for sessionID, ops := range m.operations {
+		if len(infos) >= maxQueryResults {
+			break
+		}
+		infos = append(infos, summarizeSession(sessionID, ops, int64(len(m.spans[sessionID]))))
+	}
+
+	stored := make([]*memorySession, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		stored = append(stored, session)
+	}
+	sort.SliceStable(stored, func(i, j int) bool {
+		return stored[i].updatedAt.After(stored[j].updatedAt)
+	})
+
+	metas := make([]Session, 0, len(stored))
+	for i := 0; i < len(stored) && i < maxQueryResults; i++ {
+		metas = append(metas, cloneSession(&stored[i].meta))
+	}
+
+	return mergeSessionMetadata(infos, metas), nil
+}
+
+// summarizeSession computes the SessionInfo of a session's operations.
+// Rule 2: Bounded by the operations of the session.
+func summarizeSession(sessionID string, ops []Operation, spanCount int64) SessionInfo {
+	info := SessionInfo{SessionID: sessionID, OpCount: int64(len(ops)), SpanCount: spanCount}
+	actors := make([]string, 0, 4)
+	for i := 0; i < len(ops); i++ {
+		ts := ops[i].Timestamp.Unix()
+		if i == 0 || ts < info.StartTime {
+			info.StartTime = ts
+		}
+		if i == 0 || ts > info.EndTime {
+			info.EndTime = ts
+		}
+		if len(ops[i].Error) > 0 {
+			info.ErrorCount = info.ErrorCount + 1
+		}
+		actors = append(actors, ops[i].ActorID)
+	}
+	info.Actors = sessionActors(actors)
+	return info
+}
+
+// BeginSession stores session metadata and marks the session running. A
+// session begun again keeps its earliest start time and its counters.
+func (m *MemoryStore) BeginSession(meta *Session) error {
+	err := ValidateSession(meta)
+	if err != nil {
+		return fmt.Errorf("invalid session: %w", err)
+	}
+
+	start := meta.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	return m.updateSession(meta.ID, true, func(stored *Session) {
+		next := cloneSession(meta)
+		next.Status = SessionRunning
+		next.StartTime = start
+		if !stored.StartTime.IsZero() && stored.StartTime.Before(start) {
+			next.StartTime = stored.StartTime
+		}
+		next.EndTime = time.Time{}
+		next.DroppedOperations = stored.DroppedOperations
+		next.FilteredOperations = stored.FilteredOperations
+		next.Redaction = stored.Redaction
+		*stored = next
+	})
+}
+
+// EndSession records the final status and end time of a begun session.
+func (m *MemoryStore) EndSession(sessionID string, status SessionStatus) error {
+	err := ValidateEndStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return m.updateSession(sessionID, false, func(stored *Session) {
+		stored.Status = status
+		stored.EndTime = time.Now()
+	})
+}
+
+// GetSession returns the stored metadata of a session.
+func (m *MemoryStore) GetSession(sessionID string) (*Session, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	meta := cloneSession(&session.meta)
+	return &meta, nil
+}
+
+// AddDroppedOperations adds count to the number of operations the recorder
+// dropped for a session.
+func (m *MemoryStore) AddDroppedOperations(sessionID string, count int64) error {
+	err := assert.Assert(count >= 0, "dropped count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	return m.updateSession(sessionID, true, func(stored *Session) {
+		stored.DroppedOperations = stored.DroppedOperations + count
+	})
+}
+
+// AddFilteredOperations adds count to the number of operations recording
+// filters left out of a session.
+func (m *MemoryStore) AddFilteredOperations(sessionID string, count int64) error {
+	err := assert.Assert(count >= 0, "filtered count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	return m.updateSession(sessionID, true, func(stored *Session) {
+		stored.FilteredOperations = stored.FilteredOperations + count
+	})
+}
+
+// SetSessionRedaction records the redaction rules applied to a session's
+// payloads, replacing any stored before.
+func (m *MemoryStore) SetSessionRedaction(sessionID string, rules []string) error {
+	err := assert.AssertInRange(len(rules), 0, maxRedactionRules, "redaction rules")
+	if err != nil {
+		return err
+	}
+
+	redaction := append([]string(nil), rules...)
+	return m.updateSession(sessionID, true, func(stored *Session) {
+		stored.Redaction = redaction
+	})
+}
+
+// GetSessionStats returns the recorder counters for a session. A session
+// without stored counters returns zero values.
+func (m *MemoryStore) GetSessionStats(sessionID string) (*SessionStats, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &SessionStats{SessionID: sessionID}
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return stats, nil
+	}
+
+	stats.DroppedOperations = session.meta.DroppedOperations
+	stats.FilteredOperations = session.meta.FilteredOperations
+	stats.Redaction = append([]string(nil), session.meta.Redaction...)
+	stats.UpdatedAt = session.updatedAt
+	return stats, nil
+}
+
+// updateSession applies update to the metadata of a session. A missing
+// session is created when create is set and is ErrSessionNotFound
+// otherwise.
+func (m *MemoryStore) updateSession(sessionID string, create bool, update func(stored *Session)) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		if !create {
+			return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+		}
+		session = &memorySession{meta: Session{ID: sessionID}}
+		m.sessions[sessionID] = session
+	}
+
+	update(&session.meta)
+	session.updatedAt = time.Now()
+	return nil
+}
+
+// Snapshot returns a copy of everything the store holds, ordered by
+// session ID.
+// Rule 2: Bounded by the stored operations, spans and sessions.
+func (m *MemoryStore) Snapshot() (*MemorySnapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	err := m.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(m.operations)+len(m.sessions))
+	for id := range m.operations {
+		seen[id] = true
+	}
+	for id := range m.spans {
+		seen[id] = true
+	}
+	for id := range m.sessions {
+		seen[id] = true
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	snapshot := &MemorySnapshot{
+		Operations: make([]Operation, 0, 64),
+		Spans:      make([]ReconcileSpan, 0, 16),
+		Sessions:   make([]Session, 0, len(m.sessions)),
+	}
+	for i := 0; i < len(ids); i++ {
+		ops := m.operations[ids[i]]
+		for j := 0; j < len(ops); j++ {
+			snapshot.Operations = append(snapshot.Operations, cloneOperation(&ops[j]))
+		}
+		snapshot.Spans = append(snapshot.Spans, m.spans[ids[i]]...)
+		if session, ok := m.sessions[ids[i]]; ok {
+			snapshot.Sessions = append(snapshot.Sessions, cloneSession(&session.meta))
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Restore replaces the contents of the store with a snapshot. The snapshot
+// is validated first, so an invalid one leaves the store unchanged.
+// Operation IDs are assigned again.
+// Rule 2: Bounded by the snapshot contents.
+func (m *MemoryStore) Restore(snapshot *MemorySnapshot) error {
+	err := assert.AssertNotNil(snapshot, "snapshot")
+	if err != nil {
+		return err
+	}
+
+	restored := NewMemoryStore()
+
+	for i := 0; i < len(snapshot.Operations); i++ {
+		err = restored.InsertOperation(&snapshot.Operations[i])
+		if err != nil {
+			return fmt.Errorf("failed to restore operation %d: %w", i, err)
+		}
+	}
+
+	for i := 0; i < len(snapshot.Spans); i++ {
+		err = restored.InsertReconcileSpan(&snapshot.Spans[i])
+		if err != nil {
+			return fmt.Errorf("failed to restore span %d: %w", i, err)
+		}
+	}
+
+	now := time.Now()
+	for i := 0; i < len(snapshot.Sessions); i++ {
+		meta := &snapshot.Sessions[i]
+		err = ValidateSession(meta)
+		if err != nil {
+			return fmt.Errorf("failed to restore session %d: %w", i, err)
+		}
+		restored.sessions[meta.ID] = &memorySession{meta: cloneSession(meta), updatedAt: now}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	m.nextID = restored.nextID
+	m.operations = restored.operations
+	m.spans = restored.spans
+	m.spanSessions = restored.spanSessions
+	m.sessions = restored.sessions
+	return nil
+}
+
+// Close releases the stored data. Later calls return an error.
+func (m *MemoryStore) Close() error {
+	err := assert.AssertNotNil(m, "memory store")
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.operations = nil
+	m.spans = nil
+	m.spanSessions = nil
+	m.sessions = nil
+	return nil
+}
+
+// cloneOperation copies op, including the slices it refers to.
+func cloneOperation(op *Operation) Operation {
+	clone := *op
+	clone.ListItems = append([]ListItem(nil), op.ListItems...)
+	clone.ErrorCauses = append([]ErrorCause(nil), op.ErrorCauses...)
+	if op.Force != nil {
+		forced := *op.Force
+		clone.Force = &forced
+	}
+	return clone
+}
+
+// cloneSession copies meta, including its labels and redaction rules.
+func cloneSession(meta *Session) Session {
+	clone := *meta
+	if meta.Labels != nil {
+		clone.Labels = make(map[string]string, len(meta.Labels))
+		for key, value := range meta.Labels {
+			clone.Labels[key] = value
+		}
+	}
+	clone.Redaction = append([]string(nil), meta.Redaction...)
+	return clone
+}
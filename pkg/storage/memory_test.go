@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreOperationsAndSessions(t *testing.T) {
+	store := NewMemoryStore()
+
+	require.NoError(t, store.BeginSession(&Session{ID: "session-1", OperatorName: "widget-operator"}))
+	failed := segmentTestOp("session-1", 2)
+	failed.Error = "conflict"
+	failed.ListItems = []ListItem{{UID: "uid-1"}}
+	require.NoError(t, store.InsertOperations([]*Operation{failed, segmentTestOp("session-1", 1)}))
+	require.NoError(t, store.InsertOperation(segmentTestOp("other", 1)))
+
+	invalid := segmentTestOp("session-1", 3)
+	invalid.ResourceKind = ""
+	require.Error(t, store.InsertOperations([]*Operation{segmentTestOp("session-1", 4), invalid}))
+
+	failed.ListItems[0].UID = "changed by caller"
+	ops, err := store.QueryOperations("session-1")
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, int64(1), ops[0].SequenceNumber)
+	assert.Equal(t, "uid-1", ops[1].ListItems[0].UID)
+	ops[1].ListItems[0].UID = "changed by reader"
+
+	ops, err = store.QueryOperationsByRange("session-1", 2, 2)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "uid-1", ops[0].ListItems[0].UID)
+
+	clock, err := store.MaxLamport("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), clock)
+
+	span := &ReconcileSpan{
+		ID:        "span-1",
+		SessionID: "session-1",
+		ActorID:   "controller-a",
+		StartTime: time.Unix(1700000001, 0),
+		Kind:      "Widget",
+	}
+	require.NoError(t, store.InsertReconcileSpan(span))
+	require.Error(t, store.InsertReconcileSpan(span))
+	require.Error(t, store.InsertReconcileSpan(&ReconcileSpan{ID: "span-2", SessionID: "session-1"}))
+	require.NoError(t, store.EndReconcileSpan("span-1", time.Unix(1700000002, 0), 1000, "boom"))
+	spans, err := store.QueryReconcileSpans("session-1")
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.Equal(t, "boom", spans[0].Error)
+
+	require.NoError(t, store.AddDroppedOperations("session-1", 3))
+	require.NoError(t, store.EndSession("session-1", SessionFailed))
+	require.ErrorIs(t, store.EndSession("other", SessionCompleted), ErrSessionNotFound)
+
+	session, err := store.GetSession("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, SessionFailed, session.Status)
+	assert.Equal(t, int64(3), session.DroppedOperations)
+
+	sessions, err := store.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, info := range sessions {
+		if info.SessionID == "session-1" {
+			assert.Equal(t, int64(2), info.OpCount)
+			assert.Equal(t, int64(1), info.ErrorCount)
+			assert.Equal(t, int64(1), info.SpanCount)
+			assert.Equal(t, "widget-operator", info.Meta.OperatorName)
+		}
+	}
+
+	result, err := VerifyStore(store)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+
+	require.NoError(t, store.Close())
+	_, err = store.QueryOperations("session-1")
+	require.Error(t, err)
+}
+
+func TestMemoryStoreLimits(t *testing.T) {
+	// Like the other stores, the store does not cap operations per session.
+	store := NewMemoryStore()
+	require.NoError(t, store.InsertOperation(segmentTestOp("full", 1)))
+	require.NoError(t, store.InsertOperations([]*Operation{segmentTestOp("full", 2), segmentTestOp("full", 3)}))
+	ops, err := store.QueryOperations("full")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	require.Error(t, store.InsertOperations([]*Operation{segmentTestOp("full", 4), {SessionID: "full"}}))
+
+	_, err = store.QueryOperationsByRange("full", 3, 2)
+	require.Error(t, err)
+	require.Error(t, store.SetSessionRedaction("full", make([]string, maxRedactionRules+1)))
+}
+
+func TestMemoryStoreConcurrentWriters(t *testing.T) {
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(replica string) {
+			defer wg.Done()
+			for seq := int64(1); seq <= 50; seq++ {
+				op := segmentTestOp("shared", seq)
+				op.ReplicaID = replica
+				assert.NoError(t, store.InsertOperation(op))
+				_, err := store.ListSessions()
+				assert.NoError(t, err)
+			}
+		}(fmt.Sprintf("replica-%d", w))
+	}
+	wg.Wait()
+
+	ops, err := store.QueryOperations("shared")
+	require.NoError(t, err)
+	assert.Len(t, ops, 200)
+}
+
+func TestMemoryStoreSnapshotRestore(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.BeginSession(&Session{ID: "s", Labels: map[string]string{"env": "test"}}))
+	require.NoError(t, store.InsertOperation(segmentTestOp("s", 1)))
+	require.NoError(t, store.InsertReconcileSpan(&ReconcileSpan{
+		ID:        "span-1",
+		SessionID: "s",
+		ActorID:   "controller-a",
+		StartTime: time.Unix(1700000001, 0),
+		Kind:      "Widget",
+	}))
+	require.NoError(t, store.SetSessionRedaction("s", []string{"secrets"}))
+
+	snapshot, err := store.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Operations, 1)
+	require.Len(t, snapshot.Spans, 1)
+	require.Len(t, snapshot.Sessions, 1)
+	snapshot.Sessions[0].Labels["env"] = "changed"
+
+	require.NoError(t, store.InsertOperation(segmentTestOp("s", 2)))
+	require.NoError(t, store.InsertOperation(segmentTestOp("later", 1)))
+
+	snapshot.Sessions[0].Labels["env"] = "test"
+	require.NoError(t, store.Restore(snapshot))
+
+	ops, err := store.QueryOperations("s")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	ops, err = store.QueryOperations("later")
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+
+	session, err := store.GetSession("s")
+	require.NoError(t, err)
+	assert.Equal(t, SessionRunning, session.Status)
+	assert.Equal(t, []string{"secrets"}, session.Redaction)
+	assert.Equal(t, "test", session.Labels["env"])
+
+	bad := &MemorySnapshot{Operations: []Operation{{SessionID: "x"}}}
+	require.Error(t, store.Restore(bad))
+	ops, err = store.QueryOperations("s")
+	require.NoError(t, err)
+	require.Len(t, ops, 1, "a failed restore leaves the store unchanged")
+}
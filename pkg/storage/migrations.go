@@ -5,6 +5,10 @@ import (
 	"fmt"
 )
 
+const (
+	maxMigrationColumns = 64
+)
+
 // applySQLiteMigrations ensures newer columns and indexes exist on SQLite databases.
 func applySQLiteMigrations(db *sql.DB) error {
 	err := ensureOperationsColumns(db)
@@ -17,6 +21,11 @@ func applySQLiteMigrations(db *sql.DB) error {
 		return err
 	}
 
+	err = migrateSessionStats(db)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -27,18 +36,43 @@ func ensureOperationsColumns(db *sql.DB) error {
 	}
 
 	required := map[string]string{
-		"actor_id":         "ALTER TABLE operations ADD COLUMN actor_id TEXT",
-		"uid":              "ALTER TABLE operations ADD COLUMN uid TEXT",
-		"resource_version": "ALTER TABLE operations ADD COLUMN resource_version TEXT",
-		"generation":       "ALTER TABLE operations ADD COLUMN generation INTEGER",
-		"verb":             "ALTER TABLE operations ADD COLUMN verb TEXT",
+		"actor_id":            "ALTER TABLE operations ADD COLUMN actor_id TEXT",
+		"uid":                 "ALTER TABLE operations ADD COLUMN uid TEXT",
+		"resource_version":    "ALTER TABLE operations ADD COLUMN resource_version TEXT",
+		"generation":          "ALTER TABLE operations ADD COLUMN generation INTEGER",
+		"verb":                "ALTER TABLE operations ADD COLUMN verb TEXT",
+		"api_group":           "ALTER TABLE operations ADD COLUMN api_group TEXT",
+		"api_version":         "ALTER TABLE operations ADD COLUMN api_version TEXT",
+		"resource":            "ALTER TABLE operations ADD COLUMN resource TEXT",
+		"patch_type":          "ALTER TABLE operations ADD COLUMN patch_type TEXT",
+		"patch_data":          "ALTER TABLE operations ADD COLUMN patch_data TEXT",
+		"field_manager":       "ALTER TABLE operations ADD COLUMN field_manager TEXT",
+		"force":               "ALTER TABLE operations ADD COLUMN force INTEGER",
+		"label_selector":      "ALTER TABLE operations ADD COLUMN label_selector TEXT",
+		"field_selector":      "ALTER TABLE operations ADD COLUMN field_selector TEXT",
+		"list_limit":          "ALTER TABLE operations ADD COLUMN list_limit INTEGER",
+		"list_continue":       "ALTER TABLE operations ADD COLUMN list_continue TEXT",
+		"list_items":          "ALTER TABLE operations ADD COLUMN list_items TEXT",
+		"event_type":          "ALTER TABLE operations ADD COLUMN event_type TEXT",
+		"replica_id":          "ALTER TABLE operations ADD COLUMN replica_id TEXT",
+		"lamport":             "ALTER TABLE operations ADD COLUMN lamport INTEGER",
+		"request_data":        "ALTER TABLE operations ADD COLUMN request_data TEXT",
+		"prior_data":          "ALTER TABLE operations ADD COLUMN prior_data TEXT",
+		"error_code":          "ALTER TABLE operations ADD COLUMN error_code INTEGER",
+		"error_reason":        "ALTER TABLE operations ADD COLUMN error_reason TEXT",
+		"error_causes":        "ALTER TABLE operations ADD COLUMN error_causes TEXT",
+		"retry_after_seconds": "ALTER TABLE operations ADD COLUMN retry_after_seconds INTEGER",
+		"subresource":         "ALTER TABLE operations ADD COLUMN subresource TEXT",
+		"span_id":             "ALTER TABLE operations ADD COLUMN span_id TEXT",
+		"event_reason":        "ALTER TABLE operations ADD COLUMN event_reason TEXT",
+		"event_message":       "ALTER TABLE operations ADD COLUMN event_message TEXT",
 	}
 
 	keys := make([]string, 0, len(required))
 	count := 0
 	maxKeys := len(required)
-	if maxKeys > 20 {
-		maxKeys = 20
+	if maxKeys > maxMigrationColumns {
+		maxKeys = maxMigrationColumns
 	}
 	for name := range required {
 		if count >= maxKeys {
@@ -63,6 +97,60 @@ func ensureOperationsColumns(db *sql.DB) error {
 	return nil
 }
 
+// migrateSessionStats copies the counters of databases written before the
+// sessions table existed. The session_stats table is left in place for older
+// readers; rows already in sessions are not overwritten.
+func migrateSessionStats(db *sql.DB) error {
+	tables, err := loadSQLiteTables(db)
+	if err != nil {
+		return err
+	}
+	if !tables["session_stats"] {
+		return nil
+	}
+
+	err = ensureSessionStatsColumns(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT OR IGNORE INTO sessions
+		(session_id, dropped_operations, filtered_operations, redaction, updated_ts)
+		SELECT session_id, dropped_operations, filtered_operations, redaction, updated_ts
+		FROM session_stats`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate session stats: %w", err)
+	}
+
+	return nil
+}
+
+func ensureSessionStatsColumns(db *sql.DB) error {
+	columns, err := loadSQLiteColumns(db, "session_stats")
+	if err != nil {
+		return err
+	}
+
+	// Rule 2: Fixed list of columns, in the order they were introduced.
+	required := [][2]string{
+		{"redaction", "ALTER TABLE session_stats ADD COLUMN redaction TEXT"},
+		{"filtered_operations", "ALTER TABLE session_stats ADD COLUMN filtered_operations INTEGER NOT NULL DEFAULT 0"},
+	}
+
+	for i := 0; i < len(required); i++ {
+		name := required[i][0]
+		if columns[name] {
+			continue
+		}
+		_, err = db.Exec(required[i][1])
+		if err != nil {
+			return fmt.Errorf("failed to add column %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
 func ensureOperationsIndexes(db *sql.DB) error {
 	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_uid_rv
 ON operations(uid, resource_version);`)
@@ -70,6 +158,12 @@ ON operations(uid, resource_version);`)
 		return fmt.Errorf("failed to create idx_uid_rv: %w", err)
 	}
 
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_session_lamport
+ON operations(session_id, lamport);`)
+	if err != nil {
+		return fmt.Errorf("failed to create idx_session_lamport: %w", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createLegacyOperationsTable(t *testing.T, path string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE operations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		sequence_number INTEGER NOT NULL,
+		timestamp INTEGER NOT NULL,
+		operation_type TEXT NOT NULL,
+		resource_kind TEXT NOT NULL,
+		namespace TEXT,
+		name TEXT,
+		resource_data TEXT,
+		error TEXT,
+		duration_ms INTEGER NOT NULL
+	)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO operations
+		(session_id, sequence_number, timestamp, operation_type, resource_kind,
+		 namespace, name, resource_data, error, duration_ms)
+		VALUES ('legacy', 1, 0, 'GET', 'Pod', 'default', 'demo', '{}', '', 3)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
+
+func TestMigrationAddsPatchColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	createLegacyOperationsTable(t, path)
+
+	db, err := NewDatabase(path, testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	legacy, err := db.QueryOperations("legacy")
+	require.NoError(t, err)
+	require.Len(t, legacy, 1)
+	assert.Empty(t, legacy[0].PatchType)
+	assert.Nil(t, legacy[0].Force)
+
+	forced := true
+	op := &Operation{
+		SessionID:      "patched",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  OperationPatch,
+		ResourceKind:   "Deployment",
+		Namespace:      "default",
+		Name:           "web",
+		ResourceData:   `{"kind":"Deployment"}`,
+		DurationMs:     4,
+		Verb:           "patch",
+		PatchType:      "application/apply-patch+yaml",
+		PatchData:      `{"spec":{"replicas":3}}`,
+		FieldManager:   "web-controller",
+		Force:          &forced,
+	}
+	require.NoError(t, db.InsertOperation(op))
+
+	ops, err := db.QueryOperations("patched")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, op.PatchType, ops[0].PatchType)
+	assert.Equal(t, op.PatchData, ops[0].PatchData)
+	assert.Equal(t, op.FieldManager, ops[0].FieldManager)
+	assert.Equal(t, &forced, ops[0].Force)
+
+	result, err := VerifySQLite(path, true)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+}
+
+func TestSQLiteStorePatchRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	createLegacyOperationsTable(t, path)
+
+	store, err := NewSQLiteStore(StorageConfig{
+		Type:          "sqlite",
+		ConnectionURI: path,
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	op := &Operation{
+		SessionID:      "patched",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  OperationPatch,
+		ResourceKind:   "ConfigMap",
+		DurationMs:     2,
+		PatchType:      "application/merge-patch+json",
+		PatchData:      `{"data":{"mode":"on"}}`,
+		Force:          new(bool),
+	}
+	require.NoError(t, store.InsertOperation(op))
+
+	list := &Operation{
+		SessionID:       "patched",
+		SequenceNumber:  2,
+		Timestamp:       time.Now(),
+		OperationType:   OperationList,
+		ResourceKind:    "ConfigMap",
+		DurationMs:      1,
+		ResourceVersion: "40",
+		LabelSelector:   "app=demo",
+		FieldSelector:   "status.phase=Running",
+		Limit:           100,
+		Continue:        "token-1",
+		ListItems: []ListItem{
+			{UID: "uid-1", ResourceVersion: "12", Namespace: "default", Name: "a"},
+			{UID: "uid-2", ResourceVersion: "39", Namespace: "default", Name: "b"},
+		},
+	}
+	require.NoError(t, store.InsertOperation(list))
+
+	all, err := store.QueryOperations("patched")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Empty(t, all[0].ListItems)
+	assert.Equal(t, list.LabelSelector, all[1].LabelSelector)
+	assert.Equal(t, list.FieldSelector, all[1].FieldSelector)
+	assert.Equal(t, list.Limit, all[1].Limit)
+	assert.Equal(t, list.Continue, all[1].Continue)
+	assert.Equal(t, list.ListItems, all[1].ListItems)
+
+	event := &Operation{
+		SessionID:       "patched",
+		SequenceNumber:  3,
+		Timestamp:       time.Now(),
+		OperationType:   OperationWatch,
+		ResourceKind:    "ConfigMap",
+		UID:             "uid-1",
+		ResourceVersion: "41",
+		EventType:       WatchEventModified,
+	}
+	require.NoError(t, store.InsertOperation(event))
+
+	events, err := store.QueryOperationsByRange("patched", 3, 3)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, WatchEventModified, events[0].EventType)
+
+	ops, err := store.QueryOperationsByRange("patched", 1, 1)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, op.PatchType, ops[0].PatchType)
+	assert.Equal(t, op.PatchData, ops[0].PatchData)
+	assert.Empty(t, ops[0].FieldManager)
+	require.NotNil(t, ops[0].Force, "force=false is kept apart from force not sent")
+	assert.False(t, *ops[0].Force)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,32 +14,58 @@ import (
 
 // MongoStore implements OperationStore using MongoDB.
 type MongoStore struct {
-	client         *mongo.Client
-	database       *mongo.Database
-	collection     *mongo.Collection
-	spanCollection *mongo.Collection
-	maxOperations  int
-	ctx            context.Context
+	client             *mongo.Client
+	database           *mongo.Database
+	collection         *mongo.Collection
+	spanCollection     *mongo.Collection
+	sessionsCollection *mongo.Collection
+	maxOperations      int
+	ctx                context.Context
 }
 
 // MongoOperation represents an operation document in MongoDB.
 type MongoOperation struct {
-	ID              string    `bson:"_id,omitempty"`
-	SessionID       string    `bson:"session_id"`
-	SequenceNumber  int64     `bson:"sequence_number"`
-	Timestamp       time.Time `bson:"timestamp"`
-	OperationType   string    `bson:"operation_type"`
-	ResourceKind    string    `bson:"resource_kind"`
-	Namespace       string    `bson:"namespace,omitempty"`
-	Name            string    `bson:"name,omitempty"`
-	ResourceData    string    `bson:"resource_data,omitempty"`
-	Error           string    `bson:"error,omitempty"`
-	DurationMs      int64     `bson:"duration_ms"`
-	ActorID         string    `bson:"actor_id,omitempty"`
-	UID             string    `bson:"uid,omitempty"`
-	ResourceVersion string    `bson:"resource_version,omitempty"`
-	Generation      int64     `bson:"generation,omitempty"`
-	Verb            string    `bson:"verb,omitempty"`
+	ID                string       `bson:"_id,omitempty"`
+	SessionID         string       `bson:"session_id"`
+	SequenceNumber    int64        `bson:"sequence_number"`
+	Timestamp         time.Time    `bson:"timestamp"`
+	OperationType     string       `bson:"operation_type"`
+	ResourceKind      string       `bson:"resource_kind"`
+	Namespace         string       `bson:"namespace,omitempty"`
+	Name              string       `bson:"name,omitempty"`
+	ResourceData      string       `bson:"resource_data,omitempty"`
+	Error             string       `bson:"error,omitempty"`
+	DurationMs        int64        `bson:"duration_ms"`
+	ActorID           string       `bson:"actor_id,omitempty"`
+	UID               string       `bson:"uid,omitempty"`
+	ResourceVersion   string       `bson:"resource_version,omitempty"`
+	Generation        int64        `bson:"generation,omitempty"`
+	Verb              string       `bson:"verb,omitempty"`
+	APIGroup          string       `bson:"api_group,omitempty"`
+	APIVersion        string       `bson:"api_version,omitempty"`
+	Resource          string       `bson:"resource,omitempty"`
+	PatchType         string       `bson:"patch_type,omitempty"`
+	PatchData         string       `bson:"patch_data,omitempty"`
+	FieldManager      string       `bson:"field_manager,omitempty"`
+	Force             *bool        `bson:"force,omitempty"`
+	LabelSelector     string       `bson:"label_selector,omitempty"`
+	FieldSelector     string       `bson:"field_selector,omitempty"`
+	Limit             int64        `bson:"list_limit,omitempty"`
+	Continue          string       `bson:"list_continue,omitempty"`
+	ListItems         []ListItem   `bson:"list_items,omitempty"`
+	EventType         string       `bson:"event_type,omitempty"`
+	ReplicaID         string       `bson:"replica_id,omitempty"`
+	Lamport           int64        `bson:"lamport,omitempty"`
+	RequestData       string       `bson:"request_data,omitempty"`
+	PriorData         string       `bson:"prior_data,omitempty"`
+	ErrorCode         int32        `bson:"error_code,omitempty"`
+	ErrorReason       string       `bson:"error_reason,omitempty"`
+	ErrorCauses       []ErrorCause `bson:"error_causes,omitempty"`
+	RetryAfterSeconds int32        `bson:"retry_after_seconds,omitempty"`
+	Subresource       string       `bson:"subresource,omitempty"`
+	SpanID            string       `bson:"span_id,omitempty"`
+	EventReason       string       `bson:"event_reason,omitempty"`
+	EventMessage      string       `bson:"event_message,omitempty"`
 }
 
 // MongoReconcileSpan represents a reconcile span document in MongoDB.
@@ -84,14 +111,16 @@ func NewMongoStore(cfg StorageConfig) (*MongoStore, error) {
 	database := client.Database(cfg.DatabaseName)
 	collection := database.Collection(cfg.CollectionName)
 	spanCollection := database.Collection("reconcile_spans")
+	sessionsCollection := database.Collection("sessions")
 
 	store := &MongoStore{
-		client:         client,
-		database:       database,
-		collection:     collection,
-		spanCollection: spanCollection,
-		maxOperations:  cfg.MaxOperations,
-		ctx:            ctx,
+		client:             client,
+		database:           database,
+		collection:         collection,
+		spanCollection:     spanCollection,
+		sessionsCollection: sessionsCollection,
+		maxOperations:      cfg.MaxOperations,
+		ctx:                ctx,
 	}
 
 	err = store.createIndexes()
@@ -104,6 +133,16 @@ func NewMongoStore(cfg StorageConfig) (*MongoStore, error) {
 		return nil, err
 	}
 
+	err = store.migrateSessionStats()
+	if err != nil {
+		closeErr := client.Disconnect(ctx)
+		if closeErr != nil {
+			return nil, fmt.Errorf("session migration failed: %w, disconnect failed: %v",
+				err, closeErr)
+		}
+		return nil, err
+	}
+
 	return store, nil
 }
 
@@ -119,32 +158,464 @@ func (m *MongoStore) InsertOperation(op *Operation) error {
 		return fmt.Errorf("invalid operation: %w", err)
 	}
 
-	mongoOp := MongoOperation{
-		SessionID:       op.SessionID,
-		SequenceNumber:  op.SequenceNumber,
-		Timestamp:       op.Timestamp,
-		OperationType:   string(op.OperationType),
-		ResourceKind:    op.ResourceKind,
-		Namespace:       op.Namespace,
-		Name:            op.Name,
-		ResourceData:    op.ResourceData,
-		Error:           op.Error,
-		DurationMs:      op.DurationMs,
-		ActorID:         op.ActorID,
-		UID:             op.UID,
-		ResourceVersion: op.ResourceVersion,
-		Generation:      op.Generation,
-		Verb:            op.Verb,
+	_, err = m.collection.InsertOne(m.ctx, toMongoOperation(op))
+	if err != nil {
+		return fmt.Errorf("failed to insert operation: %w", err)
 	}
 
-	_, err = m.collection.InsertOne(m.ctx, mongoOp)
+	return nil
+}
+
+// InsertOperations stores a batch with one ordered insert. Every operation is
+// validated first, so an invalid one stores nothing.
+// Rule 2: Bounded by maxBatchOperations.
+func (m *MongoStore) InsertOperations(ops []*Operation) error {
+	err := assert.AssertInRange(len(ops), 1, maxBatchOperations, "batch size")
 	if err != nil {
-		return fmt.Errorf("failed to insert operation: %w", err)
+		return err
+	}
+
+	docs := make([]interface{}, 0, len(ops))
+	for i := 0; i < len(ops); i++ {
+		err = assert.AssertNotNil(ops[i], "operation")
+		if err != nil {
+			return err
+		}
+
+		err = ValidateOperation(ops[i])
+		if err != nil {
+			return fmt.Errorf("invalid operation: %w", err)
+		}
+		docs = append(docs, toMongoOperation(ops[i]))
+	}
+
+	_, err = m.collection.InsertMany(m.ctx, docs)
+	if err != nil {
+		return fmt.Errorf("batch insert failed: %w", err)
+	}
+
+	return nil
+}
+
+// MaxLamport returns the highest logical clock stored for a session.
+// Operations without a clock count with their sequence number.
+func (m *MongoStore) MaxLamport(sessionID string) (int64, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return 0, err
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"session_id": sessionID}},
+		{
+			"$group": bson.M{
+				"_id": nil,
+				"clock": bson.M{"$max": bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{"$lamport", 0}},
+					"$lamport",
+					"$sequence_number",
+				}}},
+			},
+		},
+	}
+
+	cursor, err := m.collection.Aggregate(m.ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query logical clock: %w", err)
+	}
+	defer func() {
+		closeErr := cursor.Close(m.ctx)
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close cursor: %v\n", closeErr)
+		}
+	}()
+
+	if !cursor.Next(m.ctx) {
+		return 0, cursor.Err()
+	}
+
+	var result struct {
+		Clock int64 `bson:"clock"`
+	}
+	err = cursor.Decode(&result)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode logical clock: %w", err)
+	}
+
+	return result.Clock, nil
+}
+
+// AddDroppedOperations adds count to the number of operations the recorder
+// dropped for a session.
+func (m *MongoStore) AddDroppedOperations(sessionID string, count int64) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(count >= 0, "dropped count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"dropped_operations": count},
+		"$set": bson.M{"updated_ts": time.Now()},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	_, err = m.sessionsCollection.UpdateByID(m.ctx, sessionID, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update session stats: %w", err)
+	}
+
+	return nil
+}
+
+// AddFilteredOperations adds count to the number of operations recording
+// filters left out of a session.
+func (m *MongoStore) AddFilteredOperations(sessionID string, count int64) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(count >= 0, "filtered count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"filtered_operations": count},
+		"$set": bson.M{"updated_ts": time.Now()},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	_, err = m.sessionsCollection.UpdateByID(m.ctx, sessionID, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update session stats: %w", err)
+	}
+
+	return nil
+}
+
+// SetSessionRedaction records the redaction rules applied to a session's
+// payloads, replacing any stored before.
+func (m *MongoStore) SetSessionRedaction(sessionID string, rules []string) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(rules), 0, maxRedactionRules, "redaction rules")
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{"redaction": rules, "updated_ts": time.Now()},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	_, err = m.sessionsCollection.UpdateByID(m.ctx, sessionID, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to store redaction rules: %w", err)
+	}
+
+	return nil
+}
+
+// GetSessionStats returns the recorder counters for a session. A session
+// without stored counters returns zero values.
+func (m *MongoStore) GetSessionStats(sessionID string) (*SessionStats, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		DroppedOperations  int64     `bson:"dropped_operations"`
+		FilteredOperations int64     `bson:"filtered_operations"`
+		Redaction          []string  `bson:"redaction"`
+		UpdatedAt          time.Time `bson:"updated_ts"`
+	}
+	err = m.sessionsCollection.FindOne(m.ctx, bson.M{"_id": sessionID}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &SessionStats{SessionID: sessionID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session stats: %w", err)
+	}
+
+	return &SessionStats{
+		SessionID:          sessionID,
+		DroppedOperations:  doc.DroppedOperations,
+		FilteredOperations: doc.FilteredOperations,
+		Redaction:          doc.Redaction,
+		UpdatedAt:          doc.UpdatedAt,
+	}, nil
+}
+
+// MongoSession represents a session document in MongoDB. Counters are
+// updated in place by the recorder.
+type MongoSession struct {
+	ID                 string            `bson:"_id"`
+	Description        string            `bson:"description,omitempty"`
+	Labels             map[string]string `bson:"labels,omitempty"`
+	OperatorName       string            `bson:"operator_name,omitempty"`
+	OperatorVersion    string            `bson:"operator_version,omitempty"`
+	GitSHA             string            `bson:"git_sha,omitempty"`
+	ClusterName        string            `bson:"cluster_name,omitempty"`
+	KubernetesVersion  string            `bson:"kubernetes_version,omitempty"`
+	RecorderConfig     string            `bson:"recorder_config,omitempty"`
+	Status             string            `bson:"status,omitempty"`
+	StartTime          *time.Time        `bson:"start_ts,omitempty"`
+	EndTime            *time.Time        `bson:"end_ts,omitempty"`
+	DroppedOperations  int64             `bson:"dropped_operations"`
+	FilteredOperations int64             `bson:"filtered_operations"`
+	Redaction          []string          `bson:"redaction,omitempty"`
+	UpdatedAt          time.Time         `bson:"updated_ts"`
+}
+
+// BeginSession stores session metadata and marks the session running. A
+// session begun again keeps its earliest start time and its counters.
+func (m *MongoStore) BeginSession(meta *Session) error {
+	err := ValidateSession(meta)
+	if err != nil {
+		return fmt.Errorf("invalid session: %w", err)
+	}
+
+	start := meta.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"description":        meta.Description,
+			"labels":             meta.Labels,
+			"operator_name":      meta.OperatorName,
+			"operator_version":   meta.OperatorVersion,
+			"git_sha":            meta.GitSHA,
+			"cluster_name":       meta.ClusterName,
+			"kubernetes_version": meta.KubernetesVersion,
+			"recorder_config":    meta.RecorderConfig,
+			"status":             string(SessionRunning),
+			"updated_ts":         time.Now(),
+		},
+		"$min":   bson.M{"start_ts": start},
+		"$unset": bson.M{"end_ts": ""},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	_, err = m.sessionsCollection.UpdateByID(m.ctx, meta.ID, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+
+	return nil
+}
+
+// EndSession records the final status and end time of a begun session.
+func (m *MongoStore) EndSession(sessionID string, status SessionStatus) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return err
+	}
+
+	err = ValidateEndStatus(status)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"status": string(status), "end_ts": now, "updated_ts": now},
+	}
+
+	result, err := m.sessionsCollection.UpdateByID(m.ctx, sessionID, update)
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
 	}
 
 	return nil
 }
 
+// GetSession returns the stored metadata of a session.
+func (m *MongoStore) GetSession(sessionID string) (*Session, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	var doc MongoSession
+	err = m.sessionsCollection.FindOne(m.ctx, bson.M{"_id": sessionID}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+
+	meta := fromMongoSession(doc)
+	return &meta, nil
+}
+
+// listSessionMetadata reads stored session metadata, newest first.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MongoStore) listSessionMetadata() ([]Session, error) {
+	opts := options.Find().
+		SetSort(bson.M{"updated_ts": -1}).
+		SetLimit(int64(maxQueryResults))
+
+	cursor, err := m.sessionsCollection.Find(m.ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("session metadata query failed: %w", err)
+	}
+	defer func() {
+		closeErr := cursor.Close(m.ctx)
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close cursor: %v\n", closeErr)
+		}
+	}()
+
+	metas := make([]Session, 0, 100)
+	for len(metas) < maxQueryResults && cursor.Next(m.ctx) {
+		var doc MongoSession
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return nil, fmt.Errorf("session decode failed: %w", err)
+		}
+		metas = append(metas, fromMongoSession(doc))
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		return nil, fmt.Errorf("session cursor failed: %w", err)
+	}
+
+	return metas, nil
+}
+
+// migrateSessionStats copies the counters of databases written before the
+// sessions collection existed. The session_stats collection is left in
+// place; sessions already stored are not overwritten.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MongoStore) migrateSessionStats() error {
+	legacy := m.database.Collection("session_stats")
+	opts := options.Find().SetLimit(int64(maxQueryResults))
+
+	cursor, err := legacy.Find(m.ctx, bson.M{}, opts)
+	if err != nil {
+		return fmt.Errorf("session stats query failed: %w", err)
+	}
+	defer func() {
+		closeErr := cursor.Close(m.ctx)
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close cursor: %v\n", closeErr)
+		}
+	}()
+
+	upsert := options.Update().SetUpsert(true)
+	count := 0
+	for count < maxQueryResults && cursor.Next(m.ctx) {
+		var doc MongoSession
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return fmt.Errorf("session stats decode failed: %w", err)
+		}
+
+		update := bson.M{"$setOnInsert": bson.M{
+			"dropped_operations":  doc.DroppedOperations,
+			"filtered_operations": doc.FilteredOperations,
+			"redaction":           doc.Redaction,
+			"updated_ts":          doc.UpdatedAt,
+		}}
+		_, err = m.sessionsCollection.UpdateByID(m.ctx, doc.ID, update, upsert)
+		if err != nil {
+			return fmt.Errorf("failed to migrate session stats: %w", err)
+		}
+		count = count + 1
+	}
+
+	return cursor.Err()
+}
+
+// fromMongoSession converts a session document to its metadata.
+func fromMongoSession(doc MongoSession) Session {
+	meta := Session{
+		ID:                 doc.ID,
+		Description:        doc.Description,
+		Labels:             doc.Labels,
+		OperatorName:       doc.OperatorName,
+		OperatorVersion:    doc.OperatorVersion,
+		GitSHA:             doc.GitSHA,
+		ClusterName:        doc.ClusterName,
+		KubernetesVersion:  doc.KubernetesVersion,
+		RecorderConfig:     doc.RecorderConfig,
+		Status:             SessionStatus(doc.Status),
+		DroppedOperations:  doc.DroppedOperations,
+		FilteredOperations: doc.FilteredOperations,
+		Redaction:          doc.Redaction,
+	}
+	if doc.StartTime != nil {
+		meta.StartTime = *doc.StartTime
+	}
+	if doc.EndTime != nil {
+		meta.EndTime = *doc.EndTime
+	}
+	return meta
+}
+
+// toMongoOperation converts an operation to its document form.
+func toMongoOperation(op *Operation) MongoOperation {
+	return MongoOperation{
+		SessionID:         op.SessionID,
+		SequenceNumber:    op.SequenceNumber,
+		Timestamp:         op.Timestamp,
+		OperationType:     string(op.OperationType),
+		ResourceKind:      op.ResourceKind,
+		Namespace:         op.Namespace,
+		Name:              op.Name,
+		ResourceData:      op.ResourceData,
+		Error:             op.Error,
+		DurationMs:        op.DurationMs,
+		ActorID:           op.ActorID,
+		UID:               op.UID,
+		ResourceVersion:   op.ResourceVersion,
+		Generation:        op.Generation,
+		Verb:              op.Verb,
+		APIGroup:          op.APIGroup,
+		APIVersion:        op.APIVersion,
+		Resource:          op.Resource,
+		PatchType:         op.PatchType,
+		PatchData:         op.PatchData,
+		FieldManager:      op.FieldManager,
+		Force:             op.Force,
+		LabelSelector:     op.LabelSelector,
+		FieldSelector:     op.FieldSelector,
+		Limit:             op.Limit,
+		Continue:          op.Continue,
+		ListItems:         op.ListItems,
+		EventType:         op.EventType,
+		ReplicaID:         op.ReplicaID,
+		Lamport:           op.Lamport,
+		RequestData:       op.RequestData,
+		PriorData:         op.PriorData,
+		ErrorCode:         op.ErrorCode,
+		ErrorReason:       op.ErrorReason,
+		ErrorCauses:       op.ErrorCauses,
+		RetryAfterSeconds: op.RetryAfterSeconds,
+		Subresource:       op.Subresource,
+		SpanID:            op.SpanID,
+		EventReason:       op.EventReason,
+		EventMessage:      op.EventMessage,
+	}
+}
+
 // QueryOperations retrieves all operations for a session.
 func (m *MongoStore) QueryOperations(sessionID string) ([]Operation, error) {
 	err := assert.AssertStringNotEmpty(sessionID, "session ID")
@@ -168,7 +639,13 @@ func (m *MongoStore) QueryOperations(sessionID string) ([]Operation, error) {
 		}
 	}()
 
-	return m.scanOperations(cursor)
+	ops, err := m.scanOperations(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	SortOperations(ops)
+	return ops, nil
 }
 
 // InsertReconcileSpan inserts a reconcile span record.
@@ -347,10 +824,17 @@ func (m *MongoStore) QueryOperationsByRange(
 		}
 	}()
 
-	return m.scanOperations(cursor)
+	ops, err := m.scanOperations(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	SortOperations(ops)
+	return ops, nil
 }
 
-// ListSessions returns all available sessions.
+// ListSessions returns every session with recorded operations or stored
+// metadata, newest first.
 func (m *MongoStore) ListSessions() ([]SessionInfo, error) {
 	pipeline := []bson.M{
 		{
@@ -359,6 +843,10 @@ func (m *MongoStore) ListSessions() ([]SessionInfo, error) {
 				"start_time": bson.M{"$min": "$timestamp"},
 				"end_time":   bson.M{"$max": "$timestamp"},
 				"op_count":   bson.M{"$sum": 1},
+				"error_count": bson.M{"$sum": bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$error", ""}}, ""}}, 1, 0,
+				}}},
+				"actors": bson.M{"$addToSet": "$actor_id"},
 			},
 		},
 		{
@@ -386,10 +874,12 @@ func (m *MongoStore) ListSessions() ([]SessionInfo, error) {
 
 	for cursor.Next(m.ctx) && count < maxSessions {
 		var result struct {
-			ID        string    `bson:"_id"`
-			StartTime time.Time `bson:"start_time"`
-			EndTime   time.Time `bson:"end_time"`
-			OpCount   int64     `bson:"op_count"`
+			ID         string    `bson:"_id"`
+			StartTime  time.Time `bson:"start_time"`
+			EndTime    time.Time `bson:"end_time"`
+			OpCount    int64     `bson:"op_count"`
+			ErrorCount int64     `bson:"error_count"`
+			Actors     []string  `bson:"actors"`
 		}
 
 		err = cursor.Decode(&result)
@@ -398,17 +888,67 @@ func (m *MongoStore) ListSessions() ([]SessionInfo, error) {
 		}
 
 		session := SessionInfo{
-			SessionID: result.ID,
-			StartTime: result.StartTime.Unix(),
-			EndTime:   result.EndTime.Unix(),
-			OpCount:   result.OpCount,
+			SessionID:  result.ID,
+			StartTime:  result.StartTime.Unix(),
+			EndTime:    result.EndTime.Unix(),
+			OpCount:    result.OpCount,
+			ErrorCount: result.ErrorCount,
+			Actors:     sessionActors(result.Actors),
 		}
 
 		sessions = append(sessions, session)
 		count = count + 1
 	}
 
-	return sessions, nil
+	spans, err := m.countSessionSpans()
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].SpanCount = spans[sessions[i].SessionID]
+	}
+
+	metas, err := m.listSessionMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeSessionMetadata(sessions, metas), nil
+}
+
+// countSessionSpans returns the number of reconcile spans per session.
+// Rule 2: Bounded by maxQueryResults.
+func (m *MongoStore) countSessionSpans() (map[string]int64, error) {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$session_id", "count": bson.M{"$sum": 1}}},
+		{"$limit": maxQueryResults},
+	}
+
+	cursor, err := m.spanCollection.Aggregate(m.ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("span count query failed: %w", err)
+	}
+	defer func() {
+		closeErr := cursor.Close(m.ctx)
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close cursor: %v\n", closeErr)
+		}
+	}()
+
+	counts := make(map[string]int64, 100)
+	for len(counts) < maxQueryResults && cursor.Next(m.ctx) {
+		var result struct {
+			ID    string `bson:"_id"`
+			Count int64  `bson:"count"`
+		}
+		err = cursor.Decode(&result)
+		if err != nil {
+			return nil, fmt.Errorf("span count decode failed: %w", err)
+		}
+		counts[result.ID] = result.Count
+	}
+
+	return counts, cursor.Err()
 }
 
 // Close closes the MongoDB connection.
@@ -480,21 +1020,46 @@ func (m *MongoStore) scanOperations(cursor *mongo.Cursor) ([]Operation, error) {
 		}
 
 		op := Operation{
-			SessionID:       mongoOp.SessionID,
-			SequenceNumber:  mongoOp.SequenceNumber,
-			Timestamp:       mongoOp.Timestamp,
-			OperationType:   OperationType(mongoOp.OperationType),
-			ResourceKind:    mongoOp.ResourceKind,
-			Namespace:       mongoOp.Namespace,
-			Name:            mongoOp.Name,
-			ResourceData:    mongoOp.ResourceData,
-			Error:           mongoOp.Error,
-			DurationMs:      mongoOp.DurationMs,
-			ActorID:         mongoOp.ActorID,
-			UID:             mongoOp.UID,
-			ResourceVersion: mongoOp.ResourceVersion,
-			Generation:      mongoOp.Generation,
-			Verb:            mongoOp.Verb,
+			SessionID:         mongoOp.SessionID,
+			SequenceNumber:    mongoOp.SequenceNumber,
+			Timestamp:         mongoOp.Timestamp,
+			OperationType:     OperationType(mongoOp.OperationType),
+			ResourceKind:      mongoOp.ResourceKind,
+			Namespace:         mongoOp.Namespace,
+			Name:              mongoOp.Name,
+			ResourceData:      mongoOp.ResourceData,
+			Error:             mongoOp.Error,
+			DurationMs:        mongoOp.DurationMs,
+			ActorID:           mongoOp.ActorID,
+			UID:               mongoOp.UID,
+			ResourceVersion:   mongoOp.ResourceVersion,
+			Generation:        mongoOp.Generation,
+			Verb:              mongoOp.Verb,
+			APIGroup:          mongoOp.APIGroup,
+			APIVersion:        mongoOp.APIVersion,
+			Resource:          mongoOp.Resource,
+			PatchType:         mongoOp.PatchType,
+			PatchData:         mongoOp.PatchData,
+			FieldManager:      mongoOp.FieldManager,
+			Force:             mongoOp.Force,
+			LabelSelector:     mongoOp.LabelSelector,
+			FieldSelector:     mongoOp.FieldSelector,
+			Limit:             mongoOp.Limit,
+			Continue:          mongoOp.Continue,
+			ListItems:         mongoOp.ListItems,
+			EventType:         mongoOp.EventType,
+			ReplicaID:         mongoOp.ReplicaID,
+			Lamport:           mongoOp.Lamport,
+			RequestData:       mongoOp.RequestData,
+			PriorData:         mongoOp.PriorData,
+			ErrorCode:         mongoOp.ErrorCode,
+			ErrorReason:       mongoOp.ErrorReason,
+			ErrorCauses:       mongoOp.ErrorCauses,
+			RetryAfterSeconds: mongoOp.RetryAfterSeconds,
+			Subresource:       mongoOp.Subresource,
+			SpanID:            mongoOp.SpanID,
+			EventReason:       mongoOp.EventReason,
+			EventMessage:      mongoOp.EventMessage,
 		}
 
 		operations = append(operations, op)
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+// operationRecord is the JSON encoding of an operation shared by the
+// segment store, which frames one per record, and session bundles, which
+// carry one per line.
+type operationRecord struct {
+	ID                int64        `json:"id"`
+	SessionID         string       `json:"session_id"`
+	SequenceNumber    int64        `json:"sequence_number"`
+	Timestamp         time.Time    `json:"timestamp"`
+	OperationType     string       `json:"operation_type"`
+	ResourceKind      string       `json:"resource_kind"`
+	Namespace         string       `json:"namespace,omitempty"`
+	Name              string       `json:"name,omitempty"`
+	ResourceData      string       `json:"resource_data,omitempty"`
+	Error             string       `json:"error,omitempty"`
+	DurationMs        int64        `json:"duration_ms"`
+	ActorID           string       `json:"actor_id,omitempty"`
+	UID               string       `json:"uid,omitempty"`
+	ResourceVersion   string       `json:"resource_version,omitempty"`
+	Generation        int64        `json:"generation,omitempty"`
+	Verb              string       `json:"verb,omitempty"`
+	APIGroup          string       `json:"api_group,omitempty"`
+	APIVersion        string       `json:"api_version,omitempty"`
+	Resource          string       `json:"resource,omitempty"`
+	PatchType         string       `json:"patch_type,omitempty"`
+	PatchData         string       `json:"patch_data,omitempty"`
+	FieldManager      string       `json:"field_manager,omitempty"`
+	Force             *bool        `json:"force,omitempty"`
+	LabelSelector     string       `json:"label_selector,omitempty"`
+	FieldSelector     string       `json:"field_selector,omitempty"`
+	Limit             int64        `json:"list_limit,omitempty"`
+	Continue          string       `json:"list_continue,omitempty"`
+	ListItems         []ListItem   `json:"list_items,omitempty"`
+	EventType         string       `json:"event_type,omitempty"`
+	ReplicaID         string       `json:"replica_id,omitempty"`
+	Lamport           int64        `json:"lamport,omitempty"`
+	RequestData       string       `json:"request_data,omitempty"`
+	PriorData         string       `json:"prior_data,omitempty"`
+	ErrorCode         int32        `json:"error_code,omitempty"`
+	ErrorReason       string       `json:"error_reason,omitempty"`
+	ErrorCauses       []ErrorCause `json:"error_causes,omitempty"`
+	RetryAfterSeconds int32        `json:"retry_after_seconds,omitempty"`
+	Subresource       string       `json:"subresource,omitempty"`
+	SpanID            string       `json:"span_id,omitempty"`
+	EventReason       string       `json:"event_reason,omitempty"`
+	EventMessage      string       `json:"event_message,omitempty"`
+}
+
+// newOperationRecord converts an operation to its JSON record.
+func newOperationRecord(op *Operation) operationRecord {
+	return operationRecord{
+		ID:                op.ID,
+		SessionID:         op.SessionID,
+		SequenceNumber:    op.SequenceNumber,
+		Timestamp:         op.Timestamp,
+		OperationType:     string(op.OperationType),
+		ResourceKind:      op.ResourceKind,
+		Namespace:         op.Namespace,
+		Name:              op.Name,
+		ResourceData:      op.ResourceData,
+		Error:             op.Error,
+		DurationMs:        op.DurationMs,
+		ActorID:           op.ActorID,
+		UID:               op.UID,
+		ResourceVersion:   op.ResourceVersion,
+		Generation:        op.Generation,
+		Verb:              op.Verb,
+		APIGroup:          op.APIGroup,
+		APIVersion:        op.APIVersion,
+		Resource:          op.Resource,
+		PatchType:         op.PatchType,
+		PatchData:         op.PatchData,
+		FieldManager:      op.FieldManager,
+		Force:             op.Force,
+		LabelSelector:     op.LabelSelector,
+		FieldSelector:     op.FieldSelector,
+		Limit:             op.Limit,
+		Continue:          op.Continue,
+		ListItems:         op.ListItems,
+		EventType:         op.EventType,
+		ReplicaID:         op.ReplicaID,
+		Lamport:           op.Lamport,
+		RequestData:       op.RequestData,
+		PriorData:         op.PriorData,
+		ErrorCode:         op.ErrorCode,
+		ErrorReason:       op.ErrorReason,
+		ErrorCauses:       op.ErrorCauses,
+		RetryAfterSeconds: op.RetryAfterSeconds,
+		Subresource:       op.Subresource,
+		SpanID:            op.SpanID,
+		EventReason:       op.EventReason,
+		EventMessage:      op.EventMessage,
+	}
+}
+
+// MarshalOperation encodes op as its JSON record.
+func MarshalOperation(op *Operation) ([]byte, error) {
+	err := assert.AssertNotNil(op, "operation")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(newOperationRecord(op))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode operation: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalOperation decodes a record written by MarshalOperation. It does
+// not validate the operation.
+func UnmarshalOperation(data []byte) (Operation, error) {
+	return decodeOperationRecord(data)
+}
+
+// decodeOperationRecord parses one operation record.
+func decodeOperationRecord(payload []byte) (Operation, error) {
+	var rec operationRecord
+	err := json.Unmarshal(payload, &rec)
+	if err != nil {
+		return Operation{}, fmt.Errorf("corrupt operation record: %w", err)
+	}
+
+	return Operation{
+		ID:                rec.ID,
+		SessionID:         rec.SessionID,
+		SequenceNumber:    rec.SequenceNumber,
+		Timestamp:         rec.Timestamp,
+		OperationType:     OperationType(rec.OperationType),
+		ResourceKind:      rec.ResourceKind,
+		Namespace:         rec.Namespace,
+		Name:              rec.Name,
+		ResourceData:      rec.ResourceData,
+		Error:             rec.Error,
+		DurationMs:        rec.DurationMs,
+		ActorID:           rec.ActorID,
+		UID:               rec.UID,
+		ResourceVersion:   rec.ResourceVersion,
+		Generation:        rec.Generation,
+		Verb:              rec.Verb,
+		APIGroup:          rec.APIGroup,
+		APIVersion:        rec.APIVersion,
+		Resource:          rec.Resource,
+		PatchType:         rec.PatchType,
+		PatchData:         rec.PatchData,
+		FieldManager:      rec.FieldManager,
+		Force:             rec.Force,
+		LabelSelector:     rec.LabelSelector,
+		FieldSelector:     rec.FieldSelector,
+		Limit:             rec.Limit,
+		Continue:          rec.Continue,
+		ListItems:         rec.ListItems,
+		EventType:         rec.EventType,
+		ReplicaID:         rec.ReplicaID,
+		Lamport:           rec.Lamport,
+		RequestData:       rec.RequestData,
+		PriorData:         rec.PriorData,
+		ErrorCode:         rec.ErrorCode,
+		ErrorReason:       rec.ErrorReason,
+		ErrorCauses:       rec.ErrorCauses,
+		RetryAfterSeconds: rec.RetryAfterSeconds,
+		Subresource:       rec.Subresource,
+		SpanID:            rec.SpanID,
+		EventReason:       rec.EventReason,
+		EventMessage:      rec.EventMessage,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+// orderKey returns the logical clock of op, falling back to its sequence
+// number for operations recorded without one.
+func orderKey(op *Operation) int64 {
+	if op.Lamport > 0 {
+		return op.Lamport
+	}
+	return op.SequenceNumber
+}
+
+// OperationLess reports whether a was recorded before b. Operations are
+// ordered by logical clock, then replica, then per-replica sequence, so the
+// order is stable even when timestamps or clocks tie.
+func OperationLess(a, b *Operation) bool {
+	keyA := orderKey(a)
+	keyB := orderKey(b)
+	if keyA != keyB {
+		return keyA < keyB
+	}
+	if a.ReplicaID != b.ReplicaID {
+		return a.ReplicaID < b.ReplicaID
+	}
+	return a.SequenceNumber < b.SequenceNumber
+}
+
+// SortOperations orders ops in place using OperationLess.
+func SortOperations(ops []Operation) {
+	sort.SliceStable(ops, func(i, j int) bool {
+		return OperationLess(&ops[i], &ops[j])
+	})
+}
+
+// MaxLamport returns the highest logical clock stored for a session.
+// Recorders start their clock from it so replicas joining a session order
+// after what is already stored.
+func (d *Database) MaxLamport(sessionID string) (int64, error) {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return 0, err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return 0, err
+	}
+
+	var maxClock sql.NullInt64
+	err = d.db.QueryRow(`SELECT MAX(COALESCE(NULLIF(lamport, 0), sequence_number))
+		FROM operations WHERE session_id = ?`, sessionID).Scan(&maxClock)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query logical clock: %w", err)
+	}
+
+	if !maxClock.Valid {
+		return 0, nil
+	}
+	return maxClock.Int64, nil
+}
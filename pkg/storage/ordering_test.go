@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replicaOperation(replica string, seq int64, lamport int64) *Operation {
+	return &Operation{
+		SessionID:      "replica-session",
+		SequenceNumber: seq,
+		Timestamp:      time.Unix(1700000000, 0),
+		OperationType:  OperationGet,
+		ResourceKind:   "Pod",
+		Namespace:      "default",
+		Name:           "demo",
+		ResourceData:   `{}`,
+		ReplicaID:      replica,
+		Lamport:        lamport,
+	}
+}
+
+func TestSortOperationsIsStableOnTies(t *testing.T) {
+	ops := []Operation{
+		*replicaOperation("b", 2, 3),
+		*replicaOperation("a", 2, 3),
+		*replicaOperation("b", 1, 1),
+		*replicaOperation("a", 1, 2),
+		*replicaOperation("", 4, 0),
+	}
+
+	SortOperations(ops)
+
+	got := make([]string, 0, len(ops))
+	for i := range ops {
+		got = append(got, ops[i].ReplicaID)
+	}
+	assert.Equal(t, []string{"b", "a", "a", "b", ""}, got)
+}
+
+func TestReplicasStoreInLamportOrder(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db, err := NewDatabase(testDBPath, testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	clock, err := db.MaxLamport("replica-session")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), clock)
+
+	require.NoError(t, db.InsertOperation(replicaOperation("b", 1, 2)))
+	require.NoError(t, db.InsertOperation(replicaOperation("a", 1, 1)))
+	require.NoError(t, db.InsertOperation(replicaOperation("a", 2, 3)))
+	require.NoError(t, db.InsertOperation(replicaOperation("b", 2, 3)))
+
+	clock, err = db.MaxLamport("replica-session")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), clock)
+
+	ops, err := db.QueryOperations("replica-session")
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	order := make([]string, 0, len(ops))
+	for i := range ops {
+		order = append(order, ops[i].ReplicaID)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, order)
+	assert.Equal(t, int64(3), ops[3].Lamport)
+
+	result, err := VerifySQLite(testDBPath, true)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Empty(t, result.Warnings)
+}
@@ -0,0 +1,868 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+const (
+	segmentFormat      = "kubestep-segment 1\n"
+	segmentFormatFile  = "FORMAT"
+	segmentSessionsDir = "sessions"
+	segmentIDFile      = "SESSION"
+	segmentMetaFile    = "session.json"
+	segmentSummaryFile = "summary.json"
+	segmentLockFile    = "LOCK"
+	maxSegmentDirName  = 128
+	maxSegmentSessions = 100000
+)
+
+// SegmentStore implements OperationStore with append-only files in one
+// directory, so a recording can be copied or archived as is:
+//
+//	FORMAT
+//	LOCK                                held by the writing process
+//	sessions/<session>/SESSION          session ID
+//	sessions/<session>/session.json     metadata and recorder counters
+//	sessions/<session>/summary.json     listing as of the last close
+//	sessions/<session>/00000000.seg     operations, rolled at 64MB
+//	sessions/<session>/operations.idx   sparse sequence number index
+//	sessions/<session>/spans.log        reconcile span starts and ends
+//
+// Each record is a length, a CRC-32C checksum and the JSON operation.
+// Appends are not synced one by one; EndSession and Close sync them, and
+// opening a session truncates a record cut short by a crash. Sessions are
+// loaded on first use and keep files open only once written to, so
+// ListSessions reads session.json and summary.json and loads only the
+// sessions whose summary is missing or stale.
+//
+// One process writes a directory at a time: the store takes an exclusive
+// lock on LOCK, and a store that cannot take it, or is configured
+// ReadOnly, only reads. A reading store repairs nothing, since what looks
+// like a torn record may be a write still in progress; it ignores such a
+// record instead.
+type SegmentStore struct {
+	mu            sync.Mutex
+	root          string
+	maxOperations int
+	segmentBytes  int64
+	sessions      map[string]*segmentSession
+	// spanSessions maps the ID of every span of a loaded session to it.
+	spanSessions map[string]*segmentSession
+	closed       bool
+	// lock holds the writer lock; nil for a reading store.
+	lock *os.File
+	// readOnly is returned by every write of a reading store.
+	readOnly error
+}
+
+// NewSegmentStore opens the segment directory at cfg.ConnectionURI for
+// writing, creating it when missing. It opens the directory for reading
+// when cfg.ReadOnly is set or another process holds the writer lock.
+// Rule 5: Multiple assertions for validation.
+func NewSegmentStore(cfg StorageConfig) (*SegmentStore, error) {
+	err := assert.AssertStringNotEmpty(cfg.ConnectionURI, "segment directory")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(len(cfg.ConnectionURI), 1, maxDatabasePathLength, "path length")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertInRange(cfg.MaxOperations, 1, defaultMaxOperations, "max operations")
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SegmentStore{
+		root:          cfg.ConnectionURI,
+		maxOperations: cfg.MaxOperations,
+		segmentBytes:  maxSegmentBytes,
+		sessions:      make(map[string]*segmentSession, 16),
+		spanSessions:  make(map[string]*segmentSession, 256),
+	}
+
+	if cfg.ReadOnly {
+		store.readOnly = fmt.Errorf("segment directory %s is open read-only", store.root)
+	} else {
+		err = store.lockForWriting()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = checkSegmentFormat(store.root, store.readOnly == nil)
+	if err == nil {
+		err = store.discoverSessions()
+	}
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// lockForWriting creates the directory and takes the writer lock, leaving
+// the store reading when another process holds it.
+func (s *SegmentStore) lockForWriting() error {
+	err := os.MkdirAll(filepath.Join(s.root, segmentSessionsDir), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create segment directory: %w", err)
+	}
+
+	s.lock, err = lockSegmentDir(s.root)
+	if err != nil {
+		return err
+	}
+	if s.lock == nil {
+		s.readOnly = fmt.Errorf("segment directory %s is locked by another writer", s.root)
+	}
+	return nil
+}
+
+// checkSegmentFormat rejects a directory written in another format. A new
+// directory gets the format marker when write is set.
+func checkSegmentFormat(root string, write bool) error {
+	path := filepath.Join(root, segmentFormatFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !write {
+			return nil
+		}
+		return writeFileAtomic(path, []byte(segmentFormat))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read segment format: %w", err)
+	}
+	if string(data) != segmentFormat {
+		return fmt.Errorf("unsupported segment format in %s: %q", root, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// discoverSessions registers every session directory without loading it.
+// A directory without a SESSION file was left by a crash while it was being
+// created and holds no data.
+// Rule 2: Bounded by maxSegmentSessions.
+func (s *SegmentStore) discoverSessions() error {
+	dir := filepath.Join(s.root, segmentSessionsDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) && s.readOnly != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	for i := 0; i < len(entries) && i < maxSegmentSessions; i++ {
+		if !entries[i].IsDir() {
+			continue
+		}
+		sessionDir := filepath.Join(dir, entries[i].Name())
+		id, err := os.ReadFile(filepath.Join(sessionDir, segmentIDFile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read session ID: %w", err)
+		}
+		s.sessions[string(id)] = &segmentSession{id: string(id), dir: sessionDir}
+	}
+
+	return nil
+}
+
+// segmentDirName returns the directory name of a session: the escaped ID
+// when it is short enough, a hash of it otherwise. The hashed form starts
+// with "%x", which escaping never produces.
+func segmentDirName(sessionID string) string {
+	name := strings.ReplaceAll(url.PathEscape(sessionID), ".", "%2E")
+	if len(name) <= maxSegmentDirName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(sessionID))
+	return "%x" + hex.EncodeToString(sum[:16])
+}
+
+// session returns the loaded state of a session. A missing session is
+// created when create is set and returned as nil otherwise. Callers hold
+// s.mu.
+func (s *SegmentStore) session(sessionID string, create bool) (*segmentSession, error) {
+	if s.closed {
+		return nil, fmt.Errorf("segment store is closed")
+	}
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		err := assert.AssertInRange(len(s.sessions), 0, maxSegmentSessions-1, "session count")
+		if err != nil {
+			return nil, err
+		}
+
+		sess = &segmentSession{
+			id:  sessionID,
+			dir: filepath.Join(s.root, segmentSessionsDir, segmentDirName(sessionID)),
+		}
+		err = os.MkdirAll(sess.dir, 0o755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create session directory: %w", err)
+		}
+		err = writeFileAtomic(filepath.Join(sess.dir, segmentIDFile), []byte(sessionID))
+		if err != nil {
+			return nil, err
+		}
+		s.sessions[sessionID] = sess
+	}
+
+	if !sess.loaded {
+		err := sess.load(s.readOnly == nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open session %s: %w", sessionID, err)
+		}
+		for i := 0; i < len(sess.spans); i++ {
+			s.spanSessions[sess.spans[i].ID] = sess
+		}
+	}
+
+	return sess, nil
+}
+
+// loadAll loads every session. Callers hold s.mu.
+// Rule 2: Bounded by maxSegmentSessions.
+func (s *SegmentStore) loadAll() ([]*segmentSession, error) {
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	sessions := make([]*segmentSession, 0, len(ids))
+	for i := 0; i < len(ids) && i < maxSegmentSessions; i++ {
+		sess, err := s.session(ids[i], false)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// InsertOperation appends a single operation record.
+func (s *SegmentStore) InsertOperation(op *Operation) error {
+	return s.InsertOperations([]*Operation{op})
+}
+
+// InsertOperations appends a batch with one write per session. Every
+// operation is validated first, and a failed write is rolled back, so
+// either every operation is stored or none is.
+// Rule 2: Bounded by maxBatchOperations.
+func (s *SegmentStore) InsertOperations(ops []*Operation) error {
+	err := assert.AssertNotNil(s, "segment store")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(ops), 1, maxBatchOperations, "batch size")
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ops); i++ {
+		err = assert.AssertNotNil(ops[i], "operation")
+		if err != nil {
+			return err
+		}
+
+		err = ValidateOperation(ops[i])
+		if err != nil {
+			return fmt.Errorf("invalid operation: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+
+	batches := make([]*segmentBatch, 0, 1)
+	bySession := make(map[string]*segmentBatch, 1)
+	for i := 0; i < len(ops); i++ {
+		batch, ok := bySession[ops[i].SessionID]
+		if !ok {
+			sess, err := s.session(ops[i].SessionID, true)
+			if err != nil {
+				return err
+			}
+			batch = &segmentBatch{sess: sess}
+			bySession[ops[i].SessionID] = batch
+			batches = append(batches, batch)
+		}
+
+		err = batch.add(ops[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(batches); i++ {
+		err = batches[i].write(s.segmentBytes)
+		if err != nil {
+			for j := 0; j < i; j++ {
+				_ = batches[j].rollback()
+			}
+			return err
+		}
+	}
+
+	for i := 0; i < len(batches); i++ {
+		err = batches[i].commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MaxLamport returns the highest logical clock stored for a session.
+// Operations without a clock count with their sequence number.
+func (s *SegmentStore) MaxLamport(sessionID string) (int64, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.session(sessionID, false)
+	if err != nil || sess == nil {
+		return 0, err
+	}
+
+	err = sess.ensureSummary()
+	if err != nil {
+		return 0, err
+	}
+	return sess.summary.maxClock, nil
+}
+
+// QueryOperations retrieves the operations of a session in recording
+// order.
+// Rule 2: Bounded by maxQueryResults.
+func (s *SegmentStore) QueryOperations(sessionID string) ([]Operation, error) {
+	return s.QueryOperationsByRange(sessionID, 0, math.MaxInt64)
+}
+
+// QueryOperationsByRange retrieves operations within sequence range,
+// reading only the segment blocks the sparse index places in it.
+// Rule 2: Bounded by maxQueryResults.
+func (s *SegmentStore) QueryOperationsByRange(
+	sessionID string,
+	start, end int64,
+) ([]Operation, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.Assert(start >= 0 && start <= end, "start sequence must be within range")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.session(sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return []Operation{}, nil
+	}
+
+	ops, err := sess.readOperations(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	SortOperations(ops)
+	if len(ops) > maxQueryResults {
+		ops = ops[:maxQueryResults]
+	}
+	return ops, nil
+}
+
+// InsertReconcileSpan appends a reconcile span record.
+func (s *SegmentStore) InsertReconcileSpan(span *ReconcileSpan) error {
+	err := assert.AssertNotNil(span, "reconcile span")
+	if err != nil {
+		return err
+	}
+
+	err = ValidateReconcileSpan(span)
+	if err != nil {
+		return fmt.Errorf("invalid span: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+
+	sess, err := s.session(span.SessionID, true)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := s.spanSessions[span.ID]; exists {
+		return fmt.Errorf("failed to insert reconcile span: span %s already exists", span.ID)
+	}
+
+	start := *span
+	err = sess.appendSpan(&segmentSpanRecord{Start: &start})
+	if err != nil {
+		return fmt.Errorf("failed to insert reconcile span: %w", err)
+	}
+
+	s.spanSessions[span.ID] = sess
+	return nil
+}
+
+// EndReconcileSpan records the end time and error of a span. Ending an
+// unknown span does nothing, as in the other stores.
+func (s *SegmentStore) EndReconcileSpan(
+	spanID string,
+	endTime time.Time,
+	durationMs int64,
+	errMsg string,
+) error {
+	err := assert.AssertStringNotEmpty(spanID, "span ID")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+
+	sess, ok := s.spanSessions[spanID]
+	if !ok {
+		_, err = s.loadAll()
+		if err != nil {
+			return err
+		}
+		sess, ok = s.spanSessions[spanID]
+		if !ok {
+			return nil
+		}
+	}
+
+	err = sess.appendSpan(&segmentSpanRecord{End: &segmentSpanEnd{
+		ID:         spanID,
+		EndTime:    endTime,
+		DurationMs: durationMs,
+		Error:      errMsg,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to update reconcile span: %w", err)
+	}
+
+	return nil
+}
+
+// QueryReconcileSpans retrieves the spans of a session by start time.
+// Rule 2: Bounded by maxQueryResults.
+func (s *SegmentStore) QueryReconcileSpans(sessionID string) ([]ReconcileSpan, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.session(sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return []ReconcileSpan{}, nil
+	}
+
+	spans := make([]ReconcileSpan, len(sess.spans))
+	copy(spans, sess.spans)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+	if len(spans) > maxQueryResults {
+		spans = spans[:maxQueryResults]
+	}
+	return spans, nil
+}
+
+// ListSessions returns every session with recorded operations or stored
+// metadata, newest first. Sessions that are not loaded are listed from
+// their summary.json when it is current.
+// Rule 2: Bounded by maxSegmentSessions.
+func (s *SegmentStore) ListSessions() ([]SessionInfo, error) {
+	err := assert.AssertNotNil(s, "segment store")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("segment store is closed")
+	}
+
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	infos := make([]SessionInfo, 0, len(ids))
+	metas := make([]Session, 0, len(ids))
+	updated := make([]time.Time, 0, len(ids))
+	for i := 0; i < len(ids) && i < maxSegmentSessions; i++ {
+		meta, listing, err := s.listSession(s.sessions[ids[i]])
+		if err != nil {
+			return nil, err
+		}
+		if meta != nil {
+			metas = append(metas, meta.Session)
+			updated = append(updated, meta.UpdatedAt)
+		}
+		if listing.Operations > 0 && len(infos) < maxQueryResults {
+			infos = append(infos, listing.info(ids[i]))
+		}
+	}
+
+	sort.Sort(sessionsByUpdate{metas: metas, updated: updated})
+	if len(metas) > maxQueryResults {
+		metas = metas[:maxQueryResults]
+	}
+
+	return mergeSessionMetadata(infos, metas), nil
+}
+
+// listSession returns the metadata and listing of a session, loading it
+// only when it has no current summary.json. Callers hold s.mu.
+func (s *SegmentStore) listSession(sess *segmentSession) (*segmentSessionFile, *segmentListing, error) {
+	if !sess.loaded {
+		listing, err := readSegmentListing(sess.dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list session %s: %w", sess.id, err)
+		}
+		if listing != nil {
+			meta, err := readSegmentMeta(sess.dir)
+			if err != nil {
+				return nil, nil, err
+			}
+			return meta, listing, nil
+		}
+	}
+
+	sess, err := s.session(sess.id, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	listing, err := sess.listing()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sess.meta, listing, nil
+}
+
+// sessionsByUpdate sorts session metadata newest update first.
+type sessionsByUpdate struct {
+	metas   []Session
+	updated []time.Time
+}
+
+func (b sessionsByUpdate) Len() int { return len(b.metas) }
+
+func (b sessionsByUpdate) Less(i, j int) bool { return b.updated[i].After(b.updated[j]) }
+
+func (b sessionsByUpdate) Swap(i, j int) {
+	b.metas[i], b.metas[j] = b.metas[j], b.metas[i]
+	b.updated[i], b.updated[j] = b.updated[j], b.updated[i]
+}
+
+// BeginSession stores session metadata and marks the session running. A
+// session begun again keeps its earliest start time and its counters.
+func (s *SegmentStore) BeginSession(meta *Session) error {
+	err := ValidateSession(meta)
+	if err != nil {
+		return fmt.Errorf("invalid session: %w", err)
+	}
+
+	start := meta.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+
+	sess, err := s.session(meta.ID, true)
+	if err != nil {
+		return err
+	}
+
+	err = sess.updateMeta(func(stored *Session) {
+		next := *meta
+		next.Status = SessionRunning
+		next.StartTime = start
+		if !stored.StartTime.IsZero() && stored.StartTime.Before(start) {
+			next.StartTime = stored.StartTime
+		}
+		next.EndTime = time.Time{}
+		next.DroppedOperations = stored.DroppedOperations
+		next.FilteredOperations = stored.FilteredOperations
+		next.Redaction = stored.Redaction
+		*stored = next
+	})
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+
+	return nil
+}
+
+// EndSession records the final status and end time of a begun session and
+// syncs its files to disk.
+func (s *SegmentStore) EndSession(sessionID string, status SessionStatus) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return err
+	}
+
+	err = ValidateEndStatus(status)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+
+	sess, err := s.session(sessionID, false)
+	if err != nil {
+		return err
+	}
+	if sess == nil || sess.meta == nil {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	err = sess.sync()
+	if err == nil {
+		err = sess.writeListing()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+
+	err = sess.updateMeta(func(stored *Session) {
+		stored.Status = status
+		stored.EndTime = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession returns the stored metadata of a session.
+func (s *SegmentStore) GetSession(sessionID string) (*Session, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.session(sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.meta == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	meta := sess.meta.Session
+	return &meta, nil
+}
+
+// AddDroppedOperations adds count to the number of operations the recorder
+// dropped for a session.
+func (s *SegmentStore) AddDroppedOperations(sessionID string, count int64) error {
+	err := assert.Assert(count >= 0, "dropped count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	return s.updateSession(sessionID, "failed to update session stats", func(meta *Session) {
+		meta.DroppedOperations = meta.DroppedOperations + count
+	})
+}
+
+// AddFilteredOperations adds count to the number of operations recording
+// filters left out of a session.
+func (s *SegmentStore) AddFilteredOperations(sessionID string, count int64) error {
+	err := assert.Assert(count >= 0, "filtered count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	return s.updateSession(sessionID, "failed to update session stats", func(meta *Session) {
+		meta.FilteredOperations = meta.FilteredOperations + count
+	})
+}
+
+// SetSessionRedaction records the redaction rules applied to a session's
+// payloads, replacing any stored before.
+func (s *SegmentStore) SetSessionRedaction(sessionID string, rules []string) error {
+	err := assert.AssertInRange(len(rules), 0, maxRedactionRules, "redaction rules")
+	if err != nil {
+		return err
+	}
+
+	stored := append([]string(nil), rules...)
+	return s.updateSession(sessionID, "failed to store redaction rules", func(meta *Session) {
+		meta.Redaction = stored
+	})
+}
+
+// updateSession applies update to the metadata of a session, creating the
+// session when it has none.
+func (s *SegmentStore) updateSession(sessionID string, failure string, update func(meta *Session)) error {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+
+	sess, err := s.session(sessionID, true)
+	if err != nil {
+		return err
+	}
+
+	err = sess.updateMeta(update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", failure, err)
+	}
+	return nil
+}
+
+// GetSessionStats returns the recorder counters for a session. A session
+// without stored counters returns zero values.
+func (s *SegmentStore) GetSessionStats(sessionID string) (*SessionStats, error) {
+	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.session(sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.meta == nil {
+		return &SessionStats{SessionID: sessionID}, nil
+	}
+
+	return &SessionStats{
+		SessionID:          sessionID,
+		DroppedOperations:  sess.meta.DroppedOperations,
+		FilteredOperations: sess.meta.FilteredOperations,
+		Redaction:          sess.meta.Redaction,
+		UpdatedAt:          sess.meta.UpdatedAt,
+	}, nil
+}
+
+// Close syncs and closes the files of every written session, stores their
+// summary.json and releases the writer lock.
+// Rule 7: All return values checked and propagated.
+func (s *SegmentStore) Close() error {
+	err := assert.AssertNotNil(s, "segment store")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var lastErr error
+	for _, sess := range s.sessions {
+		if sess.data == nil {
+			continue
+		}
+		err = sess.close()
+		if err == nil {
+			err = sess.writeListing()
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	if s.lock != nil {
+		err = s.lock.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to release segment lock: %w", err)
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockSegmentDir takes the exclusive writer lock of root. It returns nil
+// without an error when another process holds the lock. Closing the
+// returned file releases it.
+func lockSegmentDir(root string) (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(root, segmentLockFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment lock: %w", err)
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		_ = file.Close()
+		return nil, nil
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to lock segment directory: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockSegmentDir opens the lock file of root without locking it: Windows
+// has no flock, so writers there are not kept apart.
+func lockSegmentDir(root string) (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(root, segmentLockFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment lock: %w", err)
+	}
+	return file, nil
+}
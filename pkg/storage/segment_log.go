@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+const (
+	segmentFileSuffix    = ".seg"
+	segmentIndexFile     = "operations.idx"
+	segmentSpansFile     = "spans.log"
+	recordHeaderSize     = 8
+	maxRecordSize        = 16 * 1048576 // three 1MB payloads, JSON escaped
+	maxSegmentBytes      = 64 * 1048576
+	maxSegmentFiles      = 100000
+	segmentIndexInterval = 256
+	indexEntrySize       = 44
+)
+
+// crcTable is the Castagnoli table used for record and index checksums.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord marks a record cut short or failing its checksum. At the end
+// of a log it is the trace of an interrupted write.
+var errTornRecord = errors.New("torn record")
+
+// segmentBlock is one sparse index entry: a run of up to
+// segmentIndexInterval records in one segment, with the range of their
+// sequence numbers. Range queries read only the blocks that overlap.
+type segmentBlock struct {
+	segment uint32
+	count   uint32
+	offset  int64
+	size    int64
+	minSeq  int64
+	maxSeq  int64
+}
+
+// add extends the block with a record of size bytes.
+func (b *segmentBlock) add(seq int64, size int64) {
+	if b.count == 0 || seq < b.minSeq {
+		b.minSeq = seq
+	}
+	if b.count == 0 || seq > b.maxSeq {
+		b.maxSeq = seq
+	}
+	b.count = b.count + 1
+	b.size = b.size + size
+}
+
+// overlaps reports whether the block may hold sequences in [start, end].
+func (b *segmentBlock) overlaps(start, end int64) bool {
+	return b.count > 0 && b.minSeq <= end && b.maxSeq >= start
+}
+
+// encode returns the fixed-size index entry of the block.
+func (b *segmentBlock) encode() []byte {
+	buf := make([]byte, indexEntrySize)
+	binary.LittleEndian.PutUint32(buf[0:], b.segment)
+	binary.LittleEndian.PutUint32(buf[4:], b.count)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(b.offset))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(b.size))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(b.minSeq))
+	binary.LittleEndian.PutUint64(buf[32:], uint64(b.maxSeq))
+	binary.LittleEndian.PutUint32(buf[40:], crc32.Checksum(buf[:40], crcTable))
+	return buf
+}
+
+// decodeSegmentBlock parses an index entry, rejecting a bad checksum.
+func decodeSegmentBlock(buf []byte) (segmentBlock, bool) {
+	if len(buf) != indexEntrySize {
+		return segmentBlock{}, false
+	}
+	if crc32.Checksum(buf[:40], crcTable) != binary.LittleEndian.Uint32(buf[40:]) {
+		return segmentBlock{}, false
+	}
+	return segmentBlock{
+		segment: binary.LittleEndian.Uint32(buf[0:]),
+		count:   binary.LittleEndian.Uint32(buf[4:]),
+		offset:  int64(binary.LittleEndian.Uint64(buf[8:])),
+		size:    int64(binary.LittleEndian.Uint64(buf[16:])),
+		minSeq:  int64(binary.LittleEndian.Uint64(buf[24:])),
+		maxSeq:  int64(binary.LittleEndian.Uint64(buf[32:])),
+	}, true
+}
+
+// appendRecord frames payload as length, CRC-32C and bytes.
+func appendRecord(buf []byte, payload []byte) []byte {
+	var header [recordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.Checksum(payload, crcTable))
+	buf = append(buf, header[:]...)
+	return append(buf, payload...)
+}
+
+// nextRecord returns the payload of the record at the start of data and the
+// number of bytes it takes. A record that is cut short, oversized or fails
+// its checksum returns errTornRecord.
+func nextRecord(data []byte) ([]byte, int64, error) {
+	if len(data) < recordHeaderSize {
+		return nil, 0, errTornRecord
+	}
+
+	length := binary.LittleEndian.Uint32(data[0:])
+	if length == 0 || length > maxRecordSize || int64(len(data)) < recordHeaderSize+int64(length) {
+		return nil, 0, errTornRecord
+	}
+
+	payload := data[recordHeaderSize : recordHeaderSize+length]
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(data[4:]) {
+		return nil, 0, errTornRecord
+	}
+	return payload, recordHeaderSize + int64(length), nil
+}
+
+// readRecords reads the records of size bytes at offset of path and calls
+// visit with each payload and its size on disk.
+// Rule 2: Bounded by size.
+func readRecords(path string, offset, size int64, visit func(payload []byte, size int64) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	data := make([]byte, size)
+	_, err = file.ReadAt(data, offset)
+	if err != nil {
+		return fmt.Errorf("failed to read segment %s: %w", filepath.Base(path), err)
+	}
+
+	for pos := int64(0); pos < size; {
+		payload, n, err := nextRecord(data[pos:])
+		if err != nil {
+			return fmt.Errorf("corrupt segment %s at offset %d: %w", filepath.Base(path), offset+pos, err)
+		}
+		err = visit(payload, n)
+		if err != nil {
+			return err
+		}
+		pos = pos + n
+	}
+	return nil
+}
+
+// scanLog checks the records of path from offset and calls visit with each
+// whole record. It returns the offset after the last whole record, which is
+// short of the file size when a write was cut short.
+// Rule 2: Bounded by the file size.
+func scanLog(path string, offset int64, visit func(payload []byte, size int64) error) (int64, error) {
+	size, err := fileSize(path)
+	if err != nil {
+		return 0, err
+	}
+
+	err = assert.Assert(offset >= 0 && offset <= size, "recovery offset must be within the file")
+	if err != nil {
+		return 0, err
+	}
+	if offset == size {
+		return size, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	data := make([]byte, size-offset)
+	_, err = file.ReadAt(data, offset)
+	closeErr := file.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if closeErr != nil {
+		return 0, fmt.Errorf("failed to close %s: %w", filepath.Base(path), closeErr)
+	}
+
+	pos := int64(0)
+	for pos < int64(len(data)) {
+		payload, n, err := nextRecord(data[pos:])
+		if err != nil {
+			break
+		}
+		err = visit(payload, n)
+		if err != nil {
+			return 0, err
+		}
+		pos = pos + n
+	}
+
+	return offset + pos, nil
+}
+
+// truncateLog cuts path to size, dropping a torn record at its end.
+func truncateLog(path string, size int64) error {
+	err := os.Truncate(path, size)
+	if err != nil {
+		return fmt.Errorf("failed to truncate torn write in %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// segmentPath returns the path of segment number n in dir.
+func segmentPath(dir string, n uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", n, segmentFileSuffix))
+}
+
+// listSegments returns the segment numbers in dir, which must run from zero
+// without gaps.
+// Rule 2: Bounded by maxSegmentFiles.
+func listSegments(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	segments := make([]uint32, 0, 4)
+	for i := 0; i < len(entries) && len(segments) < maxSegmentFiles; i++ {
+		name := entries[i].Name()
+		if !strings.HasSuffix(name, segmentFileSuffix) {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(name, segmentFileSuffix), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected segment file %s", name)
+		}
+		segments = append(segments, uint32(n))
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	for i := 0; i < len(segments); i++ {
+		if segments[i] != uint32(i) {
+			return nil, fmt.Errorf("missing segment %08d%s in %s", i, segmentFileSuffix, dir)
+		}
+	}
+	return segments, nil
+}
+
+// loadSegmentIndex reads the index entries of dir that still match the
+// segment files, and truncates the index after them when repair is set.
+// Entries past a torn or stale entry are rebuilt by rescanning the
+// segments.
+// Rule 2: Bounded by the index size.
+func loadSegmentIndex(dir string, sizes []int64, repair bool) ([]segmentBlock, error) {
+	path := filepath.Join(dir, segmentIndexFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment index: %w", err)
+	}
+
+	blocks := make([]segmentBlock, 0, len(data)/indexEntrySize)
+	var segment uint32
+	var offset int64
+	for pos := 0; pos+indexEntrySize <= len(data); pos = pos + indexEntrySize {
+		block, ok := decodeSegmentBlock(data[pos : pos+indexEntrySize])
+		if !ok || int(block.segment) >= len(sizes) || block.count == 0 {
+			break
+		}
+		if block.segment != segment {
+			if block.segment != segment+1 || block.offset != 0 || offset != sizes[segment] {
+				break
+			}
+			segment = block.segment
+			offset = 0
+		}
+		if block.offset != offset || block.offset+block.size > sizes[block.segment] {
+			break
+		}
+		blocks = append(blocks, block)
+		offset = block.offset + block.size
+	}
+
+	kept := int64(len(blocks) * indexEntrySize)
+	if repair && kept < int64(len(data)) {
+		err = os.Truncate(path, kept)
+		if err != nil {
+			return nil, fmt.Errorf("failed to truncate segment index: %w", err)
+		}
+	}
+	return blocks, nil
+}
+
+// openAppend opens path for appending, creating it when missing.
+func openAppend(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	return file, nil
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file,
+// so a crash leaves either the old or the new contents.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Base(tmp), err)
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// fileSize returns the size of path, zero when it does not exist.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", filepath.Base(path), err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,734 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+// segmentSession is the state of one session directory. Sessions are
+// loaded, and recovered, on first use; their files are opened for
+// appending on first write.
+type segmentSession struct {
+	id     string
+	dir    string
+	loaded bool
+	meta   *segmentSessionFile
+
+	segment uint32
+	sizes   []int64
+	data    *os.File
+	index   *os.File
+	blocks  []segmentBlock
+	// indexed is the number of blocks written to operations.idx.
+	indexed int
+	tail    segmentBlock
+	count   int64
+	summary *segmentSummary
+
+	spans     []ReconcileSpan
+	spanIndex map[string]int
+	spanLog   *os.File
+	spanBytes int64
+}
+
+// segmentSummary holds the per-session aggregates of ListSessions and
+// MaxLamport. It is computed on first use and kept current by inserts.
+type segmentSummary struct {
+	start    time.Time
+	end      time.Time
+	errors   int64
+	maxClock int64
+	actors   map[string]bool
+}
+
+// segmentSessionFile is the content of session.json.
+type segmentSessionFile struct {
+	Session
+	UpdatedAt time.Time
+}
+
+// segmentListing is the content of summary.json: what ListSessions shows
+// for a session, with the file sizes it was computed at. A writer stores it
+// when it ends or closes the session; it is stale once the files have
+// grown since.
+type segmentListing struct {
+	Operations int64     `json:"operations"`
+	Spans      int64     `json:"spans"`
+	Errors     int64     `json:"errors"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Actors     []string  `json:"actors,omitempty"`
+	Segments   []int64   `json:"segments"`
+	SpanBytes  int64     `json:"span_bytes"`
+}
+
+// segmentSpanRecord is one entry of spans.log: a started span or the end
+// of one.
+type segmentSpanRecord struct {
+	Start *ReconcileSpan  `json:"start,omitempty"`
+	End   *segmentSpanEnd `json:"end,omitempty"`
+}
+
+type segmentSpanEnd struct {
+	ID         string    `json:"id"`
+	EndTime    time.Time `json:"end_ts"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// load reads the session metadata and recovers its operations and spans.
+// A torn record at the end of a log is truncated when repair is set and
+// skipped otherwise.
+func (sess *segmentSession) load(repair bool) error {
+	meta, err := readSegmentMeta(sess.dir)
+	if err != nil {
+		return err
+	}
+	sess.meta = meta
+
+	err = sess.recoverOperations(repair)
+	if err == nil {
+		err = sess.recoverSpans(repair)
+	}
+	if err != nil {
+		_ = sess.close()
+		*sess = segmentSession{id: sess.id, dir: sess.dir}
+		return err
+	}
+
+	sess.loaded = true
+	return nil
+}
+
+// recoverOperations loads the sparse index and scans the segments after
+// the last indexed block. A torn record at the end of the last segment is
+// truncated, and the rebuilt index blocks written, when repair is set.
+// Damage anywhere else is reported, not repaired.
+// Rule 2: Bounded by the number of segments.
+func (sess *segmentSession) recoverOperations(repair bool) error {
+	segments, err := listSegments(sess.dir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		segments = append(segments, 0)
+	}
+
+	sizes := make([]int64, len(segments))
+	for i := 0; i < len(segments); i++ {
+		sizes[i], err = fileSize(segmentPath(sess.dir, segments[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	sess.blocks, err = loadSegmentIndex(sess.dir, sizes, repair)
+	if err != nil {
+		return err
+	}
+	sess.indexed = len(sess.blocks)
+	for i := 0; i < len(sess.blocks); i++ {
+		sess.count = sess.count + int64(sess.blocks[i].count)
+	}
+
+	if len(sess.blocks) > 0 {
+		last := sess.blocks[len(sess.blocks)-1]
+		sess.tail = segmentBlock{segment: last.segment, offset: last.offset + last.size}
+	}
+
+	first := sess.tail.segment
+	for n := first; int(n) < len(segments); n++ {
+		if n != first {
+			err = sess.flushTail()
+			if err != nil {
+				return err
+			}
+			sess.tail = segmentBlock{segment: n}
+		}
+
+		path := segmentPath(sess.dir, n)
+		valid, err := scanLog(path, sess.tail.offset+sess.tail.size, func(payload []byte, size int64) error {
+			var record struct {
+				SequenceNumber int64 `json:"sequence_number"`
+			}
+			err := json.Unmarshal(payload, &record)
+			if err != nil {
+				return fmt.Errorf("corrupt operation in %s: %w", filepath.Base(path), err)
+			}
+			return sess.track(record.SequenceNumber, size)
+		})
+		if err != nil {
+			return err
+		}
+
+		if valid < sizes[n] {
+			if int(n) != len(segments)-1 {
+				return fmt.Errorf("corrupt segment %s at offset %d", filepath.Base(path), valid)
+			}
+			if repair {
+				err = truncateLog(path, valid)
+				if err != nil {
+					return err
+				}
+			}
+			sizes[n] = valid
+		}
+	}
+
+	sess.sizes = sizes
+	sess.segment = uint32(len(segments) - 1)
+	if !repair {
+		return nil
+	}
+	return sess.writeIndex()
+}
+
+// recoverSpans replays spans.log. A torn record at its end is truncated
+// when repair is set.
+func (sess *segmentSession) recoverSpans(repair bool) error {
+	sess.spans = make([]ReconcileSpan, 0, 16)
+	sess.spanIndex = make(map[string]int, 16)
+
+	path := filepath.Join(sess.dir, segmentSpansFile)
+	valid, err := scanLog(path, 0, func(payload []byte, size int64) error {
+		var record segmentSpanRecord
+		err := json.Unmarshal(payload, &record)
+		if err != nil {
+			return fmt.Errorf("corrupt span record: %w", err)
+		}
+		sess.applySpan(&record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sess.spanBytes = valid
+	if !repair {
+		return nil
+	}
+
+	size, err := fileSize(path)
+	if err != nil {
+		return err
+	}
+	if valid < size {
+		return truncateLog(path, valid)
+	}
+	return nil
+}
+
+// openWriter opens the session files for appending, once, before the
+// first write. Sessions that are only read keep no files open.
+func (sess *segmentSession) openWriter() error {
+	if sess.data != nil {
+		return nil
+	}
+
+	var err error
+	sess.index, err = openAppend(filepath.Join(sess.dir, segmentIndexFile))
+	if err == nil {
+		err = sess.writeIndex()
+	}
+	if err == nil {
+		sess.spanLog, err = openAppend(filepath.Join(sess.dir, segmentSpansFile))
+	}
+	if err == nil {
+		sess.data, err = openAppend(segmentPath(sess.dir, sess.segment))
+	}
+	if err != nil {
+		_ = sess.close()
+		sess.data, sess.index, sess.spanLog = nil, nil, nil
+		return err
+	}
+	return nil
+}
+
+// writeIndex appends the blocks not yet in operations.idx to it, opening
+// the index for this one write when the session has no writer.
+func (sess *segmentSession) writeIndex() error {
+	if sess.indexed == len(sess.blocks) {
+		return nil
+	}
+
+	buf := make([]byte, 0, (len(sess.blocks)-sess.indexed)*indexEntrySize)
+	for i := sess.indexed; i < len(sess.blocks); i++ {
+		buf = append(buf, sess.blocks[i].encode()...)
+	}
+
+	file := sess.index
+	if file == nil {
+		var err error
+		file, err = openAppend(filepath.Join(sess.dir, segmentIndexFile))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := file.Write(buf)
+	if file != sess.index {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write segment index: %w", err)
+	}
+
+	sess.indexed = len(sess.blocks)
+	return nil
+}
+
+// readSegmentMeta reads session.json, returning nil when there is none.
+func readSegmentMeta(dir string) (*segmentSessionFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, segmentMetaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session metadata: %w", err)
+	}
+
+	var meta segmentSessionFile
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode session metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// updateMeta applies update to the session metadata and rewrites
+// session.json.
+func (sess *segmentSession) updateMeta(update func(meta *Session)) error {
+	next := segmentSessionFile{Session: Session{ID: sess.id}}
+	if sess.meta != nil {
+		next = *sess.meta
+	}
+
+	update(&next.Session)
+	next.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(&next)
+	if err != nil {
+		return fmt.Errorf("failed to encode session metadata: %w", err)
+	}
+
+	err = writeFileAtomic(filepath.Join(sess.dir, segmentMetaFile), data)
+	if err != nil {
+		return err
+	}
+
+	sess.meta = &next
+	return nil
+}
+
+// track adds a stored record to the open index block, writing the block to
+// the index once it is full.
+func (sess *segmentSession) track(seq int64, size int64) error {
+	sess.tail.add(seq, size)
+	sess.count = sess.count + 1
+	if sess.tail.count < segmentIndexInterval {
+		return nil
+	}
+	return sess.flushTail()
+}
+
+// flushTail closes the open block and starts the next one. The block is
+// written to the index at once by a writer; blocks rebuilt while loading
+// are written together by writeIndex.
+func (sess *segmentSession) flushTail() error {
+	if sess.tail.count == 0 {
+		return nil
+	}
+
+	sess.blocks = append(sess.blocks, sess.tail)
+	sess.tail = segmentBlock{segment: sess.tail.segment, offset: sess.tail.offset + sess.tail.size}
+	if sess.index == nil {
+		return nil
+	}
+	return sess.writeIndex()
+}
+
+// appendRecords writes framed records to the active segment in one write,
+// rolling to a new segment first when it would grow past segmentBytes.
+func (sess *segmentSession) appendRecords(data []byte, segmentBytes int64) error {
+	err := sess.openWriter()
+	if err != nil {
+		return err
+	}
+
+	size := sess.sizes[sess.segment]
+	if size > 0 && size+int64(len(data)) > segmentBytes {
+		err = sess.roll()
+		if err != nil {
+			return err
+		}
+		size = 0
+	}
+
+	n, err := sess.data.Write(data)
+	if err != nil {
+		if n > 0 {
+			_ = sess.data.Truncate(size)
+		}
+		return fmt.Errorf("failed to append to segment: %w", err)
+	}
+
+	sess.sizes[sess.segment] = size + int64(n)
+	return nil
+}
+
+// truncate drops what appendRecords wrote to the active segment after size.
+func (sess *segmentSession) truncate(size int64) error {
+	err := sess.data.Truncate(size)
+	if err != nil {
+		return fmt.Errorf("failed to roll back segment: %w", err)
+	}
+	sess.sizes[sess.segment] = size
+	return nil
+}
+
+// roll closes the active segment and starts the next one.
+func (sess *segmentSession) roll() error {
+	err := assert.AssertInRange(int(sess.segment)+1, 1, maxSegmentFiles-1, "segment number")
+	if err != nil {
+		return err
+	}
+
+	err = sess.flushTail()
+	if err != nil {
+		return err
+	}
+
+	err = sess.data.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	err = sess.data.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close segment: %w", err)
+	}
+
+	next := sess.segment + 1
+	sess.data, err = openAppend(segmentPath(sess.dir, next))
+	if err != nil {
+		return err
+	}
+	sess.segment = next
+	sess.sizes = append(sess.sizes, 0)
+	sess.tail = segmentBlock{segment: next}
+	return nil
+}
+
+// readOperations decodes the operations with sequence numbers in
+// [start, end], reading only the index blocks that overlap the range.
+// Adjacent blocks are read together.
+// Rule 2: Bounded by the number of stored records.
+func (sess *segmentSession) readOperations(start, end int64) ([]Operation, error) {
+	blocks := make([]segmentBlock, 0, len(sess.blocks)+1)
+	for i := 0; i < len(sess.blocks); i++ {
+		if sess.blocks[i].overlaps(start, end) {
+			blocks = append(blocks, sess.blocks[i])
+		}
+	}
+	if sess.tail.overlaps(start, end) {
+		blocks = append(blocks, sess.tail)
+	}
+
+	ops := make([]Operation, 0, 256)
+	visit := func(payload []byte, size int64) error {
+		op, err := decodeOperationRecord(payload)
+		if err != nil {
+			return err
+		}
+		if op.SequenceNumber >= start && op.SequenceNumber <= end {
+			ops = append(ops, op)
+		}
+		return nil
+	}
+
+	for i := 0; i < len(blocks); {
+		run := blocks[i]
+		i = i + 1
+		for i < len(blocks) && blocks[i].segment == run.segment && blocks[i].offset == run.offset+run.size {
+			run.size = run.size + blocks[i].size
+			i = i + 1
+		}
+
+		err := readRecords(segmentPath(sess.dir, run.segment), run.offset, run.size, visit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ops, nil
+}
+
+// ensureSummary computes the session aggregates when they are not known.
+func (sess *segmentSession) ensureSummary() error {
+	if sess.summary != nil {
+		return nil
+	}
+
+	ops, err := sess.readOperations(0, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+
+	summary := &segmentSummary{actors: make(map[string]bool, 4)}
+	for i := 0; i < len(ops); i++ {
+		summary.observe(&ops[i])
+	}
+	sess.summary = summary
+	return nil
+}
+
+// listing returns the summary.json content of a loaded session.
+func (sess *segmentSession) listing() (*segmentListing, error) {
+	err := sess.ensureSummary()
+	if err != nil {
+		return nil, err
+	}
+
+	actors := make([]string, 0, len(sess.summary.actors))
+	for actor := range sess.summary.actors {
+		actors = append(actors, actor)
+	}
+	return &segmentListing{
+		Operations: sess.count,
+		Spans:      int64(len(sess.spans)),
+		Errors:     sess.summary.errors,
+		Start:      sess.summary.start,
+		End:        sess.summary.end,
+		Actors:     sessionActors(actors),
+		Segments:   append([]int64(nil), sess.sizes...),
+		SpanBytes:  sess.spanBytes,
+	}, nil
+}
+
+// writeListing stores the listing of the session in summary.json.
+func (sess *segmentSession) writeListing() error {
+	listing, err := sess.listing()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(listing)
+	if err != nil {
+		return fmt.Errorf("failed to encode session summary: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(sess.dir, segmentSummaryFile), data)
+}
+
+// readSegmentListing reads summary.json, returning nil when there is none
+// or the session files no longer have the sizes it was computed at.
+// Rule 2: Bounded by the number of segments.
+func readSegmentListing(dir string) (*segmentListing, error) {
+	data, err := os.ReadFile(filepath.Join(dir, segmentSummaryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session summary: %w", err)
+	}
+
+	var listing segmentListing
+	err = json.Unmarshal(data, &listing)
+	if err != nil {
+		return nil, nil
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) != len(listing.Segments) {
+		return nil, nil
+	}
+	for i := 0; i < len(segments); i++ {
+		size, err := fileSize(segmentPath(dir, segments[i]))
+		if err != nil {
+			return nil, err
+		}
+		if size != listing.Segments[i] {
+			return nil, nil
+		}
+	}
+
+	size, err := fileSize(filepath.Join(dir, segmentSpansFile))
+	if err != nil {
+		return nil, err
+	}
+	if size != listing.SpanBytes {
+		return nil, nil
+	}
+	return &listing, nil
+}
+
+// info returns the listing as the SessionInfo of sessionID.
+func (l *segmentListing) info(sessionID string) SessionInfo {
+	return SessionInfo{
+		SessionID:  sessionID,
+		StartTime:  l.Start.Unix(),
+		EndTime:    l.End.Unix(),
+		OpCount:    l.Operations,
+		SpanCount:  l.Spans,
+		ErrorCount: l.Errors,
+		Actors:     sessionActors(l.Actors),
+	}
+}
+
+// observe adds one stored operation to the aggregates.
+func (sum *segmentSummary) observe(op *Operation) {
+	if sum.start.IsZero() || op.Timestamp.Before(sum.start) {
+		sum.start = op.Timestamp
+	}
+	if op.Timestamp.After(sum.end) {
+		sum.end = op.Timestamp
+	}
+	if len(op.Error) > 0 {
+		sum.errors = sum.errors + 1
+	}
+	if clock := orderKey(op); clock > sum.maxClock {
+		sum.maxClock = clock
+	}
+	if len(op.ActorID) > 0 && len(sum.actors) < maxSessionActors {
+		sum.actors[op.ActorID] = true
+	}
+}
+
+// applySpan applies a spans.log record to the loaded spans.
+func (sess *segmentSession) applySpan(record *segmentSpanRecord) {
+	if record.Start != nil {
+		sess.spanIndex[record.Start.ID] = len(sess.spans)
+		sess.spans = append(sess.spans, *record.Start)
+		return
+	}
+
+	if record.End == nil {
+		return
+	}
+	idx, ok := sess.spanIndex[record.End.ID]
+	if !ok {
+		return
+	}
+	sess.spans[idx].EndTime = record.End.EndTime
+	sess.spans[idx].DurationMs = record.End.DurationMs
+	sess.spans[idx].Error = record.End.Error
+}
+
+// appendSpan writes a spans.log record and applies it.
+func (sess *segmentSession) appendSpan(record *segmentSpanRecord) error {
+	err := sess.openWriter()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode span: %w", err)
+	}
+
+	framed := appendRecord(nil, payload)
+	_, err = sess.spanLog.Write(framed)
+	if err != nil {
+		return fmt.Errorf("failed to append span: %w", err)
+	}
+	sess.spanBytes = sess.spanBytes + int64(len(framed))
+
+	sess.applySpan(record)
+	return nil
+}
+
+// sync flushes the session's open files to disk.
+func (sess *segmentSession) sync() error {
+	files := []*os.File{sess.data, sess.index, sess.spanLog}
+	for i := 0; i < len(files); i++ {
+		if files[i] == nil {
+			continue
+		}
+		err := files[i].Sync()
+		if err != nil {
+			return fmt.Errorf("failed to sync %s: %w", filepath.Base(files[i].Name()), err)
+		}
+	}
+	return nil
+}
+
+// close syncs and closes the session's open files.
+func (sess *segmentSession) close() error {
+	lastErr := sess.sync()
+
+	files := []*os.File{sess.data, sess.index, sess.spanLog}
+	for i := 0; i < len(files); i++ {
+		if files[i] == nil {
+			continue
+		}
+		err := files[i].Close()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to close %s: %w", filepath.Base(files[i].Name()), err)
+		}
+	}
+	return lastErr
+}
+
+// segmentBatch collects the records one InsertOperations call appends to a
+// session.
+type segmentBatch struct {
+	sess  *segmentSession
+	data  []byte
+	ops   []*Operation
+	sizes []int64
+}
+
+// add encodes op as the next record of the batch.
+func (b *segmentBatch) add(op *Operation) error {
+	stored := newOperationRecord(op)
+	stored.ID = b.sess.count + int64(len(b.ops)) + 1
+
+	payload, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to encode operation: %w", err)
+	}
+	if len(payload) > maxRecordSize {
+		return fmt.Errorf("operation record exceeds %d bytes", maxRecordSize)
+	}
+
+	before := len(b.data)
+	b.data = appendRecord(b.data, payload)
+	b.ops = append(b.ops, op)
+	b.sizes = append(b.sizes, int64(len(b.data)-before))
+	return nil
+}
+
+// write appends the batch to the session's active segment.
+func (b *segmentBatch) write(segmentBytes int64) error {
+	return b.sess.appendRecords(b.data, segmentBytes)
+}
+
+// rollback removes a written batch from the active segment.
+func (b *segmentBatch) rollback() error {
+	return b.sess.truncate(b.sess.sizes[b.sess.segment] - int64(len(b.data)))
+}
+
+// commit indexes the written records and updates the session aggregates.
+func (b *segmentBatch) commit() error {
+	for i := 0; i < len(b.ops); i++ {
+		err := b.sess.track(b.ops[i].SequenceNumber, b.sizes[i])
+		if err != nil {
+			return err
+		}
+		if b.sess.summary != nil {
+			b.sess.summary.observe(b.ops[i])
+		}
+	}
+	return nil
+}
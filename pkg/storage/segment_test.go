@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestSegmentStore(t *testing.T, dir string) *SegmentStore {
+	t.Helper()
+
+	store, err := NewSegmentStore(StorageConfig{
+		Type:          StorageSegment,
+		ConnectionURI: dir,
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func segmentTestOp(sessionID string, seq int64) *Operation {
+	return &Operation{
+		SessionID:      sessionID,
+		SequenceNumber: seq,
+		Timestamp:      time.Unix(1700000000+seq, 0),
+		OperationType:  OperationUpdate,
+		ResourceKind:   "ConfigMap",
+		Namespace:      "default",
+		Name:           "demo",
+		ResourceData:   `{"data":{"k":"v"}}`,
+		ActorID:        "controller-a",
+		DurationMs:     3,
+	}
+}
+
+func TestSegmentStoreOperationsAndSessions(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestSegmentStore(t, dir)
+
+	require.NoError(t, store.BeginSession(&Session{
+		ID:           "session-1",
+		Description:  "segment test",
+		OperatorName: "widget-operator",
+		Labels:       map[string]string{"env": "test"},
+	}))
+
+	require.NoError(t, store.InsertOperation(segmentTestOp("session-1", 1)))
+	failed := segmentTestOp("session-1", 2)
+	failed.Error = "conflict"
+	failed.ActorID = "controller-b"
+	failed.ListItems = []ListItem{{UID: "uid-1", ResourceVersion: "7"}}
+	require.NoError(t, store.InsertOperations([]*Operation{
+		failed,
+		segmentTestOp("session-1", 3),
+		segmentTestOp("other", 1),
+	}))
+
+	invalid := segmentTestOp("session-1", 4)
+	invalid.ResourceKind = ""
+	require.Error(t, store.InsertOperations([]*Operation{segmentTestOp("session-1", 5), invalid}))
+
+	require.NoError(t, store.InsertReconcileSpan(&ReconcileSpan{
+		ID:        "span-1",
+		SessionID: "session-1",
+		ActorID:   "controller-a",
+		StartTime: time.Unix(1700000001, 0),
+		Kind:      "Widget",
+	}))
+	require.Error(t, store.InsertReconcileSpan(&ReconcileSpan{
+		ID:        "span-1",
+		SessionID: "session-1",
+		ActorID:   "controller-a",
+		StartTime: time.Unix(1700000001, 0),
+		Kind:      "Widget",
+	}))
+	require.NoError(t, store.EndReconcileSpan("span-1", time.Unix(1700000002, 0), 1000, "requeue"))
+	require.NoError(t, store.EndReconcileSpan("missing", time.Now(), 1, ""))
+	require.NoError(t, store.AddDroppedOperations("session-1", 2))
+	require.NoError(t, store.SetSessionRedaction("session-1", []string{"secrets"}))
+	require.NoError(t, store.EndSession("session-1", SessionCompleted))
+	require.ErrorIs(t, store.EndSession("never-begun", SessionCompleted), ErrSessionNotFound)
+	require.NoError(t, store.Close())
+
+	store = openTestSegmentStore(t, dir)
+	defer func() {
+		assert.NoError(t, store.Close())
+	}()
+
+	ops, err := store.QueryOperations("session-1")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	assert.Equal(t, "conflict", ops[1].Error)
+	assert.Equal(t, []ListItem{{UID: "uid-1", ResourceVersion: "7"}}, ops[1].ListItems)
+	assert.Equal(t, int64(2), ops[1].ID)
+
+	ops, err = store.QueryOperationsByRange("session-1", 2, 3)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	clock, err := store.MaxLamport("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), clock)
+
+	spans, err := store.QueryReconcileSpans("session-1")
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.Equal(t, int64(1000), spans[0].DurationMs)
+	assert.Equal(t, "requeue", spans[0].Error)
+
+	session, err := store.GetSession("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, SessionCompleted, session.Status)
+	assert.Equal(t, "widget-operator", session.OperatorName)
+	assert.Equal(t, int64(2), session.DroppedOperations)
+	assert.Equal(t, []string{"secrets"}, session.Redaction)
+
+	_, err = store.GetSession("other")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	sessions, err := store.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	byID := map[string]SessionInfo{}
+	for _, info := range sessions {
+		byID[info.SessionID] = info
+	}
+	assert.Equal(t, int64(3), byID["session-1"].OpCount)
+	assert.Equal(t, int64(1), byID["session-1"].SpanCount)
+	assert.Equal(t, int64(1), byID["session-1"].ErrorCount)
+	assert.Equal(t, []string{"controller-a", "controller-b"}, byID["session-1"].Actors)
+	assert.Equal(t, "segment test", byID["session-1"].Description)
+	assert.Nil(t, byID["other"].Meta)
+
+	result, err := VerifyStore(store)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, int64(4), result.Stats.Operations)
+}
+
+func TestSegmentStoreTruncatesTornWrites(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestSegmentStore(t, dir)
+	for seq := int64(1); seq <= 3; seq++ {
+		require.NoError(t, store.InsertOperation(segmentTestOp("torn", seq)))
+	}
+	require.NoError(t, store.InsertReconcileSpan(&ReconcileSpan{
+		ID:        "span-1",
+		SessionID: "torn",
+		ActorID:   "controller-a",
+		StartTime: time.Unix(1700000001, 0),
+		Kind:      "Widget",
+	}))
+	require.NoError(t, store.Close())
+
+	sessionDir := filepath.Join(dir, segmentSessionsDir, "torn")
+	segment := segmentPath(sessionDir, 0)
+	intact, err := fileSize(segment)
+	require.NoError(t, err)
+
+	// A record cut short after its header, as a crash mid-write leaves it.
+	torn := appendRecord(nil, []byte(`{"sequence_number":4}`))
+	appendBytes(t, segment, torn[:len(torn)-5])
+	appendBytes(t, filepath.Join(sessionDir, segmentSpansFile), []byte{0x20, 0, 0})
+
+	store = openTestSegmentStore(t, dir)
+	ops, err := store.QueryOperations("torn")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	size, err := fileSize(segment)
+	require.NoError(t, err)
+	assert.Equal(t, intact, size)
+
+	spans, err := store.QueryReconcileSpans("torn")
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+
+	require.NoError(t, store.InsertOperation(segmentTestOp("torn", 4)))
+	require.NoError(t, store.Close())
+
+	store = openTestSegmentStore(t, dir)
+	defer func() {
+		assert.NoError(t, store.Close())
+	}()
+	ops, err = store.QueryOperations("torn")
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	assert.Equal(t, int64(4), ops[3].SequenceNumber)
+}
+
+func TestSegmentStoreReadsWhileLocked(t *testing.T) {
+	dir := t.TempDir()
+	writer := openTestSegmentStore(t, dir)
+	for seq := int64(1); seq <= 3; seq++ {
+		require.NoError(t, writer.InsertOperation(segmentTestOp("live", seq)))
+	}
+
+	// A write in progress looks like a torn record to a reader.
+	segment := segmentPath(filepath.Join(dir, segmentSessionsDir, "live"), 0)
+	partial := appendRecord(nil, []byte(`{"sequence_number":4}`))
+	appendBytes(t, segment, partial[:len(partial)-5])
+	size, err := fileSize(segment)
+	require.NoError(t, err)
+
+	reader := openTestSegmentStore(t, dir)
+	ops, err := reader.QueryOperations("live")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	sessions, err := reader.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.ErrorContains(t, reader.InsertOperation(segmentTestOp("live", 5)), "locked by another writer")
+	require.Error(t, reader.BeginSession(&Session{ID: "other"}))
+	require.NoError(t, reader.Close())
+
+	after, err := fileSize(segment)
+	require.NoError(t, err)
+	assert.Equal(t, size, after, "a reader must not truncate the writer's records")
+	require.NoError(t, writer.Close())
+
+	readOnly, err := NewSegmentStore(StorageConfig{ConnectionURI: dir, MaxOperations: 1000, ReadOnly: true})
+	require.NoError(t, err)
+	ops, err = readOnly.QueryOperations("live")
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	require.ErrorContains(t, readOnly.EndSession("live", SessionCompleted), "read-only")
+	require.NoError(t, readOnly.Close())
+
+	// Once the writer is gone, the next writer repairs the torn record.
+	writer = openTestSegmentStore(t, dir)
+	require.NoError(t, writer.InsertOperation(segmentTestOp("live", 4)))
+	require.NoError(t, writer.Close())
+	writer = openTestSegmentStore(t, dir)
+	ops, err = writer.QueryOperations("live")
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	require.NoError(t, writer.Close())
+
+	missing, err := NewSegmentStore(StorageConfig{ConnectionURI: filepath.Join(dir, "missing"), MaxOperations: 1000, ReadOnly: true})
+	require.NoError(t, err)
+	require.NoError(t, missing.Close())
+	_, err = os.Stat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err), "a read-only store creates nothing")
+}
+
+func TestSegmentStoreListsWithoutLoading(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestSegmentStore(t, dir)
+	require.NoError(t, store.BeginSession(&Session{ID: "ended", OperatorName: "widget-operator"}))
+	for seq := int64(1); seq <= 3; seq++ {
+		require.NoError(t, store.InsertOperation(segmentTestOp("ended", seq)))
+		require.NoError(t, store.InsertOperation(segmentTestOp("closed", seq)))
+	}
+	require.NoError(t, store.EndSession("ended", SessionCompleted))
+	require.NoError(t, store.Close())
+
+	store = openTestSegmentStore(t, dir)
+	defer func() {
+		assert.NoError(t, store.Close())
+	}()
+
+	sessions, err := store.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, info := range sessions {
+		assert.Equal(t, int64(3), info.OpCount)
+		assert.Equal(t, []string{"controller-a"}, info.Actors)
+		assert.False(t, store.sessions[info.SessionID].loaded, info.SessionID)
+		if info.SessionID == "ended" {
+			require.NotNil(t, info.Meta)
+			assert.Equal(t, "widget-operator", info.Meta.OperatorName)
+		}
+	}
+
+	// Reading a session opens no files; writing one makes its summary stale.
+	_, err = store.QueryOperations("ended")
+	require.NoError(t, err)
+	assert.Nil(t, store.sessions["ended"].data)
+	require.NoError(t, store.InsertOperation(segmentTestOp("closed", 4)))
+	assert.NotNil(t, store.sessions["closed"].data)
+
+	other := openTestSegmentStore(t, dir)
+	sessions, err = other.ListSessions()
+	require.NoError(t, err)
+	require.NoError(t, other.Close())
+	for _, info := range sessions {
+		if info.SessionID == "closed" {
+			assert.Equal(t, int64(4), info.OpCount)
+		}
+	}
+}
+
+func TestSegmentStoreSparseIndexAndRolling(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestSegmentStore(t, dir)
+	store.segmentBytes = 16384
+
+	total := int64(3*segmentIndexInterval + 10)
+	batch := make([]*Operation, 0, 50)
+	for seq := int64(1); seq <= total; seq++ {
+		batch = append(batch, segmentTestOp("indexed", seq))
+		if len(batch) == cap(batch) || seq == total {
+			require.NoError(t, store.InsertOperations(batch))
+			batch = batch[:0]
+		}
+	}
+	require.NoError(t, store.Close())
+
+	sessionDir := filepath.Join(dir, segmentSessionsDir, "indexed")
+	segments, err := listSegments(sessionDir)
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+
+	check := func() {
+		store := openTestSegmentStore(t, dir)
+		defer func() {
+			assert.NoError(t, store.Close())
+		}()
+
+		ops, err := store.QueryOperations("indexed")
+		require.NoError(t, err)
+		require.Len(t, ops, int(total))
+		for i := range ops {
+			require.Equal(t, int64(i+1), ops[i].SequenceNumber)
+		}
+
+		ops, err = store.QueryOperationsByRange("indexed", 300, 305)
+		require.NoError(t, err)
+		require.Len(t, ops, 6)
+		assert.Equal(t, int64(300), ops[0].SequenceNumber)
+	}
+	check()
+
+	index := filepath.Join(sessionDir, segmentIndexFile)
+	size, err := fileSize(index)
+	require.NoError(t, err)
+	assert.Greater(t, size, int64(0))
+	assert.Zero(t, size%indexEntrySize)
+
+	// A torn index entry is dropped and the blocks after it are rebuilt.
+	appendBytes(t, index, []byte{1, 2, 3})
+	check()
+	rebuilt, err := fileSize(index)
+	require.NoError(t, err)
+	assert.Equal(t, size, rebuilt)
+
+	require.NoError(t, os.Remove(index))
+	check()
+}
+
+func TestNewOperationStoreSegment(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "recordings")
+	store, err := NewOperationStore(StorageConfig{
+		Type:          StorageFile,
+		ConnectionURI: dir,
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.InsertOperation(segmentTestOp("s/../x", 1)))
+	require.NoError(t, store.Close())
+
+	entries, err := os.ReadDir(filepath.Join(dir, segmentSessionsDir))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "s%2F%2E%2E%2Fx", entries[0].Name())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, segmentFormatFile), []byte("v9\n"), 0o600))
+	_, err = NewOperationStore(StorageConfig{
+		Type:          StorageSegment,
+		ConnectionURI: dir,
+		MaxOperations: 1000,
+	})
+	require.Error(t, err)
+}
+
+// BenchmarkInsertOperations compares batched inserts into SQLite and
+// segment files.
+func BenchmarkInsertOperations(b *testing.B) {
+	b.Run("sqlite", func(b *testing.B) {
+		db, err := NewDatabase(filepath.Join(b.TempDir(), "bench.db"), defaultMaxOperations)
+		require.NoError(b, err)
+		benchmarkInsertOperations(b, db)
+	})
+
+	b.Run("segment", func(b *testing.B) {
+		store, err := NewSegmentStore(StorageConfig{ConnectionURI: b.TempDir(), MaxOperations: defaultMaxOperations})
+		require.NoError(b, err)
+		benchmarkInsertOperations(b, store)
+	})
+}
+
+func benchmarkInsertOperations(b *testing.B, store OperationStore) {
+	defer func() {
+		require.NoError(b, store.Close())
+	}()
+
+	batch := make([]*Operation, 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range batch {
+			batch[j] = segmentTestOp("bench", int64(i*len(batch)+j+1))
+		}
+		require.NoError(b, store.InsertOperations(batch))
+	}
+	b.ReportMetric(float64(b.N*len(batch))/b.Elapsed().Seconds(), "ops/s")
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = file.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
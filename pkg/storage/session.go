@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+const (
+	maxSessionIDLength      = 256
+	maxDescriptionLength    = 1024
+	maxSessionLabels        = 64
+	maxLabelKeyLength       = 317 // 253 prefix + "/" + 63 name
+	maxLabelValueLength     = 63
+	maxSessionFieldLength   = 256
+	maxRecorderConfigLength = 65536
+	maxSessionActors        = 100
+)
+
+// ErrSessionNotFound is returned when a session has no stored metadata.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStatus is the lifecycle state of a recording session.
+type SessionStatus string
+
+const (
+	SessionRunning   SessionStatus = "running"
+	SessionCompleted SessionStatus = "completed"
+	SessionFailed    SessionStatus = "failed"
+	SessionAborted   SessionStatus = "aborted"
+)
+
+// Session holds the metadata stored for a recording session. Sessions
+// recorded before session metadata existed have only the counters set and
+// an empty Status.
+type Session struct {
+	ID          string
+	Description string
+	Labels      map[string]string
+	// OperatorName, OperatorVersion and GitSHA identify the recorded build.
+	OperatorName    string
+	OperatorVersion string
+	GitSHA          string
+	ClusterName     string
+	// KubernetesVersion is the API server version, e.g. v1.30.2.
+	KubernetesVersion string
+	// RecorderConfig is the recorder settings, encoded as JSON.
+	RecorderConfig string
+	Status         SessionStatus
+	StartTime      time.Time
+	EndTime        time.Time
+
+	DroppedOperations  int64
+	FilteredOperations int64
+	Redaction          []string
+}
+
+// SessionStore defines the interface for session metadata and recorder
+// counters. Every OperationStore is one.
+type SessionStore interface {
+	// BeginSession stores meta and marks the session running. Counters
+	// already stored for the session are kept.
+	BeginSession(meta *Session) error
+	// EndSession records the final status and end time of a session.
+	EndSession(sessionID string, status SessionStatus) error
+	// GetSession returns ErrSessionNotFound for a session without stored
+	// metadata or counters.
+	GetSession(sessionID string) (*Session, error)
+	ListSessions() ([]SessionInfo, error)
+	AddDroppedOperations(sessionID string, count int64) error
+	AddFilteredOperations(sessionID string, count int64) error
+	SetSessionRedaction(sessionID string, rules []string) error
+	GetSessionStats(sessionID string) (*SessionStats, error)
+}
+
+// ValidateSession checks session metadata meets constraints.
+// Rule 5: Multiple assertions for validation.
+func ValidateSession(meta *Session) error {
+	err := assert.Assert(meta != nil, "session must not be nil")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(meta.ID), 1, maxSessionIDLength, "session_id length")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(meta.Description), 0, maxDescriptionLength, "description length")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(meta.RecorderConfig), 0, maxRecorderConfigLength, "recorder config length")
+	if err != nil {
+		return err
+	}
+
+	fields := [][2]string{
+		{"operator name", meta.OperatorName},
+		{"operator version", meta.OperatorVersion},
+		{"git sha", meta.GitSHA},
+		{"cluster name", meta.ClusterName},
+		{"kubernetes version", meta.KubernetesVersion},
+	}
+	for i := 0; i < len(fields); i++ {
+		err = assert.AssertInRange(len(fields[i][1]), 0, maxSessionFieldLength, fields[i][0]+" length")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateSessionLabels(meta.Labels)
+	if err != nil {
+		return err
+	}
+
+	err = validateSessionStatus(meta.Status, true)
+	if err != nil {
+		return err
+	}
+
+	return assert.AssertInRange(len(meta.Redaction), 0, maxRedactionRules, "redaction rules")
+}
+
+// validateSessionLabels checks the count and sizes of session labels.
+// Rule 2: Bounded by maxSessionLabels.
+func validateSessionLabels(labels map[string]string) error {
+	err := assert.AssertInRange(len(labels), 0, maxSessionLabels, "session labels")
+	if err != nil {
+		return err
+	}
+
+	for key, value := range labels {
+		err = assert.AssertInRange(len(key), 1, maxLabelKeyLength, "label key length")
+		if err != nil {
+			return err
+		}
+		err = assert.AssertInRange(len(value), 0, maxLabelValueLength, "label value length")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateSessionStatus accepts the known statuses. allowEmpty admits the
+// status of a session not yet begun.
+func validateSessionStatus(status SessionStatus, allowEmpty bool) error {
+	switch status {
+	case SessionRunning, SessionCompleted, SessionFailed, SessionAborted:
+		return nil
+	case "":
+		if allowEmpty {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid session status: %q", status)
+}
+
+// ValidateEndStatus checks status is one a session can end with.
+func ValidateEndStatus(status SessionStatus) error {
+	err := validateSessionStatus(status, false)
+	if err != nil {
+		return err
+	}
+	return assert.Assert(status != SessionRunning, "end status must not be running")
+}
+
+// mergeSessionMetadata attaches stored metadata to the sessions found in
+// operations and adds sessions that have metadata but no operations yet.
+// The result is ordered by start time, newest first.
+// Rule 2: Bounded by maxQueryResults.
+func mergeSessionMetadata(infos []SessionInfo, metas []Session) []SessionInfo {
+	byID := make(map[string]int, len(infos))
+	for i := 0; i < len(infos); i++ {
+		byID[infos[i].SessionID] = i
+	}
+
+	for i := 0; i < len(metas); i++ {
+		meta := metas[i]
+		idx, ok := byID[meta.ID]
+		if !ok {
+			if len(infos) >= maxQueryResults {
+				continue
+			}
+			info := SessionInfo{SessionID: meta.ID}
+			if !meta.StartTime.IsZero() {
+				info.StartTime = meta.StartTime.Unix()
+			}
+			if !meta.EndTime.IsZero() {
+				info.EndTime = meta.EndTime.Unix()
+			}
+			infos = append(infos, info)
+			idx = len(infos) - 1
+		}
+		infos[idx].Meta = &metas[i]
+		infos[idx].Description = meta.Description
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].StartTime > infos[j].StartTime
+	})
+	return infos
+}
+
+// sessionActors sorts and deduplicates actor IDs, dropping empty ones.
+// Rule 2: Bounded by maxSessionActors.
+func sessionActors(actors []string) []string {
+	seen := make(map[string]bool, len(actors))
+	out := make([]string, 0, len(actors))
+	for i := 0; i < len(actors) && len(out) < maxSessionActors; i++ {
+		actor := actors[i]
+		if len(actor) == 0 || seen[actor] {
+			continue
+		}
+		seen[actor] = true
+		out = append(out, actor)
+	}
+	sort.Strings(out)
+	return out
+}
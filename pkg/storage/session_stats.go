@@ -0,0 +1,401 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+const (
+	maxRedactionRules = 256
+)
+
+// SessionStats holds recorder counters and settings kept alongside a
+// session's operations.
+type SessionStats struct {
+	SessionID         string
+	DroppedOperations int64
+	// FilteredOperations counts operations a recording filter left out.
+	// Analysis of a filtered session sees a partial recording.
+	FilteredOperations int64
+	// Redaction lists the redaction rules applied to recorded payloads.
+	// Payloads of matching resources differ from what the API server held.
+	Redaction []string
+	UpdatedAt time.Time
+}
+
+// AddDroppedOperations adds count to the number of operations the recorder
+// dropped for a session.
+// Rule 5: Multiple assertions for validation.
+func (d *Database) AddDroppedOperations(sessionID string, count int64) error {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(count >= 0, "dropped count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`INSERT INTO sessions (session_id, dropped_operations, updated_ts)
+		VALUES (?, ?, ?)
+		ON CONFLICT(session_id) DO UPDATE SET
+		dropped_operations = dropped_operations + excluded.dropped_operations,
+		updated_ts = excluded.updated_ts`,
+		sessionID, count, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to update session stats: %w", err)
+	}
+
+	return nil
+}
+
+// AddFilteredOperations adds count to the number of operations recording
+// filters left out of a session.
+// Rule 5: Multiple assertions for validation.
+func (d *Database) AddFilteredOperations(sessionID string, count int64) error {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return err
+	}
+
+	err = assert.Assert(count >= 0, "filtered count must be non-negative")
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`INSERT INTO sessions (session_id, filtered_operations, updated_ts)
+		VALUES (?, ?, ?)
+		ON CONFLICT(session_id) DO UPDATE SET
+		filtered_operations = filtered_operations + excluded.filtered_operations,
+		updated_ts = excluded.updated_ts`,
+		sessionID, count, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to update session stats: %w", err)
+	}
+
+	return nil
+}
+
+// SetSessionRedaction records the redaction rules applied to a session's
+// payloads, replacing any stored before.
+// Rule 5: Multiple assertions for validation.
+func (d *Database) SetSessionRedaction(sessionID string, rules []string) error {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(rules), 0, maxRedactionRules, "redaction rules")
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode redaction rules: %w", err)
+	}
+
+	_, err = d.db.Exec(`INSERT INTO sessions (session_id, dropped_operations, updated_ts, redaction)
+		VALUES (?, 0, ?, ?)
+		ON CONFLICT(session_id) DO UPDATE SET
+		redaction = excluded.redaction,
+		updated_ts = excluded.updated_ts`,
+		sessionID, time.Now().Unix(), string(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to store redaction rules: %w", err)
+	}
+
+	return nil
+}
+
+// GetSessionStats returns the recorder counters for a session. A session
+// without stored counters returns zero values.
+func (d *Database) GetSessionStats(sessionID string) (*SessionStats, error) {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &SessionStats{SessionID: sessionID}
+	var updated int64
+	var redaction sql.NullString
+	err = d.db.QueryRow(`SELECT dropped_operations, filtered_operations, updated_ts, redaction
+		FROM sessions WHERE session_id = ?`, sessionID).Scan(
+		&stats.DroppedOperations,
+		&stats.FilteredOperations,
+		&updated,
+		&redaction,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session stats: %w", err)
+	}
+
+	if redaction.Valid && len(redaction.String) > 0 {
+		err = json.Unmarshal([]byte(redaction.String), &stats.Redaction)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode redaction rules: %w", err)
+		}
+	}
+
+	stats.UpdatedAt = time.Unix(updated, 0)
+	return stats, nil
+}
+
+// sessionColumns lists the sessions columns read by scanSession.
+const sessionColumns = `session_id, description, labels, operator_name, operator_version,
+	git_sha, cluster_name, kubernetes_version, recorder_config, status,
+	start_ts, end_ts, dropped_operations, filtered_operations, redaction`
+
+// BeginSession stores session metadata and marks the session running. A
+// session begun again keeps its earliest start time and its counters.
+func (d *Database) BeginSession(meta *Session) error {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return err
+	}
+
+	err = ValidateSession(meta)
+	if err != nil {
+		return fmt.Errorf("invalid session: %w", err)
+	}
+
+	labels, err := encodeSessionLabels(meta.Labels)
+	if err != nil {
+		return err
+	}
+
+	start := meta.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	_, err = d.db.Exec(`INSERT INTO sessions (session_id, description, labels,
+		operator_name, operator_version, git_sha, cluster_name,
+		kubernetes_version, recorder_config, status, start_ts, updated_ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(session_id) DO UPDATE SET
+		description = excluded.description,
+		labels = excluded.labels,
+		operator_name = excluded.operator_name,
+		operator_version = excluded.operator_version,
+		git_sha = excluded.git_sha,
+		cluster_name = excluded.cluster_name,
+		kubernetes_version = excluded.kubernetes_version,
+		recorder_config = excluded.recorder_config,
+		status = excluded.status,
+		start_ts = CASE WHEN start_ts IS NULL OR start_ts > excluded.start_ts
+			THEN excluded.start_ts ELSE start_ts END,
+		end_ts = NULL,
+		updated_ts = excluded.updated_ts`,
+		meta.ID, meta.Description, labels,
+		meta.OperatorName, meta.OperatorVersion, meta.GitSHA, meta.ClusterName,
+		meta.KubernetesVersion, meta.RecorderConfig, string(SessionRunning),
+		start.Unix(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+
+	return nil
+}
+
+// EndSession records the final status and end time of a begun session.
+// Rule 5: Multiple assertions for validation.
+func (d *Database) EndSession(sessionID string, status SessionStatus) error {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return err
+	}
+
+	err = ValidateEndStatus(status)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	result, err := d.db.Exec(`UPDATE sessions SET status = ?, end_ts = ?, updated_ts = ?
+		WHERE session_id = ?`, string(status), now, now, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	return nil
+}
+
+// GetSession returns the stored metadata of a session.
+func (d *Database) GetSession(sessionID string) (*Session, error) {
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session_id")
+	if err != nil {
+		return nil, err
+	}
+
+	row := d.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE session_id = ?`, sessionID)
+	meta, err := scanSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// listSessionMetadata reads stored session metadata, newest first.
+// Rule 2: Bounded by maxQueryResults.
+func (d *Database) listSessionMetadata() ([]Session, error) {
+	rows, err := d.db.Query(`SELECT `+sessionColumns+` FROM sessions
+		ORDER BY updated_ts DESC LIMIT ?`, maxQueryResults)
+	if err != nil {
+		return nil, fmt.Errorf("session metadata query failed: %w", err)
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close rows: %v\n", closeErr)
+		}
+	}()
+
+	metas := make([]Session, 0, 100)
+	for len(metas) < maxQueryResults && rows.Next() {
+		meta, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, *meta)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("session metadata iteration failed: %w", err)
+	}
+
+	return metas, nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSession reads one row selected with sessionColumns.
+func scanSession(row rowScanner) (*Session, error) {
+	var meta Session
+	var description, labels, operatorName, operatorVersion sql.NullString
+	var gitSHA, clusterName, kubernetesVersion, recorderConfig sql.NullString
+	var status, redaction sql.NullString
+	var start, end sql.NullInt64
+
+	err := row.Scan(
+		&meta.ID,
+		&description,
+		&labels,
+		&operatorName,
+		&operatorVersion,
+		&gitSHA,
+		&clusterName,
+		&kubernetesVersion,
+		&recorderConfig,
+		&status,
+		&start,
+		&end,
+		&meta.DroppedOperations,
+		&meta.FilteredOperations,
+		&redaction,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("session scan failed: %w", err)
+	}
+
+	meta.Description = description.String
+	meta.OperatorName = operatorName.String
+	meta.OperatorVersion = operatorVersion.String
+	meta.GitSHA = gitSHA.String
+	meta.ClusterName = clusterName.String
+	meta.KubernetesVersion = kubernetesVersion.String
+	meta.RecorderConfig = recorderConfig.String
+	meta.Status = SessionStatus(status.String)
+	if start.Valid {
+		meta.StartTime = time.Unix(start.Int64, 0)
+	}
+	if end.Valid {
+		meta.EndTime = time.Unix(end.Int64, 0)
+	}
+
+	if len(labels.String) > 0 {
+		err = json.Unmarshal([]byte(labels.String), &meta.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode session labels: %w", err)
+		}
+	}
+	if len(redaction.String) > 0 {
+		err = json.Unmarshal([]byte(redaction.String), &meta.Redaction)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode redaction rules: %w", err)
+		}
+	}
+
+	return &meta, nil
+}
+
+// encodeSessionLabels stores labels as a JSON object, or NULL when empty.
+func encodeSessionLabels(labels map[string]string) (interface{}, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode session labels: %w", err)
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertOperationsBatch(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "batch.db"), testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	batch := make([]*Operation, 0, 3)
+	for i := 1; i <= 3; i++ {
+		batch = append(batch, &Operation{
+			SessionID:      "batch",
+			SequenceNumber: int64(i),
+			Timestamp:      time.Now(),
+			OperationType:  OperationGet,
+			ResourceKind:   "Pod",
+			DurationMs:     1,
+		})
+	}
+	require.NoError(t, db.InsertOperations(batch))
+
+	ops, err := db.QueryOperations("batch")
+	require.NoError(t, err)
+	assert.Len(t, ops, 3)
+
+	invalid := []*Operation{
+		{SessionID: "rollback", SequenceNumber: 1, ResourceKind: "Pod"},
+		{SessionID: "rollback", SequenceNumber: 2, ResourceKind: ""},
+	}
+	require.Error(t, db.InsertOperations(invalid))
+
+	ops, err = db.QueryOperations("rollback")
+	require.NoError(t, err)
+	assert.Empty(t, ops, "a failed batch must not be partially stored")
+
+	require.Error(t, db.InsertOperations(nil))
+}
+
+func TestSessionStatsDroppedOperations(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "stats.db"), testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	stats, err := db.GetSessionStats("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.DroppedOperations)
+
+	require.NoError(t, db.AddDroppedOperations("session-1", 3))
+	require.NoError(t, db.AddDroppedOperations("session-1", 4))
+	require.Error(t, db.AddDroppedOperations("session-1", -1))
+
+	stats, err = db.GetSessionStats("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), stats.DroppedOperations)
+	assert.False(t, stats.UpdatedAt.IsZero())
+}
+
+func TestSessionStatsRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.db")
+
+	legacy, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = legacy.Exec(`CREATE TABLE session_stats (
+		session_id TEXT PRIMARY KEY,
+		dropped_operations INTEGER NOT NULL DEFAULT 0,
+		updated_ts INTEGER NOT NULL
+	)`)
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+
+	legacy, err = sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = legacy.Exec(`INSERT INTO session_stats (session_id, dropped_operations, updated_ts)
+		VALUES ('legacy', 5, 1700000000)`)
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+
+	db, err := NewDatabase(path, testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	stats, err := db.GetSessionStats("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.DroppedOperations, "session_stats rows move to sessions")
+
+	rules := []string{"drop Secret $.data", "hash Widget.example.com $.spec.token"}
+	require.NoError(t, db.AddDroppedOperations("session-1", 2))
+	require.NoError(t, db.SetSessionRedaction("session-1", rules))
+
+	stats, err = db.GetSessionStats("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, rules, stats.Redaction)
+	assert.Equal(t, int64(2), stats.DroppedOperations, "redaction must not reset counters")
+
+	require.NoError(t, db.SetSessionRedaction("session-2", rules[:1]))
+	stats, err = db.GetSessionStats("session-2")
+	require.NoError(t, err)
+	assert.Equal(t, rules[:1], stats.Redaction)
+
+	stats, err = db.GetSessionStats("session-3")
+	require.NoError(t, err)
+	assert.Empty(t, stats.Redaction)
+
+	require.Error(t, db.SetSessionRedaction("", rules))
+}
+
+func TestSessionStatsFilteredOperations(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "filtered.db"), testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	require.NoError(t, db.AddDroppedOperations("session-1", 1))
+	require.NoError(t, db.AddFilteredOperations("session-1", 1000))
+	require.NoError(t, db.AddFilteredOperations("session-1", 5))
+	require.Error(t, db.AddFilteredOperations("session-1", -1))
+
+	stats, err := db.GetSessionStats("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1005), stats.FilteredOperations)
+	assert.Equal(t, int64(1), stats.DroppedOperations)
+}
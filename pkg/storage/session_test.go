@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteSessionLifecycle(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "sessions.db"), testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	_, err = db.GetSession("ops-1")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+	require.ErrorIs(t, db.EndSession("ops-1", SessionCompleted), ErrSessionNotFound)
+
+	require.NoError(t, db.AddDroppedOperations("ops-1", 2))
+	start := time.Unix(1700000000, 0)
+	require.NoError(t, db.BeginSession(&Session{
+		ID:                "ops-1",
+		Description:       "nightly upgrade",
+		Labels:            map[string]string{"env": "staging"},
+		OperatorName:      "widget-operator",
+		OperatorVersion:   "v1.2.0",
+		GitSHA:            "abc123",
+		ClusterName:       "kind",
+		KubernetesVersion: "v1.30.2",
+		RecorderConfig:    `{"actor_id":"ctrl"}`,
+		StartTime:         start,
+	}))
+
+	meta, err := db.GetSession("ops-1")
+	require.NoError(t, err)
+	assert.Equal(t, SessionRunning, meta.Status)
+	assert.Equal(t, "widget-operator", meta.OperatorName)
+	assert.Equal(t, map[string]string{"env": "staging"}, meta.Labels)
+	assert.Equal(t, start.Unix(), meta.StartTime.Unix())
+	assert.True(t, meta.EndTime.IsZero())
+	assert.Equal(t, int64(2), meta.DroppedOperations, "begin must keep counters")
+
+	require.Error(t, db.EndSession("ops-1", SessionRunning))
+	require.Error(t, db.EndSession("ops-1", "paused"))
+	require.NoError(t, db.EndSession("ops-1", SessionFailed))
+
+	meta, err = db.GetSession("ops-1")
+	require.NoError(t, err)
+	assert.Equal(t, SessionFailed, meta.Status)
+	assert.False(t, meta.EndTime.IsZero())
+
+	require.Error(t, db.BeginSession(&Session{}))
+	require.Error(t, db.BeginSession(&Session{ID: "bad", Status: "paused"}))
+	require.Error(t, db.BeginSession(&Session{ID: "bad", Labels: map[string]string{"": "x"}}))
+}
+
+func TestListSessionsIncludesMetadata(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "list.db"), testMaxOps)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+	}()
+
+	now := time.Now()
+	require.NoError(t, db.InsertOperation(&Operation{
+		SessionID:      "recorded",
+		SequenceNumber: 1,
+		Timestamp:      now.Add(-time.Hour),
+		OperationType:  OperationGet,
+		ResourceKind:   "Pod",
+	}))
+	require.NoError(t, db.InsertOperation(&Operation{
+		SessionID:      "bare",
+		SequenceNumber: 1,
+		Timestamp:      now.Add(-2 * time.Hour),
+		OperationType:  OperationGet,
+		ResourceKind:   "Pod",
+	}))
+	require.NoError(t, db.InsertOperation(&Operation{
+		SessionID:      "recorded",
+		SequenceNumber: 2,
+		Timestamp:      now.Add(-time.Hour),
+		OperationType:  OperationUpdate,
+		ResourceKind:   "Pod",
+		ActorID:        "ctrl-b",
+		Error:          "conflict",
+	}))
+	require.NoError(t, db.InsertOperation(&Operation{
+		SessionID:      "recorded",
+		SequenceNumber: 3,
+		Timestamp:      now.Add(-time.Hour),
+		OperationType:  OperationGet,
+		ResourceKind:   "Pod",
+		ActorID:        "ctrl-a",
+	}))
+	require.NoError(t, db.InsertReconcileSpan(&ReconcileSpan{
+		ID:        "span-1",
+		SessionID: "recorded",
+		ActorID:   "ctrl-a",
+		StartTime: now.Add(-time.Hour),
+		Kind:      "Pod",
+	}))
+	require.NoError(t, db.BeginSession(&Session{ID: "recorded", Description: "with ops"}))
+	require.NoError(t, db.BeginSession(&Session{ID: "empty", StartTime: now}))
+
+	sessions, err := db.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+
+	assert.Equal(t, "empty", sessions[0].SessionID, "a begun session is listed before it records")
+	assert.Equal(t, int64(0), sessions[0].OpCount)
+	require.NotNil(t, sessions[0].Meta)
+
+	assert.Equal(t, "recorded", sessions[1].SessionID)
+	assert.Equal(t, int64(3), sessions[1].OpCount)
+	assert.Equal(t, int64(1), sessions[1].ErrorCount)
+	assert.Equal(t, int64(1), sessions[1].SpanCount)
+	assert.Equal(t, []string{"ctrl-a", "ctrl-b"}, sessions[1].Actors)
+	assert.Equal(t, "with ops", sessions[1].Description)
+	require.NotNil(t, sessions[1].Meta)
+	assert.Equal(t, SessionRunning, sessions[1].Meta.Status)
+
+	assert.Equal(t, "bare", sessions[2].SessionID)
+	assert.Nil(t, sessions[2].Meta)
+}
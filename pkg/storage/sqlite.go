@@ -3,122 +3,49 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/slyt3/kubestep/internal/assert"
 )
 
-// SQLiteStore implements OperationStore using SQLite.
-type SQLiteStore struct {
-	db             *sql.DB
-	insertStmt     *sql.Stmt
-	queryStmt      *sql.Stmt
-	sessionStmt    *sql.Stmt
-	insertSpanStmt *sql.Stmt
-	endSpanStmt    *sql.Stmt
-	querySpanStmt  *sql.Stmt
-	maxOperations  int
-}
-
-// NewSQLiteStore creates a new SQLite-based operation store.
+// operationColumns lists the operations columns in the order scanOperations
+// reads them.
+const operationColumns = `id, session_id, sequence_number, timestamp,
+	operation_type, resource_kind, namespace, name,
+	resource_data, error, duration_ms, actor_id, uid, resource_version,
+	generation, verb, api_group, api_version, resource, patch_type,
+	patch_data, field_manager, force, label_selector, field_selector,
+	list_limit, list_continue, list_items, event_type, replica_id, lamport,
+	request_data, prior_data, error_code, error_reason, error_causes,
+	retry_after_seconds, subresource, span_id, event_reason, event_message`
+
+// operationOrder sorts operations by logical clock, then replica, then
+// sequence. It matches OperationLess.
+const operationOrder = `ORDER BY COALESCE(NULLIF(lamport, 0), sequence_number),
+	COALESCE(replica_id, ''), sequence_number`
+
+// SQLiteStore is the SQLite OperationStore. It is the same type as Database
+// and is named for symmetry with MongoStore.
+type SQLiteStore = Database
+
+// NewSQLiteStore opens the SQLite database at cfg.ConnectionURI.
 func NewSQLiteStore(cfg StorageConfig) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite3", cfg.ConnectionURI)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-
-	err = initializeSQLiteSchema(db)
-	if err != nil {
-		closeErr := db.Close()
-		if closeErr != nil {
-			return nil, fmt.Errorf("schema init failed: %w, close failed: %v",
-				err, closeErr)
-		}
-		return nil, err
-	}
-
-	store := &SQLiteStore{
-		db:            db,
-		maxOperations: cfg.MaxOperations,
-	}
-
-	err = store.prepareStatements()
-	if err != nil {
-		closeErr := db.Close()
-		if closeErr != nil {
-			return nil, fmt.Errorf("statement prep failed: %w, close failed: %v",
-				err, closeErr)
-		}
-		return nil, err
-	}
-
-	return store, nil
-}
-
-// InsertOperation inserts a single operation record.
-func (s *SQLiteStore) InsertOperation(op *Operation) error {
-	err := assert.AssertNotNil(op, "operation")
-	if err != nil {
-		return err
-	}
-
-	err = ValidateOperation(op)
-	if err != nil {
-		return fmt.Errorf("invalid operation: %w", err)
-	}
-
-	_, err = s.insertStmt.Exec(
-		op.SessionID,
-		op.SequenceNumber,
-		op.Timestamp.Unix(),
-		string(op.OperationType),
-		op.ResourceKind,
-		op.Namespace,
-		op.Name,
-		op.ResourceData,
-		op.Error,
-		op.DurationMs,
-		op.ActorID,
-		op.UID,
-		op.ResourceVersion,
-		op.Generation,
-		op.Verb,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert operation: %w", err)
-	}
-
-	return nil
-}
-
-// QueryOperations retrieves all operations for a session.
-func (s *SQLiteStore) QueryOperations(sessionID string) ([]Operation, error) {
-	err := assert.AssertStringNotEmpty(sessionID, "session ID")
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := s.queryStmt.Query(sessionID, maxQueryResults)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
-	}
-	defer func() {
-		closeErr := rows.Close()
-		if closeErr != nil {
-			fmt.Printf("Warning: failed to close rows: %v\n", closeErr)
-		}
-	}()
-
-	return s.scanOperations(rows)
+	return NewDatabase(cfg.ConnectionURI, cfg.MaxOperations)
 }
 
 // QueryOperationsByRange retrieves operations within sequence range.
-func (s *SQLiteStore) QueryOperationsByRange(
+func (d *Database) QueryOperationsByRange(
 	sessionID string,
 	start, end int64,
 ) ([]Operation, error) {
-	err := assert.AssertStringNotEmpty(sessionID, "session ID")
+	err := assert.AssertNotNil(d, "database")
+	if err != nil {
+		return nil, err
+	}
+
+	err = assert.AssertStringNotEmpty(sessionID, "session ID")
 	if err != nil {
 		return nil, err
 	}
@@ -128,16 +55,13 @@ func (s *SQLiteStore) QueryOperationsByRange(
 		return nil, err
 	}
 
-	query := `SELECT id, session_id, sequence_number, timestamp, 
-	         operation_type, resource_kind, namespace, name, 
-	         resource_data, error, duration_ms, actor_id, uid,
-	         resource_version, generation, verb
-	         FROM operations 
-	         WHERE session_id = ? 
-	         AND sequence_number BETWEEN ? AND ?
-	         ORDER BY sequence_number LIMIT ?`
+	query := `SELECT ` + operationColumns + `
+		FROM operations
+		WHERE session_id = ?
+		AND sequence_number BETWEEN ? AND ?
+		` + operationOrder + ` LIMIT ?`
 
-	rows, err := s.db.Query(query, sessionID, start, end, maxQueryResults)
+	rows, err := d.db.Query(query, sessionID, start, end, maxQueryResults)
 	if err != nil {
 		return nil, fmt.Errorf("range query failed: %w", err)
 	}
@@ -148,202 +72,24 @@ func (s *SQLiteStore) QueryOperationsByRange(
 		}
 	}()
 
-	return s.scanOperations(rows)
-}
-
-// InsertReconcileSpan inserts a reconcile span record.
-func (s *SQLiteStore) InsertReconcileSpan(span *ReconcileSpan) error {
-	err := assert.AssertNotNil(s, "store")
-	if err != nil {
-		return err
-	}
-
-	err = assert.AssertNotNil(s.insertSpanStmt, "span insert statement")
-	if err != nil {
-		return err
-	}
-
-	err = ValidateReconcileSpan(span)
-	if err != nil {
-		return fmt.Errorf("span validation failed: %w", err)
-	}
-
-	startTs := span.StartTime.Unix()
-	var endTs interface{}
-	if !span.EndTime.IsZero() {
-		endTs = span.EndTime.Unix()
-	}
-
-	var duration interface{}
-	if span.DurationMs > 0 {
-		duration = span.DurationMs
-	}
-
-	_, err = s.insertSpanStmt.Exec(
-		span.ID,
-		span.SessionID,
-		span.ActorID,
-		startTs,
-		endTs,
-		duration,
-		span.Kind,
-		span.Namespace,
-		span.Name,
-		span.TriggerUID,
-		span.TriggerResourceVersion,
-		span.TriggerReason,
-		span.Error,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert reconcile span: %w", err)
-	}
-
-	return nil
+	return scanOperations(rows)
 }
 
-// EndReconcileSpan updates end time and error for a span.
-func (s *SQLiteStore) EndReconcileSpan(
-	spanID string,
-	endTime time.Time,
-	durationMs int64,
-	errMsg string,
-) error {
-	err := assert.AssertNotNil(s, "store")
-	if err != nil {
-		return err
-	}
-
-	err = assert.AssertNotNil(s.endSpanStmt, "span end statement")
-	if err != nil {
-		return err
-	}
-
-	err = assert.AssertStringNotEmpty(spanID, "span id")
-	if err != nil {
-		return err
-	}
-
-	_, err = s.endSpanStmt.Exec(
-		endTime.Unix(),
-		durationMs,
-		errMsg,
-		spanID,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update reconcile span: %w", err)
-	}
-
-	return nil
-}
-
-// QueryReconcileSpans retrieves spans for a session.
-func (s *SQLiteStore) QueryReconcileSpans(sessionID string) ([]ReconcileSpan, error) {
-	err := assert.AssertNotNil(s, "store")
+// ListSessions returns every session with recorded operations or stored
+// metadata, newest first.
+// Rule 2: Bounded by maxQueryResults.
+func (d *Database) ListSessions() ([]SessionInfo, error) {
+	err := assert.AssertNotNil(d, "database")
 	if err != nil {
 		return nil, err
 	}
 
-	err = assert.AssertStringNotEmpty(sessionID, "session ID")
+	err = assert.AssertNotNil(d.sessionStmt, "session statement")
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := s.querySpanStmt.Query(sessionID, maxQueryResults)
-	if err != nil {
-		return nil, fmt.Errorf("span query failed: %w", err)
-	}
-	defer func() {
-		closeErr := rows.Close()
-		if closeErr != nil {
-			fmt.Printf("Warning: failed to close rows: %v\n", closeErr)
-		}
-	}()
-
-	spans := make([]ReconcileSpan, 0, 1000)
-	count := 0
-	maxResults := 10000
-
-	for rows.Next() && count < maxResults {
-		var span ReconcileSpan
-		var startTs int64
-		var endTs sql.NullInt64
-		var duration sql.NullInt64
-		var namespace sql.NullString
-		var name sql.NullString
-		var triggerUID sql.NullString
-		var triggerRV sql.NullString
-		var triggerReason sql.NullString
-		var errMsg sql.NullString
-
-		err = rows.Scan(
-			&span.ID,
-			&span.SessionID,
-			&span.ActorID,
-			&startTs,
-			&endTs,
-			&duration,
-			&span.Kind,
-			&namespace,
-			&name,
-			&triggerUID,
-			&triggerRV,
-			&triggerReason,
-			&errMsg,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("span scan failed: %w", err)
-		}
-
-		span.StartTime = time.Unix(startTs, 0)
-		if endTs.Valid {
-			span.EndTime = time.Unix(endTs.Int64, 0)
-		}
-		if duration.Valid {
-			span.DurationMs = duration.Int64
-		}
-		if namespace.Valid {
-			span.Namespace = namespace.String
-		}
-		if name.Valid {
-			span.Name = name.String
-		}
-		if triggerUID.Valid {
-			span.TriggerUID = triggerUID.String
-		}
-		if triggerRV.Valid {
-			span.TriggerResourceVersion = triggerRV.String
-		}
-		if triggerReason.Valid {
-			span.TriggerReason = triggerReason.String
-		}
-		if errMsg.Valid {
-			span.Error = errMsg.String
-		}
-
-		spans = append(spans, span)
-		count = count + 1
-	}
-
-	err = rows.Err()
-	if err != nil {
-		return nil, fmt.Errorf("span row iteration failed: %w", err)
-	}
-
-	return spans, nil
-}
-
-// ListSessions returns all available sessions.
-func (s *SQLiteStore) ListSessions() ([]SessionInfo, error) {
-	query := `SELECT session_id, 
-	         MIN(timestamp) as start_time,
-	         MAX(timestamp) as end_time,
-	         COUNT(*) as op_count
-	         FROM operations 
-	         GROUP BY session_id 
-	         ORDER BY start_time DESC
-	         LIMIT ?`
-
-	rows, err := s.db.Query(query, maxQueryResults)
+	rows, err := d.sessionStmt.Query(maxQueryResults)
 	if err != nil {
 		return nil, fmt.Errorf("session query failed: %w", err)
 	}
@@ -355,156 +101,130 @@ func (s *SQLiteStore) ListSessions() ([]SessionInfo, error) {
 	}()
 
 	sessions := make([]SessionInfo, 0, 100)
-	for rows.Next() {
+	count := 0
+	for count < maxQueryResults && rows.Next() {
 		var session SessionInfo
+		var actors sql.NullString
 		err = rows.Scan(
 			&session.SessionID,
 			&session.StartTime,
 			&session.EndTime,
 			&session.OpCount,
+			&session.ErrorCount,
+			&actors,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("session scan failed: %w", err)
 		}
-		sessions = append(sessions, session)
-	}
-
-	return sessions, nil
-}
-
-// Close closes the database connection and prepared statements.
-func (s *SQLiteStore) Close() error {
-	if s.insertStmt != nil {
-		err := s.insertStmt.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close insert statement: %w", err)
+		if len(actors.String) > 0 {
+			session.Actors = sessionActors(strings.Split(actors.String, ","))
 		}
+		sessions = append(sessions, session)
+		count = count + 1
 	}
 
-	if s.queryStmt != nil {
-		err := s.queryStmt.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close query statement: %w", err)
-		}
-	}
-
-	if s.sessionStmt != nil {
-		err := s.sessionStmt.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close session statement: %w", err)
-		}
-	}
-
-	if s.insertSpanStmt != nil {
-		err := s.insertSpanStmt.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close span insert statement: %w", err)
-		}
-	}
-
-	if s.endSpanStmt != nil {
-		err := s.endSpanStmt.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close span end statement: %w", err)
-		}
-	}
-
-	if s.querySpanStmt != nil {
-		err := s.querySpanStmt.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close span query statement: %w", err)
-		}
-	}
-
-	if s.db != nil {
-		return s.db.Close()
-	}
-
-	return nil
-}
-
-// prepareStatements creates prepared statements for SQLite operations.
-func (s *SQLiteStore) prepareStatements() error {
-	var err error
-
-	insertSQL := `INSERT INTO operations (
-		session_id, sequence_number, timestamp, operation_type,
-		resource_kind, namespace, name, resource_data, error, duration_ms,
-		actor_id, uid, resource_version, generation, verb
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	s.insertStmt, err = s.db.Prepare(insertSQL)
+	err = rows.Err()
 	if err != nil {
-		return fmt.Errorf("failed to prepare insert statement: %w", err)
+		return nil, fmt.Errorf("session row iteration failed: %w", err)
 	}
 
-	querySQL := `SELECT id, session_id, sequence_number, timestamp,
-	            operation_type, resource_kind, namespace, name,
-	            resource_data, error, duration_ms, actor_id, uid, resource_version,
-	            generation, verb
-	            FROM operations WHERE session_id = ?
-	            ORDER BY sequence_number LIMIT ?`
-
-	s.queryStmt, err = s.db.Prepare(querySQL)
+	spans, err := d.countSessionSpans()
 	if err != nil {
-		return fmt.Errorf("failed to prepare query statement: %w", err)
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].SpanCount = spans[sessions[i].SessionID]
 	}
 
-	spanInsertSQL := `INSERT INTO reconcile_spans (
-		id, session_id, actor_id, start_ts, end_ts, duration_ms,
-		kind, namespace, name, trigger_uid, trigger_resource_version,
-		trigger_reason, error
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	s.insertSpanStmt, err = s.db.Prepare(spanInsertSQL)
+	metas, err := d.listSessionMetadata()
 	if err != nil {
-		return fmt.Errorf("failed to prepare span insert statement: %w", err)
+		return nil, err
 	}
 
-	spanEndSQL := `UPDATE reconcile_spans
-		SET end_ts = ?, duration_ms = ?, error = ?
-		WHERE id = ?`
+	return mergeSessionMetadata(sessions, metas), nil
+}
 
-	s.endSpanStmt, err = s.db.Prepare(spanEndSQL)
+// countSessionSpans returns the number of reconcile spans per session.
+// Rule 2: Bounded by maxQueryResults.
+func (d *Database) countSessionSpans() (map[string]int64, error) {
+	rows, err := d.db.Query(`SELECT session_id, COUNT(*) FROM reconcile_spans
+		GROUP BY session_id LIMIT ?`, maxQueryResults)
 	if err != nil {
-		return fmt.Errorf("failed to prepare span end statement: %w", err)
+		return nil, fmt.Errorf("span count query failed: %w", err)
 	}
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			fmt.Printf("Warning: failed to close rows: %v\n", closeErr)
+		}
+	}()
 
-	spanQuerySQL := `SELECT id, session_id, actor_id, start_ts, end_ts, duration_ms,
-		kind, namespace, name, trigger_uid, trigger_resource_version,
-		trigger_reason, error
-		FROM reconcile_spans WHERE session_id = ?
-		ORDER BY start_ts LIMIT ?`
+	counts := make(map[string]int64, 100)
+	for len(counts) < maxQueryResults && rows.Next() {
+		var sessionID string
+		var count int64
+		err = rows.Scan(&sessionID, &count)
+		if err != nil {
+			return nil, fmt.Errorf("span count scan failed: %w", err)
+		}
+		counts[sessionID] = count
+	}
 
-	s.querySpanStmt, err = s.db.Prepare(spanQuerySQL)
+	err = rows.Err()
 	if err != nil {
-		return fmt.Errorf("failed to prepare span query statement: %w", err)
+		return nil, fmt.Errorf("span count iteration failed: %w", err)
 	}
 
-	return nil
+	return counts, nil
 }
 
-// scanOperations scans database rows into Operation structs.
-func (s *SQLiteStore) scanOperations(rows *sql.Rows) ([]Operation, error) {
+// scanOperations reads operation rows selected with operationColumns.
+// Rule 2: Bounded by maxQueryResults.
+func scanOperations(rows *sql.Rows) ([]Operation, error) {
 	operations := make([]Operation, 0, 1000)
 	count := 0
-	maxResults := 10000
 
-	for rows.Next() && count < maxResults {
+	for count < maxQueryResults && rows.Next() {
 		var op Operation
 		var timestamp int64
+		var opType string
 		var actorID sql.NullString
 		var uid sql.NullString
 		var resourceVersion sql.NullString
 		var generation sql.NullInt64
 		var verb sql.NullString
+		var apiGroup sql.NullString
+		var apiVersion sql.NullString
+		var resource sql.NullString
+		var patchType sql.NullString
+		var patchData sql.NullString
+		var fieldManager sql.NullString
+		var force sql.NullBool
+		var labelSelector sql.NullString
+		var fieldSelector sql.NullString
+		var limit sql.NullInt64
+		var continueToken sql.NullString
+		var listItems sql.NullString
+		var eventType sql.NullString
+		var replicaID sql.NullString
+		var lamport sql.NullInt64
+		var requestData sql.NullString
+		var priorData sql.NullString
+		var errorCode sql.NullInt64
+		var errorReason sql.NullString
+		var errorCauses sql.NullString
+		var retryAfter sql.NullInt64
+		var subresource sql.NullString
+		var spanID sql.NullString
+		var eventReason sql.NullString
+		var eventMessage sql.NullString
 
 		err := rows.Scan(
 			&op.ID,
 			&op.SessionID,
 			&op.SequenceNumber,
 			&timestamp,
-			&op.OperationType,
+			&opType,
 			&op.ResourceKind,
 			&op.Namespace,
 			&op.Name,
@@ -516,12 +236,38 @@ func (s *SQLiteStore) scanOperations(rows *sql.Rows) ([]Operation, error) {
 			&resourceVersion,
 			&generation,
 			&verb,
+			&apiGroup,
+			&apiVersion,
+			&resource,
+			&patchType,
+			&patchData,
+			&fieldManager,
+			&force,
+			&labelSelector,
+			&fieldSelector,
+			&limit,
+			&continueToken,
+			&listItems,
+			&eventType,
+			&replicaID,
+			&lamport,
+			&requestData,
+			&priorData,
+			&errorCode,
+			&errorReason,
+			&errorCauses,
+			&retryAfter,
+			&subresource,
+			&spanID,
+			&eventReason,
+			&eventMessage,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
 
 		op.Timestamp = time.Unix(timestamp, 0)
+		op.OperationType = OperationType(opType)
 		if actorID.Valid {
 			op.ActorID = actorID.String
 		}
@@ -537,22 +283,96 @@ func (s *SQLiteStore) scanOperations(rows *sql.Rows) ([]Operation, error) {
 		if verb.Valid {
 			op.Verb = verb.String
 		}
+		if apiGroup.Valid {
+			op.APIGroup = apiGroup.String
+		}
+		if apiVersion.Valid {
+			op.APIVersion = apiVersion.String
+		}
+		if resource.Valid {
+			op.Resource = resource.String
+		}
+		if patchType.Valid {
+			op.PatchType = patchType.String
+		}
+		if patchData.Valid {
+			op.PatchData = patchData.String
+		}
+		if fieldManager.Valid {
+			op.FieldManager = fieldManager.String
+		}
+		if force.Valid {
+			forced := force.Bool
+			op.Force = &forced
+		}
+		if labelSelector.Valid {
+			op.LabelSelector = labelSelector.String
+		}
+		if fieldSelector.Valid {
+			op.FieldSelector = fieldSelector.String
+		}
+		if limit.Valid {
+			op.Limit = limit.Int64
+		}
+		if continueToken.Valid {
+			op.Continue = continueToken.String
+		}
+		if eventType.Valid {
+			op.EventType = eventType.String
+		}
+		if replicaID.Valid {
+			op.ReplicaID = replicaID.String
+		}
+		if lamport.Valid {
+			op.Lamport = lamport.Int64
+		}
+		if requestData.Valid {
+			op.RequestData = requestData.String
+		}
+		if priorData.Valid {
+			op.PriorData = priorData.String
+		}
+		if errorCode.Valid {
+			op.ErrorCode = int32(errorCode.Int64)
+		}
+		if errorReason.Valid {
+			op.ErrorReason = errorReason.String
+		}
+		if retryAfter.Valid {
+			op.RetryAfterSeconds = int32(retryAfter.Int64)
+		}
+		if subresource.Valid {
+			op.Subresource = subresource.String
+		}
+		if spanID.Valid {
+			op.SpanID = spanID.String
+		}
+		if eventReason.Valid {
+			op.EventReason = eventReason.String
+		}
+		if eventMessage.Valid {
+			op.EventMessage = eventMessage.String
+		}
+		if errorCauses.Valid {
+			op.ErrorCauses, err = decodeErrorCauses(errorCauses.String)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if listItems.Valid {
+			op.ListItems, err = decodeListItems(listItems.String)
+			if err != nil {
+				return nil, err
+			}
+		}
 		operations = append(operations, op)
 		count = count + 1
 	}
 
-	return operations, nil
-}
-
-// initializeSQLiteSchema creates the operations table.
-func initializeSQLiteSchema(db *sql.DB) error {
-	_, err := db.Exec(Schema)
-	if err != nil {
-		return fmt.Errorf("schema creation failed: %w", err)
-	}
-	err = applySQLiteMigrations(db)
+	err := rows.Err()
 	if err != nil {
-		return fmt.Errorf("schema migration failed: %w", err)
+		return nil, fmt.Errorf("row iteration failed: %w", err)
 	}
-	return nil
+
+	return operations, nil
 }
@@ -52,6 +52,151 @@ func TestSQLiteStoreOperationsAndSessions(t *testing.T) {
 	require.Equal(t, sessionID, sessions[0].SessionID)
 }
 
+func TestSQLiteStoreWritePayloads(t *testing.T) {
+	store, err := NewSQLiteStore(StorageConfig{
+		Type:          "sqlite",
+		ConnectionURI: filepath.Join(t.TempDir(), "store.db"),
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	op := &Operation{
+		SessionID:      "session-writes",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  OperationUpdate,
+		ResourceKind:   "ConfigMap",
+		Namespace:      "default",
+		Name:           "demo",
+		RequestData:    `{"data":{"mode":"sent"}}`,
+		PriorData:      `{"data":{"mode":"prior"}}`,
+		Error:          "conflict",
+	}
+	require.NoError(t, store.InsertOperation(op))
+
+	ops, err := store.QueryOperations("session-writes")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, op.RequestData, ops[0].RequestData)
+	require.Equal(t, op.PriorData, ops[0].PriorData)
+	require.Empty(t, ops[0].ResourceData)
+
+	op.SequenceNumber = 2
+	op.RequestData = string(make([]byte, maxDataLength+1))
+	require.Error(t, store.InsertOperation(op))
+}
+
+func TestSQLiteStoreErrorDetails(t *testing.T) {
+	store, err := NewSQLiteStore(StorageConfig{
+		Type:          "sqlite",
+		ConnectionURI: filepath.Join(t.TempDir(), "store.db"),
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	op := &Operation{
+		SessionID:         "session-errors",
+		SequenceNumber:    1,
+		Timestamp:         time.Now(),
+		OperationType:     OperationCreate,
+		ResourceKind:      "ConfigMap",
+		Error:             "ConfigMap is invalid",
+		ErrorCode:         422,
+		ErrorReason:       "Invalid",
+		ErrorCauses:       []ErrorCause{{Type: "FieldValueInvalid", Message: "bad", Field: "data.x"}},
+		RetryAfterSeconds: 2,
+	}
+	require.NoError(t, store.InsertOperation(op))
+
+	ops, err := store.QueryOperations("session-errors")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, op.ErrorCode, ops[0].ErrorCode)
+	require.Equal(t, op.ErrorReason, ops[0].ErrorReason)
+	require.Equal(t, op.ErrorCauses, ops[0].ErrorCauses)
+	require.Equal(t, op.RetryAfterSeconds, ops[0].RetryAfterSeconds)
+
+	op.SequenceNumber = 2
+	op.ErrorCode = 700
+	require.Error(t, store.InsertOperation(op))
+}
+
+func TestSQLiteStoreSubresource(t *testing.T) {
+	store, err := NewSQLiteStore(StorageConfig{
+		Type:          "sqlite",
+		ConnectionURI: filepath.Join(t.TempDir(), "store.db"),
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	op := &Operation{
+		SessionID:      "session-subresource",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  OperationUpdate,
+		ResourceKind:   "Pod",
+		Resource:       "pods/status",
+		Subresource:    "status",
+		SpanID:         "span-1",
+	}
+	require.NoError(t, store.InsertOperation(op))
+
+	ops, err := store.QueryOperations("session-subresource")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, "status", ops[0].Subresource)
+	require.Equal(t, "pods/status", ops[0].Resource)
+	require.Equal(t, "span-1", ops[0].SpanID)
+}
+
+func TestSQLiteStoreKubeEvents(t *testing.T) {
+	store, err := NewSQLiteStore(StorageConfig{
+		Type:          "sqlite",
+		ConnectionURI: filepath.Join(t.TempDir(), "store.db"),
+		MaxOperations: 1000,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	op := &Operation{
+		SessionID:      "session-events",
+		SequenceNumber: 1,
+		Timestamp:      time.Now(),
+		OperationType:  OperationEvent,
+		ResourceKind:   "Deployment",
+		EventType:      EventTypeWarning,
+		EventReason:    "FailedCreate",
+		EventMessage:   "quota exceeded",
+	}
+	require.NoError(t, store.InsertOperation(op))
+
+	ops, err := store.QueryOperations("session-events")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, EventTypeWarning, ops[0].EventType)
+	require.Equal(t, "FailedCreate", ops[0].EventReason)
+	require.Equal(t, "quota exceeded", ops[0].EventMessage)
+
+	op.SequenceNumber = 2
+	op.EventType = WatchEventAdded
+	require.Error(t, store.InsertOperation(op), "events are Normal or Warning")
+
+	op.OperationType = OperationWatch
+	op.EventType = EventTypeNormal
+	require.Error(t, store.InsertOperation(op), "watch records carry watch event types")
+}
+
 func TestSQLiteStoreSpans(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "spans.db")
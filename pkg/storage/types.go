@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -21,6 +22,21 @@ const (
 	maxDataLength          = 1048576 // 1MB max per operation
 	maxErrorLength         = 10000
 	maxTriggerReasonLength = 512
+	maxAPIGroupLength      = 253
+	maxAPIVersionLength    = 63
+	maxResourceLength      = 100
+	maxPatchTypeLength     = 64
+	maxFieldManagerLength  = 128
+	maxSelectorLength      = 4096
+	maxContinueLength      = 4096
+	maxListItems           = 10000
+	maxEventTypeLength     = 20
+	maxEventReasonLength   = 128
+	maxEventMessageLength  = 4096
+	maxReplicaIDLength     = 253
+	maxErrorReasonLength   = 100
+	maxErrorCauses         = 100
+	maxHTTPStatusCode      = 599
 )
 
 // OperationType defines the type of Kubernetes operation.
@@ -34,6 +50,31 @@ const (
 	OperationPatch  OperationType = "PATCH"
 	OperationDelete OperationType = "DELETE"
 	OperationWatch  OperationType = "WATCH"
+
+	// OperationCacheGet and OperationCacheList are reads served from an
+	// informer cache rather than the API server.
+	OperationCacheGet  OperationType = "CACHE_GET"
+	OperationCacheList OperationType = "CACHE_LIST"
+
+	// OperationEvent is a Kubernetes Event the recorded process emitted.
+	// The Kind, Namespace, Name, UID and ResourceVersion are those of the
+	// involved object.
+	OperationEvent OperationType = "EVENT"
+)
+
+// Watch event types stored on OperationWatch records.
+const (
+	WatchEventAdded    = "ADDED"
+	WatchEventModified = "MODIFIED"
+	WatchEventDeleted  = "DELETED"
+	WatchEventBookmark = "BOOKMARK"
+	WatchEventError    = "ERROR"
+)
+
+// Kubernetes Event types stored on OperationEvent records.
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
 )
 
 // Operation represents a recorded Kubernetes API operation.
@@ -55,6 +96,67 @@ type Operation struct {
 	ResourceVersion string
 	Generation      int64
 	Verb            string
+	APIGroup        string
+	APIVersion      string
+	Resource        string
+	// Subresource is the subresource a call addressed, such as status,
+	// scale, eviction or binding. Resource holds the qualified
+	// resource/subresource form.
+	Subresource string
+	// SpanID is the reconcile span that issued the call, when the caller's
+	// context carried one.
+	SpanID       string
+	PatchType    string
+	PatchData    string
+	FieldManager string
+	// Force is the server-side apply force option, nil when the request
+	// did not set it.
+	Force         *bool
+	LabelSelector string
+	FieldSelector string
+	Limit         int64
+	Continue      string
+	ListItems     []ListItem
+	// EventType is the watch event type of an OperationWatch record, or
+	// Normal or Warning on an OperationEvent record.
+	EventType string
+	// ReplicaID names the recorder process when several replicas write one
+	// session. SequenceNumber is contiguous per replica; Lamport orders
+	// operations across replicas.
+	ReplicaID string
+	Lamport   int64
+	// RequestData is the object the caller sent on a create or update;
+	// ResourceData holds what the server returned.
+	RequestData string
+	// PriorData is the last state of the object the recorder saw before a
+	// write, when it had one.
+	PriorData string
+	// ErrorCode, ErrorReason, ErrorCauses and RetryAfterSeconds come from
+	// the metav1.Status of a failed API call. Error keeps the message.
+	ErrorCode         int32
+	ErrorReason       string
+	ErrorCauses       []ErrorCause
+	RetryAfterSeconds int32
+	// EventReason and EventMessage are the reason and message of an
+	// OperationEvent record.
+	EventReason  string
+	EventMessage string
+}
+
+// ErrorCause is one cause listed in the details of an API error, such as a
+// field that failed validation.
+type ErrorCause struct {
+	Type    string `json:"type,omitempty" bson:"type,omitempty"`
+	Message string `json:"message,omitempty" bson:"message,omitempty"`
+	Field   string `json:"field,omitempty" bson:"field,omitempty"`
+}
+
+// ListItem identifies one object version returned by a LIST call.
+type ListItem struct {
+	UID             string `json:"uid,omitempty" bson:"uid,omitempty"`
+	ResourceVersion string `json:"rv,omitempty" bson:"rv,omitempty"`
+	Namespace       string `json:"ns,omitempty" bson:"ns,omitempty"`
+	Name            string `json:"name,omitempty" bson:"name,omitempty"`
 }
 
 // Database handles SQLite storage for recorded operations.
@@ -89,6 +191,31 @@ CREATE TABLE IF NOT EXISTS operations (
     resource_version TEXT,
     generation INTEGER,
     verb TEXT,
+    api_group TEXT,
+    api_version TEXT,
+    resource TEXT,
+    patch_type TEXT,
+    patch_data TEXT,
+    field_manager TEXT,
+    force INTEGER,
+    label_selector TEXT,
+    field_selector TEXT,
+    list_limit INTEGER,
+    list_continue TEXT,
+    list_items TEXT,
+    event_type TEXT,
+    replica_id TEXT,
+    lamport INTEGER,
+    request_data TEXT,
+    prior_data TEXT,
+    error_code INTEGER,
+    error_reason TEXT,
+    error_causes TEXT,
+    retry_after_seconds INTEGER,
+    subresource TEXT,
+    span_id TEXT,
+    event_reason TEXT,
+    event_message TEXT,
     CHECK(length(operation_type) <= 20),
     CHECK(length(resource_kind) <= 100),
     CHECK(length(namespace) <= 253),
@@ -97,7 +224,27 @@ CREATE TABLE IF NOT EXISTS operations (
     CHECK(length(uid) <= 128),
     CHECK(length(resource_version) <= 128),
     CHECK(length(verb) <= 20),
+    CHECK(length(api_group) <= 253),
+    CHECK(length(api_version) <= 63),
+    CHECK(length(resource) <= 100),
+    CHECK(length(patch_type) <= 64),
+    CHECK(length(patch_data) <= 1048576),
+    CHECK(length(field_manager) <= 128),
+    CHECK(length(label_selector) <= 4096),
+    CHECK(length(field_selector) <= 4096),
+    CHECK(length(list_continue) <= 4096),
+    CHECK(length(list_items) <= 1048576),
+    CHECK(length(event_type) <= 20),
+    CHECK(length(replica_id) <= 253),
     CHECK(length(resource_data) <= 1048576),
+    CHECK(length(request_data) <= 1048576),
+    CHECK(length(prior_data) <= 1048576),
+    CHECK(length(error_reason) <= 100),
+    CHECK(length(error_causes) <= 1048576),
+    CHECK(length(subresource) <= 100),
+    CHECK(length(span_id) <= 128),
+    CHECK(length(event_reason) <= 128),
+    CHECK(length(event_message) <= 4096),
     CHECK(length(error) <= 10000)
 );
 
@@ -139,6 +286,33 @@ ON reconcile_spans(session_id, start_ts);
 
 CREATE INDEX IF NOT EXISTS idx_reconcile_trigger
 ON reconcile_spans(trigger_uid, trigger_resource_version);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id TEXT PRIMARY KEY,
+    description TEXT,
+    labels TEXT,
+    operator_name TEXT,
+    operator_version TEXT,
+    git_sha TEXT,
+    cluster_name TEXT,
+    kubernetes_version TEXT,
+    recorder_config TEXT,
+    status TEXT,
+    start_ts INTEGER,
+    end_ts INTEGER,
+    dropped_operations INTEGER NOT NULL DEFAULT 0,
+    filtered_operations INTEGER NOT NULL DEFAULT 0,
+    redaction TEXT,
+    updated_ts INTEGER NOT NULL,
+    CHECK(length(session_id) <= 256),
+    CHECK(length(description) <= 1024),
+    CHECK(length(recorder_config) <= 65536),
+    CHECK(dropped_operations >= 0),
+    CHECK(filtered_operations >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_start
+ON sessions(start_ts);
 `
 
 // ValidateOperation checks operation data meets constraints.
@@ -192,6 +366,20 @@ func ValidateOperation(op *Operation) error {
 		}
 	}
 
+	if len(op.RequestData) > maxDataLength {
+		err = assert.Assert(false, "request_data exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.PriorData) > maxDataLength {
+		err = assert.Assert(false, "prior_data exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(op.Error) > maxErrorLength {
 		err = assert.Assert(false, "error exceeds max length")
 		if err != nil {
@@ -227,6 +415,121 @@ func ValidateOperation(op *Operation) error {
 		}
 	}
 
+	if len(op.APIGroup) > maxAPIGroupLength {
+		err = assert.Assert(false, "api_group exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.APIVersion) > maxAPIVersionLength {
+		err = assert.Assert(false, "api_version exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.Resource) > maxResourceLength {
+		err = assert.Assert(false, "resource exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.Subresource) > maxResourceLength {
+		err = assert.Assert(false, "subresource exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.SpanID) > maxSpanIDLength {
+		err = assert.Assert(false, "span id exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.PatchType) > maxPatchTypeLength {
+		err = assert.Assert(false, "patch_type exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.PatchData) > maxDataLength {
+		err = assert.Assert(false, "patch_data exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.FieldManager) > maxFieldManagerLength {
+		err = assert.Assert(false, "field_manager exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.LabelSelector) > maxSelectorLength {
+		err = assert.Assert(false, "label_selector exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.FieldSelector) > maxSelectorLength {
+		err = assert.Assert(false, "field_selector exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.Continue) > maxContinueLength {
+		err = assert.Assert(false, "list_continue exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.Limit < 0 {
+		err = assert.Assert(false, "list_limit must be non-negative")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.ListItems) > maxListItems {
+		err = assert.Assert(false, "list_items exceeds max count")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateEventFields(op)
+	if err != nil {
+		return err
+	}
+
+	if len(op.ReplicaID) > maxReplicaIDLength {
+		err = assert.Assert(false, "replica_id exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateErrorDetails(op)
+	if err != nil {
+		return err
+	}
+
+	if op.Lamport < 0 {
+		err = assert.Assert(false, "lamport must be non-negative")
+		if err != nil {
+			return err
+		}
+	}
+
 	if op.Generation < 0 {
 		err = assert.Assert(false, "generation must be non-negative")
 		if err != nil {
@@ -236,3 +539,144 @@ func ValidateOperation(op *Operation) error {
 
 	return nil
 }
+
+// validateEventFields checks the event type against the operation type and
+// bounds the Kubernetes Event reason and message.
+// Rule 5: Multiple assertions for validation.
+func validateEventFields(op *Operation) error {
+	if op.OperationType == OperationEvent {
+		err := assert.Assert(op.EventType == EventTypeNormal || op.EventType == EventTypeWarning,
+			"event_type must be Normal or Warning on an event")
+		if err != nil {
+			return err
+		}
+	} else if len(op.EventType) > 0 && !isWatchEventType(op.EventType) {
+		err := assert.Assert(false, "event_type is not a known watch event")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.EventReason) > maxEventReasonLength {
+		err := assert.Assert(false, "event_reason exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(op.EventMessage) > maxEventMessageLength {
+		err := assert.Assert(false, "event_message exceeds max length")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isWatchEventType reports whether eventType is a known watch event type.
+func isWatchEventType(eventType string) bool {
+	if len(eventType) > maxEventTypeLength {
+		return false
+	}
+	switch eventType {
+	case WatchEventAdded, WatchEventModified, WatchEventDeleted,
+		WatchEventBookmark, WatchEventError:
+		return true
+	}
+	return false
+}
+
+// validateErrorDetails checks the structured API error fields.
+// Rule 5: Multiple assertions for validation.
+func validateErrorDetails(op *Operation) error {
+	err := assert.AssertInRange(int(op.ErrorCode), 0, maxHTTPStatusCode, "error_code")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(op.ErrorReason), 0, maxErrorReasonLength, "error_reason length")
+	if err != nil {
+		return err
+	}
+
+	err = assert.AssertInRange(len(op.ErrorCauses), 0, maxErrorCauses, "error_causes count")
+	if err != nil {
+		return err
+	}
+
+	return assert.Assert(op.RetryAfterSeconds >= 0, "retry_after_seconds must be non-negative")
+}
+
+// encodeListItems serializes list items for the list_items column.
+// An empty list is stored as an empty string.
+func encodeListItems(items []ListItem) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+
+	err := assert.AssertInRange(len(items), 1, maxListItems, "list item count")
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode list items: %w", err)
+	}
+
+	if len(data) > maxDataLength {
+		return "", fmt.Errorf("list items exceed max length: %d", len(data))
+	}
+
+	return string(data), nil
+}
+
+// decodeListItems parses the list_items column.
+func decodeListItems(data string) ([]ListItem, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	items := make([]ListItem, 0, 16)
+	err := json.Unmarshal([]byte(data), &items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode list items: %w", err)
+	}
+
+	return items, nil
+}
+
+// encodeErrorCauses serializes error causes for the error_causes column.
+// No causes are stored as an empty string.
+func encodeErrorCauses(causes []ErrorCause) (string, error) {
+	if len(causes) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(causes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode error causes: %w", err)
+	}
+
+	if len(data) > maxDataLength {
+		return "", fmt.Errorf("error causes exceed max length: %d", len(data))
+	}
+
+	return string(data), nil
+}
+
+// decodeErrorCauses parses the error_causes column.
+func decodeErrorCauses(data string) ([]ErrorCause, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	causes := make([]ErrorCause, 0, 4)
+	err := json.Unmarshal([]byte(data), &causes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode error causes: %w", err)
+	}
+
+	return causes, nil
+}
@@ -115,6 +115,31 @@ func verifyOperationsSchema(db *sql.DB, result *VerifyResult, strict bool) error
 		"resource_version",
 		"generation",
 		"verb",
+		"api_group",
+		"api_version",
+		"resource",
+		"patch_type",
+		"patch_data",
+		"field_manager",
+		"force",
+		"label_selector",
+		"field_selector",
+		"list_limit",
+		"list_continue",
+		"list_items",
+		"event_type",
+		"replica_id",
+		"lamport",
+		"request_data",
+		"prior_data",
+		"error_code",
+		"error_reason",
+		"error_causes",
+		"retry_after_seconds",
+		"subresource",
+		"span_id",
+		"event_reason",
+		"event_message",
 	}
 
 	for i := 0; i < len(required); i++ {
@@ -180,16 +205,29 @@ func verifySpansSchema(db *sql.DB, result *VerifyResult) error {
 }
 
 func verifyOperationsData(db *sql.DB, result *VerifyResult) error {
+	columns, err := loadSQLiteColumns(db, "operations")
+	if err != nil {
+		return err
+	}
+
+	// Tables written before replicas were recorded hold a single replica.
+	replica := "''"
+	sameReplica := "1 = 1"
+	if columns["replica_id"] {
+		replica = "COALESCE(replica_id, '')"
+		sameReplica = "COALESCE(o1.replica_id, '') = COALESCE(o2.replica_id, '')"
+	}
+
 	var dupSession string
 	var dupSeq int64
 	var dupCount int64
 
-	dupRow := db.QueryRow(`SELECT session_id, sequence_number, COUNT(*)
+	dupRow := db.QueryRow(fmt.Sprintf(`SELECT session_id, sequence_number, COUNT(*)
 		FROM operations
-		GROUP BY session_id, sequence_number
+		GROUP BY session_id, %s, sequence_number
 		HAVING COUNT(*) > 1
-		LIMIT 1`)
-	err := dupRow.Scan(&dupSession, &dupSeq, &dupCount)
+		LIMIT 1`, replica))
+	err = dupRow.Scan(&dupSession, &dupSeq, &dupCount)
 	if err == nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("duplicate sequence: session=%s seq=%d count=%d", dupSession, dupSeq, dupCount))
 	} else if err != sql.ErrNoRows {
@@ -205,8 +243,11 @@ func verifyOperationsData(db *sql.DB, result *VerifyResult) error {
 		result.Errors = append(result.Errors, "operations with negative duration_ms")
 	}
 
-	rows, err := db.Query(`SELECT session_id, MIN(sequence_number), MAX(sequence_number), COUNT(*)
-		FROM operations GROUP BY session_id LIMIT 1000`)
+	// Sequence numbers are contiguous per replica; the Lamport clock orders
+	// replicas against each other and is expected to skip values.
+	rows, err := db.Query(fmt.Sprintf(`SELECT session_id, %s,
+		MIN(sequence_number), MAX(sequence_number), COUNT(*)
+		FROM operations GROUP BY session_id, %s LIMIT 1000`, replica, replica))
 	if err != nil {
 		return fmt.Errorf("failed to scan sequence gaps: %w", err)
 	}
@@ -216,16 +257,21 @@ func verifyOperationsData(db *sql.DB, result *VerifyResult) error {
 
 	for rows.Next() {
 		var sessionID string
+		var replicaID string
 		var minSeq int64
 		var maxSeq int64
 		var count int64
-		err = rows.Scan(&sessionID, &minSeq, &maxSeq, &count)
+		err = rows.Scan(&sessionID, &replicaID, &minSeq, &maxSeq, &count)
 		if err != nil {
 			return fmt.Errorf("failed to read sequence stats: %w", err)
 		}
 		expected := maxSeq - minSeq + 1
 		if expected != count {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("sequence gaps: session=%s expected=%d actual=%d", sessionID, expected, count))
+			session := sessionID
+			if len(replicaID) > 0 {
+				session = fmt.Sprintf("%s replica=%s", sessionID, replicaID)
+			}
+			result.Warnings = append(result.Warnings, fmt.Sprintf("sequence gaps: session=%s expected=%d actual=%d", session, expected, count))
 		}
 	}
 	if err = rows.Err(); err != nil {
@@ -233,13 +279,14 @@ func verifyOperationsData(db *sql.DB, result *VerifyResult) error {
 	}
 
 	var tsSession string
-	tsRow := db.QueryRow(`SELECT o1.session_id
+	tsRow := db.QueryRow(fmt.Sprintf(`SELECT o1.session_id
 		FROM operations o1
 		JOIN operations o2
 		  ON o1.session_id = o2.session_id
+		 AND %s
 		 AND o1.sequence_number + 1 = o2.sequence_number
 		WHERE o2.timestamp < o1.timestamp
-		LIMIT 1`)
+		LIMIT 1`, sameReplica))
 	err = tsRow.Scan(&tsSession)
 	if err == nil {
 		result.Warnings = append(result.Warnings, fmt.Sprintf("non-monotonic timestamps detected in session=%s", tsSession))
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/slyt3/kubestep/internal/assert"
+)
+
+// replicaSequences collects the sequence numbers one replica recorded.
+type replicaSequences struct {
+	minSeq     int64
+	maxSeq     int64
+	count      int64
+	timestamps map[int64]int64
+}
+
+// VerifyStore checks data consistency through the OperationStore interface,
+// for backends without SQL access. It runs the data checks of VerifySQLite;
+// schema checks are SQLite-specific.
+// Rule 2: Bounded by maxQueryResults sessions.
+func VerifyStore(store OperationStore) (*VerifyResult, error) {
+	err := assert.AssertNotNil(store, "store")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{
+		Errors:   make([]string, 0, 8),
+		Warnings: make([]string, 0, 8),
+	}
+
+	sessions, err := store.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	maxSessions := len(sessions)
+	if maxSessions > maxQueryResults {
+		maxSessions = maxQueryResults
+	}
+
+	for i := 0; i < maxSessions; i++ {
+		sessionID := sessions[i].SessionID
+		ops, err := store.QueryOperations(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		verifySessionOperations(sessionID, ops, result)
+
+		spans, err := store.QueryReconcileSpans(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		verifySessionSpans(spans, result)
+
+		result.Stats.Sessions = result.Stats.Sessions + 1
+		result.Stats.Operations = result.Stats.Operations + int64(len(ops))
+		result.Stats.Spans = result.Stats.Spans + int64(len(spans))
+	}
+
+	return result, nil
+}
+
+// verifySessionOperations reports duplicate sequences, sequence gaps and
+// timestamps running backwards, per replica.
+func verifySessionOperations(sessionID string, ops []Operation, result *VerifyResult) {
+	replicas := make(map[string]*replicaSequences, 4)
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		seqs, ok := replicas[op.ReplicaID]
+		if !ok {
+			seqs = &replicaSequences{
+				minSeq:     op.SequenceNumber,
+				maxSeq:     op.SequenceNumber,
+				timestamps: make(map[int64]int64, len(ops)),
+			}
+			replicas[op.ReplicaID] = seqs
+		}
+
+		if _, dup := seqs.timestamps[op.SequenceNumber]; dup {
+			result.Errors = append(result.Errors, fmt.Sprintf("duplicate sequence: session=%s seq=%d", sessionID, op.SequenceNumber))
+			continue
+		}
+
+		seqs.timestamps[op.SequenceNumber] = op.Timestamp.Unix()
+		seqs.count = seqs.count + 1
+		if op.SequenceNumber < seqs.minSeq {
+			seqs.minSeq = op.SequenceNumber
+		}
+		if op.SequenceNumber > seqs.maxSeq {
+			seqs.maxSeq = op.SequenceNumber
+		}
+	}
+
+	nonMonotonic := false
+	for replicaID, seqs := range replicas {
+		expected := seqs.maxSeq - seqs.minSeq + 1
+		if expected != seqs.count {
+			session := sessionID
+			if len(replicaID) > 0 {
+				session = fmt.Sprintf("%s replica=%s", sessionID, replicaID)
+			}
+			result.Warnings = append(result.Warnings, fmt.Sprintf("sequence gaps: session=%s expected=%d actual=%d", session, expected, seqs.count))
+		}
+
+		for seq, ts := range seqs.timestamps {
+			next, ok := seqs.timestamps[seq+1]
+			if ok && next < ts {
+				nonMonotonic = true
+				break
+			}
+		}
+	}
+
+	if nonMonotonic {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("non-monotonic timestamps detected in session=%s", sessionID))
+	}
+}
+
+// verifySessionSpans applies the span checks of verifySpanData.
+func verifySessionSpans(spans []ReconcileSpan, result *VerifyResult) {
+	var openCount int64
+	var negativeCount int64
+	var invalidEndCount int64
+	for i := 0; i < len(spans); i++ {
+		span := spans[i]
+		if span.EndTime.IsZero() {
+			openCount = openCount + 1
+		}
+		if span.DurationMs < 0 {
+			negativeCount = negativeCount + 1
+		}
+		if !span.EndTime.IsZero() && span.EndTime.Before(span.StartTime) {
+			invalidEndCount = invalidEndCount + 1
+		}
+	}
+
+	if openCount > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("open spans: %d", openCount))
+	}
+	if negativeCount > 0 {
+		result.Errors = append(result.Errors, "reconcile spans with negative duration_ms")
+	}
+	if invalidEndCount > 0 {
+		result.Errors = append(result.Errors, "reconcile spans with end_ts before start_ts")
+	}
+}
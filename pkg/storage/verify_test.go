@@ -127,3 +127,35 @@ func TestVerifySQLiteMissingOperationsTable(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, result.Errors)
 }
+
+func TestVerifyStoreMatchesSQLiteChecks(t *testing.T) {
+	store, err := NewOperationStore(StorageConfig{
+		Type:          StorageSQLite,
+		ConnectionURI: filepath.Join(t.TempDir(), "store.db"),
+		MaxOperations: testMaxOps,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	for _, seq := range []int64{1, 2, 4} {
+		require.NoError(t, store.InsertOperation(replicaOperation("", seq, 0)))
+	}
+	for _, seq := range []int64{1, 2} {
+		require.NoError(t, store.InsertOperation(replicaOperation("b", seq, seq+4)))
+	}
+
+	result, err := VerifyStore(store)
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.Warnings, 1)
+	require.Contains(t, result.Warnings[0], "sequence gaps: session=replica-session expected=4 actual=3")
+	require.Equal(t, int64(1), result.Stats.Sessions)
+	require.Equal(t, int64(5), result.Stats.Operations)
+
+	require.NoError(t, store.InsertOperation(replicaOperation("b", 2, 7)))
+	result, err = VerifyStore(store)
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Errors)
+}